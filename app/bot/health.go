@@ -0,0 +1,63 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+	"github.com/kranikitao/fxhash-telegram-bot/src/artcollector"
+	"github.com/kranikitao/fxhash-telegram-bot/src/config"
+	"github.com/kranikitao/fxhash-telegram-bot/src/health"
+	"github.com/kranikitao/fxhash-telegram-bot/src/leader"
+	"github.com/kranikitao/fxhash-telegram-bot/src/messagesender"
+)
+
+func newHealth(
+	config *config.Config,
+	db *sql.DB,
+	bot *tgbotapi.BotAPI,
+	elector *leader.Elector,
+	collector *artcollector.ArtCollector,
+	sender *messagesender.Sender,
+) *health.Health {
+	h := health.New()
+
+	collectorStaleness := health.Staleness(collector.LastPoll, config.Health.CollectorStaleness)
+	h.AddLiveness("collector", func(ctx context.Context) (string, error) {
+		if !elector.IsLeader() {
+			return "not the leader", nil
+		}
+		return collectorStaleness(ctx)
+	})
+	h.AddLiveness("sender", health.Staleness(sender.LastBatch, config.Health.SenderStaleness))
+
+	h.AddReadiness("database", func(ctx context.Context) (string, error) {
+		if err := db.PingContext(ctx); err != nil {
+			return "", err
+		}
+		return "ok", nil
+	})
+	h.AddReadiness("telegram", health.Cached(func(ctx context.Context) (string, error) {
+		// GetMe takes no context, the probe stops waiting when ctx is done
+		type result struct {
+			user tgbotapi.User
+			err  error
+		}
+		done := make(chan result, 1)
+		go func() {
+			user, err := bot.GetMe()
+			done <- result{user, err}
+		}()
+		select {
+		case <-ctx.Done():
+			return "", ctx.Err()
+		case r := <-done:
+			if r.err != nil {
+				return "", r.err
+			}
+			return "@" + r.user.UserName, nil
+		}
+	}, config.Health.TelegramTTL))
+
+	return h
+}
@@ -1,42 +1,67 @@
 package main
 
 import (
+	"context"
 	"database/sql"
 	"fmt"
 	"log"
+	"net/http"
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+	// timezones of subscribers must resolve in images without tzdata
+	_ "time/tzdata"
 
-	migrate "github.com/golang-migrate/migrate/v4"
-	pgmigrate "github.com/golang-migrate/migrate/v4/database/postgres"
-	_ "github.com/golang-migrate/migrate/v4/source/file" // export migrations from files
 	"moul.io/zapgorm2"
 
 	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
-	"github.com/kelseyhightower/envconfig"
+	"github.com/kranikitao/fxhash-telegram-bot/src/adminapi"
 	"github.com/kranikitao/fxhash-telegram-bot/src/artcollector"
 	"github.com/kranikitao/fxhash-telegram-bot/src/chat"
+	"github.com/kranikitao/fxhash-telegram-bot/src/config"
 	"github.com/kranikitao/fxhash-telegram-bot/src/fxhash"
+	"github.com/kranikitao/fxhash-telegram-bot/src/i18n"
+	"github.com/kranikitao/fxhash-telegram-bot/src/leader"
 	"github.com/kranikitao/fxhash-telegram-bot/src/messagesender"
+	"github.com/kranikitao/fxhash-telegram-bot/src/metrics"
+	"github.com/kranikitao/fxhash-telegram-bot/src/orm"
+	"github.com/kranikitao/fxhash-telegram-bot/src/supervisor"
+	"github.com/kranikitao/fxhash-telegram-bot/src/templates"
 	_ "github.com/lib/pq"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
 	"go.uber.org/zap"
 	"gorm.io/driver/postgres"
 	"gorm.io/gorm"
 )
 
-type Config struct {
-	TGToken    string `envconfig:"TG_TOKEN"`
-	DBName     string `envconfig:"DB_NAME"`
-	DBHost     string `envconfig:"DB_HOST"`
-	DBPassword string `envconfig:"DB_PASSWORD"`
-	DBUser     string `envconfig:"DB_USER"`
-	DBPort     uint   `envconfig:"DB_PORT"`
-}
-
 func main() {
-	config := loadConfigurationFromEnvironments("FXBOT")
+	// migrations only need the database, the rest may not be configured yet
+	load := config.Load
+	if len(os.Args) > 1 && os.Args[1] == "migrate" {
+		load = config.LoadDatabase
+	}
+	config, configErr := load()
+	if configErr != nil {
+		log.Fatal(configErr.Error())
+	}
+	if err := logLevel.UnmarshalText([]byte(config.LogLevel)); err != nil {
+		log.Fatal(err.Error())
+	}
 	connectionLogger := newLogger("conncection")
-	dbConnection := connectToDatabase(config, connectionLogger)
+	dbConnection := connectToDatabase(config)
 	defer dbConnection.Close()
 
+	if len(os.Args) > 1 {
+		if os.Args[1] != "migrate" {
+			log.Fatalf("unknown command %q, usage: botrunner [migrate up|down [N]|version|force V]", os.Args[1])
+		}
+		runMigrateCommand(dbConnection, connectionLogger, os.Args[2:])
+		return
+	}
+	migrateIt(dbConnection, connectionLogger)
+
 	gormLogger := zapgorm2.New(connectionLogger)
 	gormDB, err := gorm.Open(postgres.New(postgres.Config{
 		Conn: dbConnection,
@@ -47,67 +72,161 @@ func main() {
 
 	botLogger := newLogger("bot")
 
-	bot, err := tgbotapi.NewBotAPI(config.TGToken)
+	bot, err := tgbotapi.NewBotAPI(config.TG.Token)
 	if err != nil {
 		botLogger.Panic("can't connect to bot api", zap.Error(err))
 	}
 
-	setCommandsRequest := tgbotapi.NewSetMyCommandsWithScope(
-		tgbotapi.NewBotCommandScopeDefault(),
-		tgbotapi.BotCommand{Command: chat.CommandSubscribeArtist, Description: "Subscribe to artist"},
-		tgbotapi.BotCommand{Command: chat.CommandSubscribeFree, Description: "Subscribe to zero cost generatives"},
-		tgbotapi.BotCommand{Command: chat.CommandUnsubscribe, Description: "Unsubscribe"},
-		tgbotapi.BotCommand{Command: chat.CommandCancel, Description: "Cancel operation"},
-	)
+	userCommands := func(language string) []tgbotapi.BotCommand {
+		return []tgbotapi.BotCommand{
+			{Command: chat.CommandSubscribeArtist, Description: i18n.T(language, "command.subscribeartist")},
+			{Command: chat.CommandSubscribeFree, Description: i18n.T(language, "command.subscribefree")},
+			{Command: chat.CommandFollowCollector, Description: i18n.T(language, "command.followcollector")},
+			{Command: chat.CommandArtist, Description: i18n.T(language, "command.artist")},
+			{Command: chat.CommandLinkWallet, Description: i18n.T(language, "command.linkwallet")},
+			{Command: chat.CommandWallets, Description: i18n.T(language, "command.wallets")},
+			{Command: chat.CommandWatch, Description: i18n.T(language, "command.watch")},
+			{Command: chat.CommandWatches, Description: i18n.T(language, "command.watches")},
+			{Command: chat.CommandUnsubscribe, Description: i18n.T(language, "command.unsubscribe")},
+			{Command: chat.CommandMute, Description: i18n.T(language, "command.mute")},
+			{Command: chat.CommandSettings, Description: i18n.T(language, "command.settings")},
+			{Command: chat.CommandLanguage, Description: i18n.T(language, "command.language")},
+			{Command: chat.CommandCancel, Description: i18n.T(language, "command.cancel")},
+		}
+	}
+	setCommandsRequest := tgbotapi.NewSetMyCommandsWithScope(tgbotapi.NewBotCommandScopeDefault(), userCommands(i18n.DefaultLanguage)...)
 
 	_, err = bot.Request(setCommandsRequest)
 
 	if err != nil {
 		log.Panic(err)
 	}
-	go artcollector.New(newLogger("collector"), fxhash.New(), gormDB).Collect()
-	go messagesender.New(newLogger("sender"), bot, gormDB).Start()
 
-	chat.New(bot, botLogger, gormDB).Start()
-}
+	// Telegram shows these to users whose app is in one of the languages
+	for _, language := range i18n.Languages() {
+		if language == i18n.DefaultLanguage {
+			continue
+		}
+		setCommandsRequest := tgbotapi.NewSetMyCommandsWithScopeAndLanguage(tgbotapi.NewBotCommandScopeDefault(), language, userCommands(language)...)
+		if _, err := bot.Request(setCommandsRequest); err != nil {
+			botLogger.Error("can't set commands", zap.String("language", language), zap.Error(err))
+		}
+	}
 
-func connectToDatabase(config *Config, logger *zap.Logger) *sql.DB {
-	connectionString := fmt.Sprintf("host=%s user=%s dbname=%s password=%s sslmode=disable port=%d", config.DBHost, config.DBUser, config.DBName, config.DBPassword, config.DBPort)
-	db, err := sql.Open("postgres", connectionString)
-	if err != nil {
-		log.Panic(err.Error())
+	adminCommands := append(userCommands(i18n.DefaultLanguage),
+		tgbotapi.BotCommand{Command: chat.CommandStats, Description: "Show stats"},
+		tgbotapi.BotCommand{Command: chat.CommandBroadcast, Description: "Send a message to every subscriber"},
+		tgbotapi.BotCommand{Command: chat.CommandUser, Description: "Show a subscriber by chat id or username"},
+		tgbotapi.BotCommand{Command: chat.CommandPause, Description: "Pause the collector"},
+		tgbotapi.BotCommand{Command: chat.CommandResume, Description: "Resume the collector"},
+		tgbotapi.BotCommand{Command: chat.CommandPreview, Description: "Preview a message template"},
+	)
+	for _, adminChatID := range config.AdminChatIDs {
+		setCommandsRequest := tgbotapi.NewSetMyCommandsWithScope(tgbotapi.NewBotCommandScopeChat(adminChatID), adminCommands...)
+		if _, err := bot.Request(setCommandsRequest); err != nil {
+			botLogger.Error("can't set admin commands", zap.Int64("chatID", adminChatID), zap.Error(err))
+		}
 	}
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	stores := orm.NewStores(gormDB)
+	registry := prometheus.NewRegistry()
+	registry.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+	)
+	botMetrics := metrics.New(registry)
+	metrics.RegisterStoreGauges(registry, stores)
 
-	migrateIt(db, config, logger)
+	messageTemplates, templatesErr := templates.Load(config.Templates.Dir, stores.Settings)
+	if templatesErr != nil {
+		log.Fatal(templatesErr.Error())
+	}
 
-	return db
+	fxHash := fxhash.New(botMetrics, fxhash.Config{
+		Endpoint:    config.FxHash.Endpoint,
+		IPFSGateway: config.FxHash.IPFSGateway,
+		PageSize:    config.FxHash.PageSize,
+		Timeout:     config.FxHash.Timeout,
+	})
+	collector := artcollector.New(newLogger("collector"), fxHash, stores, botMetrics, artcollector.Config{
+		Interval: config.Collector.Interval,
+	})
+	sender := messagesender.New(newLogger("sender"), bot, stores, botMetrics, messageTemplates, messagesender.Config{
+		Interval:     config.Sender.Interval,
+		BatchSize:    config.Sender.BatchSize,
+		Workers:      config.Sender.Workers,
+		QueueLength:  config.Sender.QueueLength,
+		RateLimit:    config.Sender.RateLimit,
+		ClaimTimeout: config.Sender.ClaimTimeout,
+		Owner:        replicaName(),
+	})
+	botChat := chat.New(bot, botLogger, fxHash, stores, botMetrics, messageTemplates, chat.Config{
+		AdminChatIDs: config.AdminChatIDs,
+	})
+
+	elector := leader.New(newLogger("leader"), dbConnection, config.Leader.LockID, config.Leader.Interval)
+
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", metrics.Handler(registry))
+	newHealth(config, dbConnection, bot, elector, collector, sender).Register(mux)
+	if config.AdminAPIToken != "" {
+		adminapi.New(newLogger("adminapi"), config.AdminAPIToken, stores, fxHash).Register(mux)
+	}
+
+	componentSupervisor := supervisor.New(newLogger("supervisor"), botMetrics, config.Supervisor.MinBackoff, config.Supervisor.MaxBackoff)
+
+	var wg sync.WaitGroup
+	wg.Add(2)
+	go func() {
+		defer wg.Done()
+		componentSupervisor.Run(ctx, "sender", sender.Start)
+	}()
+	go func() {
+		defer wg.Done()
+		serveHTTP(ctx, config.HTTPAddr, mux, newLogger("http"))
+	}()
+
+	elector.Run(ctx, func(ctx context.Context) {
+		var leaderWg sync.WaitGroup
+		leaderWg.Add(1)
+		go func() {
+			defer leaderWg.Done()
+			componentSupervisor.Run(ctx, "collector", collector.Collect)
+		}()
+		componentSupervisor.Run(ctx, "chat", botChat.Start)
+		leaderWg.Wait()
+	})
+	wg.Wait()
 }
 
-func migrateIt(db *sql.DB, config *Config, logger *zap.Logger) {
-	driver, err := pgmigrate.WithInstance(db, &pgmigrate.Config{})
+// replicaName identifies this process among bot replicas
+func replicaName() string {
+	hostname, err := os.Hostname()
 	if err != nil {
-		log.Fatal(err)
+		hostname = "unknown"
 	}
 
-	m, err := migrate.NewWithDatabaseInstance("file://src/migrations", config.DBName, driver)
+	return fmt.Sprintf("%s-%d", hostname, os.Getpid())
+}
 
+func connectToDatabase(config *config.Config) *sql.DB {
+	db, err := sql.Open("postgres", config.DB.DSN())
 	if err != nil {
-		log.Fatal(err)
+		log.Panic(err.Error())
 	}
 
-	if err := m.Up(); err != nil {
-		logger.Warn(
-			"sql migration result",
-			zap.Error(err),
-		)
-	} else {
-		logger.Info("Schema was migrated")
-	}
+	return db
 }
 
+// logLevel is shared by all loggers
+var logLevel = zap.NewAtomicLevel()
+
 func newLogger(name string) *zap.Logger {
 	config := zap.NewProductionConfig()
 	config.Encoding = "json"
+	config.Level = logLevel
 	logger, err := config.Build()
 
 	if err != nil {
@@ -118,13 +237,3 @@ func newLogger(name string) *zap.Logger {
 
 	return logger
 }
-
-func loadConfigurationFromEnvironments(prefix string) *Config {
-	config := &Config{}
-	err := envconfig.Process(prefix, config)
-	if err != nil {
-		log.Fatal(err.Error())
-	}
-
-	return config
-}
@@ -0,0 +1,112 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"log"
+	"strconv"
+
+	migrate "github.com/golang-migrate/migrate/v4"
+	pgmigrate "github.com/golang-migrate/migrate/v4/database/postgres"
+	"github.com/golang-migrate/migrate/v4/source/iofs"
+	"github.com/kranikitao/fxhash-telegram-bot/src/migrations"
+	"go.uber.org/zap"
+)
+
+// migrateIt applies all pending migrations and refuses to go further when
+// the schema is dirty or a migration fails.
+func migrateIt(db *sql.DB, logger *zap.Logger) {
+	m, conn := newMigrate(db)
+	defer conn.Close()
+
+	if version, dirty, err := m.Version(); err == nil && dirty {
+		log.Fatalf("schema is dirty at version %d, fix it manually and run `botrunner migrate force %d`", version, version)
+	}
+
+	err := m.Up()
+	if err != nil && err != migrate.ErrNoChange {
+		log.Fatalf("can't migrate schema: %s", err)
+	}
+
+	version, _, _ := m.Version()
+	if err == migrate.ErrNoChange {
+		logger.Info("Schema is up to date", zap.Uint("version", version))
+	} else {
+		logger.Info("Schema was migrated", zap.Uint("version", version))
+	}
+}
+
+// runMigrateCommand handles `botrunner migrate up|down [N]|version|force V`
+func runMigrateCommand(db *sql.DB, logger *zap.Logger, args []string) {
+	if len(args) == 0 {
+		log.Fatal("usage: botrunner migrate up|down [N]|version|force V")
+	}
+
+	m, conn := newMigrate(db)
+	defer conn.Close()
+
+	var err error
+	switch args[0] {
+	case "up":
+		err = m.Up()
+	case "down":
+		steps := 1
+		if len(args) > 1 {
+			steps = parseMigrateNumber(args[1])
+		}
+		err = m.Steps(-steps)
+	case "version":
+	case "force":
+		if len(args) < 2 {
+			log.Fatal("usage: botrunner migrate force V")
+		}
+		err = m.Force(parseMigrateNumber(args[1]))
+	default:
+		log.Fatalf("unknown migrate command %q", args[0])
+	}
+	if err != nil && err != migrate.ErrNoChange {
+		log.Fatalf("migrate %s failed: %s", args[0], err)
+	}
+
+	version, dirty, err := m.Version()
+	if err != nil && err != migrate.ErrNilVersion {
+		log.Fatalf("can't get schema version: %s", err)
+	}
+	logger.Info("Schema version", zap.Uint("version", version), zap.Bool("dirty", dirty))
+}
+
+// newMigrate runs migrations over a dedicated connection, so closing it
+// leaves the shared pool untouched.
+func newMigrate(db *sql.DB) (*migrate.Migrate, *sql.Conn) {
+	ctx := context.Background()
+	conn, err := db.Conn(ctx)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	driver, err := pgmigrate.WithConnection(ctx, conn, &pgmigrate.Config{})
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	source, err := iofs.New(migrations.FS, ".")
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	m, err := migrate.NewWithInstance("iofs", source, "postgres", driver)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	return m, conn
+}
+
+func parseMigrateNumber(value string) int {
+	number, err := strconv.Atoi(value)
+	if err != nil {
+		log.Fatalf("%q is not a number", value)
+	}
+
+	return number
+}
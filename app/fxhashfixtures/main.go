@@ -0,0 +1,44 @@
+// fxhashfixtures records responses of the real fxhash API into the fixtures
+// of the fake GraphQL server:
+//
+//	go run ./app/fxhashfixtures -users kranikitao,zancan
+package main
+
+import (
+	"flag"
+	"log"
+	"net/http/httptest"
+	"strings"
+
+	"github.com/kranikitao/fxhash-telegram-bot/src/fxhash"
+	"github.com/kranikitao/fxhash-telegram-bot/src/fxhash/fxhashtest"
+	"github.com/kranikitao/fxhash-telegram-bot/src/metrics"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+func main() {
+	endpoint := flag.String("endpoint", fxhash.DefaultEndpoint, "fxhash GraphQL endpoint")
+	dir := flag.String("dir", "src/fxhash/fxhashtest/fixtures", "fixtures directory")
+	users := flag.String("users", "kranikitao", "comma separated fxhash user names to record")
+	flag.Parse()
+
+	recorder := httptest.NewServer(fxhashtest.NewRecorder(*endpoint, *dir))
+	defer recorder.Close()
+	client := fxhash.New(metrics.New(prometheus.NewRegistry()), fxhash.Config{Endpoint: recorder.URL})
+
+	if _, err := client.GetLastGeneratives(); err != nil {
+		log.Printf("last generatives: %s", err)
+	}
+	if _, err := client.GetFreeGeneratives(); err != nil {
+		log.Printf("free generatives: %s", err)
+	}
+	for _, name := range strings.Split(*users, ",") {
+		if name == "" {
+			continue
+		}
+		if _, err := client.GetFxHashUser(name); err != nil {
+			log.Printf("user %s: %s", name, err)
+		}
+	}
+	log.Printf("fixtures were recorded to %s", *dir)
+}
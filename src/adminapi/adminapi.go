@@ -0,0 +1,217 @@
+// Package adminapi serves a JSON API for operators under /admin/. Every
+// request must carry the configured token:
+//
+//	Authorization: Bearer <token>
+//
+// Routes:
+//
+//	GET   /admin/subscribers?q=&limit=&offset=
+//	GET   /admin/subscribers/{chat_id}
+//	PATCH /admin/subscribers/{chat_id}
+//	GET   /admin/subscribers/{chat_id}/subscriptions
+//	POST  /admin/subscribers/{chat_id}/subscriptions
+//	PATCH /admin/subscribers/{chat_id}/subscriptions/{id}
+//	GET   /admin/delivery-items?status=pending|failed&limit=&offset=
+//	POST  /admin/delivery-items/{id}/retry
+//	POST  /admin/delivery-items/{id}/cancel
+//	POST  /admin/collector/run (202, the leader polls within a few seconds)
+//	GET   /admin/events?chat_id=&code=&since=&limit=
+package adminapi
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/kranikitao/fxhash-telegram-bot/src/errors"
+	"github.com/kranikitao/fxhash-telegram-bot/src/fxhash"
+	"github.com/kranikitao/fxhash-telegram-bot/src/orm"
+	"go.uber.org/zap"
+)
+
+const (
+	prefix       = "/admin/"
+	defaultLimit = 50
+	maxLimit     = 500
+	maxBodySize  = 1 << 20
+)
+
+type API struct {
+	logger *zap.Logger
+	token  string
+	stores *orm.Stores
+	fxHash *fxhash.FxHash
+}
+
+func New(logger *zap.Logger, token string, stores *orm.Stores, fxHash *fxhash.FxHash) *API {
+	return &API{
+		logger: logger,
+		token:  token,
+		stores: stores,
+		fxHash: fxHash,
+	}
+}
+
+func (a *API) Register(mux *http.ServeMux) {
+	mux.Handle(prefix, a)
+}
+
+// route maps methods of a matched path to handlers, ids in the path are
+// already parsed into the handlers
+type route map[string]func(w http.ResponseWriter, r *http.Request)
+
+func (a *API) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if !a.authorized(r) {
+		w.Header().Set("WWW-Authenticate", "Bearer")
+		writeError(w, http.StatusUnauthorized, "invalid token")
+		return
+	}
+
+	routes := a.match(strings.Split(strings.Trim(strings.TrimPrefix(r.URL.Path, prefix), "/"), "/"))
+	if routes == nil {
+		writeError(w, http.StatusNotFound, "not found")
+		return
+	}
+	handler, ok := routes[r.Method]
+	if !ok {
+		var allowed []string
+		for method := range routes {
+			allowed = append(allowed, method)
+		}
+		sort.Strings(allowed)
+		w.Header().Set("Allow", strings.Join(allowed, ", "))
+		writeError(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+	r.Body = http.MaxBytesReader(w, r.Body, maxBodySize)
+	handler(w, r)
+}
+
+// match routes by hand, ServeMux of this Go version has no path parameters
+func (a *API) match(parts []string) route {
+	switch {
+	case len(parts) == 1 && parts[0] == "subscribers":
+		return route{http.MethodGet: a.listSubscribers}
+	case len(parts) >= 2 && parts[0] == "subscribers":
+		chatID, err := strconv.ParseInt(parts[1], 10, 64)
+		if err != nil {
+			return nil
+		}
+		switch {
+		case len(parts) == 2:
+			return route{
+				http.MethodGet:   func(w http.ResponseWriter, r *http.Request) { a.getSubscriber(w, r, chatID) },
+				http.MethodPatch: func(w http.ResponseWriter, r *http.Request) { a.updateSubscriber(w, r, chatID) },
+			}
+		case len(parts) == 3 && parts[2] == "subscriptions":
+			return route{
+				http.MethodGet:  func(w http.ResponseWriter, r *http.Request) { a.listSubscriptions(w, r, chatID) },
+				http.MethodPost: func(w http.ResponseWriter, r *http.Request) { a.createSubscription(w, r, chatID) },
+			}
+		case len(parts) == 4 && parts[2] == "subscriptions":
+			id, err := strconv.ParseUint(parts[3], 10, 64)
+			if err != nil {
+				return nil
+			}
+			return route{
+				http.MethodPatch: func(w http.ResponseWriter, r *http.Request) { a.updateSubscription(w, r, chatID, id) },
+			}
+		}
+	case len(parts) == 1 && parts[0] == "delivery-items":
+		return route{http.MethodGet: a.listDeliveryItems}
+	case len(parts) == 3 && parts[0] == "delivery-items":
+		id, err := strconv.ParseUint(parts[1], 10, 64)
+		if err != nil {
+			return nil
+		}
+		switch parts[2] {
+		case "retry":
+			return route{http.MethodPost: func(w http.ResponseWriter, r *http.Request) { a.retryDeliveryItem(w, r, id) }}
+		case "cancel":
+			return route{http.MethodPost: func(w http.ResponseWriter, r *http.Request) { a.cancelDeliveryItem(w, r, id) }}
+		}
+	case len(parts) == 2 && parts[0] == "collector" && parts[1] == "run":
+		return route{http.MethodPost: a.runCollector}
+	case len(parts) == 1 && parts[0] == "events":
+		return route{http.MethodGet: a.listEvents}
+	}
+
+	return nil
+}
+
+// authorized requires the Bearer scheme, a bare token is rejected
+func (a *API) authorized(r *http.Request) bool {
+	const scheme = "Bearer "
+	header := r.Header.Get("Authorization")
+	if a.token == "" || !strings.HasPrefix(header, scheme) {
+		return false
+	}
+
+	return subtle.ConstantTimeCompare([]byte(strings.TrimPrefix(header, scheme)), []byte(a.token)) == 1
+}
+
+// storeError answers 404 for ErrNotFound and logs anything else as a 500
+func (a *API) storeError(w http.ResponseWriter, r *http.Request, err *errors.Error) {
+	if errors.Is(err, orm.ErrNotFound) {
+		writeError(w, http.StatusNotFound, "not found")
+		return
+	}
+	a.logger.Error(
+		"admin api request failed",
+		zap.String("method", r.Method),
+		zap.String("path", r.URL.Path),
+		zap.Error(err),
+		errors.ErrorTraceLogField(err),
+	)
+	writeError(w, http.StatusInternalServerError, "internal error")
+}
+
+// page reads limit and offset of the query
+func page(r *http.Request) (int, int, bool) {
+	limit, offset := defaultLimit, 0
+	query := r.URL.Query()
+	if value := query.Get("limit"); value != "" {
+		parsed, err := strconv.Atoi(value)
+		if err != nil || parsed < 1 || parsed > maxLimit {
+			return 0, 0, false
+		}
+		limit = parsed
+	}
+	if value := query.Get("offset"); value != "" {
+		parsed, err := strconv.Atoi(value)
+		if err != nil || parsed < 0 {
+			return 0, 0, false
+		}
+		offset = parsed
+	}
+
+	return limit, offset, true
+}
+
+func readJSON(w http.ResponseWriter, r *http.Request, v interface{}) bool {
+	decoder := json.NewDecoder(r.Body)
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(v); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid body: "+err.Error())
+		return false
+	}
+
+	return true
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
+
+type errorResponse struct {
+	Error string `json:"error"`
+}
+
+func writeError(w http.ResponseWriter, status int, message string) {
+	writeJSON(w, status, &errorResponse{Error: message})
+}
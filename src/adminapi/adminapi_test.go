@@ -0,0 +1,79 @@
+package adminapi_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"go.uber.org/zap/zaptest"
+
+	"github.com/kranikitao/fxhash-telegram-bot/src/adminapi"
+	"github.com/kranikitao/fxhash-telegram-bot/src/orm"
+	"github.com/kranikitao/fxhash-telegram-bot/src/orm/memory"
+	"github.com/kranikitao/fxhash-telegram-bot/src/orm/model"
+)
+
+const token = "secret"
+
+func newAPI(t *testing.T) (*http.ServeMux, *orm.Stores) {
+	stores := memory.NewStores()
+	mux := http.NewServeMux()
+	adminapi.New(zaptest.NewLogger(t), token, stores, nil).Register(mux)
+
+	return mux, stores
+}
+
+func serve(mux *http.ServeMux, method string, path string, authorization string) *httptest.ResponseRecorder {
+	request := httptest.NewRequest(method, path, nil)
+	if authorization != "" {
+		request.Header.Set("Authorization", authorization)
+	}
+	response := httptest.NewRecorder()
+	mux.ServeHTTP(response, request)
+
+	return response
+}
+
+func TestRunCollector(t *testing.T) {
+	mux, stores := newAPI(t)
+
+	response := serve(mux, http.MethodPost, "/admin/collector/run", "Bearer "+token)
+	if response.Code != http.StatusAccepted {
+		t.Fatalf("POST /admin/collector/run: want %d, got %d %s", http.StatusAccepted, response.Code, response.Body)
+	}
+	if requestedAt, err := stores.Settings.Get(model.SettingCollectorRunRequested); err != nil || requestedAt == "" {
+		t.Fatalf("the run must be requested from the leader, got %q, %v", requestedAt, err)
+	}
+}
+
+func TestAuthorization(t *testing.T) {
+	mux, _ := newAPI(t)
+
+	for _, test := range []struct {
+		name          string
+		authorization string
+		want          int
+	}{
+		{name: "bearer token", authorization: "Bearer " + token, want: http.StatusOK},
+		{name: "no header", authorization: "", want: http.StatusUnauthorized},
+		{name: "bare token", authorization: token, want: http.StatusUnauthorized},
+		{name: "other scheme", authorization: "Basic " + token, want: http.StatusUnauthorized},
+		{name: "wrong token", authorization: "Bearer " + token + "x", want: http.StatusUnauthorized},
+		{name: "empty token", authorization: "Bearer ", want: http.StatusUnauthorized},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			if response := serve(mux, http.MethodGet, "/admin/subscribers", test.authorization); response.Code != test.want {
+				t.Fatalf("want %d, got %d %s", test.want, response.Code, response.Body)
+			}
+		})
+	}
+}
+
+func TestEmptyTokenRejectsEverything(t *testing.T) {
+	mux := http.NewServeMux()
+	adminapi.New(zaptest.NewLogger(t), "", memory.NewStores(), nil).Register(mux)
+
+	if response := serve(mux, http.MethodGet, "/admin/subscribers", "Bearer "); response.Code != http.StatusUnauthorized {
+		t.Fatalf("want %d, got %d", http.StatusUnauthorized, response.Code)
+	}
+}
@@ -0,0 +1,467 @@
+package adminapi
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/kranikitao/fxhash-telegram-bot/src/artcollector"
+	"github.com/kranikitao/fxhash-telegram-bot/src/errors"
+	"github.com/kranikitao/fxhash-telegram-bot/src/fxhash"
+	"github.com/kranikitao/fxhash-telegram-bot/src/orm"
+	"github.com/kranikitao/fxhash-telegram-bot/src/orm/model"
+	"go.uber.org/zap"
+)
+
+const maxEvents = 1000
+
+type subscriberJSON struct {
+	ChatID     int64     `json:"chat_id"`
+	Username   string    `json:"username"`
+	Subscribed bool      `json:"subscribed"`
+	State      string    `json:"state"`
+	CreatedAt  time.Time `json:"created_at"`
+	UpdatedAt  time.Time `json:"updated_at"`
+}
+
+func newSubscriberJSON(m *model.Subscriber) *subscriberJSON {
+	return &subscriberJSON{
+		ChatID:     m.ChatID,
+		Username:   m.Username,
+		Subscribed: m.Subscribed,
+		State:      m.State,
+		CreatedAt:  m.CreatedAt,
+		UpdatedAt:  m.UpdatedAt,
+	}
+}
+
+type subscriptionJSON struct {
+	ID               uint64    `json:"id"`
+	ChatID           int64     `json:"chat_id"`
+	Kind             string    `json:"kind"`
+	FxHashArtistID   string    `json:"fx_hash_artist_id"`
+	FxHashArtistName string    `json:"fx_hash_artist_name"`
+	IsActive         bool      `json:"is_active"`
+	FirstTouchOnly   bool      `json:"first_touch_only"`
+	CreatedAt        time.Time `json:"created_at"`
+	UpdatedAt        time.Time `json:"updated_at"`
+}
+
+func newSubscriptionJSON(m *model.ArtistSubscribtion) *subscriptionJSON {
+	return &subscriptionJSON{
+		ID:               m.ID,
+		ChatID:           m.ChatID,
+		Kind:             m.Kind,
+		FxHashArtistID:   m.FxHashArtistID,
+		FxHashArtistName: m.FxHashArtistName,
+		IsActive:         m.IsActive,
+		FirstTouchOnly:   m.FirstTouchOnly,
+		CreatedAt:        m.CreatedAt,
+		UpdatedAt:        m.UpdatedAt,
+	}
+}
+
+type walletJSON struct {
+	ID        uint64    `json:"id"`
+	Address   string    `json:"address"`
+	PublicKey string    `json:"public_key"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+func newWalletJSON(m *model.Wallet) *walletJSON {
+	return &walletJSON{
+		ID:        m.ID,
+		Address:   m.Address,
+		PublicKey: m.PublicKey,
+		CreatedAt: m.CreatedAt,
+	}
+}
+
+type deliveryItemJSON struct {
+	ID             uint64     `json:"id"`
+	Type           string     `json:"type"`
+	ChatID         int64      `json:"chat_id"`
+	DedupeKey      string     `json:"dedupe_key"`
+	GenerativeID   int64      `json:"generative_id"`
+	GenerativeSlug string     `json:"generative_slug"`
+	URL            string     `json:"url"`
+	Text           string     `json:"text,omitempty"`
+	Collector      string     `json:"collector,omitempty"`
+	Action         string     `json:"action,omitempty"`
+	IsSent         bool       `json:"is_sent"`
+	Failures       int64      `json:"failures"`
+	LastError      string     `json:"last_error,omitempty"`
+	ClaimedBy      string     `json:"claimed_by,omitempty"`
+	ClaimedAt      *time.Time `json:"claimed_at,omitempty"`
+	CreatedAt      time.Time  `json:"created_at"`
+	UpdatedAt      time.Time  `json:"updated_at"`
+}
+
+func newDeliveryItemJSON(m *model.DeliveryItem) *deliveryItemJSON {
+	return &deliveryItemJSON{
+		ID:             m.ID,
+		Type:           m.Type,
+		ChatID:         m.ChatID,
+		DedupeKey:      m.DedupeKey,
+		GenerativeID:   m.GenerativeId,
+		GenerativeSlug: m.GenerativeSlug,
+		URL:            m.Url,
+		Text:           m.Text,
+		Collector:      m.Collector,
+		Action:         m.Action,
+		IsSent:         m.IsSent,
+		Failures:       m.Failures,
+		LastError:      m.LastError,
+		ClaimedBy:      m.ClaimedBy,
+		ClaimedAt:      m.ClaimedAt,
+		CreatedAt:      m.CreatedAt,
+		UpdatedAt:      m.UpdatedAt,
+	}
+}
+
+type eventJSON struct {
+	ID        uint64    `json:"id"`
+	ChatID    int64     `json:"chat_id"`
+	EventCode string    `json:"event_code"`
+	EventData string    `json:"event_data"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+func (a *API) listSubscribers(w http.ResponseWriter, r *http.Request) {
+	limit, offset, ok := page(r)
+	if !ok {
+		writeError(w, http.StatusBadRequest, "invalid limit or offset")
+		return
+	}
+	subscribers, err := a.stores.Subscribers.Search(r.URL.Query().Get("q"), limit, offset)
+	if err != nil {
+		a.storeError(w, r, err)
+		return
+	}
+
+	result := []*subscriberJSON{}
+	for _, subscriber := range subscribers {
+		result = append(result, newSubscriberJSON(subscriber))
+	}
+	writeJSON(w, http.StatusOK, result)
+}
+
+type subscriberDetailsJSON struct {
+	*subscriberJSON
+	Subscriptions []*subscriptionJSON `json:"subscriptions"`
+	Wallets       []*walletJSON       `json:"wallets"`
+}
+
+func (a *API) getSubscriber(w http.ResponseWriter, r *http.Request, chatID int64) {
+	subscriber, err := a.stores.Subscribers.FindByChatID(chatID)
+	if err != nil {
+		a.storeError(w, r, err)
+		return
+	}
+	subscriptions, err := a.stores.ArtistSubscriptions.FindByChatId(chatID)
+	if err != nil {
+		a.storeError(w, r, err)
+		return
+	}
+	wallets, err := a.stores.Wallets.FindByChatID(chatID)
+	if err != nil {
+		a.storeError(w, r, err)
+		return
+	}
+
+	result := &subscriberDetailsJSON{subscriberJSON: newSubscriberJSON(subscriber), Subscriptions: []*subscriptionJSON{}, Wallets: []*walletJSON{}}
+	for _, subscription := range subscriptions {
+		result.Subscriptions = append(result.Subscriptions, newSubscriptionJSON(subscription))
+	}
+	for _, wallet := range wallets {
+		result.Wallets = append(result.Wallets, newWalletJSON(wallet))
+	}
+	writeJSON(w, http.StatusOK, result)
+}
+
+type updateSubscriberRequest struct {
+	Subscribed *bool   `json:"subscribed"`
+	State      *string `json:"state"`
+}
+
+func (a *API) updateSubscriber(w http.ResponseWriter, r *http.Request, chatID int64) {
+	request := &updateSubscriberRequest{}
+	if !readJSON(w, r, request) {
+		return
+	}
+	subscriber, err := a.stores.Subscribers.FindByChatID(chatID)
+	if err != nil {
+		a.storeError(w, r, err)
+		return
+	}
+
+	if request.Subscribed != nil {
+		subscriber.Subscribed = *request.Subscribed
+	}
+	if request.State != nil {
+		subscriber.State = *request.State
+	}
+	if err := a.stores.Subscribers.Update(subscriber); err != nil {
+		a.storeError(w, r, err)
+		return
+	}
+	a.logger.Info("subscriber was updated", zap.Int64("chatID", chatID), zap.Any("request", request))
+	writeJSON(w, http.StatusOK, newSubscriberJSON(subscriber))
+}
+
+func (a *API) listSubscriptions(w http.ResponseWriter, r *http.Request, chatID int64) {
+	subscriptions, err := a.stores.ArtistSubscriptions.FindByChatId(chatID)
+	if err != nil {
+		a.storeError(w, r, err)
+		return
+	}
+
+	result := []*subscriptionJSON{}
+	for _, subscription := range subscriptions {
+		result = append(result, newSubscriptionJSON(subscription))
+	}
+	writeJSON(w, http.StatusOK, result)
+}
+
+type createSubscriptionRequest struct {
+	FxHashArtistName string `json:"fx_hash_artist_name"`
+	// Kind is model.SubscriptionKindArtist when it is empty
+	Kind string `json:"kind"`
+}
+
+// createSubscription subscribes the chat to an fxhash user like
+// /subscribeartist and /followcollector do, an inactive subscription is
+// activated again
+func (a *API) createSubscription(w http.ResponseWriter, r *http.Request, chatID int64) {
+	request := &createSubscriptionRequest{}
+	if !readJSON(w, r, request) {
+		return
+	}
+	if request.FxHashArtistName == "" {
+		writeError(w, http.StatusBadRequest, "fx_hash_artist_name is required")
+		return
+	}
+	if request.Kind == "" {
+		request.Kind = model.SubscriptionKindArtist
+	}
+	if request.Kind != model.SubscriptionKindArtist && request.Kind != model.SubscriptionKindCollector {
+		writeError(w, http.StatusBadRequest, "kind must be artist or collector")
+		return
+	}
+	if _, err := a.stores.Subscribers.FindByChatID(chatID); err != nil {
+		a.storeError(w, r, err)
+		return
+	}
+
+	user, err := a.fxHash.GetFxHashUser(request.FxHashArtistName)
+	if err != nil {
+		if errors.Is(err, fxhash.ErrUserNotFound) {
+			writeError(w, http.StatusNotFound, "fxhash user not found")
+			return
+		}
+		a.logger.Error(
+			"can't get fxhash user",
+			zap.String("name", request.FxHashArtistName),
+			zap.Error(err),
+			errors.ErrorTraceLogField(err),
+		)
+		writeError(w, http.StatusBadGateway, "fxhash request failed")
+		return
+	}
+
+	subscription, err := a.stores.ArtistSubscriptions.FindByChatIDAndKindAndFxHashArtistName(chatID, request.Kind, user.Name)
+	status := http.StatusOK
+	if err != nil {
+		if !errors.Is(err, orm.ErrNotFound) {
+			a.storeError(w, r, err)
+			return
+		}
+		subscription = &model.ArtistSubscribtion{
+			ChatID:           chatID,
+			Kind:             request.Kind,
+			FxHashArtistName: user.Name,
+			FxHashArtistID:   user.Id,
+			IsActive:         true,
+		}
+		err = a.stores.ArtistSubscriptions.Create(subscription)
+		status = http.StatusCreated
+	} else {
+		subscription.IsActive = true
+		err = a.stores.ArtistSubscriptions.Update(subscription)
+	}
+	if err != nil {
+		a.storeError(w, r, err)
+		return
+	}
+	a.logger.Info("subscription was added", zap.Int64("chatID", chatID), zap.String("kind", request.Kind), zap.String("artist", user.Name))
+	writeJSON(w, status, newSubscriptionJSON(subscription))
+}
+
+type updateSubscriptionRequest struct {
+	IsActive       *bool `json:"is_active"`
+	FirstTouchOnly *bool `json:"first_touch_only"`
+}
+
+func (a *API) updateSubscription(w http.ResponseWriter, r *http.Request, chatID int64, id uint64) {
+	request := &updateSubscriptionRequest{}
+	if !readJSON(w, r, request) {
+		return
+	}
+	subscription, err := a.stores.ArtistSubscriptions.FindByID(id)
+	if err != nil {
+		a.storeError(w, r, err)
+		return
+	}
+	if subscription.ChatID != chatID {
+		writeError(w, http.StatusNotFound, "not found")
+		return
+	}
+
+	if request.IsActive != nil {
+		subscription.IsActive = *request.IsActive
+	}
+	if request.FirstTouchOnly != nil {
+		subscription.FirstTouchOnly = *request.FirstTouchOnly
+	}
+	if err := a.stores.ArtistSubscriptions.Update(subscription); err != nil {
+		a.storeError(w, r, err)
+		return
+	}
+	a.logger.Info("subscription was updated", zap.Int64("chatID", chatID), zap.Uint64("id", id), zap.Any("request", request))
+	writeJSON(w, http.StatusOK, newSubscriptionJSON(subscription))
+}
+
+func (a *API) listDeliveryItems(w http.ResponseWriter, r *http.Request) {
+	limit, offset, ok := page(r)
+	if !ok {
+		writeError(w, http.StatusBadRequest, "invalid limit or offset")
+		return
+	}
+
+	var items []*model.DeliveryItem
+	var err *errors.Error
+	switch status := r.URL.Query().Get("status"); status {
+	case "", "pending":
+		items, err = a.stores.DeliveryItems.FindPending(limit, offset)
+	case "failed":
+		items, err = a.stores.DeliveryItems.FindFailed(limit, offset)
+	default:
+		writeError(w, http.StatusBadRequest, "status must be pending or failed")
+		return
+	}
+	if err != nil {
+		a.storeError(w, r, err)
+		return
+	}
+
+	result := []*deliveryItemJSON{}
+	for _, item := range items {
+		result = append(result, newDeliveryItemJSON(item))
+	}
+	writeJSON(w, http.StatusOK, result)
+}
+
+// retryDeliveryItem queues the item again. Items sent to many chats are sent
+// to every chat again, not only to the failed ones.
+func (a *API) retryDeliveryItem(w http.ResponseWriter, r *http.Request, id uint64) {
+	item, err := a.stores.DeliveryItems.FindByID(id)
+	if err != nil {
+		a.storeError(w, r, err)
+		return
+	}
+
+	item.IsSent = false
+	item.ClaimedBy = ""
+	item.ClaimedAt = nil
+	item.Failures = 0
+	item.LastError = ""
+	if err := a.stores.DeliveryItems.Update(item); err != nil {
+		a.storeError(w, r, err)
+		return
+	}
+	a.logger.Info("delivery item was queued again", zap.Uint64("id", id))
+	writeJSON(w, http.StatusOK, newDeliveryItemJSON(item))
+}
+
+// cancelDeliveryItem deletes a not sent item, so it is never sent
+func (a *API) cancelDeliveryItem(w http.ResponseWriter, r *http.Request, id uint64) {
+	item, err := a.stores.DeliveryItems.FindByID(id)
+	if err != nil {
+		a.storeError(w, r, err)
+		return
+	}
+	if item.IsSent {
+		writeError(w, http.StatusConflict, "delivery item was already sent")
+		return
+	}
+
+	if err := a.stores.DeliveryItems.Delete(item); err != nil {
+		a.storeError(w, r, err)
+		return
+	}
+	a.logger.Info("delivery item was canceled", zap.Uint64("id", id))
+	w.WriteHeader(http.StatusNoContent)
+}
+
+type collectorRunJSON struct {
+	RequestedAt time.Time `json:"requested_at"`
+}
+
+// runCollector asks the leader to poll fxhash, any replica may serve the
+// request while only the leader collects
+func (a *API) runCollector(w http.ResponseWriter, r *http.Request) {
+	requestedAt := time.Now().UTC().Truncate(time.Second)
+	if err := artcollector.RequestRun(a.stores.Settings, requestedAt); err != nil {
+		a.storeError(w, r, err)
+		return
+	}
+	a.logger.Info("collector run was requested")
+	writeJSON(w, http.StatusAccepted, &collectorRunJSON{RequestedAt: requestedAt})
+}
+
+func (a *API) listEvents(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	filter := orm.EventFilter{EventCode: query.Get("code"), Limit: 100}
+	if value := query.Get("chat_id"); value != "" {
+		chatID, err := strconv.ParseInt(value, 10, 64)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, "invalid chat_id")
+			return
+		}
+		filter.ChatID = chatID
+	}
+	if value := query.Get("since"); value != "" {
+		since, err := time.Parse(time.RFC3339, value)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, "since must be an RFC 3339 time")
+			return
+		}
+		filter.Since = since
+	}
+	if value := query.Get("limit"); value != "" {
+		limit, err := strconv.Atoi(value)
+		if err != nil || limit < 1 || limit > maxEvents {
+			writeError(w, http.StatusBadRequest, "invalid limit")
+			return
+		}
+		filter.Limit = limit
+	}
+
+	events, err := a.stores.Events.Find(filter)
+	if err != nil {
+		a.storeError(w, r, err)
+		return
+	}
+
+	result := []*eventJSON{}
+	for _, event := range events {
+		result = append(result, &eventJSON{
+			ID:        event.ID,
+			ChatID:    event.ChatID,
+			EventCode: event.EventCode,
+			EventData: event.EventData,
+			CreatedAt: event.CreatedAt,
+		})
+	}
+	writeJSON(w, http.StatusOK, result)
+}
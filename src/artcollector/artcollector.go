@@ -1,121 +1,279 @@
 package artcollector
 
 import (
+	"context"
+	"strconv"
 	"time"
 
 	"github.com/kranikitao/fxhash-telegram-bot/src/errors"
 	"github.com/kranikitao/fxhash-telegram-bot/src/fxhash"
+	"github.com/kranikitao/fxhash-telegram-bot/src/health"
+	"github.com/kranikitao/fxhash-telegram-bot/src/metrics"
 	"github.com/kranikitao/fxhash-telegram-bot/src/orm"
 	"github.com/kranikitao/fxhash-telegram-bot/src/orm/model"
 	"go.uber.org/zap"
-	"gorm.io/gorm"
 )
 
+type Config struct {
+	// Interval between two polls of fxhash
+	Interval time.Duration
+}
+
+// runRequestInterval is how often the leader checks for requested runs
+const runRequestInterval = 5 * time.Second
+
 type ArtCollector struct {
+	config                  Config
 	logger                  *zap.Logger
 	fxhash                  *fxhash.FxHash
-	deliveryItemStore       *orm.DeliveryItemStore
-	artistSubscriptionStore *orm.ArtistSubscriptionStore
+	deliveryItemStore       orm.DeliveryItemStore
+	artistSubscriptionStore orm.ArtistSubscriptionStore
+	subscriberStore         orm.SubscriberStore
+	settingStore            orm.SettingStore
+	walletStore             orm.WalletStore
+	listingWatchStore       orm.ListingWatchStore
+	metrics                 *metrics.Metrics
+	polled                  *health.Heartbeat
 }
 
-func New(logger *zap.Logger, fxhash *fxhash.FxHash, gorm *gorm.DB) *ArtCollector {
+func New(logger *zap.Logger, fxhash *fxhash.FxHash, stores *orm.Stores, metrics *metrics.Metrics, config Config) *ArtCollector {
 	return &ArtCollector{
+		config:                  config,
 		logger:                  logger,
 		fxhash:                  fxhash,
-		deliveryItemStore:       orm.GetDeliveryItemStore(gorm),
-		artistSubscriptionStore: orm.GetArtistSubscriptionStore(gorm),
+		metrics:                 metrics,
+		polled:                  health.NewHeartbeat(),
+		deliveryItemStore:       stores.DeliveryItems,
+		artistSubscriptionStore: stores.ArtistSubscriptions,
+		subscriberStore:         stores.Subscribers,
+		settingStore:            stores.Settings,
+		walletStore:             stores.Wallets,
+		listingWatchStore:       stores.ListingWatches,
 	}
 }
 
-func (c *ArtCollector) Collect() {
-	done := make(chan bool)
-	ticker := time.NewTicker(60 * time.Second)
+// Collect polls fxhash until ctx is done. It must run on the leader only.
+func (c *ArtCollector) Collect(ctx context.Context) {
+	c.polled.Beat()
+	ticker := time.NewTicker(c.config.Interval)
+	defer ticker.Stop()
+	requests := time.NewTicker(runRequestInterval)
+	defer requests.Stop()
 	for {
 		select {
-		case <-done:
-			ticker.Stop()
+		case <-ctx.Done():
+			return
 		case <-ticker.C:
-			c.recieveLastGeneratives()
-			c.recieveFreeGeneratives()
+			c.CollectOnce()
+		case <-requests.C:
+			c.collectRequested()
 		}
 	}
 }
 
-func (c *ArtCollector) recieveLastGeneratives() {
+// collectRequested polls fxhash if a run was requested through RequestRun
+func (c *ArtCollector) collectRequested() {
+	requestedAt, err := takeRunRequest(c.settingStore)
+	if err != nil {
+		c.logger.Error("can't get collector run request",
+			zap.Error(err),
+			errors.ErrorTraceLogField(err),
+		)
+		return
+	}
+	if requestedAt == "" {
+		return
+	}
+	c.logger.Info("requested collector run", zap.String("requestedAt", requestedAt))
+	c.CollectOnce()
+}
+
+// CollectOnce resumes ended mutes, polls fxhash a single time and creates
+// delivery items. Nothing is polled while the collector is paused.
+func (c *ArtCollector) CollectOnce() {
+	c.resumeMuted(time.Now())
+	paused, err := IsPaused(c.settingStore)
+	if err != nil {
+		c.logger.Error("can't get collector state",
+			zap.Error(err),
+			errors.ErrorTraceLogField(err),
+		)
+		return
+	}
+	if paused {
+		c.polled.Beat()
+		return
+	}
+
+	lastReceived := c.recieveLastGeneratives()
+	freeReceived := c.recieveFreeGeneratives()
+	actionsReceived := c.recieveCollectorActions()
+	artistsReceived := c.recieveArtistActions(time.Now())
+	walletsReceived := c.recieveWalletObjkts()
+	listingsReceived := c.recieveListings()
+	activityReceived := c.recieveWalletActivity(time.Now())
+	if lastReceived && freeReceived && actionsReceived && artistsReceived && walletsReceived && listingsReceived && activityReceived {
+		c.polled.Beat()
+	}
+}
+
+// LastPoll returns when fxhash was polled successfully last time
+func (c *ArtCollector) LastPoll() time.Time {
+	return c.polled.Last()
+}
+
+// IsPaused reports whether operators paused the collector. The state is kept
+// in the database, so it applies to whichever replica is the leader.
+func IsPaused(settings orm.SettingStore) (bool, *errors.Error) {
+	value, err := settings.Get(model.SettingCollectorPaused)
+	if err != nil {
+		if errors.Is(err, orm.ErrNotFound) {
+			return false, nil
+		}
+		return false, err
+	}
+
+	return value == strconv.FormatBool(true), nil
+}
+
+// SetPaused pauses or resumes the collector
+func SetPaused(settings orm.SettingStore, paused bool) *errors.Error {
+	return settings.Set(model.SettingCollectorPaused, strconv.FormatBool(paused))
+}
+
+// RequestRun asks the leader, whichever replica it is, to poll fxhash within
+// a few seconds instead of waiting for the interval
+func RequestRun(settings orm.SettingStore, now time.Time) *errors.Error {
+	return settings.Set(model.SettingCollectorRunRequested, now.UTC().Format(time.RFC3339))
+}
+
+// takeRunRequest returns when a pending run was requested and clears the
+// request, an empty time means no run was requested
+func takeRunRequest(settings orm.SettingStore) (string, *errors.Error) {
+	requestedAt, err := settings.Get(model.SettingCollectorRunRequested)
+	if err != nil {
+		if errors.Is(err, orm.ErrNotFound) {
+			return "", nil
+		}
+		return "", err
+	}
+	if requestedAt == "" {
+		return "", nil
+	}
+	if err := settings.Set(model.SettingCollectorRunRequested, ""); err != nil {
+		return "", err
+	}
+
+	return requestedAt, nil
+}
+
+func (c *ArtCollector) recieveLastGeneratives() bool {
 	tokens, err := c.fxhash.GetLastGeneratives()
 	if err != nil {
+		if errors.Is(err, fxhash.ErrGenerativesNotFound) {
+			return true
+		}
 		c.logger.Error("can't get generatives",
 			zap.Error(err),
 			errors.ErrorTraceLogField(err),
 		)
+		return false
 	}
 
 	tokensByAuthors := map[string][]*fxhash.GenerativeToken{}
 	var authorIds []string
 	for _, token := range tokens {
-		if token.Author.Name != "" {
-			authorIds = append(authorIds, token.Author.Id)
-			tokensByAuthors[token.Author.Id] = append(tokensByAuthors[token.Author.Id], token)
-		} else {
-			for _, author := range token.Collaborators {
-				if author.Name != "" {
-					authorIds = append(authorIds, author.Id)
-					tokensByAuthors[author.Id] = append(tokensByAuthors[token.Author.Id], token)
-				}
+		for _, artist := range token.Artists() {
+			if artist == nil || artist.Id == "" {
+				continue
+			}
+			if _, ok := tokensByAuthors[artist.Id]; !ok {
+				authorIds = append(authorIds, artist.Id)
 			}
+			tokensByAuthors[artist.Id] = append(tokensByAuthors[artist.Id], token)
 		}
 	}
-	subscriptions, err := c.artistSubscriptionStore.FindActiveByFxHashArtistIds(authorIds)
+	subscriptions, err := c.artistSubscriptionStore.FindActiveByKindAndFxHashArtistIds(model.SubscriptionKindArtist, authorIds)
 	if err != nil {
 		c.logger.Error("can't get subscriptions",
 			zap.Error(err),
 			errors.ErrorTraceLogField(err),
 		)
+		return false
 	}
 	if len(subscriptions) == 0 {
-		return
+		return true
 	}
 
+	now := time.Now()
 	for _, subscription := range subscriptions {
+		if subscription.IsMuted(now) {
+			continue
+		}
 		if tokensByAuthors[subscription.FxHashArtistID] != nil {
 			for _, token := range tokensByAuthors[subscription.FxHashArtistID] {
-				c.createDeliveryItem(subscription.ChatID, token)
+				c.createDeliveryItem(subscription.ChatID, token, subscription.AlwaysNotify)
 			}
 		}
 	}
+
+	return true
 }
 
-func (c *ArtCollector) recieveFreeGeneratives() {
+func (c *ArtCollector) recieveFreeGeneratives() bool {
 	tokens, err := c.fxhash.GetFreeGeneratives()
 	if err != nil {
+		if errors.Is(err, fxhash.ErrGenerativesNotFound) {
+			return true
+		}
 		c.logger.Error("can't get generatives",
 			zap.Error(err),
 			errors.ErrorTraceLogField(err),
 		)
+		return false
 	}
 	for _, token := range tokens {
-		c.createDeliveryItem(model.NullChatID, token)
+		c.createDeliveryItem(model.NullChatID, token, false)
 	}
+
+	return true
 }
 
-func (c *ArtCollector) createDeliveryItem(ChatID int64, token *fxhash.GenerativeToken) {
+// createDeliveryItem queues the token, urgent items are sent during quiet hours too
+func (c *ArtCollector) createDeliveryItem(ChatID int64, token *fxhash.GenerativeToken, urgent bool) {
+	var mintOpensAt *time.Time
+	if !token.MintOpensAt.IsZero() {
+		mintOpensAt = &token.MintOpensAt
+	}
+	var price *int64
+	if value, ok := token.Price(); ok {
+		price = &value
+	}
 	deliveryItem := &model.DeliveryItem{
 		Type:           model.DeliveryItemTypeByArtist,
 		ChatID:         ChatID,
+		DedupeKey:      strconv.FormatInt(token.Id, 10),
 		GenerativeId:   token.Id,
 		GenerativeSlug: token.Slug,
 		Url:            "https://www.fxhash.xyz/generative/slug/" + token.Slug,
 		IsSent:         false,
+		Urgent:         urgent,
+		MintOpensAt:    mintOpensAt,
+		Name:           token.Name,
+		Author:         token.AuthorName(),
+		Price:          price,
 	}
-	_, err := c.deliveryItemStore.FindByTypeAndChatIdAndGenerativeId(model.DeliveryItemTypeByArtist, deliveryItem.ChatID, deliveryItem.GenerativeId)
+	_, err := c.deliveryItemStore.FindByTypeAndChatIdAndDedupeKey(model.DeliveryItemTypeByArtist, deliveryItem.ChatID, deliveryItem.DedupeKey)
 	if err != nil {
-		if err.Type == orm.ErrNotFound {
+		if errors.Is(err, orm.ErrNotFound) {
 			if err := c.deliveryItemStore.Create(deliveryItem); err != nil {
 				c.logger.Error("can't add delivery item",
 					zap.Any("deliveryItem", deliveryItem),
 					zap.Error(err),
 					errors.ErrorTraceLogField(err),
 				)
+			} else {
+				c.metrics.DeliveryItemsCreated.WithLabelValues(deliveryItem.Type).Inc()
 			}
 		} else {
 			c.logger.Error("can't get delivery item",
@@ -0,0 +1,45 @@
+package artcollector_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/kranikitao/fxhash-telegram-bot/src/errors"
+	"github.com/kranikitao/fxhash-telegram-bot/src/harness"
+	"github.com/kranikitao/fxhash-telegram-bot/src/orm"
+	"github.com/kranikitao/fxhash-telegram-bot/src/orm/memory"
+	"github.com/kranikitao/fxhash-telegram-bot/src/orm/model"
+)
+
+type failingArtistLookup struct {
+	orm.ArtistSubscriptionStore
+}
+
+func (failingArtistLookup) FindActiveByKindAndFxHashArtistIds(string, []string) ([]*model.ArtistSubscribtion, *errors.Error) {
+	return nil, errors.New("connection refused", nil)
+}
+
+func TestPollFailsWhenSubscriptionsCantBeRead(t *testing.T) {
+	for _, test := range []struct {
+		name   string
+		stores func() *orm.Stores
+		beat   bool
+	}{
+		{name: "ok", stores: memory.NewStores, beat: true},
+		{name: "store failure", stores: func() *orm.Stores {
+			stores := memory.NewStores()
+			stores.ArtistSubscriptions = failingArtistLookup{stores.ArtistSubscriptions}
+			return stores
+		}},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			h := harness.NewWithStores(t, test.stores())
+			before := h.Collector.LastPoll()
+			time.Sleep(time.Millisecond)
+			h.Collect()
+			if beat := h.Collector.LastPoll().After(before); beat != test.beat {
+				t.Fatalf("LastPoll: want a new successful poll %v, got %v", test.beat, beat)
+			}
+		})
+	}
+}
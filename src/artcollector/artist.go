@@ -0,0 +1,232 @@
+package artcollector
+
+import (
+	"hash/fnv"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/kranikitao/fxhash-telegram-bot/src/errors"
+	"github.com/kranikitao/fxhash-telegram-bot/src/fxhash"
+	"github.com/kranikitao/fxhash-telegram-bot/src/i18n"
+	"github.com/kranikitao/fxhash-telegram-bot/src/orm"
+	"github.com/kranikitao/fxhash-telegram-bot/src/orm/model"
+	"github.com/kranikitao/fxhash-telegram-bot/src/templates"
+	"go.uber.org/zap"
+)
+
+// artistSummaryHour is the local hour linked artists get the summary of the
+// last 24 hours at
+const artistSummaryHour = 9
+
+// artistEvent is an action on a token of a linked artist
+type artistEvent struct {
+	token  *fxhash.GenerativeToken
+	action *fxhash.Action
+}
+
+// recieveArtistActions tells linked artists about actions on their tokens
+// made after they linked their account, and sends the daily summary
+func (c *ArtCollector) recieveArtistActions(now time.Time) bool {
+	artists, err := c.subscriberStore.FindLinkedArtists()
+	if err != nil {
+		c.logger.Error("can't get linked artists",
+			zap.Error(err),
+			errors.ErrorTraceLogField(err),
+		)
+		return false
+	}
+
+	received := true
+	for _, artist := range artists {
+		tokens, err := c.fxhash.GetArtistTokens(artist.ArtistID)
+		if err != nil {
+			c.logger.Error("can't get artist tokens",
+				zap.Int64("chatID", artist.ChatID),
+				zap.String("artistId", artist.ArtistID),
+				zap.Error(err),
+				errors.ErrorTraceLogField(err),
+			)
+			received = false
+			continue
+		}
+
+		var events []artistEvent
+		for _, token := range tokens {
+			for _, action := range token.Actions {
+				if !action.CreatedAt.Before(*artist.ArtistLinkedAt) {
+					events = append(events, artistEvent{token: token, action: action})
+				}
+			}
+		}
+		sort.SliceStable(events, func(i, j int) bool {
+			return events[i].action.CreatedAt.Before(events[j].action.CreatedAt)
+		})
+		for _, event := range events {
+			text, ok := artistEventText(artist.Language, event.token, event.action)
+			if !ok {
+				continue
+			}
+			c.createArtistItem(artist.ChatID, model.DeliveryItemTypeArtistEvent, actionKey(event.action.Id), event.token, text)
+		}
+		c.summarizeArtist(artist, tokens, now)
+	}
+
+	return received
+}
+
+// summarizeArtist queues the summary of the last 24 hours once a day
+func (c *ArtCollector) summarizeArtist(artist *model.Subscriber, tokens []*fxhash.GenerativeToken, now time.Time) {
+	local := now.In(artist.Location())
+	if local.Hour() < artistSummaryHour {
+		return
+	}
+	// the first summary comes the morning after the account is linked
+	to := time.Date(local.Year(), local.Month(), local.Day(), artistSummaryHour, 0, 0, 0, local.Location())
+	if !artist.ArtistLinkedAt.Before(to) {
+		return
+	}
+	date := local.Format("20060102")
+	_, err := c.deliveryItemStore.FindByTypeAndChatIdAndDedupeKey(model.DeliveryItemTypeArtistSummary, artist.ChatID, date)
+	if err == nil {
+		return
+	}
+	if !errors.Is(err, orm.ErrNotFound) {
+		c.logger.Error("can't get artist summary",
+			zap.Int64("chatID", artist.ChatID),
+			zap.Error(err),
+			errors.ErrorTraceLogField(err),
+		)
+		return
+	}
+
+	from := to.Add(-24 * time.Hour)
+	var mints, sales int
+	var primary, volume, royalties int64
+	for _, token := range tokens {
+		for _, action := range token.Actions {
+			if action.CreatedAt.Before(from) || !action.CreatedAt.Before(to) {
+				continue
+			}
+			price, _ := action.Price()
+			switch action.Type {
+			case fxhash.ActionTypeMinted:
+				mints++
+				primary += price
+			case fxhash.ActionTypeListingV1Accepted, fxhash.ActionTypeListingV2Accepted,
+				fxhash.ActionTypeOfferAccepted, fxhash.ActionTypeCollectionOfferAccepted:
+				sales++
+				volume += price
+				royalties += price * int64(token.Royalties) / 1000
+			}
+		}
+	}
+
+	text := i18n.T(artist.Language, "artist.summary.none")
+	if mints > 0 || sales > 0 {
+		text = i18n.T(artist.Language, "artist.summary", mints, tez(primary), sales, tez(volume), tez(royalties))
+	}
+	c.createArtistItem(artist.ChatID, model.DeliveryItemTypeArtistSummary, date, nil, text)
+}
+
+// artistEventText renders the action in the language, it reports false for
+// actions artists are not told about
+func artistEventText(language string, token *fxhash.GenerativeToken, action *fxhash.Action) (string, bool) {
+	name := token.Name
+	if action.Objkt != nil && action.Objkt.Name != "" {
+		name = action.Objkt.Name
+	}
+	price, _ := action.Price()
+	var text string
+	switch action.Type {
+	case fxhash.ActionTypeMinted:
+		text = i18n.T(language, "artist.event.minted", userName(action.Issuer), name, tez(price))
+	case fxhash.ActionTypeListingV1Accepted, fxhash.ActionTypeListingV2Accepted,
+		fxhash.ActionTypeOfferAccepted, fxhash.ActionTypeCollectionOfferAccepted:
+		text = i18n.T(language, "artist.event.sold", userName(action.Collector()), name, tez(price))
+	case fxhash.ActionTypeOffer:
+		text = i18n.T(language, "artist.event.offer", userName(action.Issuer), tez(price), name)
+	case fxhash.ActionTypeCollectionOffer:
+		text = i18n.T(language, "artist.event.offer", userName(action.Issuer), tez(price), token.Name)
+	case fxhash.ActionTypeCompleted:
+		text = i18n.T(language, "artist.event.sold_out", token.Name)
+	default:
+		return "", false
+	}
+
+	return text + "\n" + generativeURL(token.Slug), true
+}
+
+// createArtistItem queues the text for the artist once per key, token is nil
+// for summaries
+func (c *ArtCollector) createArtistItem(chatID int64, itemType string, key string, token *fxhash.GenerativeToken, text string) {
+	deliveryItem := &model.DeliveryItem{
+		Type:      itemType,
+		ChatID:    chatID,
+		DedupeKey: key,
+		Text:      text,
+	}
+	if token != nil {
+		deliveryItem.GenerativeSlug = token.Slug
+		deliveryItem.Url = generativeURL(token.Slug)
+		deliveryItem.Name = token.Name
+	}
+	c.createTextItem(deliveryItem)
+}
+
+// createTextItem queues the item unless an item of the type and the chat
+// with the same DedupeKey exists, it reports false when the store fails
+func (c *ArtCollector) createTextItem(deliveryItem *model.DeliveryItem) bool {
+	_, err := c.deliveryItemStore.FindByTypeAndChatIdAndDedupeKey(deliveryItem.Type, deliveryItem.ChatID, deliveryItem.DedupeKey)
+	if err == nil {
+		return true
+	}
+	if !errors.Is(err, orm.ErrNotFound) {
+		c.logger.Error("can't get delivery item",
+			zap.Any("deliveryItem", deliveryItem),
+			zap.Error(err),
+			errors.ErrorTraceLogField(err),
+		)
+		return false
+	}
+	if err := c.deliveryItemStore.Create(deliveryItem); err != nil {
+		c.logger.Error("can't add delivery item",
+			zap.Any("deliveryItem", deliveryItem),
+			zap.Error(err),
+			errors.ErrorTraceLogField(err),
+		)
+		return false
+	}
+	c.metrics.DeliveryItemsCreated.WithLabelValues(deliveryItem.Type).Inc()
+
+	return true
+}
+
+// actionKey turns the id of an action into a DedupeKey. Items queued before
+// dedupe_key existed kept the same hash in generative_id, the migration copied
+// it so they still match.
+func actionKey(id string) string {
+	hash := fnv.New64a()
+	hash.Write([]byte(id))
+
+	return strconv.FormatUint(hash.Sum64()>>1, 10)
+}
+
+func userName(user *fxhash.Author) string {
+	if user == nil {
+		return "?"
+	}
+	if user.Name == "" {
+		return user.Id
+	}
+
+	return user.Name
+}
+
+func tez(mutez int64) string {
+	return templates.Price{Mutez: mutez}.Tez()
+}
+
+func generativeURL(slug string) string {
+	return "https://www.fxhash.xyz/generative/slug/" + slug
+}
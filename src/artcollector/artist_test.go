@@ -0,0 +1,177 @@
+package artcollector_test
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+	_ "time/tzdata"
+
+	"github.com/kranikitao/fxhash-telegram-bot/src/fxhash"
+	"github.com/kranikitao/fxhash-telegram-bot/src/harness"
+	"github.com/kranikitao/fxhash-telegram-bot/src/orm/model"
+)
+
+const kranikitaoID = "tz1ZPfnRHtLtHoPiE9ibVFDhKXXLALwDfdsd"
+
+func mutez(value float64) *float64 {
+	return &value
+}
+
+// pendingItems returns not sent items of the type queued for the chat
+func pendingItems(t *testing.T, h *harness.Harness, itemType string, chatID int64) []*model.DeliveryItem {
+	t.Helper()
+	pending, err := h.Stores.DeliveryItems.FindPending(100, 0)
+	if err != nil {
+		t.Fatalf("FindPending: %v", err)
+	}
+	var result []*model.DeliveryItem
+	for _, item := range pending {
+		if item.Type == itemType && item.ChatID == chatID {
+			result = append(result, item)
+		}
+	}
+
+	return result
+}
+
+func itemTexts(items []*model.DeliveryItem) []string {
+	result := make([]string, 0, len(items))
+	for _, item := range items {
+		result = append(result, item.Text)
+	}
+
+	return result
+}
+
+// morningZone returns a timezone where it is past the summary hour now
+func morningZone(t *testing.T, now time.Time) string {
+	for offset := -12; offset <= 14; offset++ {
+		name := fmt.Sprintf("Etc/GMT%+d", -offset)
+		location, err := time.LoadLocation(name)
+		if err != nil {
+			t.Fatalf("LoadLocation(%s): %v", name, err)
+		}
+		if hour := now.In(location).Hour(); hour >= 10 && hour <= 22 {
+			return name
+		}
+	}
+	t.Fatal("no timezone is past the summary hour")
+
+	return ""
+}
+
+// putArtist makes kranikitao the author of a token with the actions
+func putArtist(t *testing.T, h *harness.Harness, description string, actions []*fxhash.Action) {
+	t.Helper()
+	err := h.FxHash.PutUser(map[string]interface{}{
+		"id":          kranikitaoID,
+		"name":        "kranikitao",
+		"flag":        "NONE",
+		"description": description,
+		"generativeTokens": []*fxhash.GenerativeToken{{
+			Id:        15021,
+			Name:      "Ondulations",
+			Slug:      "ondulations",
+			Supply:    256,
+			Balance:   200,
+			Royalties: 100,
+			Actions:   actions,
+		}},
+	})
+	if err != nil {
+		t.Fatalf("PutUser: %v", err)
+	}
+}
+
+func TestArtistLink(t *testing.T) {
+	h := harness.New(t)
+	alice := h.NewUser(1, "alice")
+	alice.Say("/start")
+
+	alice.Say("/artist")
+	reply := alice.Say("https://www.fxhash.xyz/u/kranikitao")
+	subscriber, err := h.Stores.Subscribers.FindByChatID(alice.ChatID)
+	if err != nil {
+		t.Fatalf("FindByChatID: %v", err)
+	}
+	code := subscriber.ArtistCode
+	if code == "" || subscriber.ArtistID != kranikitaoID || subscriber.IsArtistLinked() {
+		t.Fatalf("linking must wait for the code, got %+v", subscriber)
+	}
+	if len(reply) != 1 || !strings.Contains(reply[0].Text(), code) {
+		t.Fatalf("linking: want the code %s, got %v", code, reply)
+	}
+
+	reply = alice.Press("Verify")
+	if len(reply) != 1 || !strings.Contains(reply[0].Text(), "can't find") {
+		t.Fatalf("verifying without the code: got %v", reply)
+	}
+	putArtist(t, h, "generative art "+code, nil)
+	reply = alice.Press("Verify")
+	if len(reply) != 1 || !strings.Contains(reply[0].Text(), "kranikitao is linked") {
+		t.Fatalf("verifying with the code: got %v", reply)
+	}
+	if subscriber, _ = h.Stores.Subscribers.FindByChatID(alice.ChatID); !subscriber.IsArtistLinked() || subscriber.ArtistCode != "" {
+		t.Fatalf("verifying must link the account, got %+v", subscriber)
+	}
+
+	alice.Say("/artist")
+	alice.Press("Unlink")
+	if linked, err := h.Stores.Subscribers.FindLinkedArtists(); err != nil || len(linked) != 0 {
+		t.Fatalf("unlinking: want no linked artist, got %v, %v", linked, err)
+	}
+}
+
+func TestArtistEvents(t *testing.T) {
+	h := harness.New(t)
+	alice := h.NewUser(1, "alice")
+	alice.Say("/start")
+
+	now := time.Now()
+	linkedAt := now.Add(-48 * time.Hour)
+	subscriber, err := h.Stores.Subscribers.FindByChatID(alice.ChatID)
+	if err != nil {
+		t.Fatalf("FindByChatID: %v", err)
+	}
+	subscriber.ArtistID = kranikitaoID
+	subscriber.ArtistName = "kranikitao"
+	subscriber.ArtistLinkedAt = &linkedAt
+	subscriber.Timezone = morningZone(t, now)
+	if err := h.Stores.Subscribers.Update(subscriber); err != nil {
+		t.Fatalf("Update: %v", err)
+	}
+
+	collector := &fxhash.Author{Id: "tz1Vs2H6bCGDZVb4CxWqj4zRLpsWnRCsWeYP", Name: "zancan_fan"}
+	putArtist(t, h, "", []*fxhash.Action{
+		{Id: "before-link", Type: fxhash.ActionTypeMinted, CreatedAt: linkedAt.Add(-time.Hour), Issuer: collector, NumericValue: mutez(5000000)},
+		{Id: "mint", Type: fxhash.ActionTypeMinted, CreatedAt: now.Add(-2 * time.Hour), Issuer: collector, NumericValue: mutez(5000000), Objkt: &fxhash.Objkt{Id: 1, Name: "Ondulations #7"}},
+		{Id: "sale", Type: fxhash.ActionTypeOfferAccepted, CreatedAt: now.Add(-time.Hour), Issuer: &fxhash.Author{Id: "tz1seller", Name: "seller"}, Target: collector, NumericValue: mutez(12000000)},
+		{Id: "transfer", Type: fxhash.ActionTypeTransfered, CreatedAt: now.Add(-time.Minute), Issuer: collector},
+	})
+
+	h.Collect()
+	events := itemTexts(pendingItems(t, h, model.DeliveryItemTypeArtistEvent, alice.ChatID))
+	if len(events) != 2 {
+		t.Fatalf("events: want the mint and the sale made after linking, got %q", events)
+	}
+	if !strings.Contains(events[0], "zancan_fan minted Ondulations #7 for 5 tez") || !strings.Contains(events[1], "zancan_fan bought Ondulations for 12 tez") {
+		t.Fatalf("events: got %q", events)
+	}
+	if summaries := pendingItems(t, h, model.DeliveryItemTypeArtistSummary, alice.ChatID); len(summaries) != 1 {
+		t.Fatalf("summary: want the summary of the morning, got %q", itemTexts(summaries))
+	}
+
+	h.Collect()
+	if again := pendingItems(t, h, model.DeliveryItemTypeArtistEvent, alice.ChatID); len(again) != 2 {
+		t.Fatalf("a second poll must not queue events again, got %q", itemTexts(again))
+	}
+	if summaries := pendingItems(t, h, model.DeliveryItemTypeArtistSummary, alice.ChatID); len(summaries) != 1 {
+		t.Fatalf("a second poll must not queue the summary again, got %q", itemTexts(summaries))
+	}
+
+	h.Deliver()
+	if received := alice.Received(); len(received) != 3 {
+		t.Fatalf("delivery: want two events and the summary, got %v", received)
+	}
+}
@@ -0,0 +1,147 @@
+package artcollector
+
+import (
+	"strconv"
+	"time"
+
+	"github.com/kranikitao/fxhash-telegram-bot/src/errors"
+	"github.com/kranikitao/fxhash-telegram-bot/src/fxhash"
+	"github.com/kranikitao/fxhash-telegram-bot/src/orm"
+	"github.com/kranikitao/fxhash-telegram-bot/src/orm/model"
+	"go.uber.org/zap"
+)
+
+// recieveCollectorActions queues mints and purchases of followed collectors
+// made after the chat started following them
+func (c *ArtCollector) recieveCollectorActions() bool {
+	subscriptions, err := c.artistSubscriptionStore.FindActiveByKind(model.SubscriptionKindCollector)
+	if err != nil {
+		c.logger.Error("can't get collector subscriptions",
+			zap.Error(err),
+			errors.ErrorTraceLogField(err),
+		)
+		return false
+	}
+
+	subscriptionsByCollector := map[string][]*model.ArtistSubscribtion{}
+	var collectorIds []string
+	now := time.Now()
+	for _, subscription := range subscriptions {
+		if subscription.IsMuted(now) {
+			continue
+		}
+		if _, ok := subscriptionsByCollector[subscription.FxHashArtistID]; !ok {
+			collectorIds = append(collectorIds, subscription.FxHashArtistID)
+		}
+		subscriptionsByCollector[subscription.FxHashArtistID] = append(subscriptionsByCollector[subscription.FxHashArtistID], subscription)
+	}
+
+	received := true
+	for _, collectorId := range collectorIds {
+		actions, err := c.fxhash.GetUserActions(collectorId)
+		if err != nil {
+			c.logger.Error("can't get collector actions",
+				zap.String("collectorId", collectorId),
+				zap.Error(err),
+				errors.ErrorTraceLogField(err),
+			)
+			received = false
+			continue
+		}
+		// actions come newest first, they are queued in the order they happened
+		for i := len(actions) - 1; i >= 0; i-- {
+			action := actions[i]
+			collector := action.Collector()
+			if collector == nil || collector.Id != collectorId || action.Token == nil || action.Objkt == nil {
+				continue
+			}
+			firstTouch := !touchedBefore(collectorId, action, actions[i+1:])
+			for _, subscription := range subscriptionsByCollector[collectorId] {
+				if action.CreatedAt.Before(subscription.CreatedAt) || subscription.FirstTouchOnly && !firstTouch {
+					continue
+				}
+				c.createCollectedItem(subscription, collector, action)
+			}
+		}
+	}
+
+	return received
+}
+
+// touchedBefore reports whether the collector minted or bought the token of
+// the action in one of the older actions
+func touchedBefore(collectorId string, action *fxhash.Action, older []*fxhash.Action) bool {
+	for _, previous := range older {
+		collector := previous.Collector()
+		if collector != nil && collector.Id == collectorId && previous.Token != nil && previous.Token.Id == action.Token.Id {
+			return true
+		}
+	}
+
+	return false
+}
+
+// createCollectedItem queues the action for the chat of the subscription once,
+// subscriptions to the first touch only skip tokens the chat already heard of
+func (c *ArtCollector) createCollectedItem(subscription *model.ArtistSubscribtion, collector *fxhash.Author, action *fxhash.Action) {
+	if subscription.FirstTouchOnly {
+		_, err := c.deliveryItemStore.FindByChatIdAndCollectorIdAndGenerativeSlug(subscription.ChatID, subscription.FxHashArtistID, action.Token.Slug)
+		if err == nil {
+			return
+		}
+		if !errors.Is(err, orm.ErrNotFound) {
+			c.logger.Error("can't get delivery item",
+				zap.Int64("chatID", subscription.ChatID),
+				zap.String("generativeSlug", action.Token.Slug),
+				zap.Error(err),
+				errors.ErrorTraceLogField(err),
+			)
+			return
+		}
+	}
+
+	actionName := model.CollectorActionBought
+	if action.Type == fxhash.ActionTypeMinted {
+		actionName = model.CollectorActionMinted
+	}
+	var price *int64
+	if value, ok := action.Price(); ok {
+		price = &value
+	}
+	deliveryItem := &model.DeliveryItem{
+		Type:           model.DeliveryItemTypeByCollector,
+		ChatID:         subscription.ChatID,
+		DedupeKey:      strconv.FormatInt(action.Objkt.Id, 10),
+		GenerativeId:   action.Token.Id,
+		GenerativeSlug: action.Token.Slug,
+		Url:            generativeURL(action.Token.Slug),
+		Urgent:         subscription.AlwaysNotify,
+		Name:           action.Token.Name,
+		Author:         action.Token.AuthorName(),
+		Price:          price,
+		Collector:      collector.Name,
+		CollectorID:    subscription.FxHashArtistID,
+		Action:         actionName,
+	}
+	_, err := c.deliveryItemStore.FindByTypeAndChatIdAndDedupeKey(deliveryItem.Type, deliveryItem.ChatID, deliveryItem.DedupeKey)
+	if err == nil {
+		return
+	}
+	if !errors.Is(err, orm.ErrNotFound) {
+		c.logger.Error("can't get delivery item",
+			zap.Any("deliveryItem", deliveryItem),
+			zap.Error(err),
+			errors.ErrorTraceLogField(err),
+		)
+		return
+	}
+	if err := c.deliveryItemStore.Create(deliveryItem); err != nil {
+		c.logger.Error("can't add delivery item",
+			zap.Any("deliveryItem", deliveryItem),
+			zap.Error(err),
+			errors.ErrorTraceLogField(err),
+		)
+		return
+	}
+	c.metrics.DeliveryItemsCreated.WithLabelValues(deliveryItem.Type).Inc()
+}
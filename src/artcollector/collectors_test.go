@@ -0,0 +1,51 @@
+package artcollector_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/kranikitao/fxhash-telegram-bot/src/fxhash"
+	"github.com/kranikitao/fxhash-telegram-bot/src/harness"
+	"github.com/kranikitao/fxhash-telegram-bot/src/orm/model"
+)
+
+func TestFollowCollectorFirstTouchAfterRename(t *testing.T) {
+	h := harness.New(t)
+	alice := h.NewUser(1, "alice")
+	alice.Say("/start")
+	alice.Say("/followcollector")
+	alice.Say("https://www.fxhash.xyz/u/kranikitao")
+	alice.Press("⬜ Only their first token of each project")
+	subscription, findErr := h.Stores.ArtistSubscriptions.FindByChatIDAndKindAndFxHashArtistName(alice.ChatID, model.SubscriptionKindCollector, "kranikitao")
+	if findErr != nil || !subscription.FirstTouchOnly || subscription.FxHashArtistID != kranikitaoID {
+		t.Fatalf("following the first touch only: got %+v, %v", subscription, findErr)
+	}
+
+	waves := &fxhash.GenerativeToken{Id: 15021, Name: "Waves", Slug: "waves"}
+	err := h.FxHash.PutUser(&fxhash.UserActions{Id: kranikitaoID, Name: "kranikitao", Actions: []*fxhash.Action{
+		{Id: "1", Type: fxhash.ActionTypeMinted, CreatedAt: subscription.CreatedAt.Add(time.Second),
+			Issuer: &fxhash.Author{Id: kranikitaoID, Name: "kranikitao"}, Token: waves, Objkt: &fxhash.Objkt{Id: 1, Name: "Waves #1"}},
+	}})
+	if err != nil {
+		t.Fatalf("PutUser: %v", err)
+	}
+	h.Collect()
+	items := pendingItems(t, h, model.DeliveryItemTypeByCollector, alice.ChatID)
+	if len(items) != 1 || items[0].GenerativeId != waves.Id || items[0].DedupeKey != "1" {
+		t.Fatalf("the mint: want one item of the token keyed by the objkt, got %+v", items)
+	}
+
+	// the mint is out of the latest actions and the collector renamed their
+	// profile, the token is still not their first touch
+	err = h.FxHash.PutUser(&fxhash.UserActions{Id: kranikitaoID, Name: "kranikitao_new", Actions: []*fxhash.Action{
+		{Id: "2", Type: fxhash.ActionTypeListingV2Accepted, CreatedAt: subscription.CreatedAt.Add(time.Minute),
+			Issuer: &fxhash.Author{Id: kranikitaoID, Name: "kranikitao_new"}, Token: waves, Objkt: &fxhash.Objkt{Id: 2, Name: "Waves #2"}},
+	}})
+	if err != nil {
+		t.Fatalf("PutUser: %v", err)
+	}
+	h.Collect()
+	if items := pendingItems(t, h, model.DeliveryItemTypeByCollector, alice.ChatID); len(items) != 1 {
+		t.Fatalf("a renamed collector buying the token again: want no new item, got %d items", len(items))
+	}
+}
@@ -0,0 +1,143 @@
+package artcollector
+
+import (
+	"strconv"
+	"strings"
+
+	"github.com/kranikitao/fxhash-telegram-bot/src/errors"
+	"github.com/kranikitao/fxhash-telegram-bot/src/fxhash"
+	"github.com/kranikitao/fxhash-telegram-bot/src/i18n"
+	"github.com/kranikitao/fxhash-telegram-bot/src/orm/model"
+	"go.uber.org/zap"
+)
+
+// recieveListings tells chats about listings below the thresholds of their
+// watches, only listings made after the watch was created count
+func (c *ArtCollector) recieveListings() bool {
+	watches, err := c.listingWatchStore.FindAll()
+	if err != nil {
+		c.logger.Error("can't get listing watches",
+			zap.Error(err),
+			errors.ErrorTraceLogField(err),
+		)
+		return false
+	}
+
+	received := true
+	tokensByTarget := map[string][]*fxhash.GenerativeToken{}
+	languages := map[int64]string{}
+	for _, watch := range watches {
+		if !watch.IsSet() {
+			continue
+		}
+		target := watch.Kind + " " + watch.TargetID
+		tokens, ok := tokensByTarget[target]
+		if !ok {
+			tokens, err = c.getWatchedTokens(watch)
+			if err != nil {
+				if !errors.Is(err, fxhash.ErrGenerativeNotFound) && !errors.Is(err, fxhash.ErrUserNotFound) {
+					received = false
+				}
+				c.logger.Error("can't get listings",
+					zap.Any("watch", watch),
+					zap.Error(err),
+					errors.ErrorTraceLogField(err),
+				)
+				continue
+			}
+			tokensByTarget[target] = tokens
+		}
+
+		for _, token := range tokens {
+			for _, listing := range token.Listings {
+				if listing.Objkt == nil || listing.CreatedAt.Before(watch.CreatedAt) {
+					continue
+				}
+				floor := floorPrice(token.Listings, listing)
+				if !watch.Matches(listing.Price, floor) {
+					continue
+				}
+				language, ok := languages[watch.ChatID]
+				if !ok {
+					subscriber, err := c.subscriberStore.FindByChatID(watch.ChatID)
+					if err != nil {
+						c.logger.Error("can't get subscriber",
+							zap.Int64("chatID", watch.ChatID),
+							zap.Error(err),
+							errors.ErrorTraceLogField(err),
+						)
+						received = false
+						break
+					}
+					language = subscriber.Language
+					languages[watch.ChatID] = language
+				}
+				price := listing.Price
+				deliveryItem := &model.DeliveryItem{
+					Type:           model.DeliveryItemTypeListing,
+					ChatID:         watch.ChatID,
+					DedupeKey:      actionKey(listing.Key()),
+					GenerativeSlug: token.Slug,
+					Url:            objktURL(listing.Objkt.Id),
+					Name:           listing.Objkt.Name,
+					Price:          &price,
+					Text:           listingText(language, token, listing, floor),
+				}
+				if !c.createTextItem(deliveryItem) {
+					received = false
+				}
+			}
+		}
+	}
+
+	return received
+}
+
+// getWatchedTokens returns the watched token or the tokens of the watched
+// artist with their cheapest listings
+func (c *ArtCollector) getWatchedTokens(watch *model.ListingWatch) ([]*fxhash.GenerativeToken, *errors.Error) {
+	if watch.Kind == model.ListingWatchKindArtist {
+		return c.fxhash.GetArtistListings(watch.TargetID)
+	}
+	id, parseErr := strconv.ParseInt(watch.TargetID, 10, 64)
+	if parseErr != nil {
+		return nil, errors.Wrap(parseErr, "invalid generative id")
+	}
+	token, err := c.fxhash.GetTokenListings(id, "")
+	if err != nil {
+		return nil, err
+	}
+
+	return []*fxhash.GenerativeToken{token}, nil
+}
+
+// floorPrice returns the lowest price of the other listings, 0 when there is
+// none
+func floorPrice(listings []*fxhash.Listing, listing *fxhash.Listing) int64 {
+	floor := int64(0)
+	for _, other := range listings {
+		if other.Key() == listing.Key() {
+			continue
+		}
+		if floor == 0 || other.Price < floor {
+			floor = other.Price
+		}
+	}
+
+	return floor
+}
+
+func listingText(language string, token *fxhash.GenerativeToken, listing *fxhash.Listing, floor int64) string {
+	lines := []string{i18n.T(language, "listing.alert", listing.Objkt.Name, tez(listing.Price))}
+	if floor > listing.Price {
+		lines = append(lines, i18n.T(language, "listing.below_floor", (floor-listing.Price)*100/floor, tez(floor)))
+	} else if floor > 0 {
+		lines = append(lines, i18n.T(language, "listing.floor", tez(floor)))
+	}
+	if listing.Issuer != nil {
+		lines = append(lines, i18n.T(language, "listing.seller", userName(listing.Issuer)))
+	}
+	lines = append(lines, generativeURL(token.Slug))
+
+	return strings.Join(lines, "\n")
+}
@@ -0,0 +1,171 @@
+package artcollector_test
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/kranikitao/fxhash-telegram-bot/src/fxhash"
+	"github.com/kranikitao/fxhash-telegram-bot/src/harness"
+	"github.com/kranikitao/fxhash-telegram-bot/src/orm/model"
+)
+
+// watchOf returns the only listing watch of the chat
+func watchOf(t *testing.T, h *harness.Harness, chatID int64) *model.ListingWatch {
+	t.Helper()
+	watches, err := h.Stores.ListingWatches.FindByChatID(chatID)
+	if err != nil || len(watches) != 1 {
+		t.Fatalf("FindByChatID: want one watch, got %v, %v", watches, err)
+	}
+
+	return watches[0]
+}
+
+func listing(id int64, price int64, createdAt time.Time, seller *fxhash.Author) *fxhash.Listing {
+	return &fxhash.Listing{
+		Id:        id,
+		Version:   1,
+		Price:     price,
+		CreatedAt: createdAt,
+		Issuer:    seller,
+		Objkt:     &fxhash.Objkt{Id: id, Name: fmt.Sprintf("Listed #%d", id), Iteration: int(id)},
+	}
+}
+
+func listingRequests(h *harness.Harness, query string) int {
+	count := 0
+	for _, request := range h.FxHash.Requests() {
+		if strings.Contains(request.Query, query) {
+			count++
+		}
+	}
+
+	return count
+}
+
+func TestListingWatchToken(t *testing.T) {
+	h := harness.New(t)
+	alice := h.NewUser(1, "alice")
+	bob := h.NewUser(2, "bob")
+	alice.Say("/start")
+	bob.Say("/start")
+	token := &fxhash.GenerativeToken{Id: 15030, Name: "Listed", Slug: "listed", Supply: 100}
+	if err := h.FxHash.PutGenerativeToken(token); err != nil {
+		t.Fatalf("PutGenerativeToken: %v", err)
+	}
+
+	alice.Say("/watch")
+	reply := alice.Say("https://www.fxhash.xyz/generative/15030")
+	if len(reply) != 1 || !strings.Contains(reply[0].Text(), "listing of Listed") {
+		t.Fatalf("watching the token: want the threshold prompt, got %v", reply)
+	}
+	reply = alice.Say("5 20%")
+	if len(reply) != 1 || !strings.Contains(reply[0].Text(), "Listed: at most 5 tez or 20% below the floor") {
+		t.Fatalf("setting the thresholds: got %v", reply)
+	}
+	// a watch without a threshold alerts about nothing
+	bob.Say("/watch")
+	bob.Say("https://www.fxhash.xyz/generative/slug/listed")
+	bob.Say("/cancel")
+
+	watchedAt := watchOf(t, h, alice.ChatID).CreatedAt
+	seller := &fxhash.Author{Id: "tz1Vs2H6bCGDZVb4CxWqj4zRLpsWnRCsWeYP", Name: "zancan_fan"}
+	token.Listings = []*fxhash.Listing{
+		listing(1, 1000000, watchedAt.Add(-time.Hour), seller),
+		listing(2, 4500000, watchedAt.Add(time.Second), seller),
+		listing(3, 7000000, watchedAt.Add(time.Second), nil),
+	}
+	if err := h.FxHash.PutGenerativeToken(token); err != nil {
+		t.Fatalf("PutGenerativeToken: %v", err)
+	}
+
+	requests := listingRequests(h, "TokenListings")
+	h.Collect()
+	items := itemTexts(pendingItems(t, h, model.DeliveryItemTypeListing, alice.ChatID))
+	if len(items) != 1 {
+		t.Fatalf("listings: want the listing at most 5 tez made after watching, got %q", items)
+	}
+	if want := "🏷 Listed #2 is listed for 4.5 tez\nFloor: 1 tez\nSeller: zancan_fan\nhttps://www.fxhash.xyz/generative/slug/listed"; items[0] != want {
+		t.Fatalf("listing: want %q, got %q", want, items[0])
+	}
+	if got := pendingItems(t, h, model.DeliveryItemTypeListing, bob.ChatID); len(got) != 0 {
+		t.Fatalf("listings: bob set no threshold, got %q", itemTexts(got))
+	}
+	if polled := listingRequests(h, "TokenListings") - requests; polled != 1 {
+		t.Fatalf("a token watched by two chats must be fetched once per poll, got %d requests", polled)
+	}
+
+	// the first listing is sold, a new one is cheap only against the floor
+	token.Listings = []*fxhash.Listing{
+		listing(3, 7000000, watchedAt.Add(time.Second), nil),
+		listing(4, 5500000, watchedAt.Add(time.Minute), seller),
+		listing(5, 9000000, watchedAt.Add(time.Minute), seller),
+	}
+	if err := h.FxHash.PutGenerativeToken(token); err != nil {
+		t.Fatalf("PutGenerativeToken: %v", err)
+	}
+	h.Collect()
+	h.Collect()
+	items = itemTexts(pendingItems(t, h, model.DeliveryItemTypeListing, alice.ChatID))
+	if len(items) != 2 || !strings.Contains(items[1], "Listed #4 is listed for 5.5 tez\n21% below the floor of 7 tez") {
+		t.Fatalf("listings: want one more below the floor and no duplicates, got %q", items)
+	}
+
+	h.Deliver()
+	if received := alice.Received(); len(received) != 2 {
+		t.Fatalf("delivery: want the 2 listings, got %v", received)
+	}
+	if received := bob.Received(); len(received) != 0 {
+		t.Fatalf("delivery: want nothing for bob, got %v", received)
+	}
+}
+
+func TestListingWatchArtist(t *testing.T) {
+	h := harness.New(t)
+	alice := h.NewUser(1, "alice")
+	alice.Say("/start")
+
+	alice.Say("/watch")
+	reply := alice.Say("https://www.fxhash.xyz/u/kranikitao")
+	if len(reply) != 1 || !strings.Contains(reply[0].Text(), "You don't follow kranikitao") {
+		t.Fatalf("watching an artist who is not followed: got %v", reply)
+	}
+	alice.Say("/subscribeartist")
+	alice.Say("https://www.fxhash.xyz/u/kranikitao")
+	alice.Say("/watch")
+	alice.Say("https://www.fxhash.xyz/u/kranikitao")
+	alice.Say("3")
+	watch := watchOf(t, h, alice.ChatID)
+	if watch.Kind != model.ListingWatchKindArtist || watch.TargetID != kranikitaoID || watch.MaxPrice == nil || *watch.MaxPrice != 3000000 {
+		t.Fatalf("watching the artist: got %+v", watch)
+	}
+
+	err := h.FxHash.PutUser(&fxhash.UserActions{
+		Id:   kranikitaoID,
+		Name: "kranikitao",
+		GenerativeTokens: []*fxhash.GenerativeToken{
+			{Id: 15021, Name: "Ondulations", Slug: "ondulations", Listings: []*fxhash.Listing{
+				listing(1, 2000000, watch.CreatedAt.Add(time.Second), nil),
+			}},
+			{Id: 15019, Name: "Joint venture", Slug: "joint-venture", Listings: []*fxhash.Listing{
+				listing(2, 4000000, watch.CreatedAt.Add(time.Second), nil),
+			}},
+		},
+	})
+	if err != nil {
+		t.Fatalf("PutUser: %v", err)
+	}
+
+	h.Collect()
+	items := itemTexts(pendingItems(t, h, model.DeliveryItemTypeListing, alice.ChatID))
+	if len(items) != 1 || !strings.Contains(items[0], "Listed #1 is listed for 2 tez") || !strings.HasSuffix(items[0], "/ondulations") {
+		t.Fatalf("listings: want the listing of Ondulations at most 3 tez, got %q", items)
+	}
+
+	alice.Say("/watches")
+	alice.Press("❌ kranikitao: at most 3 tez")
+	if watches, err := h.Stores.ListingWatches.FindByChatID(alice.ChatID); err != nil || len(watches) != 0 {
+		t.Fatalf("deleting the watch: want no watch, got %v, %v", watches, err)
+	}
+}
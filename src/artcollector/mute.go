@@ -0,0 +1,107 @@
+package artcollector
+
+import (
+	"strconv"
+	"time"
+
+	"github.com/kranikitao/fxhash-telegram-bot/src/errors"
+	"github.com/kranikitao/fxhash-telegram-bot/src/i18n"
+	"github.com/kranikitao/fxhash-telegram-bot/src/orm/model"
+	"go.uber.org/zap"
+)
+
+// resumeMuted clears mutes which ended and tells the chats their
+// notifications are back. A mute changed since it was read is left alone and
+// a mute cleared by another replica is not told twice.
+func (c *ArtCollector) resumeMuted(now time.Time) {
+	subscriptions, err := c.artistSubscriptionStore.FindMuteEnded(now)
+	if err != nil {
+		c.logger.Error("can't get muted subscriptions",
+			zap.Error(err),
+			errors.ErrorTraceLogField(err),
+		)
+	}
+	subscribers, err := c.subscriberStore.FindFreeMuteEnded(now)
+	if err != nil {
+		c.logger.Error("can't get muted subscribers",
+			zap.Error(err),
+			errors.ErrorTraceLogField(err),
+		)
+	}
+	if len(subscriptions) == 0 && len(subscribers) == 0 {
+		return
+	}
+
+	languages := map[int64]string{}
+	for _, subscriber := range subscribers {
+		languages[subscriber.ChatID] = subscriber.Language
+	}
+	var chatIDs []int64
+	for _, subscription := range subscriptions {
+		if _, ok := languages[subscription.ChatID]; !ok {
+			chatIDs = append(chatIDs, subscription.ChatID)
+		}
+	}
+	if len(chatIDs) > 0 {
+		chats, err := c.subscriberStore.FindByChatIDs(chatIDs)
+		if err != nil {
+			c.logger.Error("can't get subscribers",
+				zap.Error(err),
+				errors.ErrorTraceLogField(err),
+			)
+		}
+		for _, subscriber := range chats {
+			languages[subscriber.ChatID] = subscriber.Language
+		}
+	}
+
+	// notices keep a unique id in DedupeKey like broadcasts
+	id := now.UnixNano()
+	notify := func(chatID int64, text string) {
+		id++
+		notice := &model.DeliveryItem{
+			Type:      model.DeliveryItemTypeNotice,
+			ChatID:    chatID,
+			DedupeKey: strconv.FormatInt(id, 10),
+			Text:      text,
+		}
+		if err := c.deliveryItemStore.Create(notice); err != nil {
+			c.logger.Error("can't add notice",
+				zap.Any("deliveryItem", notice),
+				zap.Error(err),
+				errors.ErrorTraceLogField(err),
+			)
+			return
+		}
+		c.metrics.DeliveryItemsCreated.WithLabelValues(notice.Type).Inc()
+	}
+
+	for _, subscription := range subscriptions {
+		resumed, err := c.artistSubscriptionStore.ResumeMuted(subscription)
+		if err != nil {
+			c.logger.Error("can't resume subscription",
+				zap.Any("subscription", subscription),
+				zap.Error(err),
+				errors.ErrorTraceLogField(err),
+			)
+			continue
+		}
+		if resumed && subscription.IsActive {
+			notify(subscription.ChatID, i18n.T(languages[subscription.ChatID], "mute.resumed.artist", subscription.FxHashArtistName))
+		}
+	}
+	for _, subscriber := range subscribers {
+		resumed, err := c.subscriberStore.ResumeFreeMuted(subscriber)
+		if err != nil {
+			c.logger.Error("can't resume zero cost generatives",
+				zap.Int64("chatID", subscriber.ChatID),
+				zap.Error(err),
+				errors.ErrorTraceLogField(err),
+			)
+			continue
+		}
+		if resumed && subscriber.Subscribed {
+			notify(subscriber.ChatID, i18n.T(subscriber.Language, "mute.resumed.free"))
+		}
+	}
+}
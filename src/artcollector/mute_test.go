@@ -0,0 +1,99 @@
+package artcollector_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/kranikitao/fxhash-telegram-bot/src/errors"
+	"github.com/kranikitao/fxhash-telegram-bot/src/harness"
+	"github.com/kranikitao/fxhash-telegram-bot/src/orm"
+	"github.com/kranikitao/fxhash-telegram-bot/src/orm/memory"
+	"github.com/kranikitao/fxhash-telegram-bot/src/orm/model"
+)
+
+// remutingSubscriptions mutes the subscriptions again right after they are
+// read as ended, like a chat muting them while the collector runs
+type remutingSubscriptions struct {
+	orm.ArtistSubscriptionStore
+	until time.Time
+}
+
+func (s remutingSubscriptions) FindMuteEnded(now time.Time) ([]*model.ArtistSubscribtion, *errors.Error) {
+	subscriptions, err := s.ArtistSubscriptionStore.FindMuteEnded(now)
+	for _, subscription := range subscriptions {
+		remuted := *subscription
+		remuted.MutedUntil = &s.until
+		if err := s.ArtistSubscriptionStore.Update(&remuted); err != nil {
+			return nil, err
+		}
+	}
+
+	return subscriptions, err
+}
+
+// muteEnded mutes the subscription and the zero cost generatives of the chat
+// until a minute ago
+func muteEnded(t *testing.T, h *harness.Harness, chatID int64) {
+	t.Helper()
+	ended := time.Now().Add(-time.Minute)
+	subscription, err := h.Stores.ArtistSubscriptions.FindByChatIDAndKindAndFxHashArtistName(chatID, model.SubscriptionKindArtist, "kranikitao")
+	if err != nil {
+		t.Fatalf("FindByChatIDAndKindAndFxHashArtistName: %v", err)
+	}
+	subscription.MutedUntil = &ended
+	if err := h.Stores.ArtistSubscriptions.Update(subscription); err != nil {
+		t.Fatalf("Update subscription: %v", err)
+	}
+	subscriber, err := h.Stores.Subscribers.FindByChatID(chatID)
+	if err != nil {
+		t.Fatalf("FindByChatID: %v", err)
+	}
+	subscriber.FreeMutedUntil = &ended
+	if err := h.Stores.Subscribers.Update(subscriber); err != nil {
+		t.Fatalf("Update subscriber: %v", err)
+	}
+}
+
+func TestResumeMuted(t *testing.T) {
+	h := harness.New(t)
+	alice := h.NewUser(1, "alice")
+	alice.Say("/start")
+	alice.Say("/subscribefree")
+	alice.Say("/subscribeartist")
+	alice.Say("https://www.fxhash.xyz/u/kranikitao")
+	muteEnded(t, h, alice.ChatID)
+
+	h.Collect()
+	h.Collect()
+	notices := itemTexts(pendingItems(t, h, model.DeliveryItemTypeNotice, alice.ChatID))
+	if len(notices) != 2 || notices[0] != "Notifications about kranikitao are back on." || notices[1] != "Notifications about zero cost generatives are back on." {
+		t.Fatalf("resuming: want each mute told once, got %q", notices)
+	}
+	subscriber, err := h.Stores.Subscribers.FindByChatID(alice.ChatID)
+	if err != nil || subscriber.FreeMutedUntil != nil {
+		t.Fatalf("resuming must clear the mute of zero cost generatives, got %+v, %v", subscriber, err)
+	}
+}
+
+func TestResumeMutedSkipsRemuted(t *testing.T) {
+	stores := memory.NewStores()
+	until := time.Now().Add(time.Hour)
+	stores.ArtistSubscriptions = remutingSubscriptions{stores.ArtistSubscriptions, until}
+	h := harness.NewWithStores(t, stores)
+	alice := h.NewUser(1, "alice")
+	alice.Say("/start")
+	alice.Say("/subscribefree")
+	alice.Say("/subscribeartist")
+	alice.Say("https://www.fxhash.xyz/u/kranikitao")
+	muteEnded(t, h, alice.ChatID)
+
+	h.Collect()
+	notices := itemTexts(pendingItems(t, h, model.DeliveryItemTypeNotice, alice.ChatID))
+	if len(notices) != 1 || notices[0] != "Notifications about zero cost generatives are back on." {
+		t.Fatalf("resuming: want the zero cost generatives only, got %q", notices)
+	}
+	subscription, err := h.Stores.ArtistSubscriptions.FindByChatIDAndKindAndFxHashArtistName(alice.ChatID, model.SubscriptionKindArtist, "kranikitao")
+	if err != nil || subscription.MutedUntil == nil || !subscription.MutedUntil.Equal(until) {
+		t.Fatalf("a subscription muted again must keep its new mute, got %+v, %v", subscription, err)
+	}
+}
@@ -0,0 +1,208 @@
+package artcollector
+
+import (
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/kranikitao/fxhash-telegram-bot/src/errors"
+	"github.com/kranikitao/fxhash-telegram-bot/src/fxhash"
+	"github.com/kranikitao/fxhash-telegram-bot/src/i18n"
+	"github.com/kranikitao/fxhash-telegram-bot/src/orm"
+	"github.com/kranikitao/fxhash-telegram-bot/src/orm/model"
+	"github.com/kranikitao/fxhash-telegram-bot/src/templates"
+	"go.uber.org/zap"
+)
+
+// auctionEndingNotice is how long before the end of an auction bidders are
+// reminded about it
+const auctionEndingNotice = time.Hour
+
+// walletEvent is an offer or an auction event of a linked wallet
+type walletEvent struct {
+	key    string
+	amount int64
+	url    string
+	name   string
+	slug   string
+	text   string
+	// urgent events are useless after quiet hours end
+	urgent bool
+}
+
+// recieveWalletActivity tells chats subscribed to a linked wallet about
+// offers on objkts it owns, collection offers on projects it holds and
+// auctions it bid on. Offers and bids made before the subscription don't count.
+func (c *ArtCollector) recieveWalletActivity(now time.Time) bool {
+	subscriptions, err := c.artistSubscriptionStore.FindActiveByKind(model.SubscriptionKindWallet)
+	if err != nil {
+		c.logger.Error("can't get wallet subscriptions",
+			zap.Error(err),
+			errors.ErrorTraceLogField(err),
+		)
+		return false
+	}
+
+	received := true
+	activityByAddress := map[string]*fxhash.UserActions{}
+	for _, subscription := range subscriptions {
+		if subscription.IsMuted(now) {
+			continue
+		}
+		address := subscription.FxHashArtistID
+		// a subscription turned on again in /unsubscribe outlives its wallet
+		if _, err := c.walletStore.FindByChatIDAndAddress(subscription.ChatID, address); err != nil {
+			if !errors.Is(err, orm.ErrNotFound) {
+				c.logger.Error("can't get wallet",
+					zap.Int64("chatID", subscription.ChatID),
+					zap.String("address", address),
+					zap.Error(err),
+					errors.ErrorTraceLogField(err),
+				)
+				received = false
+			}
+			continue
+		}
+		activity, ok := activityByAddress[address]
+		if !ok {
+			activity, err = c.fxhash.GetWalletActivity(address)
+			if err != nil {
+				c.logger.Error("can't get wallet activity",
+					zap.String("address", address),
+					zap.Error(err),
+					errors.ErrorTraceLogField(err),
+				)
+				received = false
+				continue
+			}
+			activityByAddress[address] = activity
+		}
+		if activity == nil {
+			continue
+		}
+		subscriber, err := c.subscriberStore.FindByChatID(subscription.ChatID)
+		if err != nil {
+			c.logger.Error("can't get subscriber",
+				zap.Int64("chatID", subscription.ChatID),
+				zap.Error(err),
+				errors.ErrorTraceLogField(err),
+			)
+			received = false
+			continue
+		}
+
+		for _, event := range walletEvents(subscriber, address, activity, subscription.CreatedAt, now) {
+			amount := event.amount
+			deliveryItem := &model.DeliveryItem{
+				Type:           model.DeliveryItemTypeWalletActivity,
+				ChatID:         subscription.ChatID,
+				DedupeKey:      actionKey(event.key),
+				GenerativeSlug: event.slug,
+				Url:            event.url,
+				Name:           event.name,
+				Price:          &amount,
+				Text:           event.text,
+				Urgent:         subscription.AlwaysNotify || event.urgent,
+			}
+			if !c.createTextItem(deliveryItem) {
+				received = false
+			}
+		}
+	}
+
+	return received
+}
+
+// walletEvents returns offers made since on objkts of the address and on
+// generative tokens it holds, bids outbidding the address since and auctions
+// it bid on ending soon
+func walletEvents(subscriber *model.Subscriber, address string, activity *fxhash.UserActions, since time.Time, now time.Time) []*walletEvent {
+	language := subscriber.Language
+	wallet := shortAddress(address)
+	isOther := func(user *fxhash.Author) bool {
+		return user == nil || user.Id != address
+	}
+
+	var events []*walletEvent
+	tokens := map[int64]bool{}
+	for _, objkt := range activity.Objkts {
+		for _, offer := range objkt.Offers {
+			if offer.CreatedAt.Before(since) || !isOther(offer.Buyer) {
+				continue
+			}
+			events = append(events, &walletEvent{
+				key:    "offer-" + offer.Key(),
+				amount: offer.Price,
+				url:    objktURL(objkt.Id),
+				name:   objkt.Name,
+				text:   walletEventText(i18n.T(language, "wallet.activity.offer", tez(offer.Price), objkt.Name, userName(offer.Buyer), wallet), objktURL(objkt.Id)),
+			})
+		}
+		token := objkt.Issuer
+		if token == nil || tokens[token.Id] {
+			continue
+		}
+		tokens[token.Id] = true
+		for _, offer := range token.CollectionOffers {
+			if offer.CreatedAt.Before(since) || !isOther(offer.Buyer) {
+				continue
+			}
+			events = append(events, &walletEvent{
+				key:    "collection-offer-" + offer.Key(),
+				amount: offer.Price,
+				url:    generativeURL(token.Slug),
+				name:   token.Name,
+				slug:   token.Slug,
+				text:   walletEventText(i18n.T(language, "wallet.activity.collection_offer", tez(offer.Price), token.Name, userName(offer.Buyer), wallet), generativeURL(token.Slug)),
+			})
+		}
+	}
+
+	for _, auction := range activity.Auctions {
+		if auction.Objkt == nil || !auction.EndsAt.After(now) {
+			continue
+		}
+		var latestBid *fxhash.Bid
+		for _, bid := range auction.Bids {
+			if !isOther(bid.Bidder) && (latestBid == nil || bid.CreatedAt.After(latestBid.CreatedAt)) {
+				latestBid = bid
+			}
+		}
+		highest := auction.HighestBid()
+		if latestBid == nil || highest == nil {
+			continue
+		}
+		url := objktURL(auction.Objkt.Id)
+		leading := !isOther(highest.Bidder)
+		if !leading && highest.CreatedAt.After(latestBid.CreatedAt) && !highest.CreatedAt.Before(since) {
+			events = append(events, &walletEvent{
+				key:    "outbid-" + strconv.FormatInt(highest.Id, 10),
+				amount: highest.Amount,
+				url:    url,
+				name:   auction.Objkt.Name,
+				text:   walletEventText(i18n.T(language, "wallet.activity.outbid", auction.Objkt.Name, tez(highest.Amount), userName(highest.Bidder), tez(latestBid.Amount)), url),
+			})
+		}
+		if auction.EndsAt.Sub(now) <= auctionEndingNotice {
+			status := i18n.T(language, "wallet.activity.not_leading")
+			if leading {
+				status = i18n.T(language, "wallet.activity.leading")
+			}
+			endsAt := auction.EndsAt.In(subscriber.Location()).Format(templates.TimeLayout)
+			events = append(events, &walletEvent{
+				key:    "ending-" + strconv.FormatInt(auction.Id, 10),
+				amount: highest.Amount,
+				url:    url,
+				name:   auction.Objkt.Name,
+				urgent: true,
+				text:   walletEventText(i18n.T(language, "wallet.activity.ending", auction.Objkt.Name, endsAt, tez(highest.Amount))+"\n"+status, url),
+			})
+		}
+	}
+
+	return events
+}
+
+func walletEventText(text string, url string) string {
+	return strings.Join([]string{text, url}, "\n")
+}
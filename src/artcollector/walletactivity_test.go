@@ -0,0 +1,162 @@
+package artcollector_test
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/kranikitao/fxhash-telegram-bot/src/fxhash"
+	"github.com/kranikitao/fxhash-telegram-bot/src/harness"
+	"github.com/kranikitao/fxhash-telegram-bot/src/orm/model"
+)
+
+// walletSubscription returns the wallet subscription of the chat
+func walletSubscription(t *testing.T, h *harness.Harness, chatID int64) *model.ArtistSubscribtion {
+	t.Helper()
+	subscription, err := h.Stores.ArtistSubscriptions.FindByChatIDAndKindAndFxHashArtistName(chatID, model.SubscriptionKindWallet, walletAddress)
+	if err != nil {
+		t.Fatalf("FindByChatIDAndKindAndFxHashArtistName: %v", err)
+	}
+
+	return subscription
+}
+
+func walletActivityRequests(h *harness.Harness) int {
+	count := 0
+	for _, request := range h.FxHash.Requests() {
+		if strings.Contains(request.Query, "WalletActivity") {
+			count++
+		}
+	}
+
+	return count
+}
+
+func TestWalletActivity(t *testing.T) {
+	h := harness.New(t)
+	alice := h.NewUser(1, "alice")
+	alice.Say("/start")
+	linkWallet(t, h, alice)
+
+	alice.Say("/wallets")
+	alice.Press("⬜ Offers")
+	subscription := walletSubscription(t, h, alice.ChatID)
+	if !subscription.IsActive {
+		t.Fatalf("the toggle must turn on offer alerts, got %+v", subscription)
+	}
+
+	now := time.Now()
+	since := subscription.CreatedAt
+	me := &fxhash.Author{Id: walletAddress}
+	other := &fxhash.Author{Id: "tz1Vs2H6bCGDZVb4CxWqj4zRLpsWnRCsWeYP", Name: "zancan_fan"}
+	ondulations := &fxhash.GenerativeToken{Id: 15021, Name: "Ondulations", Slug: "ondulations", CollectionOffers: []*fxhash.Offer{
+		{Id: 1, Version: 1, Price: 2000000, CreatedAt: since.Add(-time.Hour), Buyer: other},
+		{Id: 2, Version: 1, Price: 3000000, CreatedAt: since.Add(time.Second), Buyer: other},
+	}}
+	activity := &fxhash.UserActions{
+		Id: walletAddress,
+		Objkts: []*fxhash.Objkt{
+			{Id: 1, Name: "Ondulations #1", Issuer: ondulations, Offers: []*fxhash.Offer{
+				{Id: 1, Version: 1, Price: 5000000, CreatedAt: since.Add(-time.Hour), Buyer: other},
+				{Id: 2, Version: 1, Price: 6000000, CreatedAt: since.Add(time.Second), Buyer: other},
+				{Id: 3, Version: 1, Price: 7000000, CreatedAt: since.Add(time.Second), Buyer: me},
+			}},
+			// the collection offer is told once for every objkt of the token
+			{Id: 2, Name: "Ondulations #2", Issuer: ondulations},
+		},
+		Auctions: []*fxhash.Auction{
+			{Id: 1, EndsAt: now.Add(30 * time.Minute), Objkt: &fxhash.Objkt{Id: 3, Name: "Ondulations #3"}, Bids: []*fxhash.Bid{
+				{Id: 2, Amount: 3000000, CreatedAt: since.Add(2 * time.Second), Bidder: other},
+				{Id: 1, Amount: 2000000, CreatedAt: since.Add(time.Second), Bidder: me},
+			}},
+			{Id: 2, EndsAt: now.Add(3 * time.Hour), Objkt: &fxhash.Objkt{Id: 4, Name: "Ondulations #4"}, Bids: []*fxhash.Bid{
+				{Id: 4, Amount: 9000000, CreatedAt: since.Add(2 * time.Second), Bidder: other},
+				{Id: 3, Amount: 8000000, CreatedAt: since.Add(time.Second), Bidder: me},
+			}},
+			{Id: 3, EndsAt: now.Add(30 * time.Minute), Objkt: &fxhash.Objkt{Id: 5, Name: "Ondulations #5"}, Bids: []*fxhash.Bid{
+				{Id: 6, Amount: 4000000, CreatedAt: since.Add(2 * time.Second), Bidder: me},
+				{Id: 5, Amount: 1000000, CreatedAt: since.Add(time.Second), Bidder: other},
+			}},
+			// nobody outbid the wallet and the auction ends later
+			{Id: 4, EndsAt: now.Add(3 * time.Hour), Objkt: &fxhash.Objkt{Id: 6, Name: "Ondulations #6"}, Bids: []*fxhash.Bid{
+				{Id: 7, Amount: 1000000, CreatedAt: since.Add(time.Second), Bidder: me},
+			}},
+		},
+	}
+	if err := h.FxHash.PutUser(activity); err != nil {
+		t.Fatalf("PutUser: %v", err)
+	}
+
+	h.Collect()
+	items := pendingItems(t, h, model.DeliveryItemTypeWalletActivity, alice.ChatID)
+	texts := itemTexts(items)
+	if len(items) != 6 {
+		t.Fatalf("activity: want an offer, a collection offer, two outbids and two ending auctions, got %q", texts)
+	}
+	for i, want := range []string{
+		"💰 Offer of 6 tez on Ondulations #1 by zancan_fan (tz1KqT",
+		"💰 Collection offer of 3 tez on Ondulations by zancan_fan",
+		"⚠️ You were outbid on Ondulations #3: 3 tez by zancan_fan, your bid was 2 tez",
+		"⏳ The auction of Ondulations #3 ends at",
+		"⚠️ You were outbid on Ondulations #4: 9 tez by zancan_fan, your bid was 8 tez",
+		"⏳ The auction of Ondulations #5 ends at",
+	} {
+		if !strings.Contains(texts[i], want) {
+			t.Fatalf("activity %d: want %q in %q", i, want, texts[i])
+		}
+	}
+	if !strings.Contains(texts[3], "You are not the highest bidder.") || !strings.Contains(texts[5], "You are the highest bidder.") {
+		t.Fatalf("ending auctions: want the bidder status, got %q and %q", texts[3], texts[5])
+	}
+	for i, item := range items {
+		if urgent := i == 3 || i == 5; item.Urgent != urgent {
+			t.Fatalf("activity %d: want urgent %v, got %v", i, urgent, item.Urgent)
+		}
+	}
+
+	h.Collect()
+	if got := pendingItems(t, h, model.DeliveryItemTypeWalletActivity, alice.ChatID); len(got) != 6 {
+		t.Fatalf("a second poll must not queue activity again, got %q", itemTexts(got))
+	}
+	h.Deliver()
+	if received := alice.Received(); len(received) != 6 {
+		t.Fatalf("delivery: want the 6 events, got %v", received)
+	}
+
+	// a muted subscription is not polled
+	activity.Objkts[0].Offers = append(activity.Objkts[0].Offers, &fxhash.Offer{Id: 4, Version: 1, Price: 6500000, CreatedAt: since.Add(time.Minute), Buyer: other})
+	if err := h.FxHash.PutUser(activity); err != nil {
+		t.Fatalf("PutUser: %v", err)
+	}
+	mutedUntil := time.Now().Add(time.Hour)
+	subscription = walletSubscription(t, h, alice.ChatID)
+	subscription.MutedUntil = &mutedUntil
+	if err := h.Stores.ArtistSubscriptions.Update(subscription); err != nil {
+		t.Fatalf("Update: %v", err)
+	}
+	requests := walletActivityRequests(h)
+	h.Collect()
+	if got := pendingItems(t, h, model.DeliveryItemTypeWalletActivity, alice.ChatID); len(got) != 0 || walletActivityRequests(h) != requests {
+		t.Fatalf("a muted subscription must not be polled, got %q", itemTexts(got))
+	}
+
+	// unlinking turns the alerts off, turning them on again without the
+	// wallet still tells nothing
+	subscription.MutedUntil = nil
+	if err := h.Stores.ArtistSubscriptions.Update(subscription); err != nil {
+		t.Fatalf("Update: %v", err)
+	}
+	alice.Say("/wallets")
+	alice.Press("❌ " + walletAddress)
+	if subscription = walletSubscription(t, h, alice.ChatID); subscription.IsActive {
+		t.Fatalf("unlinking must turn the alerts off, got %+v", subscription)
+	}
+	subscription.IsActive = true
+	if err := h.Stores.ArtistSubscriptions.Update(subscription); err != nil {
+		t.Fatalf("Update: %v", err)
+	}
+	h.Collect()
+	if got := pendingItems(t, h, model.DeliveryItemTypeWalletActivity, alice.ChatID); len(got) != 0 || walletActivityRequests(h) != requests {
+		t.Fatalf("a subscription without its wallet must not be polled, got %q", itemTexts(got))
+	}
+}
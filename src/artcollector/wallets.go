@@ -0,0 +1,171 @@
+package artcollector
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/kranikitao/fxhash-telegram-bot/src/errors"
+	"github.com/kranikitao/fxhash-telegram-bot/src/fxhash"
+	"github.com/kranikitao/fxhash-telegram-bot/src/i18n"
+	"github.com/kranikitao/fxhash-telegram-bot/src/orm/model"
+	"go.uber.org/zap"
+)
+
+// acquisition is an objkt and the action which brought it to a wallet
+type acquisition struct {
+	objkt  *fxhash.Objkt
+	action *fxhash.Action
+}
+
+// recieveWalletObjkts tells chats about objkts which landed in their linked
+// wallets since the watermark of the wallet
+func (c *ArtCollector) recieveWalletObjkts() bool {
+	wallets, err := c.walletStore.FindAll()
+	if err != nil {
+		c.logger.Error("can't get wallets",
+			zap.Error(err),
+			errors.ErrorTraceLogField(err),
+		)
+		return false
+	}
+
+	received := true
+	objktsByAddress := map[string][]*fxhash.Objkt{}
+	for _, wallet := range wallets {
+		objkts, ok := objktsByAddress[wallet.Address]
+		if !ok {
+			objkts, err = c.fxhash.GetWalletObjkts(wallet.Address)
+			if err != nil {
+				c.logger.Error("can't get wallet objkts",
+					zap.String("address", wallet.Address),
+					zap.Error(err),
+					errors.ErrorTraceLogField(err),
+				)
+				received = false
+				continue
+			}
+			objktsByAddress[wallet.Address] = objkts
+		}
+
+		since := wallet.ObjktsSince()
+		var acquisitions []acquisition
+		for _, objkt := range objkts {
+			action := acquiredBy(objkt, wallet.Address)
+			if action != nil && !action.CreatedAt.Before(since) {
+				acquisitions = append(acquisitions, acquisition{objkt: objkt, action: action})
+			}
+		}
+		if len(acquisitions) == 0 {
+			continue
+		}
+		subscriber, err := c.subscriberStore.FindByChatID(wallet.ChatID)
+		if err != nil {
+			c.logger.Error("can't get subscriber",
+				zap.Int64("chatID", wallet.ChatID),
+				zap.Error(err),
+				errors.ErrorTraceLogField(err),
+			)
+			received = false
+			continue
+		}
+
+		sort.SliceStable(acquisitions, func(i, j int) bool {
+			return acquisitions[i].action.CreatedAt.Before(acquisitions[j].action.CreatedAt)
+		})
+		latest := since
+		for _, acquisition := range acquisitions {
+			deliveryItem := &model.DeliveryItem{
+				Type:      model.DeliveryItemTypeWalletObjkt,
+				ChatID:    wallet.ChatID,
+				DedupeKey: actionKey(acquisition.action.Id),
+				Url:       objktURL(acquisition.objkt.Id),
+				Name:      acquisition.objkt.Name,
+				Text:      walletObjktText(subscriber.Language, wallet.Address, acquisition.objkt, acquisition.action),
+			}
+			if acquisition.objkt.Issuer != nil {
+				deliveryItem.GenerativeSlug = acquisition.objkt.Issuer.Slug
+			}
+			if !c.createTextItem(deliveryItem) {
+				received = false
+				break
+			}
+			latest = acquisition.action.CreatedAt
+		}
+		if latest.After(since) {
+			wallet.LastObjktAt = &latest
+			if err := c.walletStore.Update(wallet); err != nil {
+				c.logger.Error("can't update wallet",
+					zap.Any("wallet", wallet),
+					zap.Error(err),
+					errors.ErrorTraceLogField(err),
+				)
+				received = false
+			}
+		}
+	}
+
+	return received
+}
+
+// acquiredBy returns the latest action which brought the objkt to the
+// address: a mint, a purchase or a transfer
+func acquiredBy(objkt *fxhash.Objkt, address string) *fxhash.Action {
+	var latest *fxhash.Action
+	for _, action := range objkt.Actions {
+		receiver := action.Collector()
+		if action.Type == fxhash.ActionTypeTransfered {
+			receiver = action.Target
+		}
+		if receiver == nil || receiver.Id != address {
+			continue
+		}
+		if latest == nil || action.CreatedAt.After(latest.CreatedAt) {
+			latest = action
+		}
+	}
+
+	return latest
+}
+
+func walletObjktText(language string, address string, objkt *fxhash.Objkt, action *fxhash.Action) string {
+	var lines []string
+	switch action.Type {
+	case fxhash.ActionTypeMinted:
+		lines = append(lines, i18n.T(language, "wallet.objkt.minted", shortAddress(address), objkt.Name))
+	case fxhash.ActionTypeTransfered:
+		lines = append(lines, i18n.T(language, "wallet.objkt.gift", shortAddress(address), objkt.Name, userName(action.Issuer)))
+	default:
+		price, _ := action.Price()
+		lines = append(lines, i18n.T(language, "wallet.objkt.bought", shortAddress(address), objkt.Name, tez(price)))
+	}
+	if objkt.Issuer != nil && objkt.Issuer.Supply > 0 {
+		lines = append(lines, i18n.T(language, "wallet.objkt.iteration", objkt.Iteration, objkt.Issuer.Supply))
+	}
+	if objkt.Rarity != nil {
+		lines = append(lines, i18n.T(language, "wallet.objkt.rarity", fmt.Sprintf("%.1f%%", *objkt.Rarity*100)))
+	}
+	if len(objkt.Features) > 0 {
+		lines = append(lines, i18n.T(language, "wallet.objkt.features"))
+		for _, feature := range objkt.Features {
+			lines = append(lines, fmt.Sprintf("• %s: %v", feature.Name, feature.Value))
+		}
+	}
+	lines = append(lines, objktURL(objkt.Id))
+
+	return strings.Join(lines, "\n")
+}
+
+// shortAddress keeps the start and the end of a Tezos address
+func shortAddress(address string) string {
+	if len(address) <= 12 {
+		return address
+	}
+
+	return address[:7] + "…" + address[len(address)-4:]
+}
+
+func objktURL(id int64) string {
+	return "https://www.fxhash.xyz/gentk/" + strconv.FormatInt(id, 10)
+}
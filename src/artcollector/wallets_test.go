@@ -0,0 +1,169 @@
+package artcollector_test
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/kranikitao/fxhash-telegram-bot/src/fxhash"
+	"github.com/kranikitao/fxhash-telegram-bot/src/harness"
+	"github.com/kranikitao/fxhash-telegram-bot/src/orm/model"
+)
+
+// The wallet is the sandbox bootstrap1 account, the signature signs the
+// packed sign-in message of walletNonce
+const (
+	walletAddress   = "tz1KqTpEZ7Yob7QbPE4Hy4Wo8fHG8LhKxZSx"
+	walletKey       = "edpkuBknW28nW72KG6RoHtYW7p12T6GKc7nAbwYX5m8Wd9sDVC9yav"
+	walletNonce     = "00112233445566778899aabbccddeeff"
+	walletSignature = "edsigtuH7QPbWSSY3rjkJm7LZjzH2STd7Sho38EynEPr5tnHTuPZKSujziBjGooYyQqpGpVCBmxbEDTmTwW5bB8NXdSb3Kzi1m6"
+)
+
+// linkWallet links the wallet to the chat of the user through /linkwallet
+// and returns it
+func linkWallet(t *testing.T, h *harness.Harness, user *harness.User) *model.Wallet {
+	t.Helper()
+	user.Say("/linkwallet")
+	// the nonce is random, the signature is made for a known one
+	subscriber, err := h.Stores.Subscribers.FindByChatID(user.ChatID)
+	if err != nil {
+		t.Fatalf("FindByChatID: %v", err)
+	}
+	subscriber.WalletNonce = walletNonce
+	if err := h.Stores.Subscribers.Update(subscriber); err != nil {
+		t.Fatalf("Update: %v", err)
+	}
+	reply := user.Say(walletKey + " " + walletSignature)
+	if len(reply) != 1 || !strings.Contains(reply[0].Text(), walletAddress+" is linked") {
+		t.Fatalf("linking the wallet: got %v", reply)
+	}
+	wallet, err := h.Stores.Wallets.FindByChatIDAndAddress(user.ChatID, walletAddress)
+	if err != nil {
+		t.Fatalf("FindByChatIDAndAddress: %v", err)
+	}
+
+	return wallet
+}
+
+// putWallet makes the objkts the latest objkts of the wallet
+func putWallet(t *testing.T, h *harness.Harness, objkts []*fxhash.Objkt) {
+	t.Helper()
+	if err := h.FxHash.PutUser(&fxhash.UserActions{Id: walletAddress, Name: "bootstrap1", Objkts: objkts}); err != nil {
+		t.Fatalf("PutUser: %v", err)
+	}
+}
+
+func walletObjktRequests(h *harness.Harness) int {
+	count := 0
+	for _, request := range h.FxHash.Requests() {
+		if strings.Contains(request.Query, "WalletObjkts") {
+			count++
+		}
+	}
+
+	return count
+}
+
+func TestWalletLinkRejectsWrongSignature(t *testing.T) {
+	h := harness.New(t)
+	alice := h.NewUser(1, "alice")
+	alice.Say("/start")
+
+	// the signature is valid for walletNonce, not for the random nonce
+	alice.Say("/linkwallet")
+	reply := alice.Say(walletKey + " " + walletSignature)
+	if len(reply) != 1 || !strings.Contains(reply[0].Text(), "doesn't match") {
+		t.Fatalf("linking with the signature of another nonce: got %v", reply)
+	}
+	if wallets, err := h.Stores.Wallets.FindByChatID(alice.ChatID); err != nil || len(wallets) != 0 {
+		t.Fatalf("no wallet must be linked, got %v, %v", wallets, err)
+	}
+}
+
+func TestWalletObjkts(t *testing.T) {
+	h := harness.New(t)
+	alice := h.NewUser(1, "alice")
+	bob := h.NewUser(2, "bob")
+	alice.Say("/start")
+	bob.Say("/start")
+	wallet := linkWallet(t, h, alice)
+	linkWallet(t, h, bob)
+
+	linkedAt := wallet.CreatedAt
+	me := &fxhash.Author{Id: walletAddress}
+	other := &fxhash.Author{Id: "tz1Vs2H6bCGDZVb4CxWqj4zRLpsWnRCsWeYP", Name: "zancan_fan"}
+	ondulations := &fxhash.GenerativeToken{Id: 15021, Slug: "ondulations", Supply: 256}
+	rarity := 0.25
+	putWallet(t, h, []*fxhash.Objkt{
+		{Id: 1, Name: "Ondulations #1", Iteration: 1, Issuer: ondulations, Actions: []*fxhash.Action{
+			{Id: "old-mint", Type: fxhash.ActionTypeMinted, CreatedAt: linkedAt.Add(-time.Hour), Issuer: me},
+		}},
+		{Id: 2, Name: "Ondulations #2", Iteration: 2, Issuer: ondulations, Rarity: &rarity, Features: []*fxhash.Feature{{Name: "Palette", Value: "Dusk"}}, Actions: []*fxhash.Action{
+			{Id: "mint", Type: fxhash.ActionTypeMinted, CreatedAt: linkedAt.Add(time.Second), Issuer: me},
+		}},
+		{Id: 3, Name: "Ondulations #3", Iteration: 3, Issuer: ondulations, Actions: []*fxhash.Action{
+			{Id: "mint-3", Type: fxhash.ActionTypeMinted, CreatedAt: linkedAt.Add(-2 * time.Hour), Issuer: other},
+			{Id: "buy", Type: fxhash.ActionTypeListingV2Accepted, CreatedAt: linkedAt.Add(2 * time.Second), Issuer: me, Target: other, NumericValue: mutez(7500000)},
+		}},
+		{Id: 4, Name: "Ondulations #4", Iteration: 4, Issuer: ondulations, Actions: []*fxhash.Action{
+			{Id: "gift", Type: fxhash.ActionTypeTransfered, CreatedAt: linkedAt.Add(3 * time.Second), Issuer: other, Target: me},
+		}},
+	})
+
+	h.Collect()
+	items := itemTexts(pendingItems(t, h, model.DeliveryItemTypeWalletObjkt, alice.ChatID))
+	if len(items) != 3 {
+		t.Fatalf("objkts: want the mint, the purchase and the gift after linking, got %q", items)
+	}
+	for i, want := range []string{
+		"you minted Ondulations #2\nIteration #2 of 256\nRarity: 25.0% (lower is rarer)\nFeatures:\n• Palette: Dusk\nhttps://www.fxhash.xyz/gentk/2",
+		"you bought Ondulations #3 for 7.5 tez",
+		"Ondulations #4, sent by zancan_fan",
+	} {
+		if !strings.Contains(items[i], want) {
+			t.Fatalf("objkt %d: want %q in %q", i, want, items[i])
+		}
+	}
+	if got := pendingItems(t, h, model.DeliveryItemTypeWalletObjkt, bob.ChatID); len(got) != 3 {
+		t.Fatalf("objkts: bob linked the same wallet, got %q", itemTexts(got))
+	}
+	if requests := walletObjktRequests(h); requests != 1 {
+		t.Fatalf("a wallet linked by two chats must be fetched once per poll, got %d requests", requests)
+	}
+	if wallet, _ = h.Stores.Wallets.FindByID(wallet.ID); !wallet.ObjktsSince().Equal(linkedAt.Add(3 * time.Second)) {
+		t.Fatalf("watermark: want the gift at %s, got %s", linkedAt.Add(3*time.Second), wallet.ObjktsSince())
+	}
+
+	h.Collect()
+	if got := pendingItems(t, h, model.DeliveryItemTypeWalletObjkt, alice.ChatID); len(got) != 3 {
+		t.Fatalf("a second poll must not queue objkts again, got %q", itemTexts(got))
+	}
+	// items are unique per action even when the watermark was not saved
+	wallet.LastObjktAt = nil
+	if err := h.Stores.Wallets.Update(wallet); err != nil {
+		t.Fatalf("Update: %v", err)
+	}
+	h.Collect()
+	if got := pendingItems(t, h, model.DeliveryItemTypeWalletObjkt, alice.ChatID); len(got) != 3 {
+		t.Fatalf("a poll without the watermark must not queue objkts again, got %q", itemTexts(got))
+	}
+
+	h.Deliver()
+	if received := alice.Received(); len(received) != 3 {
+		t.Fatalf("delivery: want the 3 objkts, got %v", received)
+	}
+
+	// an objkt held before the wallet was linked and bought back later is new
+	putWallet(t, h, []*fxhash.Objkt{
+		{Id: 1, Name: "Ondulations #1", Iteration: 1, Issuer: ondulations, Actions: []*fxhash.Action{
+			{Id: "old-mint", Type: fxhash.ActionTypeMinted, CreatedAt: linkedAt.Add(-time.Hour), Issuer: me},
+			{Id: "buy-back", Type: fxhash.ActionTypeOfferAccepted, CreatedAt: linkedAt.Add(time.Minute), Issuer: other, Target: me, NumericValue: mutez(1000000)},
+		}},
+	})
+	h.Collect()
+	h.Deliver()
+	received := alice.Received()
+	if len(received) != 1 || !strings.Contains(received[0].Text(), "you bought Ondulations #1 for 1 tez") {
+		t.Fatalf("a new objkt after the watermark: got %v", received)
+	}
+}
@@ -0,0 +1,318 @@
+package chat
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+	"github.com/kranikitao/fxhash-telegram-bot/src/artcollector"
+	"github.com/kranikitao/fxhash-telegram-bot/src/errors"
+	"github.com/kranikitao/fxhash-telegram-bot/src/i18n"
+	"github.com/kranikitao/fxhash-telegram-bot/src/orm"
+	"github.com/kranikitao/fxhash-telegram-bot/src/orm/model"
+	"github.com/kranikitao/fxhash-telegram-bot/src/templates"
+	"go.uber.org/zap"
+)
+
+const topArtistsLimit = 10
+
+func (c *Chat) isAdmin(chatID int64) bool {
+	for _, adminChatID := range c.config.AdminChatIDs {
+		if adminChatID == chatID {
+			return true
+		}
+	}
+
+	return false
+}
+
+func (c *Chat) handleAdminCommands(command string, arguments string, subscriber *model.Subscriber) {
+	switch command {
+	case CommandStats:
+		c.showStats(subscriber)
+	case CommandBroadcast:
+		c.previewBroadcast(subscriber, arguments)
+	case CommandUser:
+		c.showUser(subscriber, arguments)
+	case CommandPause:
+		c.pauseCollector(subscriber, true)
+	case CommandResume:
+		c.pauseCollector(subscriber, false)
+	case CommandPreview:
+		c.previewTemplate(subscriber, arguments)
+	default:
+	}
+}
+
+func (c *Chat) showStats(subscriber *model.Subscriber) {
+	var failed *errors.Error
+	count := func(counter func() (int64, *errors.Error)) int64 {
+		value, err := counter()
+		if err != nil && failed == nil {
+			failed = err
+		}
+		return value
+	}
+	subscribers := count(c.subscriberStore.CountAll)
+	freeSubscribers := count(c.subscriberStore.CountSubscribed)
+	artistSubscriptions := count(c.artistSubscriptionStore.CountActive)
+	artistChats := count(c.artistSubscriptionStore.CountActiveChats)
+	delivered := count(func() (int64, *errors.Error) {
+		return c.deliveryItemStore.CountSentSince(time.Now().Add(-24 * time.Hour))
+	})
+	topArtists, err := c.artistSubscriptionStore.FindTopArtists(topArtistsLimit)
+	if err != nil && failed == nil {
+		failed = err
+	}
+	paused, err := artcollector.IsPaused(c.settingStore)
+	if err != nil && failed == nil {
+		failed = err
+	}
+	if failed != nil {
+		c.logger.Error(
+			"can't collect stats",
+			zap.Error(failed),
+			errors.ErrorTraceLogField(failed),
+		)
+		c.reply(subscriber, ChatErrorUnexpected)
+		return
+	}
+
+	collectorState := c.text(subscriber, "admin.stats.running")
+	if paused {
+		collectorState = c.text(subscriber, "admin.stats.paused")
+	}
+	var text strings.Builder
+	text.WriteString(c.text(subscriber, "admin.stats", subscribers, freeSubscribers, artistSubscriptions, artistChats, delivered, collectorState))
+	if len(topArtists) > 0 {
+		text.WriteString("\n\n" + c.text(subscriber, "admin.stats.top_artists"))
+		for i, artist := range topArtists {
+			fmt.Fprintf(&text, "\n%d. %s - %d", i+1, artist.FxHashArtistName, artist.Followers)
+		}
+	}
+
+	c.sendTextMessage(subscriber.ChatID, text.String())
+}
+
+// previewBroadcast shows the broadcast as subscribers will see it, the text
+// is taken back from the preview message once the admin confirms it
+func (c *Chat) previewBroadcast(subscriber *model.Subscriber, text string) {
+	text = strings.TrimSpace(text)
+	if text == "" {
+		c.reply(subscriber, "admin.broadcast.usage", CommandBroadcast)
+		return
+	}
+	subscribers, err := c.subscriberStore.CountAll()
+	if err != nil {
+		c.logger.Error(
+			"can't count subscribers",
+			zap.Error(err),
+			errors.ErrorTraceLogField(err),
+		)
+		c.reply(subscriber, ChatErrorUnexpected)
+		return
+	}
+
+	if err := c.sendTextMessage(subscriber.ChatID, i18n.N(subscriber.Language, "admin.broadcast.preview", int(subscribers))); err != nil {
+		return
+	}
+	message := tgbotapi.NewMessage(subscriber.ChatID, text)
+	message.ReplyMarkup = tgbotapi.NewInlineKeyboardMarkup(tgbotapi.NewInlineKeyboardRow(
+		tgbotapi.NewInlineKeyboardButtonData(c.text(subscriber, "admin.broadcast.send"), "/"+CommandBroadcastSend),
+		tgbotapi.NewInlineKeyboardButtonData(c.text(subscriber, "button.cancel"), "/"+CommandCancel),
+	))
+	if _, err := c.bot.Send(message); err != nil {
+		err := errors.Wrap(err, "can't send broadcast preview")
+		c.logger.Error(
+			"can't send message with keyboard",
+			zap.Any("message", message),
+			zap.Error(err),
+			errors.ErrorTraceLogField(err),
+		)
+	}
+}
+
+// sendBroadcast queues the confirmed preview for every subscriber. Each chat
+// gets its own delivery item, so a batch never carries a message to all
+// subscribers and a claim outlives no more than one send. The keyboard of the
+// preview is removed first, a second tap on Send then finds nothing to edit
+// and queues nothing.
+func (c *Chat) sendBroadcast(subscriber *model.Subscriber, preview *tgbotapi.Message) {
+	if preview == nil || strings.TrimSpace(preview.Text) == "" {
+		c.reply(subscriber, "admin.broadcast.empty")
+		return
+	}
+
+	removeKeyboard := tgbotapi.NewEditMessageReplyMarkup(subscriber.ChatID, preview.MessageID, tgbotapi.InlineKeyboardMarkup{
+		InlineKeyboard: [][]tgbotapi.InlineKeyboardButton{},
+	})
+	if _, err := c.bot.Request(removeKeyboard); err != nil {
+		if strings.Contains(err.Error(), "message is not modified") {
+			c.reply(subscriber, "admin.broadcast.already_queued")
+			return
+		}
+		err := errors.Wrap(err, "can't remove broadcast keyboard")
+		c.logger.Error(
+			"can't remove broadcast keyboard",
+			zap.Error(err),
+			errors.ErrorTraceLogField(err),
+		)
+		c.reply(subscriber, ChatErrorUnexpected)
+		return
+	}
+
+	recipients, err := c.subscriberStore.FindAll()
+	if err != nil && !errors.Is(err, orm.ErrNotFound) {
+		c.logger.Error(
+			"can't get broadcast recipients",
+			zap.Error(err),
+			errors.ErrorTraceLogField(err),
+		)
+		c.reply(subscriber, ChatErrorUnexpected)
+		return
+	}
+	queuedAt := strconv.FormatInt(time.Now().UnixNano(), 10)
+	items := make([]*model.DeliveryItem, 0, len(recipients))
+	for _, recipient := range recipients {
+		items = append(items, &model.DeliveryItem{
+			Type:      model.DeliveryItemTypeBroadcast,
+			ChatID:    recipient.ChatID,
+			DedupeKey: queuedAt,
+			Text:      preview.Text,
+		})
+	}
+	if err := c.deliveryItemStore.CreateBatch(items); err != nil {
+		c.logger.Error(
+			"can't add broadcast",
+			zap.Int("recipients", len(items)),
+			zap.Error(err),
+			errors.ErrorTraceLogField(err),
+		)
+		c.reply(subscriber, ChatErrorUnexpected)
+		return
+	}
+	c.sendTextMessage(subscriber.ChatID, i18n.N(subscriber.Language, "admin.broadcast.done", len(items)))
+}
+
+func (c *Chat) showUser(subscriber *model.Subscriber, arguments string) {
+	arguments = strings.TrimSpace(arguments)
+	if arguments == "" {
+		c.reply(subscriber, "admin.user.usage", CommandUser)
+		return
+	}
+
+	var user *model.Subscriber
+	var err *errors.Error
+	if userChatID, parseErr := strconv.ParseInt(arguments, 10, 64); parseErr == nil {
+		user, err = c.subscriberStore.FindByChatID(userChatID)
+	} else {
+		user, err = c.subscriberStore.FindByUsername(strings.TrimPrefix(arguments, "@"))
+	}
+	if err != nil {
+		if errors.Is(err, orm.ErrNotFound) {
+			c.reply(subscriber, "admin.user.not_found")
+			return
+		}
+		c.logger.Error(
+			"can't get subscriber",
+			zap.String("user", arguments),
+			zap.Error(err),
+			errors.ErrorTraceLogField(err),
+		)
+		c.reply(subscriber, ChatErrorUnexpected)
+		return
+	}
+
+	subscriptions, err := c.artistSubscriptionStore.FindActiveByChatId(user.ChatID)
+	if err != nil {
+		c.logger.Error(
+			"can't get subscriptions",
+			zap.Int64("chatId", user.ChatID),
+			zap.Error(err),
+			errors.ErrorTraceLogField(err),
+		)
+		c.reply(subscriber, ChatErrorUnexpected)
+		return
+	}
+
+	state := user.State
+	if state == "" {
+		state = "-"
+	}
+	lines := []string{c.text(subscriber, "admin.user.chat", user.ChatID)}
+	if user.Username != "" {
+		lines = append(lines, c.text(subscriber, "admin.user.username", user.Username))
+	}
+	lines = append(lines,
+		c.text(subscriber, "admin.user.registered", user.CreatedAt.UTC().Format("2006-01-02 15:04 MST")),
+		c.text(subscriber, "admin.user.free", user.Subscribed),
+		c.text(subscriber, "admin.user.state", state),
+		c.text(subscriber, "admin.user.artists", len(subscriptions)),
+	)
+	text := strings.Join(lines, "\n")
+	for _, subscription := range subscriptions {
+		text += "\n- " + subscription.FxHashArtistName
+	}
+
+	c.sendTextMessage(subscriber.ChatID, text)
+}
+
+func (c *Chat) pauseCollector(subscriber *model.Subscriber, paused bool) {
+	if err := artcollector.SetPaused(c.settingStore, paused); err != nil {
+		c.logger.Error(
+			"can't change collector state",
+			zap.Bool("paused", paused),
+			zap.Error(err),
+			errors.ErrorTraceLogField(err),
+		)
+		c.reply(subscriber, ChatErrorUnexpected)
+		return
+	}
+
+	if paused {
+		c.reply(subscriber, "admin.collector.paused", CommandResume)
+	} else {
+		c.reply(subscriber, "admin.collector.resumed")
+	}
+}
+
+// previewTemplate renders the template of a kind against a sample token, a
+// template given after the kind is previewed instead of the loaded one
+func (c *Chat) previewTemplate(subscriber *model.Subscriber, arguments string) {
+	arguments = strings.TrimSpace(arguments)
+	name, text := arguments, ""
+	if i := strings.IndexFunc(arguments, unicode.IsSpace); i >= 0 {
+		name, text = arguments[:i], strings.TrimSpace(arguments[i:])
+	}
+	kind, ok := templates.ParseKind(name)
+	if !ok {
+		var usage strings.Builder
+		usage.WriteString(c.text(subscriber, "admin.preview.usage", CommandPreview))
+		for _, kind := range templates.Kinds() {
+			fmt.Fprintf(&usage, "\n- %s (%s)", kind, c.templates.Get(kind).Source())
+		}
+		c.sendTextMessage(subscriber.ChatID, usage.String())
+		return
+	}
+
+	template := c.templates.Get(kind)
+	if text != "" {
+		var err *errors.Error
+		if template, err = templates.Parse(kind, "preview", text); err != nil {
+			c.sendTextMessage(subscriber.ChatID, err.Error())
+			return
+		}
+	}
+	recipient := templates.NewSubscriber(subscriber.ChatID, subscriber, subscriber.Location())
+	message, err := template.Render(templates.Sample(kind, recipient))
+	if err != nil {
+		c.sendTextMessage(subscriber.ChatID, err.Error())
+		return
+	}
+	if err := c.sendRendered(subscriber.ChatID, message); err != nil {
+		c.reply(subscriber, "admin.preview.rejected", err.Error())
+	}
+}
@@ -0,0 +1,148 @@
+package chat
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"strings"
+	"time"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+	"github.com/kranikitao/fxhash-telegram-bot/src/errors"
+	"github.com/kranikitao/fxhash-telegram-bot/src/fxhash"
+	"github.com/kranikitao/fxhash-telegram-bot/src/orm/model"
+	"go.uber.org/zap"
+)
+
+// stateArtistLink waits for the link to the fxhash profile of the artist
+const stateArtistLink = "artist_link"
+
+// actions of CommandArtist callbacks:
+//
+//	/artist verify  looks for the code in the fxhash description
+//	/artist unlink  forgets the account or the pending code
+const (
+	artistVerify = "verify"
+	artistUnlink = "unlink"
+)
+
+// artistCodePrefix makes the code easy to tell apart in a description
+const artistCodePrefix = "fxbot-"
+
+// showArtist shows the linked account, the pending code or asks for the
+// profile link
+func (c *Chat) showArtist(subscriber *model.Subscriber) {
+	if subscriber.IsArtistLinked() {
+		keyboard := tgbotapi.NewInlineKeyboardMarkup(tgbotapi.NewInlineKeyboardRow(
+			tgbotapi.NewInlineKeyboardButtonData(c.text(subscriber, "button.unlink"), "/"+CommandArtist+" "+artistUnlink),
+		))
+		c.sendKeyboard(subscriber.ChatID, c.text(subscriber, "artist.linked", subscriber.ArtistName), keyboard)
+		return
+	}
+	if subscriber.ArtistCode != "" {
+		c.sendArtistCode(subscriber)
+		return
+	}
+
+	if err := c.updateState(subscriber, stateArtistLink); err != nil {
+		c.reply(subscriber, ChatErrorUnexpected)
+		return
+	}
+	c.reply(subscriber, "artist.prompt")
+}
+
+// linkArtist starts linking the fxhash account, it is pending until the code
+// shows up in the account description
+func (c *Chat) linkArtist(subscriber *model.Subscriber, textRecieved string) {
+	fxHashUserName := parseFxHashUserName(textRecieved)
+	if fxHashUserName == "" {
+		c.reply(subscriber, "subscribe.artist.bad_url")
+		return
+	}
+	user, err := c.fxHash.GetFxHashUser(fxHashUserName)
+	if err != nil {
+		if errors.Is(err, fxhash.ErrUserNotFound) {
+			c.reply(subscriber, "subscribe.artist.not_found", fxHashUserName)
+		} else {
+			c.reply(subscriber, ChatErrorUnexpected)
+		}
+		return
+	}
+
+	code := make([]byte, 4)
+	if _, err := rand.Read(code); err != nil {
+		err := errors.Wrap(err, "can't read random artist code")
+		c.logger.Error(
+			"can't generate artist code",
+			zap.Int64("chatId", subscriber.ChatID),
+			zap.Error(err),
+			errors.ErrorTraceLogField(err),
+		)
+		c.reply(subscriber, ChatErrorUnexpected)
+		return
+	}
+	subscriber.State = ""
+	subscriber.ArtistID = user.Id
+	subscriber.ArtistName = user.Name
+	subscriber.ArtistCode = artistCodePrefix + hex.EncodeToString(code)
+	subscriber.ArtistLinkedAt = nil
+	if err := c.updateSubscriber(subscriber); err != nil {
+		return
+	}
+	c.sendArtistCode(subscriber)
+}
+
+func (c *Chat) sendArtistCode(subscriber *model.Subscriber) {
+	keyboard := tgbotapi.NewInlineKeyboardMarkup(tgbotapi.NewInlineKeyboardRow(
+		tgbotapi.NewInlineKeyboardButtonData(c.text(subscriber, "button.verify"), "/"+CommandArtist+" "+artistVerify),
+		tgbotapi.NewInlineKeyboardButtonData(c.text(subscriber, "button.cancel"), "/"+CommandArtist+" "+artistUnlink),
+	))
+	c.sendKeyboard(subscriber.ChatID, c.text(subscriber, "artist.code", subscriber.ArtistName, subscriber.ArtistCode), keyboard)
+}
+
+func (c *Chat) handleArtistCallback(subscriber *model.Subscriber, arguments string) {
+	switch arguments {
+	case artistVerify:
+		c.verifyArtist(subscriber)
+	case artistUnlink:
+		subscriber.ArtistID = ""
+		subscriber.ArtistName = ""
+		subscriber.ArtistCode = ""
+		subscriber.ArtistLinkedAt = nil
+		if err := c.updateSubscriber(subscriber); err == nil {
+			c.reply(subscriber, "artist.unlinked")
+		}
+	}
+}
+
+// verifyArtist links the account when its description contains the code
+func (c *Chat) verifyArtist(subscriber *model.Subscriber) {
+	if subscriber.IsArtistLinked() {
+		c.reply(subscriber, "artist.linked", subscriber.ArtistName)
+		return
+	}
+	if subscriber.ArtistCode == "" {
+		c.showArtist(subscriber)
+		return
+	}
+	user, err := c.fxHash.GetFxHashUser(subscriber.ArtistName)
+	if err != nil {
+		if errors.Is(err, fxhash.ErrUserNotFound) {
+			c.reply(subscriber, "subscribe.artist.not_found", subscriber.ArtistName)
+		} else {
+			c.reply(subscriber, ChatErrorUnexpected)
+		}
+		return
+	}
+	if user.Id != subscriber.ArtistID || !strings.Contains(user.Description, subscriber.ArtistCode) {
+		c.reply(subscriber, "artist.verify.missing", subscriber.ArtistCode)
+		return
+	}
+
+	now := time.Now()
+	subscriber.ArtistCode = ""
+	subscriber.ArtistLinkedAt = &now
+	if err := c.updateSubscriber(subscriber); err != nil {
+		return
+	}
+	c.reply(subscriber, "artist.verify.done", subscriber.ArtistName)
+}
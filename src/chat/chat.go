@@ -1,219 +1,279 @@
 package chat
 
 import (
+	"context"
 	"encoding/json"
-	"fmt"
+	"strconv"
 	"strings"
+	"time"
 
 	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
 	"github.com/kranikitao/fxhash-telegram-bot/src/errors"
 	"github.com/kranikitao/fxhash-telegram-bot/src/fxhash"
+	"github.com/kranikitao/fxhash-telegram-bot/src/i18n"
+	"github.com/kranikitao/fxhash-telegram-bot/src/metrics"
 	"github.com/kranikitao/fxhash-telegram-bot/src/orm"
 	"github.com/kranikitao/fxhash-telegram-bot/src/orm/model"
+	"github.com/kranikitao/fxhash-telegram-bot/src/templates"
 	"go.uber.org/zap"
-	"gorm.io/gorm"
 )
 
 const (
-	ChatErrorUnexpected = "Unexpected error. I am working on it."
+	// ChatErrorUnexpected is the i18n key of the reply to any internal error
+	ChatErrorUnexpected = "error.unexpected"
 )
 
+type Config struct {
+	// AdminChatIDs are the chats allowed to run admin commands
+	AdminChatIDs []int64
+}
+
 type Chat struct {
+	config                  Config
 	bot                     *tgbotapi.BotAPI
-	subscriberStore         *orm.SubscriberStore
+	subscriberStore         orm.SubscriberStore
 	fxHash                  *fxhash.FxHash
 	logger                  *zap.Logger
-	eventStore              *orm.EventStore
-	artistSubscriptionStore *orm.ArtistSubscriptionStore
+	eventStore              orm.EventStore
+	artistSubscriptionStore orm.ArtistSubscriptionStore
+	deliveryItemStore       orm.DeliveryItemStore
+	settingStore            orm.SettingStore
+	walletStore             orm.WalletStore
+	listingWatchStore       orm.ListingWatchStore
+	metrics                 *metrics.Metrics
+	templates               *templates.Set
+	offset                  int
 }
 
-func New(bot *tgbotapi.BotAPI, logger *zap.Logger, gorm *gorm.DB) *Chat {
+func New(bot *tgbotapi.BotAPI, logger *zap.Logger, fxHash *fxhash.FxHash, stores *orm.Stores, metrics *metrics.Metrics, templates *templates.Set, config Config) *Chat {
 	return &Chat{
+		config:                  config,
 		bot:                     bot,
-		fxHash:                  fxhash.New(),
+		fxHash:                  fxHash,
+		metrics:                 metrics,
 		logger:                  logger,
-		eventStore:              orm.GetEventStore(gorm),
-		subscriberStore:         orm.GetSubscriberStore(gorm),
-		artistSubscriptionStore: orm.GetArtistSubscriptionStore(gorm),
+		eventStore:              stores.Events,
+		subscriberStore:         stores.Subscribers,
+		artistSubscriptionStore: stores.ArtistSubscriptions,
+		deliveryItemStore:       stores.DeliveryItems,
+		settingStore:            stores.Settings,
+		walletStore:             stores.Wallets,
+		listingWatchStore:       stores.ListingWatches,
+		templates:               templates,
 	}
 }
 
-func (c *Chat) Start() {
+// pollTimeout is the getUpdates long poll timeout in seconds. A poll can't be
+// canceled, so it bounds how long Start runs once ctx is done.
+const pollTimeout = 5
+
+// Start polls Telegram for updates until ctx is done. Only one replica may
+// poll at a time, otherwise Telegram rejects concurrent getUpdates requests.
+//
+// The offset is kept in the settings before an update is handled, so an
+// update which made the chat panic is not handled again, neither by this
+// replica after a restart nor by the next leader.
+func (c *Chat) Start(ctx context.Context) {
 	updateConfig := tgbotapi.NewUpdate(0)
-	updateConfig.Timeout = 60
-	updates := c.bot.GetUpdatesChan(updateConfig)
-
-	for update := range updates {
-		var currentMessage *tgbotapi.Message
-		isCallbackQuery := false
-		if update.Message != nil {
-			currentMessage = update.Message
-		} else if update.CallbackQuery != nil {
-			isCallbackQuery = true
-			currentMessage = update.CallbackQuery.Message
-		} else {
-			continue
-		}
-		subscriber, err := c.registerSubscriberIfNotExists(currentMessage)
+	updateConfig.Timeout = pollTimeout
+	c.loadOffset()
+
+	for ctx.Err() == nil {
+		updateConfig.Offset = c.offset
+		updates, err := c.bot.GetUpdates(updateConfig)
 		if err != nil {
+			err := errors.Wrap(err, "can't get updates")
 			c.logger.Error(
-				"Can't register subscriber",
-				zap.Any("Chat", update.Message.Chat),
-				zap.Any("From", update.Message.From),
+				"can't get updates",
 				zap.Error(err),
 				errors.ErrorTraceLogField(err),
 			)
-			c.sendTextMessage(currentMessage.Chat.ID, ChatErrorUnexpected)
+			select {
+			case <-ctx.Done():
+			case <-time.After(3 * time.Second):
+			}
 			continue
 		}
 
-		if !isCallbackQuery {
-			c.PushEvent(subscriber.ChatID, "chat", update.Message.Text)
-			if currentMessage.IsCommand() {
-				c.handleCommmands(update.Message.Command(), currentMessage.CommandArguments(), subscriber)
-			} else {
-				if subscriber.State == CommandSubscribeArtist {
-					c.subscribeToArtist(currentMessage.Text, subscriber)
-				}
+		for _, update := range updates {
+			// updates left unhandled are fetched again by the next poller
+			if ctx.Err() != nil {
+				return
 			}
-		} else {
-			c.PushEvent(subscriber.ChatID, "callback", update.CallbackQuery.Data)
-			callback := tgbotapi.NewCallback(update.CallbackQuery.ID, update.CallbackQuery.Data)
-			if _, err := c.bot.Request(callback); err != nil {
-				panic(err)
+			if update.UpdateID >= c.offset {
+				c.offset = update.UpdateID + 1
+				c.saveOffset()
+				c.handleUpdate(update)
 			}
+		}
+	}
+}
 
-			data := update.CallbackQuery.Data
-			command, arguments := c.parseCommandAndArguments(data)
-			switch command {
-			case CommandCancel:
-				if err := c.updateState(subscriber, ""); err != nil {
-					c.sendTextMessage(subscriber.ChatID, ChatErrorUnexpected)
-				} else {
-					deleteRequest := tgbotapi.NewDeleteMessage(subscriber.ChatID, update.CallbackQuery.Message.MessageID)
-					if _, err := c.bot.Request(deleteRequest); err != nil {
-						c.sendTextMessage(subscriber.ChatID, ChatErrorUnexpected)
-					}
-				}
-			case CommandUnsubscribeFree:
-				subscriber.Subscribed = false
-				if err := c.subscriberStore.Update(subscriber); err != nil {
-					c.sendTextMessage(subscriber.ChatID, ChatErrorUnexpected)
-				} else {
-					deleteRequest := tgbotapi.NewDeleteMessage(subscriber.ChatID, update.CallbackQuery.Message.MessageID)
-					if _, err := c.bot.Request(deleteRequest); err != nil {
-						c.sendTextMessage(subscriber.ChatID, ChatErrorUnexpected)
-					} else {
-						c.showUnsubscribeWindow(subscriber)
-					}
-				}
-			case CommandUnsubscribe:
-				if arguments != "" {
-					textToSend := ""
-					artistSubscripton, err := c.artistSubscriptionStore.FindByChatIDAndFxHashArtistName(subscriber.ChatID, arguments)
-					if err != nil {
-						if err.Type == orm.ErrNotFound {
-							textToSend = "Subscription not found."
-						} else {
-							textToSend = ChatErrorUnexpected
-							c.logger.Error(
-								"can't get subscription",
-								zap.Int64("chatId", subscriber.ChatID),
-								zap.String("message", arguments),
-								zap.Error(err),
-								errors.ErrorTraceLogField(err),
-							)
-						}
-					} else {
-						artistSubscripton.IsActive = false
-						if err := c.artistSubscriptionStore.Update(artistSubscripton); err != nil {
-							textToSend = ChatErrorUnexpected
-							c.logger.Error(
-								"can't update subscription",
-								zap.Int64("chatId", subscriber.ChatID),
-								zap.String("message", arguments),
-								zap.Error(err),
-								errors.ErrorTraceLogField(err),
-							)
-						}
-					}
-					if err := c.updateState(subscriber, ""); err != nil {
-						textToSend = ChatErrorUnexpected
-					}
-					if textToSend == "" {
-						deleteRequest := tgbotapi.NewDeleteMessage(subscriber.ChatID, update.CallbackQuery.Message.MessageID)
-						if _, err := c.bot.Request(deleteRequest); err != nil {
-							c.sendTextMessage(subscriber.ChatID, ChatErrorUnexpected)
-						} else {
-							c.showUnsubscribeWindow(subscriber)
-						}
-					} else {
-						message := tgbotapi.NewMessage(subscriber.ChatID, textToSend)
-						message.ReplyMarkup = tgbotapi.NewRemoveKeyboard(true)
-						_, errr := c.bot.Send(message)
-						if errr != nil {
-							errr := errors.Wrap(err, "")
-							c.logger.Error(
-								"can't send message with keyboard",
-								zap.Any("message", message),
-								zap.Error(errr),
-								errors.ErrorTraceLogField(errr),
-							)
-						}
-					}
-				} else {
-					c.showUnsubscribeWindow(subscriber)
-				}
-			}
+// loadOffset takes the offset saved by the previous poller when it is ahead
+// of the one in memory
+func (c *Chat) loadOffset() {
+	value, err := c.settingStore.Get(model.SettingUpdatesOffset)
+	if err != nil {
+		if !errors.Is(err, orm.ErrNotFound) {
+			c.logger.Error("can't get updates offset",
+				zap.Error(err),
+				errors.ErrorTraceLogField(err),
+			)
 		}
+		return
+	}
+	offset, parseErr := strconv.Atoi(value)
+	if parseErr != nil {
+		err := errors.Wrap(parseErr, "can't parse updates offset").With("offset", value)
+		c.logger.Error("can't get updates offset",
+			zap.Error(err),
+			errors.ErrorTraceLogField(err),
+		)
+		return
+	}
+	if offset > c.offset {
+		c.offset = offset
 	}
 }
 
-func (c *Chat) showUnsubscribeWindow(subscriber *model.Subscriber) {
-	subscribtions, err := c.artistSubscriptionStore.FindActiveByChatId(subscriber.ChatID)
+// saveOffset keeps the offset for the next poller, the update is handled
+// anyway when it can't be saved
+func (c *Chat) saveOffset() {
+	if err := c.settingStore.Set(model.SettingUpdatesOffset, strconv.Itoa(c.offset)); err != nil {
+		c.logger.Error("can't save updates offset",
+			zap.Int("offset", c.offset),
+			zap.Error(err),
+			errors.ErrorTraceLogField(err),
+		)
+	}
+}
+
+func (c *Chat) handleUpdate(update tgbotapi.Update) {
+	var currentMessage *tgbotapi.Message
+	isCallbackQuery := false
+	if update.Message != nil {
+		currentMessage = update.Message
+	} else if update.CallbackQuery != nil {
+		isCallbackQuery = true
+		currentMessage = update.CallbackQuery.Message
+	} else {
+		return
+	}
+	subscriber, err := c.registerSubscriberIfNotExists(currentMessage)
 	if err != nil {
 		c.logger.Error(
-			"can't get subscriptions",
-			zap.Int64("chatId", subscriber.ChatID),
+			"Can't register subscriber",
+			zap.Any("Chat", currentMessage.Chat),
+			zap.Any("From", currentMessage.From),
 			zap.Error(err),
 			errors.ErrorTraceLogField(err),
 		)
-		c.sendTextMessage(subscriber.ChatID, ChatErrorUnexpected)
-	}
-	if len(subscribtions) > 0 || subscriber.Subscribed {
-		var buttons [][]tgbotapi.InlineKeyboardButton
-		for _, subscription := range subscribtions {
-			buttons = append(buttons, tgbotapi.NewInlineKeyboardRow(
-				tgbotapi.NewInlineKeyboardButtonData(
-					subscription.FxHashArtistName,
-					"/"+CommandUnsubscribe+" "+subscription.FxHashArtistName,
-				)),
-			)
+		language := ""
+		if currentMessage.From != nil {
+			language = currentMessage.From.LanguageCode
 		}
-		if subscriber.Subscribed {
-			buttons = append(buttons, tgbotapi.NewInlineKeyboardRow(
-				tgbotapi.NewInlineKeyboardButtonData(
-					"Unsubscribe free generatives",
-					"/"+CommandUnsubscribeFree,
-				)),
-			)
+		c.sendTextMessage(currentMessage.Chat.ID, i18n.T(language, ChatErrorUnexpected))
+		return
+	}
+
+	if !isCallbackQuery {
+		c.PushEvent(subscriber.ChatID, "chat", update.Message.Text)
+		if currentMessage.IsCommand() {
+			c.metrics.UpdatesProcessed.WithLabelValues(commandLabel(update.Message.Command())).Inc()
+			if adminCommands[update.Message.Command()] && c.isAdmin(subscriber.ChatID) {
+				c.handleAdminCommands(update.Message.Command(), currentMessage.CommandArguments(), subscriber)
+			} else {
+				c.handleCommmands(update.Message.Command(), currentMessage.CommandArguments(), subscriber)
+			}
+		} else {
+			c.metrics.UpdatesProcessed.WithLabelValues("text").Inc()
+			switch {
+			case currentMessage.Location != nil:
+				c.setTimezoneFromLocation(subscriber, currentMessage.Location)
+			case subscriber.State == CommandSubscribeArtist:
+				c.subscribeToArtist(currentMessage.Text, subscriber)
+			case subscriber.State == CommandFollowCollector:
+				c.followCollector(currentMessage.Text, subscriber)
+			case subscriber.State == stateSettingsTimezone:
+				c.setTimezone(subscriber, currentMessage.Text)
+			case subscriber.State == stateSettingsQuietHours:
+				c.setQuietHours(subscriber, currentMessage.Text)
+			case subscriber.State == stateSubscriptionsSearch:
+				c.searchSubscriptions(subscriber, currentMessage.Text)
+			case strings.HasPrefix(subscriber.State, stateMuteDate+" "):
+				c.setMuteDate(subscriber, currentMessage.Text)
+			case subscriber.State == stateArtistLink:
+				c.linkArtist(subscriber, currentMessage.Text)
+			case subscriber.State == stateWalletLink:
+				c.linkWallet(subscriber, currentMessage.Text)
+			case subscriber.State == stateWatchTarget:
+				c.setWatchTarget(subscriber, currentMessage.Text)
+			case strings.HasPrefix(subscriber.State, stateWatchThreshold+" "):
+				c.setWatchThreshold(subscriber, currentMessage.Text)
+			}
 		}
-		buttons = append(buttons, tgbotapi.NewInlineKeyboardRow(tgbotapi.NewInlineKeyboardButtonData("Cancel", "/"+CommandCancel)))
-		var keyboard = tgbotapi.NewInlineKeyboardMarkup(buttons...)
-		message := tgbotapi.NewMessage(subscriber.ChatID, "Select the artist you want to unsubscribe")
-		message.ReplyMarkup = keyboard
-		_, errr := c.bot.Send(message)
-		if errr != nil {
-			errr := errors.Wrap(errr, "")
+	} else {
+		c.PushEvent(subscriber.ChatID, "callback", update.CallbackQuery.Data)
+		callback := tgbotapi.NewCallback(update.CallbackQuery.ID, update.CallbackQuery.Data)
+		if _, err := c.bot.Request(callback); err != nil {
+			err := errors.Wrap(err, "can't answer callback query")
 			c.logger.Error(
-				"can't send message with keyboard",
-				zap.Any("message", message),
-				zap.Error(errr),
-				errors.ErrorTraceLogField(errr),
+				"can't answer callback query",
+				zap.String("data", update.CallbackQuery.Data),
+				zap.Error(err),
+				errors.ErrorTraceLogField(err),
 			)
 		}
-	} else {
-		c.sendTextMessage(subscriber.ChatID, "There are no subscriptions.")
+
+		data := update.CallbackQuery.Data
+		command, arguments := c.parseCommandAndArguments(data)
+		c.metrics.UpdatesProcessed.WithLabelValues("callback_" + commandLabel(command)).Inc()
+		switch command {
+		case CommandBroadcastSend:
+			if c.isAdmin(subscriber.ChatID) {
+				c.sendBroadcast(subscriber, update.CallbackQuery.Message)
+			}
+		case CommandSettings:
+			c.handleSettingsCallback(subscriber, arguments, update.CallbackQuery.Message)
+		case CommandLanguage:
+			c.setLanguage(subscriber, arguments)
+		case CommandCancel:
+			if err := c.updateState(subscriber, ""); err != nil {
+				c.reply(subscriber, ChatErrorUnexpected)
+			} else {
+				deleteRequest := tgbotapi.NewDeleteMessage(subscriber.ChatID, update.CallbackQuery.Message.MessageID)
+				if _, err := c.bot.Request(deleteRequest); err != nil {
+					c.reply(subscriber, ChatErrorUnexpected)
+				}
+			}
+		case CommandUnsubscribeFree:
+			subscriber.Subscribed = false
+			if err := c.updateSubscriber(subscriber); err == nil {
+				c.editSubscriptions(subscriber, &subscriptionsView{}, update.CallbackQuery.Message)
+			}
+		case CommandUnsubscribe:
+			if arguments != "" {
+				c.unsubscribeByName(subscriber, arguments, update.CallbackQuery.Message)
+			} else {
+				c.showSubscriptions(subscriber, "")
+			}
+		case CommandSubscriptions:
+			c.handleSubscriptionsCallback(subscriber, arguments, update.CallbackQuery.Message)
+		case CommandMute:
+			c.handleMuteCallback(subscriber, arguments, update.CallbackQuery.Message)
+		case CommandFollowCollector:
+			c.handleFollowCollectorCallback(subscriber, arguments, update.CallbackQuery.Message)
+		case CommandArtist:
+			c.handleArtistCallback(subscriber, arguments)
+		case CommandLinkWallet:
+			c.startWalletLink(subscriber)
+		case CommandWallets:
+			c.handleWalletsCallback(subscriber, arguments, update.CallbackQuery.Message)
+		case CommandWatch:
+			c.startWatch(subscriber)
+		case CommandWatches:
+			c.handleWatchesCallback(subscriber, arguments, update.CallbackQuery.Message)
+		}
 	}
 }
 
@@ -235,6 +295,21 @@ func (*Chat) parseCommandAndArguments(data string) (string, string) {
 }
 
 func (c *Chat) subscribeToArtist(textRecieved string, subscriber *model.Subscriber) {
+	fxHashUserName := parseFxHashUserName(textRecieved)
+	if fxHashUserName == "" {
+		c.reply(subscriber, "subscribe.artist.bad_url")
+		return
+	}
+
+	if _, ok := c.subscribeToUser(subscriber, model.SubscriptionKindArtist, fxHashUserName); !ok {
+		return
+	}
+
+	c.reply(subscriber, "subscribe.artist.done", fxHashUserName)
+}
+
+// parseFxHashUserName returns the user name of an fxhash profile link
+func parseFxHashUserName(textRecieved string) string {
 	textRecieved = strings.ReplaceAll(textRecieved, "%20", " ")
 	splitedUrl := strings.Split(textRecieved, "/")
 	found := false
@@ -247,25 +322,29 @@ func (c *Chat) subscribeToArtist(textRecieved string, subscriber *model.Subscrib
 			found = true
 		}
 	}
-	if fxHashUserName == "" {
-		c.sendTextMessage(subscriber.ChatID, "Unrecognized url, please try again.")
-	}
 
+	return fxHashUserName
+}
+
+// subscribeToUser creates or activates the subscription of the kind to the
+// fxhash user and resets the state, it replies itself on failure
+func (c *Chat) subscribeToUser(subscriber *model.Subscriber, kind string, fxHashUserName string) (*model.ArtistSubscribtion, bool) {
 	user, err := c.fxHash.GetFxHashUser(fxHashUserName)
 	if err != nil {
-		if err.Type == fxhash.ErrTypeUserNotFound {
-			c.sendTextMessage(subscriber.ChatID, fmt.Sprintf("FxHash user %s not found.", fxHashUserName))
+		if errors.Is(err, fxhash.ErrUserNotFound) {
+			c.reply(subscriber, "subscribe.artist.not_found", fxHashUserName)
 		} else {
-			c.sendTextMessage(subscriber.ChatID, ChatErrorUnexpected)
+			c.reply(subscriber, ChatErrorUnexpected)
 		}
-		return
+		return nil, false
 	}
 
-	subscription, err := c.artistSubscriptionStore.FindByChatIDAndFxHashArtistName(subscriber.ChatID, user.Name)
+	subscription, err := c.artistSubscriptionStore.FindByChatIDAndKindAndFxHashArtistName(subscriber.ChatID, kind, user.Name)
 	if err != nil {
-		if err.Type == orm.ErrNotFound {
+		if errors.Is(err, orm.ErrNotFound) {
 			subscription = &model.ArtistSubscribtion{
 				ChatID:           subscriber.ChatID,
+				Kind:             kind,
 				FxHashArtistName: user.Name,
 				FxHashArtistID:   user.Id,
 				IsActive:         true,
@@ -277,7 +356,8 @@ func (c *Chat) subscribeToArtist(textRecieved string, subscriber *model.Subscrib
 					zap.Error(err),
 					errors.ErrorTraceLogField(err),
 				)
-				c.sendTextMessage(subscriber.ChatID, ChatErrorUnexpected)
+				c.reply(subscriber, ChatErrorUnexpected)
+				return nil, false
 			}
 		} else {
 			c.logger.Error(
@@ -286,8 +366,8 @@ func (c *Chat) subscribeToArtist(textRecieved string, subscriber *model.Subscrib
 				zap.Error(err),
 				errors.ErrorTraceLogField(err),
 			)
-			c.sendTextMessage(subscriber.ChatID, ChatErrorUnexpected)
-			return
+			c.reply(subscriber, ChatErrorUnexpected)
+			return nil, false
 		}
 	} else {
 		subscription.IsActive = true
@@ -298,15 +378,16 @@ func (c *Chat) subscribeToArtist(textRecieved string, subscriber *model.Subscrib
 				zap.Error(err),
 				errors.ErrorTraceLogField(err),
 			)
-			c.sendTextMessage(subscriber.ChatID, ChatErrorUnexpected)
+			c.reply(subscriber, ChatErrorUnexpected)
+			return nil, false
 		}
 	}
 
 	if err := c.updateState(subscriber, ""); err != nil {
-		c.sendTextMessage(subscriber.ChatID, ChatErrorUnexpected)
+		c.reply(subscriber, ChatErrorUnexpected)
 	}
 
-	c.sendTextMessage(subscriber.ChatID, fmt.Sprintf("You was subscribed to %s.", fxHashUserName))
+	return subscription, true
 }
 
 func (c *Chat) updateState(subscriber *model.Subscriber, state string) *errors.Error {
@@ -327,27 +408,51 @@ func (c *Chat) updateState(subscriber *model.Subscriber, state string) *errors.E
 func (c *Chat) handleCommmands(command string, arguments string, subscriber *model.Subscriber) {
 	switch command {
 	case CommandStart:
-		c.answerStart(subscriber.ChatID, subscriber.Username)
+		c.answerStart(subscriber)
 	case CommandSubscribeFree:
 		subscriber.Subscribed = true
 		if err := c.subscriberStore.Update(subscriber); err != nil {
-			c.sendTextMessage(subscriber.ChatID, ChatErrorUnexpected)
+			c.reply(subscriber, ChatErrorUnexpected)
 		} else {
-			c.sendTextMessage(subscriber.ChatID, "You was subscribed to zero cost minting generatives")
+			c.reply(subscriber, "subscribe.free.done")
 		}
-	case CommandUnsubscribe:
-		c.showUnsubscribeWindow(subscriber)
+	case CommandUnsubscribe, CommandMute:
+		c.showSubscriptions(subscriber, arguments)
 	case CommandSubscribeArtist:
 		if err := c.updateState(subscriber, CommandSubscribeArtist); err != nil {
-			c.sendTextMessage(subscriber.ChatID, ChatErrorUnexpected)
+			c.reply(subscriber, ChatErrorUnexpected)
+		} else {
+			c.reply(subscriber, "subscribe.artist.prompt")
+		}
+	case CommandFollowCollector:
+		if err := c.updateState(subscriber, CommandFollowCollector); err != nil {
+			c.reply(subscriber, ChatErrorUnexpected)
 		} else {
-			c.sendTextMessage(subscriber.ChatID, "Type link to artist on fx hash \n(ex: https://www.fxhash.xyz/u/kranikitao)")
+			c.reply(subscriber, "follow.collector.prompt")
+		}
+	case CommandArtist:
+		c.showArtist(subscriber)
+	case CommandLinkWallet:
+		c.startWalletLink(subscriber)
+	case CommandWallets:
+		c.showWallets(subscriber)
+	case CommandWatch:
+		c.startWatch(subscriber)
+	case CommandWatches:
+		c.showWatches(subscriber)
+	case CommandSettings:
+		c.showSettings(subscriber)
+	case CommandLanguage:
+		if arguments != "" {
+			c.setLanguage(subscriber, arguments)
+		} else {
+			c.showLanguages(subscriber)
 		}
 	case CommandCancel:
 		if err := c.updateState(subscriber, ""); err != nil {
-			c.sendTextMessage(subscriber.ChatID, ChatErrorUnexpected)
+			c.reply(subscriber, ChatErrorUnexpected)
 		} else {
-			c.sendTextMessage(subscriber.ChatID, "Operation was canceled")
+			c.reply(subscriber, "cancel.done")
 		}
 	default:
 	}
@@ -356,7 +461,7 @@ func (c *Chat) handleCommmands(command string, arguments string, subscriber *mod
 func (c *Chat) registerSubscriberIfNotExists(message *tgbotapi.Message) (*model.Subscriber, *errors.Error) {
 	subscriber, err := c.subscriberStore.FindByChatID(message.Chat.ID)
 	if err != nil {
-		if err.Type == orm.ErrNotFound {
+		if errors.Is(err, orm.ErrNotFound) {
 			buf, err := json.Marshal(message.From)
 			rawUser := ""
 			if err != nil {
@@ -375,6 +480,7 @@ func (c *Chat) registerSubscriberIfNotExists(message *tgbotapi.Message) (*model.
 				Subscribed: false,
 				RawUser:    rawUser,
 				State:      "",
+				Language:   i18n.Match(message.From.LanguageCode),
 			}
 
 			if err := c.subscriberStore.Create(subscriber); err != nil {
@@ -388,25 +494,37 @@ func (c *Chat) registerSubscriberIfNotExists(message *tgbotapi.Message) (*model.
 	return subscriber, nil
 }
 
-func (c *Chat) answerStart(chatId int64, firstName string) *errors.Error {
-	welcomeText := "Hello, " + firstName + "!\n" +
+func (c *Chat) answerStart(subscriber *model.Subscriber) *errors.Error {
+	data := &templates.Data{Subscriber: templates.NewSubscriber(subscriber.ChatID, subscriber, subscriber.Location())}
+	message, err := c.templates.Render(templates.KindWelcome, data)
+	if err != nil {
+		c.logger.Error(
+			"can't render welcome message",
+			zap.Int64("chatID", subscriber.ChatID),
+			zap.Error(err),
+			errors.ErrorTraceLogField(err),
+		)
+		return c.reply(subscriber, ChatErrorUnexpected)
+	}
 
-		"I can help you to be first minter on fxhash.xyz.\n" +
-		"So, first of all you should subscribe. \n\n" +
-		"There are two types of subscription:\n" +
-		"/subscribeartist - subscription to new generatives of your favorite artist\n" +
-		"/subscribefree - subscription to zero cost minting generatives\n\n" +
-		"Type /unsubscribe to manage subscriptions:\n\n" +
-		"Author @kranikitao\n"
+	return c.sendRendered(subscriber.ChatID, message)
+}
 
-	return c.sendTextMessage(chatId, welcomeText)
+// text translates the i18n key to the language of the subscriber
+func (c *Chat) text(subscriber *model.Subscriber, key string, args ...interface{}) string {
+	return i18n.T(subscriber.Language, key, args...)
+}
+
+// reply sends the text of the i18n key to the subscriber
+func (c *Chat) reply(subscriber *model.Subscriber, key string, args ...interface{}) *errors.Error {
+	return c.sendTextMessage(subscriber.ChatID, c.text(subscriber, key, args...))
 }
 
 func (c *Chat) sendTextMessage(chatId int64, text string) *errors.Error {
 	message := tgbotapi.NewMessage(chatId, text)
 	_, err := c.bot.Send(message)
 	if err != nil {
-		err := errors.Wrap(err, "")
+		err := errors.Wrap(err, "can't send message")
 		c.logger.Error(
 			"can't send message",
 			zap.Int64("ChatId", chatId),
@@ -420,6 +538,25 @@ func (c *Chat) sendTextMessage(chatId int64, text string) *errors.Error {
 	return nil
 }
 
+// sendRendered sends a message rendered from a template with its parse mode
+func (c *Chat) sendRendered(chatID int64, rendered *templates.Message) *errors.Error {
+	message := tgbotapi.NewMessage(chatID, rendered.Text)
+	message.ParseMode = rendered.ParseMode
+	if _, err := c.bot.Send(message); err != nil {
+		err := errors.Wrap(err, "can't send message")
+		c.logger.Error(
+			"can't send message",
+			zap.Int64("ChatId", chatID),
+			zap.String("text", rendered.Text),
+			zap.Error(err),
+			errors.ErrorTraceLogField(err),
+		)
+		return err
+	}
+
+	return nil
+}
+
 func (c *Chat) PushEvent(chatId int64, eventCode string, eventData string) {
 	if err := c.eventStore.Push(chatId, eventCode, eventData); err != nil {
 		c.logger.Error("can't push event",
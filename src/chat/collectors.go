@@ -0,0 +1,79 @@
+package chat
+
+import (
+	"strconv"
+	"strings"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+	"github.com/kranikitao/fxhash-telegram-bot/src/errors"
+	"github.com/kranikitao/fxhash-telegram-bot/src/orm"
+	"github.com/kranikitao/fxhash-telegram-bot/src/orm/model"
+	"go.uber.org/zap"
+)
+
+// followCollectorFirstTouch toggles the first touch only mode of a followed
+// collector:
+//
+//	/followcollector first <id>
+const followCollectorFirstTouch = "first"
+
+func (c *Chat) followCollector(textRecieved string, subscriber *model.Subscriber) {
+	fxHashUserName := parseFxHashUserName(textRecieved)
+	if fxHashUserName == "" {
+		c.reply(subscriber, "subscribe.artist.bad_url")
+		return
+	}
+
+	subscription, ok := c.subscribeToUser(subscriber, model.SubscriptionKindCollector, fxHashUserName)
+	if !ok {
+		return
+	}
+
+	c.sendKeyboard(subscriber.ChatID, c.text(subscriber, "follow.collector.done", subscription.FxHashArtistName), c.firstTouchKeyboard(subscriber, subscription))
+}
+
+func (c *Chat) handleFollowCollectorCallback(subscriber *model.Subscriber, arguments string, message *tgbotapi.Message) {
+	action, value, _ := strings.Cut(arguments, " ")
+	if action != followCollectorFirstTouch {
+		return
+	}
+	id, err := strconv.ParseUint(value, 10, 64)
+	if err != nil {
+		return
+	}
+	subscription, findErr := c.artistSubscriptionStore.FindByID(id)
+	if findErr != nil || subscription.ChatID != subscriber.ChatID || !subscription.IsCollector() {
+		if findErr != nil && !errors.Is(findErr, orm.ErrNotFound) {
+			c.subscriptionsError(subscriber, "can't get subscription", findErr)
+			return
+		}
+		c.reply(subscriber, "subscriptions.not_found")
+		return
+	}
+
+	subscription.FirstTouchOnly = !subscription.FirstTouchOnly
+	if err := c.artistSubscriptionStore.Update(subscription); err != nil {
+		c.subscriptionsError(subscriber, "can't update subscription", err)
+		return
+	}
+	if message == nil {
+		return
+	}
+	edit := tgbotapi.NewEditMessageReplyMarkup(subscriber.ChatID, message.MessageID, c.firstTouchKeyboard(subscriber, subscription))
+	if _, err := c.bot.Request(edit); err != nil && !strings.Contains(err.Error(), "message is not modified") {
+		err := errors.Wrap(err, "can't edit collector keyboard")
+		c.logger.Error(
+			"can't update collector keyboard",
+			zap.Int64("chatId", subscriber.ChatID),
+			zap.Error(err),
+			errors.ErrorTraceLogField(err),
+		)
+	}
+}
+
+func (c *Chat) firstTouchKeyboard(subscriber *model.Subscriber, subscription *model.ArtistSubscribtion) tgbotapi.InlineKeyboardMarkup {
+	data := "/" + CommandFollowCollector + " " + followCollectorFirstTouch + " " + strconv.FormatUint(subscription.ID, 10)
+	label := toggleLabel(subscription.FirstTouchOnly, false, c.text(subscriber, "follow.collector.first_touch"))
+
+	return tgbotapi.NewInlineKeyboardMarkup(tgbotapi.NewInlineKeyboardRow(tgbotapi.NewInlineKeyboardButtonData(label, data)))
+}
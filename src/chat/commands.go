@@ -8,4 +8,70 @@ const (
 	CommandUnsubscribeFree = "unsubscribefree"
 	CommandCancel          = "cancel"
 	CommandStatus          = "status"
+	CommandSettings        = "settings"
+	CommandLanguage        = "language"
+	CommandMute            = "mute"
+	CommandFollowCollector = "followcollector"
+	CommandArtist          = "artist"
+	CommandLinkWallet      = "linkwallet"
+	CommandWallets         = "wallets"
+	CommandWatch           = "watch"
+	CommandWatches         = "watches"
+	// CommandSubscriptions only comes from buttons of the subscriptions keyboard
+	CommandSubscriptions = "subscriptions"
+
+	CommandStats         = "stats"
+	CommandBroadcast     = "broadcast"
+	CommandBroadcastSend = "broadcastsend"
+	CommandUser          = "user"
+	CommandPause         = "pause"
+	CommandResume        = "resume"
+	CommandPreview       = "preview"
 )
+
+var commands = map[string]bool{
+	CommandStart:           true,
+	CommandSubscribeArtist: true,
+	CommandSubscribeFree:   true,
+	CommandUnsubscribe:     true,
+	CommandUnsubscribeFree: true,
+	CommandCancel:          true,
+	CommandStatus:          true,
+	CommandSettings:        true,
+	CommandLanguage:        true,
+	CommandMute:            true,
+	CommandFollowCollector: true,
+	CommandArtist:          true,
+	CommandLinkWallet:      true,
+	CommandWallets:         true,
+	CommandWatch:           true,
+	CommandWatches:         true,
+	CommandSubscriptions:   true,
+	CommandStats:           true,
+	CommandBroadcast:       true,
+	CommandBroadcastSend:   true,
+	CommandUser:            true,
+	CommandPause:           true,
+	CommandResume:          true,
+	CommandPreview:         true,
+}
+
+// adminCommands are only handled in chats listed in Config.AdminChatIDs
+var adminCommands = map[string]bool{
+	CommandStats:         true,
+	CommandBroadcast:     true,
+	CommandBroadcastSend: true,
+	CommandUser:          true,
+	CommandPause:         true,
+	CommandResume:        true,
+	CommandPreview:       true,
+}
+
+// commandLabel keeps metric labels bounded to known commands
+func commandLabel(command string) string {
+	if commands[command] {
+		return command
+	}
+
+	return "unknown"
+}
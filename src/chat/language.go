@@ -0,0 +1,32 @@
+package chat
+
+import (
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+	"github.com/kranikitao/fxhash-telegram-bot/src/i18n"
+	"github.com/kranikitao/fxhash-telegram-bot/src/orm/model"
+)
+
+func (c *Chat) showLanguages(subscriber *model.Subscriber) {
+	var buttons [][]tgbotapi.InlineKeyboardButton
+	for _, language := range i18n.Languages() {
+		buttons = append(buttons, tgbotapi.NewInlineKeyboardRow(tgbotapi.NewInlineKeyboardButtonData(
+			i18n.T(language, "language.name"),
+			"/"+CommandLanguage+" "+language,
+		)))
+	}
+	buttons = append(buttons, tgbotapi.NewInlineKeyboardRow(tgbotapi.NewInlineKeyboardButtonData(c.text(subscriber, "button.cancel"), "/"+CommandCancel)))
+	c.sendKeyboard(subscriber.ChatID, c.text(subscriber, "language.select"), tgbotapi.NewInlineKeyboardMarkup(buttons...))
+}
+
+func (c *Chat) setLanguage(subscriber *model.Subscriber, language string) {
+	if i18n.Match(language) != language {
+		c.showLanguages(subscriber)
+		return
+	}
+
+	subscriber.Language = language
+	if err := c.updateSubscriber(subscriber); err != nil {
+		return
+	}
+	c.reply(subscriber, "language.done", i18n.T(language, "language.name"))
+}
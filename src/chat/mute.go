@@ -0,0 +1,242 @@
+package chat
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+	"github.com/kranikitao/fxhash-telegram-bot/src/errors"
+	"github.com/kranikitao/fxhash-telegram-bot/src/orm"
+	"github.com/kranikitao/fxhash-telegram-bot/src/orm/model"
+	"github.com/kranikitao/fxhash-telegram-bot/src/templates"
+	"go.uber.org/zap"
+)
+
+// stateMuteDate waits for the date to mute the target until, the target
+// follows the state like "mute_date a 12"
+const stateMuteDate = "mute_date"
+
+// targets of CommandMute callbacks, the free feed has id 0
+const (
+	muteArtist = "a"
+	muteFree   = "f"
+)
+
+// actions of CommandMute callbacks, the page and the search prefix bring the
+// subscriptions keyboard back:
+//
+//	/mute <action> <target> <id> <page> [prefix]
+const (
+	muteOptions = "o"
+	muteDate    = "date"
+	muteOff     = "off"
+)
+
+// muteDurations are offered in this order
+var muteDurations = []struct {
+	action   string
+	key      string
+	duration time.Duration
+}{
+	{"1h", "mute.button.hour", time.Hour},
+	{"24h", "mute.button.day", 24 * time.Hour},
+	{"7d", "mute.button.week", 7 * 24 * time.Hour},
+}
+
+var muteDateLayouts = []string{"2006-01-02 15:04", "2006-01-02"}
+
+// muteTarget is an artist subscription or the free feed of the subscriber
+type muteTarget struct {
+	kind         string
+	subscription *model.ArtistSubscribtion
+}
+
+func (c *Chat) handleMuteCallback(subscriber *model.Subscriber, arguments string, message *tgbotapi.Message) {
+	parts := strings.SplitN(arguments, " ", 5)
+	if len(parts) < 4 {
+		return
+	}
+	action := parts[0]
+	page, err := strconv.Atoi(parts[3])
+	if err != nil {
+		return
+	}
+	view := &subscriptionsView{page: page}
+	if len(parts) == 5 {
+		view.prefix = parts[4]
+	}
+	target, ok := c.findMuteTarget(subscriber, parts[1], parts[2])
+	if !ok {
+		return
+	}
+
+	switch action {
+	case muteOptions:
+		c.showMuteOptions(subscriber, target, view, message)
+		return
+	case muteDate:
+		if err := c.updateState(subscriber, strings.Join([]string{stateMuteDate, parts[1], parts[2]}, " ")); err != nil {
+			c.reply(subscriber, ChatErrorUnexpected)
+			return
+		}
+		example := time.Now().In(subscriber.Location()).AddDate(0, 0, 7).Format(muteDateLayouts[1])
+		c.reply(subscriber, "mute.date.prompt", example, timezoneName(subscriber))
+		return
+	case muteOff:
+		if !c.mute(subscriber, target, nil) {
+			return
+		}
+	default:
+		duration, ok := muteDuration(action)
+		if !ok {
+			return
+		}
+		until := time.Now().Add(duration)
+		if !c.mute(subscriber, target, &until) {
+			return
+		}
+	}
+	c.editSubscriptions(subscriber, view, message)
+}
+
+// setMuteDate mutes the target of the state until the typed date
+func (c *Chat) setMuteDate(subscriber *model.Subscriber, text string) {
+	parts := strings.Fields(subscriber.State)
+	if len(parts) != 3 {
+		c.updateState(subscriber, "")
+		return
+	}
+	var until time.Time
+	var err error
+	for _, layout := range muteDateLayouts {
+		if until, err = time.ParseInLocation(layout, strings.TrimSpace(text), subscriber.Location()); err == nil {
+			break
+		}
+	}
+	if err != nil {
+		c.reply(subscriber, "mute.date.bad", time.Now().In(subscriber.Location()).AddDate(0, 0, 7).Format(muteDateLayouts[1]))
+		return
+	}
+	if !until.After(time.Now()) {
+		c.reply(subscriber, "mute.date.past")
+		return
+	}
+
+	target, ok := c.findMuteTarget(subscriber, parts[1], parts[2])
+	if !ok {
+		c.updateState(subscriber, "")
+		return
+	}
+	if err := c.updateState(subscriber, ""); err != nil {
+		c.reply(subscriber, ChatErrorUnexpected)
+		return
+	}
+	if c.mute(subscriber, target, &until) {
+		c.reply(subscriber, "mute.done", until.Format(templates.TimeLayout))
+	}
+}
+
+func (c *Chat) showMuteOptions(subscriber *model.Subscriber, target *muteTarget, view *subscriptionsView, message *tgbotapi.Message) {
+	id := uint64(0)
+	text := c.text(subscriber, "mute.select.free")
+	mutedUntil := subscriber.FreeMutedUntil
+	if target.subscription != nil {
+		id = target.subscription.ID
+		text = c.text(subscriber, "mute.select.artist", target.subscription.FxHashArtistName)
+		mutedUntil = target.subscription.MutedUntil
+	}
+	muted := mutedUntil != nil && mutedUntil.After(time.Now())
+	if muted {
+		text += "\n" + c.text(subscriber, "mute.until", mutedUntil.In(subscriber.Location()).Format(templates.TimeLayout))
+	}
+
+	button := func(key string, action string) tgbotapi.InlineKeyboardButton {
+		data := fmt.Sprintf("/%s %s %s %d %d", CommandMute, action, target.kind, id, view.page)
+		if view.prefix != "" {
+			data += " " + view.prefix
+		}
+		return tgbotapi.NewInlineKeyboardButtonData(c.text(subscriber, key), data)
+	}
+	var row []tgbotapi.InlineKeyboardButton
+	for _, duration := range muteDurations {
+		row = append(row, button(duration.key, duration.action))
+	}
+	buttons := [][]tgbotapi.InlineKeyboardButton{row, {button("mute.button.date", muteDate)}}
+	if muted {
+		buttons = append(buttons, []tgbotapi.InlineKeyboardButton{button("mute.button.off", muteOff)})
+	}
+	back := "/" + CommandSubscriptions + " " + subscriptionsPage + " " + strconv.Itoa(view.page)
+	if view.prefix != "" {
+		back += " " + view.prefix
+	}
+	buttons = append(buttons, []tgbotapi.InlineKeyboardButton{tgbotapi.NewInlineKeyboardButtonData(c.text(subscriber, "button.back"), back)})
+	keyboard := tgbotapi.NewInlineKeyboardMarkup(buttons...)
+
+	if message == nil {
+		c.sendKeyboard(subscriber.ChatID, text, keyboard)
+		return
+	}
+	edit := tgbotapi.NewEditMessageTextAndMarkup(subscriber.ChatID, message.MessageID, text, keyboard)
+	if _, err := c.bot.Request(edit); err != nil && !strings.Contains(err.Error(), "message is not modified") {
+		err := errors.Wrap(err, "can't edit mute options message")
+		c.logger.Error(
+			"can't show mute options",
+			zap.Int64("chatId", subscriber.ChatID),
+			zap.Error(err),
+			errors.ErrorTraceLogField(err),
+		)
+	}
+}
+
+// findMuteTarget returns the target of callback data, it must belong to the chat
+func (c *Chat) findMuteTarget(subscriber *model.Subscriber, kind string, value string) (*muteTarget, bool) {
+	switch kind {
+	case muteFree:
+		return &muteTarget{kind: muteFree}, true
+	case muteArtist:
+		id, err := strconv.ParseUint(value, 10, 64)
+		if err != nil {
+			return nil, false
+		}
+		subscription, findErr := c.artistSubscriptionStore.FindByID(id)
+		if findErr != nil || subscription.ChatID != subscriber.ChatID {
+			if findErr != nil && !errors.Is(findErr, orm.ErrNotFound) {
+				c.subscriptionsError(subscriber, "can't get subscription", findErr)
+				return nil, false
+			}
+			c.reply(subscriber, "subscriptions.not_found")
+			return nil, false
+		}
+		return &muteTarget{kind: muteArtist, subscription: subscription}, true
+	}
+
+	return nil, false
+}
+
+// mute snoozes the target until the time, nil unmutes it
+func (c *Chat) mute(subscriber *model.Subscriber, target *muteTarget, until *time.Time) bool {
+	if target.subscription == nil {
+		subscriber.FreeMutedUntil = until
+		return c.updateSubscriber(subscriber) == nil
+	}
+
+	target.subscription.MutedUntil = until
+	if err := c.artistSubscriptionStore.Update(target.subscription); err != nil {
+		c.subscriptionsError(subscriber, "can't update subscription", err)
+		return false
+	}
+
+	return true
+}
+
+func muteDuration(action string) (time.Duration, bool) {
+	for _, duration := range muteDurations {
+		if duration.action == action {
+			return duration.duration, true
+		}
+	}
+
+	return 0, false
+}
@@ -0,0 +1,456 @@
+package chat
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+	"github.com/kranikitao/fxhash-telegram-bot/src/errors"
+	"github.com/kranikitao/fxhash-telegram-bot/src/orm"
+	"github.com/kranikitao/fxhash-telegram-bot/src/orm/model"
+	"go.uber.org/zap"
+)
+
+// states of the subscriber while a setting is typed in
+const (
+	stateSettingsTimezone   = "settings_timezone"
+	stateSettingsQuietHours = "settings_quiet_hours"
+)
+
+// arguments of CommandSettings callbacks
+const (
+	settingsTimezone     = "tz"
+	settingsQuietHours   = "quiet"
+	settingsAlwaysNotify = "notify"
+	settingsDigest       = "digest"
+	settingsOff          = "off"
+)
+
+const settingsTimeLayout = "15:04"
+
+// digestModeInstant stands for model.DigestModeInstant in callbacks, which is empty
+const digestModeInstant = "instant"
+
+var settingsTimezones = []string{
+	"UTC",
+	"Europe/London",
+	"Europe/Paris",
+	"Europe/Moscow",
+	"Asia/Dubai",
+	"Asia/Kolkata",
+	"Asia/Shanghai",
+	"Asia/Tokyo",
+	"Australia/Sydney",
+	"America/Sao_Paulo",
+	"America/New_York",
+	"America/Chicago",
+	"America/Los_Angeles",
+}
+
+var settingsQuietHoursPresets = [][2]int{{22, 8}, {23, 7}, {0, 8}, {21, 9}}
+
+func (c *Chat) showSettings(subscriber *model.Subscriber) {
+	now := time.Now().In(subscriber.Location())
+	var text strings.Builder
+	text.WriteString(c.text(subscriber, "settings.timezone", timezoneName(subscriber), now.Format(settingsTimeLayout)) + "\n")
+	text.WriteString(c.text(subscriber, "settings.quiet_hours", c.quietHoursText(subscriber)) + "\n")
+	text.WriteString(c.text(subscriber, "settings.delivery", c.digestText(subscriber)))
+	if subscriber.HasQuietHours() {
+		text.WriteString("\n" + c.text(subscriber, "settings.quiet_hours_hint"))
+	}
+
+	c.sendKeyboard(subscriber.ChatID, text.String(), tgbotapi.NewInlineKeyboardMarkup(
+		tgbotapi.NewInlineKeyboardRow(tgbotapi.NewInlineKeyboardButtonData(c.text(subscriber, "settings.button.timezone"), "/"+CommandSettings+" "+settingsTimezone)),
+		tgbotapi.NewInlineKeyboardRow(tgbotapi.NewInlineKeyboardButtonData(c.text(subscriber, "settings.button.quiet_hours"), "/"+CommandSettings+" "+settingsQuietHours)),
+		tgbotapi.NewInlineKeyboardRow(tgbotapi.NewInlineKeyboardButtonData(c.text(subscriber, "settings.button.delivery"), "/"+CommandSettings+" "+settingsDigest)),
+		tgbotapi.NewInlineKeyboardRow(tgbotapi.NewInlineKeyboardButtonData(c.text(subscriber, "settings.button.always_notify"), "/"+CommandSettings+" "+settingsAlwaysNotify)),
+		tgbotapi.NewInlineKeyboardRow(tgbotapi.NewInlineKeyboardButtonData(c.text(subscriber, "button.close"), "/"+CommandCancel)),
+	))
+}
+
+func (c *Chat) handleSettingsCallback(subscriber *model.Subscriber, arguments string, message *tgbotapi.Message) {
+	setting, value, _ := strings.Cut(arguments, " ")
+	switch setting {
+	case settingsTimezone:
+		if value != "" {
+			c.setTimezone(subscriber, value)
+		} else {
+			c.showTimezones(subscriber)
+		}
+	case settingsQuietHours:
+		if value != "" {
+			c.setQuietHours(subscriber, value)
+		} else {
+			c.showQuietHours(subscriber)
+		}
+	case settingsDigest:
+		c.setDigest(subscriber, value)
+	case settingsAlwaysNotify:
+		if value != "" {
+			c.toggleAlwaysNotify(subscriber, value, message)
+		} else {
+			c.showAlwaysNotify(subscriber)
+		}
+	default:
+		c.showSettings(subscriber)
+	}
+}
+
+func (c *Chat) showTimezones(subscriber *model.Subscriber) {
+	if err := c.updateState(subscriber, stateSettingsTimezone); err != nil {
+		c.reply(subscriber, ChatErrorUnexpected)
+		return
+	}
+
+	var buttons [][]tgbotapi.InlineKeyboardButton
+	for i := 0; i < len(settingsTimezones); i += 2 {
+		row := tgbotapi.NewInlineKeyboardRow(
+			tgbotapi.NewInlineKeyboardButtonData(settingsTimezones[i], "/"+CommandSettings+" "+settingsTimezone+" "+settingsTimezones[i]),
+		)
+		if i+1 < len(settingsTimezones) {
+			row = append(row, tgbotapi.NewInlineKeyboardButtonData(settingsTimezones[i+1], "/"+CommandSettings+" "+settingsTimezone+" "+settingsTimezones[i+1]))
+		}
+		buttons = append(buttons, row)
+	}
+	buttons = append(buttons, tgbotapi.NewInlineKeyboardRow(tgbotapi.NewInlineKeyboardButtonData(c.text(subscriber, "button.cancel"), "/"+CommandCancel)))
+	if err := c.sendKeyboard(subscriber.ChatID, c.text(subscriber, "settings.timezone.select"), tgbotapi.NewInlineKeyboardMarkup(buttons...)); err != nil {
+		return
+	}
+
+	c.sendKeyboard(subscriber.ChatID, c.text(subscriber, "settings.timezone.location"), tgbotapi.NewOneTimeReplyKeyboard(
+		tgbotapi.NewKeyboardButtonRow(tgbotapi.NewKeyboardButtonLocation(c.text(subscriber, "settings.timezone.share"))),
+	))
+}
+
+func (c *Chat) setTimezone(subscriber *model.Subscriber, name string) {
+	name = strings.TrimSpace(name)
+	location, err := time.LoadLocation(name)
+	if err != nil || name == "" || strings.EqualFold(name, "Local") {
+		c.reply(subscriber, "settings.timezone.unknown", name)
+		return
+	}
+	c.saveTimezone(subscriber, location.String())
+}
+
+// setTimezoneFromLocation picks the fixed offset zone of the longitude, it may
+// be an hour off near borders and ignores daylight saving time
+func (c *Chat) setTimezoneFromLocation(subscriber *model.Subscriber, location *tgbotapi.Location) {
+	offset := int(math.Round(location.Longitude / 15))
+	name := "UTC"
+	if offset > 0 {
+		// signs of Etc zones are inverted, Etc/GMT-3 is UTC+3
+		name = "Etc/GMT-" + strconv.Itoa(offset)
+	} else if offset < 0 {
+		name = "Etc/GMT+" + strconv.Itoa(-offset)
+	}
+	c.saveTimezone(subscriber, name)
+}
+
+func (c *Chat) saveTimezone(subscriber *model.Subscriber, name string) {
+	subscriber.Timezone = name
+	subscriber.State = ""
+	if err := c.updateSubscriber(subscriber); err != nil {
+		return
+	}
+
+	now := time.Now().In(subscriber.Location())
+	message := tgbotapi.NewMessage(subscriber.ChatID, c.text(subscriber, "settings.timezone.done", name, now.Format(settingsTimeLayout)))
+	message.ReplyMarkup = tgbotapi.NewRemoveKeyboard(true)
+	c.send(message)
+}
+
+func (c *Chat) showQuietHours(subscriber *model.Subscriber) {
+	if err := c.updateState(subscriber, stateSettingsQuietHours); err != nil {
+		c.reply(subscriber, ChatErrorUnexpected)
+		return
+	}
+
+	var buttons [][]tgbotapi.InlineKeyboardButton
+	for _, preset := range settingsQuietHoursPresets {
+		buttons = append(buttons, tgbotapi.NewInlineKeyboardRow(tgbotapi.NewInlineKeyboardButtonData(
+			fmt.Sprintf("%02d:00 - %02d:00", preset[0], preset[1]),
+			fmt.Sprintf("/%s %s %d-%d", CommandSettings, settingsQuietHours, preset[0], preset[1]),
+		)))
+	}
+	buttons = append(buttons, tgbotapi.NewInlineKeyboardRow(
+		tgbotapi.NewInlineKeyboardButtonData(c.text(subscriber, "settings.quiet_hours.button_off"), "/"+CommandSettings+" "+settingsQuietHours+" "+settingsOff),
+		tgbotapi.NewInlineKeyboardButtonData(c.text(subscriber, "button.cancel"), "/"+CommandCancel),
+	))
+	c.sendKeyboard(
+		subscriber.ChatID,
+		c.text(subscriber, "settings.quiet_hours.select", timezoneName(subscriber)),
+		tgbotapi.NewInlineKeyboardMarkup(buttons...),
+	)
+}
+
+func (c *Chat) setQuietHours(subscriber *model.Subscriber, value string) {
+	value = strings.TrimSpace(value)
+	from, to := 0, 0
+	if value != settingsOff {
+		var ok bool
+		from, to, ok = parseQuietHours(value)
+		if !ok {
+			c.reply(subscriber, "settings.quiet_hours.invalid")
+			return
+		}
+	}
+
+	subscriber.QuietFrom = from
+	subscriber.QuietTo = to
+	subscriber.State = ""
+	if err := c.updateSubscriber(subscriber); err != nil {
+		return
+	}
+	if !subscriber.HasQuietHours() {
+		c.reply(subscriber, "settings.quiet_hours.off")
+		return
+	}
+	c.reply(subscriber, "settings.quiet_hours.done", c.quietHoursText(subscriber))
+}
+
+// parseQuietHours reads hours like "22-8", minutes may follow as in "22:00-08:00"
+func parseQuietHours(value string) (int, int, bool) {
+	fromText, toText, found := strings.Cut(value, "-")
+	if !found {
+		return 0, 0, false
+	}
+	from, ok := parseHour(fromText)
+	if !ok {
+		return 0, 0, false
+	}
+	to, ok := parseHour(toText)
+	if !ok || from == to {
+		return 0, 0, false
+	}
+
+	return from, to, true
+}
+
+func parseHour(value string) (int, bool) {
+	value = strings.TrimSuffix(strings.TrimSpace(value), ":00")
+	hour, err := strconv.Atoi(value)
+	if err != nil || hour < 0 || hour > 23 {
+		return 0, false
+	}
+
+	return hour, true
+}
+
+// setDigest shows delivery modes until the mode and, for a daily digest, the
+// hour are chosen
+func (c *Chat) setDigest(subscriber *model.Subscriber, value string) {
+	mode, hourText, _ := strings.Cut(value, " ")
+	switch mode {
+	case "":
+		c.sendKeyboard(
+			subscriber.ChatID,
+			c.text(subscriber, "settings.delivery.select"),
+			tgbotapi.NewInlineKeyboardMarkup(
+				tgbotapi.NewInlineKeyboardRow(tgbotapi.NewInlineKeyboardButtonData(c.text(subscriber, "settings.delivery.instant"), "/"+CommandSettings+" "+settingsDigest+" "+digestModeInstant)),
+				tgbotapi.NewInlineKeyboardRow(tgbotapi.NewInlineKeyboardButtonData(c.text(subscriber, "settings.delivery.hourly"), "/"+CommandSettings+" "+settingsDigest+" "+model.DigestModeHourly)),
+				tgbotapi.NewInlineKeyboardRow(tgbotapi.NewInlineKeyboardButtonData(c.text(subscriber, "settings.delivery.daily"), "/"+CommandSettings+" "+settingsDigest+" "+model.DigestModeDaily)),
+				tgbotapi.NewInlineKeyboardRow(tgbotapi.NewInlineKeyboardButtonData(c.text(subscriber, "button.cancel"), "/"+CommandCancel)),
+			),
+		)
+		return
+	case digestModeInstant:
+		subscriber.DigestMode = model.DigestModeInstant
+	case model.DigestModeHourly:
+		subscriber.DigestMode = model.DigestModeHourly
+	case model.DigestModeDaily:
+		hour, ok := parseHour(hourText)
+		if !ok {
+			c.showDigestHours(subscriber)
+			return
+		}
+		subscriber.DigestMode = model.DigestModeDaily
+		subscriber.DigestHour = hour
+	default:
+		return
+	}
+
+	if err := c.updateSubscriber(subscriber); err != nil {
+		return
+	}
+	c.reply(subscriber, "settings.delivery.done", c.digestText(subscriber))
+}
+
+func (c *Chat) showDigestHours(subscriber *model.Subscriber) {
+	var buttons [][]tgbotapi.InlineKeyboardButton
+	for hour := 0; hour < 24; hour += 6 {
+		var row []tgbotapi.InlineKeyboardButton
+		for i := hour; i < hour+6; i++ {
+			row = append(row, tgbotapi.NewInlineKeyboardButtonData(
+				fmt.Sprintf("%02d:00", i),
+				fmt.Sprintf("/%s %s %s %d", CommandSettings, settingsDigest, model.DigestModeDaily, i),
+			))
+		}
+		buttons = append(buttons, row)
+	}
+	buttons = append(buttons, tgbotapi.NewInlineKeyboardRow(tgbotapi.NewInlineKeyboardButtonData(c.text(subscriber, "button.cancel"), "/"+CommandCancel)))
+	c.sendKeyboard(
+		subscriber.ChatID,
+		c.text(subscriber, "settings.delivery.hour", timezoneName(subscriber)),
+		tgbotapi.NewInlineKeyboardMarkup(buttons...),
+	)
+}
+
+func (c *Chat) showAlwaysNotify(subscriber *model.Subscriber) {
+	keyboard, ok := c.alwaysNotifyKeyboard(subscriber)
+	if !ok {
+		return
+	}
+	if len(keyboard.InlineKeyboard) == 1 {
+		c.reply(subscriber, "subscriptions.none")
+		return
+	}
+	c.sendKeyboard(subscriber.ChatID, c.text(subscriber, "settings.always_notify.select"), keyboard)
+}
+
+func (c *Chat) alwaysNotifyKeyboard(subscriber *model.Subscriber) (tgbotapi.InlineKeyboardMarkup, bool) {
+	subscriptions, err := c.artistSubscriptionStore.FindActiveByChatId(subscriber.ChatID)
+	if err != nil {
+		c.logger.Error(
+			"can't get subscriptions",
+			zap.Int64("chatId", subscriber.ChatID),
+			zap.Error(err),
+			errors.ErrorTraceLogField(err),
+		)
+		c.reply(subscriber, ChatErrorUnexpected)
+		return tgbotapi.InlineKeyboardMarkup{}, false
+	}
+
+	var buttons [][]tgbotapi.InlineKeyboardButton
+	for _, subscription := range subscriptions {
+		text := subscription.FxHashArtistName
+		if subscription.IsCollector() {
+			text = c.text(subscriber, "subscriptions.collector", text)
+		} else if subscription.IsWallet() {
+			text = c.text(subscriber, "subscriptions.wallet", text)
+		}
+		if subscription.AlwaysNotify {
+			text = c.text(subscriber, "settings.always_notify.marked", text)
+		}
+		buttons = append(buttons, tgbotapi.NewInlineKeyboardRow(tgbotapi.NewInlineKeyboardButtonData(
+			text,
+			fmt.Sprintf("/%s %s %d", CommandSettings, settingsAlwaysNotify, subscription.ID),
+		)))
+	}
+	buttons = append(buttons, tgbotapi.NewInlineKeyboardRow(tgbotapi.NewInlineKeyboardButtonData(c.text(subscriber, "button.close"), "/"+CommandCancel)))
+
+	return tgbotapi.NewInlineKeyboardMarkup(buttons...), true
+}
+
+func (c *Chat) toggleAlwaysNotify(subscriber *model.Subscriber, value string, message *tgbotapi.Message) {
+	id, parseErr := strconv.ParseUint(value, 10, 64)
+	if parseErr != nil {
+		return
+	}
+	subscription, err := c.artistSubscriptionStore.FindByID(id)
+	if err != nil || subscription.ChatID != subscriber.ChatID {
+		if err != nil && !errors.Is(err, orm.ErrNotFound) {
+			c.logger.Error(
+				"can't get subscription",
+				zap.Uint64("id", id),
+				zap.Error(err),
+				errors.ErrorTraceLogField(err),
+			)
+			c.reply(subscriber, ChatErrorUnexpected)
+			return
+		}
+		c.reply(subscriber, "subscriptions.not_found")
+		return
+	}
+
+	subscription.AlwaysNotify = !subscription.AlwaysNotify
+	if err := c.artistSubscriptionStore.Update(subscription); err != nil {
+		c.logger.Error(
+			"can't update subscription",
+			zap.Any("subscription", subscription),
+			zap.Error(err),
+			errors.ErrorTraceLogField(err),
+		)
+		c.reply(subscriber, ChatErrorUnexpected)
+		return
+	}
+
+	keyboard, ok := c.alwaysNotifyKeyboard(subscriber)
+	if !ok || message == nil {
+		return
+	}
+	if _, err := c.bot.Request(tgbotapi.NewEditMessageReplyMarkup(subscriber.ChatID, message.MessageID, keyboard)); err != nil {
+		err := errors.Wrap(err, "can't edit keyboard")
+		c.logger.Error(
+			"can't update keyboard",
+			zap.Error(err),
+			errors.ErrorTraceLogField(err),
+		)
+	}
+}
+
+func (c *Chat) updateSubscriber(subscriber *model.Subscriber) *errors.Error {
+	if err := c.subscriberStore.Update(subscriber); err != nil {
+		c.logger.Error(
+			"can't update subscriber",
+			zap.Any("subscriber", subscriber),
+			zap.Error(err),
+			errors.ErrorTraceLogField(err),
+		)
+		c.reply(subscriber, ChatErrorUnexpected)
+		return err
+	}
+
+	return nil
+}
+
+func (c *Chat) sendKeyboard(chatID int64, text string, keyboard interface{}) *errors.Error {
+	message := tgbotapi.NewMessage(chatID, text)
+	message.ReplyMarkup = keyboard
+
+	return c.send(message)
+}
+
+func (c *Chat) send(message tgbotapi.MessageConfig) *errors.Error {
+	if _, err := c.bot.Send(message); err != nil {
+		err := errors.Wrap(err, "can't send message with keyboard")
+		c.logger.Error(
+			"can't send message with keyboard",
+			zap.Any("message", message),
+			zap.Error(err),
+			errors.ErrorTraceLogField(err),
+		)
+		return err
+	}
+
+	return nil
+}
+
+func timezoneName(subscriber *model.Subscriber) string {
+	if subscriber.Timezone == "" {
+		return "UTC"
+	}
+
+	return subscriber.Timezone
+}
+
+func (c *Chat) quietHoursText(subscriber *model.Subscriber) string {
+	if !subscriber.HasQuietHours() {
+		return c.text(subscriber, "settings.off")
+	}
+
+	return fmt.Sprintf("%02d:00 - %02d:00 %s", subscriber.QuietFrom, subscriber.QuietTo, timezoneName(subscriber))
+}
+
+func (c *Chat) digestText(subscriber *model.Subscriber) string {
+	switch subscriber.DigestMode {
+	case model.DigestModeHourly:
+		return c.text(subscriber, "settings.delivery.hourly")
+	case model.DigestModeDaily:
+		return c.text(subscriber, "settings.delivery.daily_at", fmt.Sprintf("%02d:00 %s", subscriber.DigestHour, timezoneName(subscriber)))
+	default:
+		return c.text(subscriber, "settings.delivery.instant")
+	}
+}
@@ -0,0 +1,304 @@
+package chat
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+	"github.com/kranikitao/fxhash-telegram-bot/src/errors"
+	"github.com/kranikitao/fxhash-telegram-bot/src/orm"
+	"github.com/kranikitao/fxhash-telegram-bot/src/orm/model"
+	"go.uber.org/zap"
+)
+
+// stateSubscriptionsSearch waits for the prefix of an artist name
+const stateSubscriptionsSearch = "subscriptions_search"
+
+// actions of CommandSubscriptions callbacks, the search prefix ends the data:
+//
+//	/subscriptions p <page> [prefix]       shows the page
+//	/subscriptions t <page> <id> [prefix]  toggles the artist subscription
+//	/subscriptions f <page> [prefix]       toggles zero cost generatives
+//	/subscriptions s                       asks for a prefix
+const (
+	subscriptionsPage   = "p"
+	subscriptionsToggle = "t"
+	subscriptionsFree   = "f"
+	subscriptionsSearch = "s"
+)
+
+const subscriptionsPageSize = 8
+
+// maxSearchLength in bytes keeps the longest callback data within the 64
+// bytes allowed by Telegram
+const maxSearchLength = 20
+
+// subscriptionsView is a page of the subscriptions keyboard
+type subscriptionsView struct {
+	page   int
+	prefix string
+}
+
+// showSubscriptions sends the first page of subscriptions matching prefix
+func (c *Chat) showSubscriptions(subscriber *model.Subscriber, prefix string) {
+	view := subscriptionsView{prefix: trimSearch(prefix)}
+	if view.prefix == "" && !subscriber.Subscribed {
+		count, err := c.artistSubscriptionStore.CountByChatID(subscriber.ChatID, "")
+		if err != nil {
+			c.subscriptionsError(subscriber, "can't count subscriptions", err)
+			return
+		}
+		if count == 0 {
+			c.reply(subscriber, "subscriptions.none")
+			return
+		}
+	}
+
+	text, keyboard, ok := c.subscriptionsPage(subscriber, &view)
+	if !ok {
+		return
+	}
+	if keyboard == nil {
+		c.sendTextMessage(subscriber.ChatID, text)
+		return
+	}
+	c.sendKeyboard(subscriber.ChatID, text, keyboard)
+}
+
+func (c *Chat) handleSubscriptionsCallback(subscriber *model.Subscriber, arguments string, message *tgbotapi.Message) {
+	action, arguments, _ := strings.Cut(arguments, " ")
+	if action == subscriptionsSearch {
+		if err := c.updateState(subscriber, stateSubscriptionsSearch); err != nil {
+			c.reply(subscriber, ChatErrorUnexpected)
+			return
+		}
+		c.reply(subscriber, "subscriptions.search.prompt")
+		return
+	}
+
+	pageNumber, arguments, _ := strings.Cut(arguments, " ")
+	page, err := strconv.Atoi(pageNumber)
+	if err != nil {
+		return
+	}
+	view := subscriptionsView{page: page}
+	switch action {
+	case subscriptionsPage:
+		view.prefix = arguments
+	case subscriptionsToggle:
+		var value string
+		value, view.prefix, _ = strings.Cut(arguments, " ")
+		id, err := strconv.ParseUint(value, 10, 64)
+		if err != nil || !c.toggleSubscription(subscriber, id) {
+			return
+		}
+	case subscriptionsFree:
+		view.prefix = arguments
+		subscriber.Subscribed = !subscriber.Subscribed
+		if err := c.updateSubscriber(subscriber); err != nil {
+			return
+		}
+	default:
+		return
+	}
+	c.editSubscriptions(subscriber, &view, message)
+}
+
+// searchSubscriptions shows subscriptions starting with the typed prefix
+func (c *Chat) searchSubscriptions(subscriber *model.Subscriber, prefix string) {
+	if err := c.updateState(subscriber, ""); err != nil {
+		c.reply(subscriber, ChatErrorUnexpected)
+		return
+	}
+	c.showSubscriptions(subscriber, prefix)
+}
+
+func (c *Chat) toggleSubscription(subscriber *model.Subscriber, id uint64) bool {
+	subscription, err := c.artistSubscriptionStore.FindByID(id)
+	if err != nil || subscription.ChatID != subscriber.ChatID {
+		if err != nil && !errors.Is(err, orm.ErrNotFound) {
+			c.subscriptionsError(subscriber, "can't get subscription", err)
+			return false
+		}
+		c.reply(subscriber, "subscriptions.not_found")
+		return false
+	}
+
+	subscription.IsActive = !subscription.IsActive
+	if err := c.artistSubscriptionStore.Update(subscription); err != nil {
+		c.subscriptionsError(subscriber, "can't update subscription", err)
+		return false
+	}
+
+	return true
+}
+
+// unsubscribeByName handles keyboards sent before subscriptions were paginated,
+// their buttons carry the artist name
+func (c *Chat) unsubscribeByName(subscriber *model.Subscriber, name string, message *tgbotapi.Message) {
+	subscription, err := c.artistSubscriptionStore.FindByChatIDAndKindAndFxHashArtistName(subscriber.ChatID, model.SubscriptionKindArtist, name)
+	if err != nil {
+		if errors.Is(err, orm.ErrNotFound) {
+			c.reply(subscriber, "subscriptions.not_found")
+			return
+		}
+		c.subscriptionsError(subscriber, "can't get subscription", err)
+		return
+	}
+	if subscription.IsActive && !c.toggleSubscription(subscriber, subscription.ID) {
+		return
+	}
+	c.editSubscriptions(subscriber, &subscriptionsView{}, message)
+}
+
+// editSubscriptions replaces the keyboard message with the page of the view
+func (c *Chat) editSubscriptions(subscriber *model.Subscriber, view *subscriptionsView, message *tgbotapi.Message) {
+	text, keyboard, ok := c.subscriptionsPage(subscriber, view)
+	if !ok || message == nil {
+		return
+	}
+	edit := tgbotapi.NewEditMessageText(subscriber.ChatID, message.MessageID, text)
+	edit.ReplyMarkup = keyboard
+	if _, err := c.bot.Request(edit); err != nil && !strings.Contains(err.Error(), "message is not modified") {
+		err := errors.Wrap(err, "can't edit subscriptions message")
+		c.logger.Error(
+			"can't update subscriptions",
+			zap.Int64("chatId", subscriber.ChatID),
+			zap.Error(err),
+			errors.ErrorTraceLogField(err),
+		)
+	}
+}
+
+// subscriptionsPage renders the page of the view, the page is moved into the
+// existing pages. The keyboard is nil when nothing matches the prefix.
+func (c *Chat) subscriptionsPage(subscriber *model.Subscriber, view *subscriptionsView) (string, *tgbotapi.InlineKeyboardMarkup, bool) {
+	count, err := c.artistSubscriptionStore.CountByChatID(subscriber.ChatID, view.prefix)
+	if err != nil {
+		c.subscriptionsError(subscriber, "can't count subscriptions", err)
+		return "", nil, false
+	}
+	if count == 0 && view.prefix != "" {
+		return c.text(subscriber, "subscriptions.search.none", view.prefix), nil, true
+	}
+	pages := int((count + subscriptionsPageSize - 1) / subscriptionsPageSize)
+	if pages == 0 {
+		pages = 1
+	}
+	if view.page >= pages {
+		view.page = pages - 1
+	}
+	if view.page < 0 {
+		view.page = 0
+	}
+	subscriptions, err := c.artistSubscriptionStore.SearchByChatID(subscriber.ChatID, view.prefix, subscriptionsPageSize, view.page*subscriptionsPageSize)
+	if err != nil {
+		c.subscriptionsError(subscriber, "can't get subscriptions", err)
+		return "", nil, false
+	}
+
+	var buttons [][]tgbotapi.InlineKeyboardButton
+	button := func(text string, action string, arguments ...interface{}) tgbotapi.InlineKeyboardButton {
+		data := "/" + CommandSubscriptions + " " + action
+		for _, argument := range arguments {
+			data += fmt.Sprintf(" %v", argument)
+		}
+		if view.prefix != "" && action != subscriptionsSearch {
+			data += " " + view.prefix
+		}
+		return tgbotapi.NewInlineKeyboardButtonData(text, data)
+	}
+	muteButton := func(target string, id uint64) tgbotapi.InlineKeyboardButton {
+		data := fmt.Sprintf("/%s %s %s %d %d", CommandMute, muteOptions, target, id, view.page)
+		if view.prefix != "" {
+			data += " " + view.prefix
+		}
+		return tgbotapi.NewInlineKeyboardButtonData("⏰", data)
+	}
+	now := time.Now()
+	if view.page == 0 && view.prefix == "" {
+		row := tgbotapi.NewInlineKeyboardRow(
+			button(toggleLabel(subscriber.Subscribed, subscriber.IsFreeMuted(now), c.text(subscriber, "subscriptions.free")), subscriptionsFree, view.page),
+		)
+		if subscriber.Subscribed {
+			row = append(row, muteButton(muteFree, 0))
+		}
+		buttons = append(buttons, row)
+	}
+	for _, subscription := range subscriptions {
+		name := subscription.FxHashArtistName
+		if subscription.IsCollector() {
+			name = c.text(subscriber, "subscriptions.collector", name)
+		} else if subscription.IsWallet() {
+			name = c.text(subscriber, "subscriptions.wallet", name)
+		}
+		row := tgbotapi.NewInlineKeyboardRow(
+			button(toggleLabel(subscription.IsActive, subscription.IsMuted(now), name), subscriptionsToggle, view.page, subscription.ID),
+		)
+		if subscription.IsActive {
+			row = append(row, muteButton(muteArtist, subscription.ID))
+		}
+		buttons = append(buttons, row)
+	}
+	if pages > 1 {
+		var row []tgbotapi.InlineKeyboardButton
+		if view.page > 0 {
+			row = append(row, button("◀", subscriptionsPage, view.page-1))
+		}
+		row = append(row, button(fmt.Sprintf("%d/%d", view.page+1, pages), subscriptionsPage, view.page))
+		if view.page < pages-1 {
+			row = append(row, button("▶", subscriptionsPage, view.page+1))
+		}
+		buttons = append(buttons, row)
+	}
+	row := []tgbotapi.InlineKeyboardButton{button(c.text(subscriber, "button.search"), subscriptionsSearch)}
+	if view.prefix != "" {
+		row = append(row, tgbotapi.NewInlineKeyboardButtonData(c.text(subscriber, "button.show_all"), "/"+CommandSubscriptions+" "+subscriptionsPage+" 0"))
+	}
+	row = append(row, tgbotapi.NewInlineKeyboardButtonData(c.text(subscriber, "button.close"), "/"+CommandCancel))
+	buttons = append(buttons, row)
+
+	text := c.text(subscriber, "subscriptions.manage", view.page+1, pages)
+	if view.prefix != "" {
+		text += "\n" + c.text(subscriber, "subscriptions.search.results", view.prefix)
+	}
+	keyboard := tgbotapi.NewInlineKeyboardMarkup(buttons...)
+
+	return text, &keyboard, true
+}
+
+func (c *Chat) subscriptionsError(subscriber *model.Subscriber, message string, err *errors.Error) {
+	c.logger.Error(
+		message,
+		zap.Int64("chatId", subscriber.ChatID),
+		zap.Error(err),
+		errors.ErrorTraceLogField(err),
+	)
+	c.reply(subscriber, ChatErrorUnexpected)
+}
+
+// toggleLabel marks whether a subscription is on, muted or off
+func toggleLabel(on bool, muted bool, text string) string {
+	if on && muted {
+		return "🔕 " + text
+	}
+	if on {
+		return "✅ " + text
+	}
+
+	return "⬜ " + text
+}
+
+// trimSearch cuts the prefix to maxSearchLength without splitting a character
+func trimSearch(prefix string) string {
+	prefix = strings.TrimSpace(prefix)
+	for len(prefix) > maxSearchLength {
+		_, size := utf8.DecodeLastRuneInString(prefix)
+		prefix = prefix[:len(prefix)-size]
+	}
+
+	return strings.TrimSpace(prefix)
+}
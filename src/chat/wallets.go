@@ -0,0 +1,268 @@
+package chat
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"strconv"
+	"strings"
+	"time"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+	"github.com/kranikitao/fxhash-telegram-bot/src/errors"
+	"github.com/kranikitao/fxhash-telegram-bot/src/orm"
+	"github.com/kranikitao/fxhash-telegram-bot/src/orm/model"
+	"github.com/kranikitao/fxhash-telegram-bot/src/tezos"
+	"go.uber.org/zap"
+)
+
+// stateWalletLink waits for the public key and the signature of the nonce
+const stateWalletLink = "wallet_link"
+
+// actions of CommandWallets callbacks:
+//
+//	/wallets unlink <id>
+//	/wallets activity <id>  toggles alerts about offers and auctions
+const (
+	walletUnlink   = "unlink"
+	walletActivity = "activity"
+)
+
+const (
+	walletNonceTTL = time.Hour
+	maxWallets     = 10
+)
+
+// walletMessage is the text the wallet signs, wallets show messages with
+// this prefix to the user before signing
+func walletMessage(nonce string) string {
+	return "Tezos Signed Message: link wallet to fxhash telegram bot " + nonce
+}
+
+// startWalletLink issues a new nonce and asks to sign it
+func (c *Chat) startWalletLink(subscriber *model.Subscriber) {
+	nonce := make([]byte, 16)
+	if _, err := rand.Read(nonce); err != nil {
+		err := errors.Wrap(err, "can't read random wallet nonce")
+		c.logger.Error(
+			"can't generate wallet nonce",
+			zap.Int64("chatId", subscriber.ChatID),
+			zap.Error(err),
+			errors.ErrorTraceLogField(err),
+		)
+		c.reply(subscriber, ChatErrorUnexpected)
+		return
+	}
+	expiresAt := time.Now().Add(walletNonceTTL)
+	subscriber.State = stateWalletLink
+	subscriber.WalletNonce = hex.EncodeToString(nonce)
+	subscriber.WalletNonceExpiresAt = &expiresAt
+	if err := c.updateSubscriber(subscriber); err != nil {
+		return
+	}
+
+	message := walletMessage(subscriber.WalletNonce)
+	c.reply(subscriber, "wallet.link.prompt", message, hex.EncodeToString(tezos.MichelineString(message)), int(walletNonceTTL.Minutes()))
+}
+
+// linkWallet verifies the signature of the nonce and links the address of
+// the public key, the state is kept after a wrong signature to retry
+func (c *Chat) linkWallet(subscriber *model.Subscriber, text string) {
+	if subscriber.WalletNonce == "" || subscriber.WalletNonceExpiresAt == nil || time.Now().After(*subscriber.WalletNonceExpiresAt) {
+		subscriber.State = ""
+		subscriber.WalletNonce = ""
+		subscriber.WalletNonceExpiresAt = nil
+		if err := c.updateSubscriber(subscriber); err == nil {
+			c.reply(subscriber, "wallet.link.expired")
+		}
+		return
+	}
+
+	var key *tezos.PublicKey
+	signature := ""
+	for _, field := range strings.Fields(text) {
+		if parsed, err := tezos.ParsePublicKey(field); err == nil {
+			key = parsed
+		} else if strings.HasPrefix(field, "sig") || strings.HasPrefix(field, "edsig") || strings.HasPrefix(field, "spsig") || strings.HasPrefix(field, "p2sig") {
+			signature = field
+		}
+	}
+	if key == nil || signature == "" {
+		c.reply(subscriber, "wallet.link.bad_format")
+		return
+	}
+	// wallets sign the packed message, some of them can sign the raw text too
+	message := walletMessage(subscriber.WalletNonce)
+	if key.Verify(tezos.MichelineString(message), signature) != nil && key.Verify([]byte(message), signature) != nil {
+		c.reply(subscriber, "wallet.link.invalid")
+		return
+	}
+
+	address := key.Address()
+	_, err := c.walletStore.FindByChatIDAndAddress(subscriber.ChatID, address)
+	if err != nil {
+		if !errors.Is(err, orm.ErrNotFound) {
+			c.walletsError(subscriber, "can't get wallet", err)
+			return
+		}
+		wallets, err := c.walletStore.FindByChatID(subscriber.ChatID)
+		if err != nil {
+			c.walletsError(subscriber, "can't get wallets", err)
+			return
+		}
+		if len(wallets) >= maxWallets {
+			c.reply(subscriber, "wallet.link.limit", maxWallets)
+			return
+		}
+		if err := c.walletStore.Create(&model.Wallet{ChatID: subscriber.ChatID, Address: address, PublicKey: key.String()}); err != nil {
+			c.walletsError(subscriber, "can't add wallet", err)
+			return
+		}
+	}
+
+	subscriber.State = ""
+	subscriber.WalletNonce = ""
+	subscriber.WalletNonceExpiresAt = nil
+	if err := c.updateSubscriber(subscriber); err != nil {
+		return
+	}
+	c.reply(subscriber, "wallet.link.done", address)
+}
+
+func (c *Chat) showWallets(subscriber *model.Subscriber) {
+	text, keyboard, ok := c.walletsList(subscriber)
+	if !ok {
+		return
+	}
+	c.sendKeyboard(subscriber.ChatID, text, keyboard)
+}
+
+func (c *Chat) handleWalletsCallback(subscriber *model.Subscriber, arguments string, message *tgbotapi.Message) {
+	action, value, _ := strings.Cut(arguments, " ")
+	if action != walletUnlink && action != walletActivity {
+		return
+	}
+	id, err := strconv.ParseUint(value, 10, 64)
+	if err != nil {
+		return
+	}
+	wallet, findErr := c.walletStore.FindByID(id)
+	if findErr != nil || wallet.ChatID != subscriber.ChatID {
+		if findErr != nil && !errors.Is(findErr, orm.ErrNotFound) {
+			c.walletsError(subscriber, "can't get wallet", findErr)
+			return
+		}
+		c.reply(subscriber, "wallets.not_found")
+		return
+	}
+	subscription, findErr := c.artistSubscriptionStore.FindByChatIDAndKindAndFxHashArtistName(subscriber.ChatID, model.SubscriptionKindWallet, wallet.Address)
+	if findErr != nil {
+		if !errors.Is(findErr, orm.ErrNotFound) {
+			c.walletsError(subscriber, "can't get wallet subscription", findErr)
+			return
+		}
+		subscription = nil
+	}
+	switch {
+	case action == walletUnlink:
+		if subscription != nil && subscription.IsActive {
+			subscription.IsActive = false
+			if err := c.artistSubscriptionStore.Update(subscription); err != nil {
+				c.walletsError(subscriber, "can't update wallet subscription", err)
+				return
+			}
+		}
+		if err := c.walletStore.Delete(wallet); err != nil {
+			c.walletsError(subscriber, "can't delete wallet", err)
+			return
+		}
+	case subscription == nil:
+		subscription = &model.ArtistSubscribtion{
+			ChatID:           subscriber.ChatID,
+			Kind:             model.SubscriptionKindWallet,
+			FxHashArtistID:   wallet.Address,
+			FxHashArtistName: wallet.Address,
+			IsActive:         true,
+		}
+		if err := c.artistSubscriptionStore.Create(subscription); err != nil {
+			c.walletsError(subscriber, "can't add wallet subscription", err)
+			return
+		}
+	default:
+		subscription.IsActive = !subscription.IsActive
+		if err := c.artistSubscriptionStore.Update(subscription); err != nil {
+			c.walletsError(subscriber, "can't update wallet subscription", err)
+			return
+		}
+	}
+
+	text, keyboard, ok := c.walletsList(subscriber)
+	if !ok || message == nil {
+		return
+	}
+	edit := tgbotapi.NewEditMessageTextAndMarkup(subscriber.ChatID, message.MessageID, text, keyboard)
+	if _, err := c.bot.Request(edit); err != nil && !strings.Contains(err.Error(), "message is not modified") {
+		err := errors.Wrap(err, "can't edit wallets message")
+		c.logger.Error(
+			"can't update wallets",
+			zap.Int64("chatId", subscriber.ChatID),
+			zap.Error(err),
+			errors.ErrorTraceLogField(err),
+		)
+	}
+}
+
+// walletsList renders linked wallets with an unlink button and a toggle of
+// offer and auction alerts each
+func (c *Chat) walletsList(subscriber *model.Subscriber) (string, tgbotapi.InlineKeyboardMarkup, bool) {
+	wallets, err := c.walletStore.FindByChatID(subscriber.ChatID)
+	if err != nil {
+		c.walletsError(subscriber, "can't get wallets", err)
+		return "", tgbotapi.InlineKeyboardMarkup{}, false
+	}
+	subscriptions, err := c.artistSubscriptionStore.FindByChatId(subscriber.ChatID)
+	if err != nil {
+		c.walletsError(subscriber, "can't get subscriptions", err)
+		return "", tgbotapi.InlineKeyboardMarkup{}, false
+	}
+	subscriptionsByAddress := map[string]*model.ArtistSubscribtion{}
+	for _, subscription := range subscriptions {
+		if subscription.IsWallet() {
+			subscriptionsByAddress[subscription.FxHashArtistID] = subscription
+		}
+	}
+
+	var buttons [][]tgbotapi.InlineKeyboardButton
+	now := time.Now()
+	for _, wallet := range wallets {
+		id := strconv.FormatUint(wallet.ID, 10)
+		active, muted := false, false
+		if subscription, ok := subscriptionsByAddress[wallet.Address]; ok {
+			active, muted = subscription.IsActive, subscription.IsMuted(now)
+		}
+		buttons = append(buttons, tgbotapi.NewInlineKeyboardRow(
+			tgbotapi.NewInlineKeyboardButtonData("❌ "+wallet.Address, "/"+CommandWallets+" "+walletUnlink+" "+id),
+			tgbotapi.NewInlineKeyboardButtonData(toggleLabel(active, muted, c.text(subscriber, "button.wallet_activity")), "/"+CommandWallets+" "+walletActivity+" "+id),
+		))
+	}
+	buttons = append(buttons, tgbotapi.NewInlineKeyboardRow(
+		tgbotapi.NewInlineKeyboardButtonData(c.text(subscriber, "button.link_wallet"), "/"+CommandLinkWallet),
+		tgbotapi.NewInlineKeyboardButtonData(c.text(subscriber, "button.close"), "/"+CommandCancel),
+	))
+
+	text := c.text(subscriber, "wallets.list") + "\n" + c.text(subscriber, "wallets.activity")
+	if len(wallets) == 0 {
+		text = c.text(subscriber, "wallets.none")
+	}
+
+	return text, tgbotapi.NewInlineKeyboardMarkup(buttons...), true
+}
+
+func (c *Chat) walletsError(subscriber *model.Subscriber, message string, err *errors.Error) {
+	c.logger.Error(
+		message,
+		zap.Int64("chatId", subscriber.ChatID),
+		zap.Error(err),
+		errors.ErrorTraceLogField(err),
+	)
+	c.reply(subscriber, ChatErrorUnexpected)
+}
@@ -0,0 +1,291 @@
+package chat
+
+import (
+	"math"
+	"strconv"
+	"strings"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+	"github.com/kranikitao/fxhash-telegram-bot/src/errors"
+	"github.com/kranikitao/fxhash-telegram-bot/src/fxhash"
+	"github.com/kranikitao/fxhash-telegram-bot/src/orm"
+	"github.com/kranikitao/fxhash-telegram-bot/src/orm/model"
+	"github.com/kranikitao/fxhash-telegram-bot/src/templates"
+	"go.uber.org/zap"
+)
+
+// stateWatchTarget waits for the link to the generative token or to the
+// followed artist to watch
+const stateWatchTarget = "watch_target"
+
+// stateWatchThreshold waits for the thresholds of the watch which follows
+// the state like "watch_threshold 12"
+const stateWatchThreshold = "watch_threshold"
+
+// watchDelete is the action of CommandWatches callbacks:
+//
+//	/watches delete <id>
+const watchDelete = "delete"
+
+func (c *Chat) startWatch(subscriber *model.Subscriber) {
+	if err := c.updateState(subscriber, stateWatchTarget); err != nil {
+		c.reply(subscriber, ChatErrorUnexpected)
+		return
+	}
+	c.reply(subscriber, "watch.prompt")
+}
+
+// setWatchTarget creates the watch of a generative token or of a followed
+// artist and asks for its thresholds
+func (c *Chat) setWatchTarget(subscriber *model.Subscriber, text string) {
+	watch := &model.ListingWatch{ChatID: subscriber.ChatID}
+	if id, slug, ok := parseGenerative(text); ok {
+		token, err := c.fxHash.GetTokenListings(id, slug)
+		if err != nil {
+			if errors.Is(err, fxhash.ErrGenerativeNotFound) {
+				c.reply(subscriber, "watch.token_not_found")
+			} else {
+				c.watchesError(subscriber, "can't get generative", err)
+			}
+			return
+		}
+		watch.Kind = model.ListingWatchKindToken
+		watch.TargetID = strconv.FormatInt(token.Id, 10)
+		watch.TargetName = token.Name
+	} else {
+		fxHashUserName := parseFxHashUserName(text)
+		if fxHashUserName == "" {
+			c.reply(subscriber, "subscribe.artist.bad_url")
+			return
+		}
+		subscription, err := c.artistSubscriptionStore.FindByChatIDAndKindAndFxHashArtistName(subscriber.ChatID, model.SubscriptionKindArtist, fxHashUserName)
+		if err != nil || !subscription.IsActive {
+			if err != nil && !errors.Is(err, orm.ErrNotFound) {
+				c.watchesError(subscriber, "can't get subscription", err)
+				return
+			}
+			c.reply(subscriber, "watch.not_followed", fxHashUserName)
+			return
+		}
+		watch.Kind = model.ListingWatchKindArtist
+		watch.TargetID = subscription.FxHashArtistID
+		watch.TargetName = subscription.FxHashArtistName
+	}
+
+	existing, err := c.listingWatchStore.FindByChatIDAndKindAndTargetID(subscriber.ChatID, watch.Kind, watch.TargetID)
+	if err == nil {
+		watch = existing
+	} else if !errors.Is(err, orm.ErrNotFound) {
+		c.watchesError(subscriber, "can't get listing watch", err)
+		return
+	} else if err := c.listingWatchStore.Create(watch); err != nil {
+		c.watchesError(subscriber, "can't add listing watch", err)
+		return
+	}
+
+	if err := c.updateState(subscriber, stateWatchThreshold+" "+strconv.FormatUint(watch.ID, 10)); err != nil {
+		c.reply(subscriber, ChatErrorUnexpected)
+		return
+	}
+	c.reply(subscriber, "watch.threshold.prompt", watch.TargetName)
+}
+
+// setWatchThreshold sets the thresholds of the watch of the state, they
+// replace the previous ones
+func (c *Chat) setWatchThreshold(subscriber *model.Subscriber, text string) {
+	parts := strings.Fields(subscriber.State)
+	if len(parts) != 2 {
+		c.updateState(subscriber, "")
+		return
+	}
+	maxPrice, belowFloor, ok := parseWatchThresholds(text)
+	if !ok {
+		c.reply(subscriber, "watch.threshold.bad")
+		return
+	}
+	id, parseErr := strconv.ParseUint(parts[1], 10, 64)
+	if parseErr != nil {
+		c.updateState(subscriber, "")
+		return
+	}
+	watch, err := c.listingWatchStore.FindByID(id)
+	if err != nil || watch.ChatID != subscriber.ChatID {
+		if err != nil && !errors.Is(err, orm.ErrNotFound) {
+			c.watchesError(subscriber, "can't get listing watch", err)
+			return
+		}
+		c.updateState(subscriber, "")
+		c.reply(subscriber, "watches.not_found")
+		return
+	}
+
+	watch.MaxPrice = maxPrice
+	watch.BelowFloor = belowFloor
+	if err := c.listingWatchStore.Update(watch); err != nil {
+		c.watchesError(subscriber, "can't update listing watch", err)
+		return
+	}
+	if err := c.updateState(subscriber, ""); err != nil {
+		c.reply(subscriber, ChatErrorUnexpected)
+		return
+	}
+	c.reply(subscriber, "watch.done", watch.TargetName, c.watchThresholds(subscriber, watch))
+}
+
+func (c *Chat) showWatches(subscriber *model.Subscriber) {
+	text, keyboard, ok := c.watchesList(subscriber)
+	if !ok {
+		return
+	}
+	c.sendKeyboard(subscriber.ChatID, text, keyboard)
+}
+
+func (c *Chat) handleWatchesCallback(subscriber *model.Subscriber, arguments string, message *tgbotapi.Message) {
+	action, value, _ := strings.Cut(arguments, " ")
+	if action != watchDelete {
+		return
+	}
+	id, err := strconv.ParseUint(value, 10, 64)
+	if err != nil {
+		return
+	}
+	watch, findErr := c.listingWatchStore.FindByID(id)
+	if findErr != nil || watch.ChatID != subscriber.ChatID {
+		if findErr != nil && !errors.Is(findErr, orm.ErrNotFound) {
+			c.watchesError(subscriber, "can't get listing watch", findErr)
+			return
+		}
+		c.reply(subscriber, "watches.not_found")
+		return
+	}
+	if err := c.listingWatchStore.Delete(watch); err != nil {
+		c.watchesError(subscriber, "can't delete listing watch", err)
+		return
+	}
+
+	text, keyboard, ok := c.watchesList(subscriber)
+	if !ok || message == nil {
+		return
+	}
+	edit := tgbotapi.NewEditMessageTextAndMarkup(subscriber.ChatID, message.MessageID, text, keyboard)
+	if _, err := c.bot.Request(edit); err != nil && !strings.Contains(err.Error(), "message is not modified") {
+		err := errors.Wrap(err, "can't edit listing watches message")
+		c.logger.Error(
+			"can't update listing watches",
+			zap.Int64("chatId", subscriber.ChatID),
+			zap.Error(err),
+			errors.ErrorTraceLogField(err),
+		)
+	}
+}
+
+// watchesList renders the watches with a delete button each
+func (c *Chat) watchesList(subscriber *model.Subscriber) (string, tgbotapi.InlineKeyboardMarkup, bool) {
+	watches, err := c.listingWatchStore.FindByChatID(subscriber.ChatID)
+	if err != nil {
+		c.watchesError(subscriber, "can't get listing watches", err)
+		return "", tgbotapi.InlineKeyboardMarkup{}, false
+	}
+
+	var buttons [][]tgbotapi.InlineKeyboardButton
+	for _, watch := range watches {
+		label := "❌ " + watch.TargetName + ": " + c.watchThresholds(subscriber, watch)
+		data := "/" + CommandWatches + " " + watchDelete + " " + strconv.FormatUint(watch.ID, 10)
+		buttons = append(buttons, tgbotapi.NewInlineKeyboardRow(tgbotapi.NewInlineKeyboardButtonData(label, data)))
+	}
+	buttons = append(buttons, tgbotapi.NewInlineKeyboardRow(
+		tgbotapi.NewInlineKeyboardButtonData(c.text(subscriber, "button.watch"), "/"+CommandWatch),
+		tgbotapi.NewInlineKeyboardButtonData(c.text(subscriber, "button.close"), "/"+CommandCancel),
+	))
+
+	text := c.text(subscriber, "watches.list")
+	if len(watches) == 0 {
+		text = c.text(subscriber, "watches.none")
+	}
+
+	return text, tgbotapi.NewInlineKeyboardMarkup(buttons...), true
+}
+
+// watchThresholds describes the thresholds of the watch
+func (c *Chat) watchThresholds(subscriber *model.Subscriber, watch *model.ListingWatch) string {
+	var thresholds []string
+	if watch.MaxPrice != nil {
+		thresholds = append(thresholds, c.text(subscriber, "watch.max_price", templates.Price{Mutez: *watch.MaxPrice}.Tez()))
+	}
+	if watch.BelowFloor > 0 {
+		thresholds = append(thresholds, c.text(subscriber, "watch.below_floor", watch.BelowFloor))
+	}
+	if len(thresholds) == 0 {
+		return c.text(subscriber, "watch.not_set")
+	}
+
+	return strings.Join(thresholds, c.text(subscriber, "watch.or"))
+}
+
+func (c *Chat) watchesError(subscriber *model.Subscriber, message string, err *errors.Error) {
+	c.logger.Error(
+		message,
+		zap.Int64("chatId", subscriber.ChatID),
+		zap.Error(err),
+		errors.ErrorTraceLogField(err),
+	)
+	c.reply(subscriber, ChatErrorUnexpected)
+}
+
+// parseGenerative returns the id or the slug of a generative token link like
+// https://www.fxhash.xyz/generative/slug/<slug> or .../generative/<id>
+func parseGenerative(text string) (int64, string, bool) {
+	text, _, _ = strings.Cut(strings.TrimSpace(text), "?")
+	parts := strings.Split(strings.TrimSuffix(text, "/"), "/")
+	for i, part := range parts {
+		if part != "generative" || i+1 >= len(parts) {
+			continue
+		}
+		if parts[i+1] == "slug" {
+			if i+2 < len(parts) && parts[i+2] != "" {
+				return 0, parts[i+2], true
+			}
+			return 0, "", false
+		}
+		id, err := strconv.ParseInt(parts[i+1], 10, 64)
+		if err != nil || id <= 0 {
+			return 0, "", false
+		}
+		return id, "", true
+	}
+
+	return 0, "", false
+}
+
+// parseWatchThresholds reads a price in tez like "5" or "2.5 tez" and a
+// percent below the floor like "20%", one of them or both
+func parseWatchThresholds(text string) (*int64, int, bool) {
+	var maxPrice *int64
+	belowFloor := 0
+	fields := strings.Fields(strings.ToLower(text))
+	if len(fields) == 0 || len(fields) > 4 {
+		return nil, 0, false
+	}
+	for _, field := range fields {
+		if field == "tez" || field == "ꜩ" {
+			continue
+		}
+		if strings.HasSuffix(field, "%") {
+			value, err := strconv.Atoi(strings.TrimSuffix(field, "%"))
+			if err != nil || value <= 0 || value >= 100 || belowFloor > 0 {
+				return nil, 0, false
+			}
+			belowFloor = value
+			continue
+		}
+		field = strings.TrimSuffix(strings.TrimSuffix(field, "tez"), "ꜩ")
+		value, err := strconv.ParseFloat(strings.ReplaceAll(field, ",", "."), 64)
+		if err != nil || !(value > 0) || math.IsInf(value, 0) || maxPrice != nil {
+			return nil, 0, false
+		}
+		mutez := int64(math.Round(value * 1e6))
+		maxPrice = &mutez
+	}
+
+	return maxPrice, belowFloor, maxPrice != nil || belowFloor > 0
+}
@@ -0,0 +1,307 @@
+// Package config loads the bot configuration.
+//
+// Values are taken from the defaults, then from an optional YAML file named
+// by the FXBOT_CONFIG_FILE environment variable and finally from the
+// environment. Environment variables keep the flat names used so far, e.g.
+// FXBOT_SENDER_BATCH_SIZE overrides sender.batch_size of the file.
+package config
+
+import (
+	"bytes"
+	"fmt"
+	"net"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/kelseyhightower/envconfig"
+	"github.com/kranikitao/fxhash-telegram-bot/src/errors"
+	"github.com/kranikitao/fxhash-telegram-bot/src/fxhash"
+	"go.uber.org/zap/zapcore"
+	"gopkg.in/yaml.v3"
+)
+
+// EnvPrefix is the prefix of every environment variable
+const EnvPrefix = "FXBOT"
+
+const minAdminAPITokenLength = 16
+
+var ErrInvalid = errors.NewKind("invalid_config")
+
+type Config struct {
+	TG         TGConfig         `yaml:"tg" split_words:"true"`
+	DB         DBConfig         `yaml:"db" split_words:"true"`
+	Collector  CollectorConfig  `yaml:"collector" split_words:"true"`
+	Sender     SenderConfig     `yaml:"sender" split_words:"true"`
+	FxHash     FxHashConfig     `yaml:"fxhash" envconfig:"FXHASH"`
+	Leader     LeaderConfig     `yaml:"leader" split_words:"true"`
+	Health     HealthConfig     `yaml:"health" split_words:"true"`
+	Supervisor SupervisorConfig `yaml:"supervisor" split_words:"true"`
+	Templates  TemplatesConfig  `yaml:"templates" split_words:"true"`
+
+	// AdminChatIDs are the chats allowed to run admin commands
+	AdminChatIDs []int64 `yaml:"admin_chat_ids" envconfig:"ADMIN_CHAT_IDS"`
+	// AdminAPIToken enables the admin HTTP API, it is disabled when empty
+	AdminAPIToken string `yaml:"admin_api_token" envconfig:"ADMIN_API_TOKEN"`
+	LogLevel      string `yaml:"log_level" split_words:"true"`
+	HTTPAddr      string `yaml:"http_addr" split_words:"true"`
+}
+
+type TGConfig struct {
+	Token string `yaml:"token" split_words:"true"`
+}
+
+type DBConfig struct {
+	Name     string `yaml:"name" split_words:"true"`
+	Host     string `yaml:"host" split_words:"true"`
+	Password string `yaml:"password" split_words:"true"`
+	User     string `yaml:"user" split_words:"true"`
+	Port     uint   `yaml:"port" split_words:"true"`
+}
+
+type CollectorConfig struct {
+	Interval time.Duration `yaml:"interval" split_words:"true"`
+}
+
+type SenderConfig struct {
+	Interval     time.Duration `yaml:"interval" split_words:"true"`
+	BatchSize    int           `yaml:"batch_size" split_words:"true"`
+	Workers      int           `yaml:"workers" split_words:"true"`
+	QueueLength  int           `yaml:"queue_length" split_words:"true"`
+	RateLimit    time.Duration `yaml:"rate_limit" split_words:"true"`
+	ClaimTimeout time.Duration `yaml:"claim_timeout" split_words:"true"`
+}
+
+type FxHashConfig struct {
+	Endpoint    string        `yaml:"endpoint" split_words:"true"`
+	IPFSGateway string        `yaml:"ipfs_gateway" split_words:"true"`
+	PageSize    int           `yaml:"page_size" split_words:"true"`
+	Timeout     time.Duration `yaml:"timeout" split_words:"true"`
+}
+
+type LeaderConfig struct {
+	LockID   int64         `yaml:"lock_id" split_words:"true"`
+	Interval time.Duration `yaml:"interval" split_words:"true"`
+}
+
+type HealthConfig struct {
+	CollectorStaleness time.Duration `yaml:"collector_staleness" split_words:"true"`
+	SenderStaleness    time.Duration `yaml:"sender_staleness" split_words:"true"`
+	// TelegramTTL is how long /readyz reuses the result of asking Telegram
+	// who the bot is
+	TelegramTTL time.Duration `yaml:"telegram_ttl" split_words:"true"`
+}
+
+type SupervisorConfig struct {
+	MinBackoff time.Duration `yaml:"min_backoff" split_words:"true"`
+	MaxBackoff time.Duration `yaml:"max_backoff" split_words:"true"`
+}
+
+type TemplatesConfig struct {
+	// Dir holds <kind>.tmpl files replacing built-in templates, none when empty
+	Dir string `yaml:"dir" split_words:"true"`
+}
+
+func Default() *Config {
+	return &Config{
+		DB: DBConfig{
+			Port: 5432,
+		},
+		Collector: CollectorConfig{
+			Interval: 60 * time.Second,
+		},
+		Sender: SenderConfig{
+			Interval:     60 * time.Second,
+			BatchSize:    500,
+			Workers:      4,
+			QueueLength:  100,
+			RateLimit:    35 * time.Millisecond,
+			ClaimTimeout: 10 * time.Minute,
+		},
+		FxHash: FxHashConfig{
+			Endpoint:    fxhash.DefaultEndpoint,
+			IPFSGateway: fxhash.DefaultIPFSGateway,
+			PageSize:    fxhash.DefaultPageSize,
+			Timeout:     fxhash.DefaultTimeout,
+		},
+		Leader: LeaderConfig{
+			LockID:   7461626,
+			Interval: 5 * time.Second,
+		},
+		Health: HealthConfig{
+			CollectorStaleness: 5 * time.Minute,
+			SenderStaleness:    5 * time.Minute,
+			TelegramTTL:        30 * time.Second,
+		},
+		Supervisor: SupervisorConfig{
+			MinBackoff: time.Second,
+			MaxBackoff: time.Minute,
+		},
+		LogLevel: "info",
+		HTTPAddr: ":9090",
+	}
+}
+
+// Load builds the configuration and validates it. The returned error lists
+// every problem found.
+func Load() (*Config, *errors.Error) {
+	config, err := read()
+	if err != nil {
+		return nil, err
+	}
+	if err := config.Validate(); err != nil {
+		return nil, err
+	}
+
+	return config, nil
+}
+
+// LoadDatabase builds the configuration and validates only the database
+// section, which is all the migrate command needs
+func LoadDatabase() (*Config, *errors.Error) {
+	config, err := read()
+	if err != nil {
+		return nil, err
+	}
+	if err := config.ValidateDatabase(); err != nil {
+		return nil, err
+	}
+
+	return config, nil
+}
+
+// read builds the configuration from the defaults, the file and the
+// environment
+func read() (*Config, *errors.Error) {
+	config := Default()
+	if path := os.Getenv(EnvPrefix + "_CONFIG_FILE"); path != "" {
+		if err := config.loadFile(path); err != nil {
+			return nil, err
+		}
+	}
+	if err := envconfig.Process(EnvPrefix, config); err != nil {
+		return nil, errors.Wrap(err, "can't read environment").WithKind(ErrInvalid)
+	}
+
+	return config, nil
+}
+
+func (c *Config) loadFile(path string) *errors.Error {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return errors.Wrap(err, "can't read config file").WithKind(ErrInvalid)
+	}
+	decoder := yaml.NewDecoder(bytes.NewReader(content))
+	decoder.KnownFields(true)
+	if err := decoder.Decode(c); err != nil {
+		return errors.Wrap(err, "can't parse config file "+path).WithKind(ErrInvalid)
+	}
+
+	return nil
+}
+
+// Validate checks every value and reports all problems at once
+func (c *Config) Validate() *errors.Error {
+	v := &validator{}
+	check, positive := v.check, v.positive
+
+	check(c.TG.Token != "", "tg.token", "is required")
+
+	c.DB.validate(v)
+
+	positive("collector.interval", c.Collector.Interval)
+
+	positive("sender.interval", c.Sender.Interval)
+	check(c.Sender.BatchSize > 0, "sender.batch_size", "must be positive, got %d", c.Sender.BatchSize)
+	check(c.Sender.Workers > 0, "sender.workers", "must be positive, got %d", c.Sender.Workers)
+	check(c.Sender.QueueLength >= 0, "sender.queue_length", "must not be negative, got %d", c.Sender.QueueLength)
+	positive("sender.rate_limit", c.Sender.RateLimit)
+	positive("sender.claim_timeout", c.Sender.ClaimTimeout)
+
+	check(isHTTPURL(c.FxHash.Endpoint), "fxhash.endpoint", "must be an http(s) url, got %q", c.FxHash.Endpoint)
+	check(isHTTPURL(c.FxHash.IPFSGateway), "fxhash.ipfs_gateway", "must be an http(s) url, got %q", c.FxHash.IPFSGateway)
+	check(c.FxHash.PageSize > 0 && c.FxHash.PageSize <= fxhash.MaxPageSize, "fxhash.page_size", "must be between 1 and %d, got %d", fxhash.MaxPageSize, c.FxHash.PageSize)
+	positive("fxhash.timeout", c.FxHash.Timeout)
+
+	positive("leader.interval", c.Leader.Interval)
+
+	positive("health.collector_staleness", c.Health.CollectorStaleness)
+	positive("health.sender_staleness", c.Health.SenderStaleness)
+	positive("health.telegram_ttl", c.Health.TelegramTTL)
+
+	positive("supervisor.min_backoff", c.Supervisor.MinBackoff)
+	check(c.Supervisor.MaxBackoff >= c.Supervisor.MinBackoff, "supervisor.max_backoff", "must not be less than min_backoff, got %s", c.Supervisor.MaxBackoff)
+
+	if c.Templates.Dir != "" {
+		info, err := os.Stat(c.Templates.Dir)
+		check(err == nil && info.IsDir(), "templates.dir", "must be a directory, got %q", c.Templates.Dir)
+	}
+
+	for _, chatID := range c.AdminChatIDs {
+		check(chatID != 0, "admin_chat_ids", "must not contain 0")
+	}
+	check(c.AdminAPIToken == "" || len(c.AdminAPIToken) >= minAdminAPITokenLength, "admin_api_token", "must be at least %d characters long", minAdminAPITokenLength)
+	_, err := zapcore.ParseLevel(c.LogLevel)
+	check(err == nil, "log_level", "unknown level %q", c.LogLevel)
+	_, _, err = net.SplitHostPort(c.HTTPAddr)
+	check(err == nil, "http_addr", "must be host:port, got %q", c.HTTPAddr)
+
+	return v.err()
+}
+
+// ValidateDatabase checks the database section only
+func (c *Config) ValidateDatabase() *errors.Error {
+	v := &validator{}
+	c.DB.validate(v)
+
+	return v.err()
+}
+
+func (c DBConfig) validate(v *validator) {
+	v.check(c.Name != "", "db.name", "is required")
+	v.check(c.Host != "", "db.host", "is required")
+	v.check(c.User != "", "db.user", "is required")
+	v.check(c.Port > 0 && c.Port <= 65535, "db.port", "must be between 1 and 65535, got %d", c.Port)
+}
+
+// validator collects the problems of the configuration
+type validator struct {
+	problems []string
+}
+
+func (v *validator) check(ok bool, name string, format string, args ...interface{}) {
+	if !ok {
+		v.problems = append(v.problems, fmt.Sprintf("%s (%s): ", name, envName(name))+fmt.Sprintf(format, args...))
+	}
+}
+
+func (v *validator) positive(name string, value time.Duration) {
+	v.check(value > 0, name, "must be positive, got %s", value)
+}
+
+func (v *validator) err() *errors.Error {
+	if len(v.problems) > 0 {
+		return errors.New("invalid configuration:\n  "+strings.Join(v.problems, "\n  "), ErrInvalid)
+	}
+
+	return nil
+}
+
+func (c DBConfig) DSN() string {
+	return fmt.Sprintf("host=%s user=%s dbname=%s password=%s sslmode=disable port=%d", c.Host, c.User, c.Name, c.Password, c.Port)
+}
+
+// envName returns the environment variable of a dotted yaml key
+func envName(name string) string {
+	return EnvPrefix + "_" + strings.ToUpper(strings.ReplaceAll(name, ".", "_"))
+}
+
+func isHTTPURL(value string) bool {
+	parsed, err := url.Parse(value)
+	if err != nil {
+		return false
+	}
+
+	return (parsed.Scheme == "http" || parsed.Scheme == "https") && parsed.Host != ""
+}
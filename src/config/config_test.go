@@ -0,0 +1,52 @@
+package config_test
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/kranikitao/fxhash-telegram-bot/src/config"
+	"github.com/kranikitao/fxhash-telegram-bot/src/errors"
+)
+
+// setDatabase configures the database and nothing else
+func setDatabase(t *testing.T) {
+	t.Setenv("FXBOT_CONFIG_FILE", "")
+	t.Setenv("FXBOT_TG_TOKEN", "")
+	t.Setenv("FXBOT_DB_NAME", "fxbot")
+	t.Setenv("FXBOT_DB_HOST", "localhost")
+	t.Setenv("FXBOT_DB_USER", "fxbot")
+}
+
+func TestLoadDatabase(t *testing.T) {
+	setDatabase(t)
+
+	loaded, err := config.LoadDatabase()
+	if err != nil {
+		t.Fatalf("LoadDatabase: %v", err)
+	}
+	if want := "host=localhost user=fxbot dbname=fxbot password= sslmode=disable port=5432"; loaded.DB.DSN() != want {
+		t.Fatalf("DSN: want %q, got %q", want, loaded.DB.DSN())
+	}
+	if _, err := config.Load(); err == nil || !strings.Contains(err.Error(), "tg.token") {
+		t.Fatalf("Load: want tg.token to be required, got %v", err)
+	}
+}
+
+func TestLoadDatabaseErrors(t *testing.T) {
+	setDatabase(t)
+	t.Setenv("FXBOT_DB_HOST", "")
+	t.Setenv("FXBOT_DB_PORT", "70000")
+
+	_, err := config.LoadDatabase()
+	if err == nil || !errors.Is(err, config.ErrInvalid) {
+		t.Fatalf("LoadDatabase: want %s, got %v", config.ErrInvalid, err)
+	}
+	for _, want := range []string{"db.host (FXBOT_DB_HOST): is required", "db.port (FXBOT_DB_PORT): must be between 1 and 65535"} {
+		if !strings.Contains(err.Error(), want) {
+			t.Fatalf("LoadDatabase: want %q in %q", want, err.Error())
+		}
+	}
+	if strings.Contains(err.Error(), "tg.token") {
+		t.Fatalf("LoadDatabase must not check the bot token, got %q", err.Error())
+	}
+}
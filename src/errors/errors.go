@@ -1,61 +1,222 @@
 package errors
 
 import (
-	"log"
+	stderrors "errors"
+	"fmt"
+	"runtime"
+	"strings"
 
 	"github.com/pkg/errors"
 	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
 )
 
-// Error ...
+// Kind classifies errors. Kinds are sentinels checked with Is:
+//
+//	var ErrNotFound = errors.NewKind("not_found")
+//	if errors.Is(err, ErrNotFound) { ... }
+type Kind struct {
+	name string
+}
+
+func NewKind(name string) *Kind {
+	return &Kind{name: name}
+}
+
+func (k *Kind) Error() string {
+	return k.name
+}
+
+// Error carries a kind, a context message, key/value fields for logs and
+// the stack trace of the place where the failure happened first.
 type Error struct {
-	Type          string
-	originalError error
-	error
+	kind    *Kind
+	message string
+	fields  []zap.Field
+	cause   error
+	stack   []uintptr
 }
 
 type stackTracer interface {
 	StackTrace() errors.StackTrace
 }
 
-// ErrorTraceLogField ...
-func ErrorTraceLogField(err *Error) zap.Field {
-	return zap.String("error_stacktrace", getTrace(err))
+// New returns an error with a stack trace, kind may be nil
+func New(message string, kind *Kind) *Error {
+	return &Error{
+		kind:    kind,
+		message: message,
+		stack:   callers(),
+	}
+}
+
+// Wrap adds a context message to err. The stack trace is captured only if
+// err doesn't carry one yet, so wrapping at every layer keeps the origin.
+func Wrap(err error, message string) *Error {
+	if err == nil {
+		return nil
+	}
+	if e, ok := err.(*Error); ok && e == nil {
+		return nil
+	}
+
+	wrapped := &Error{
+		message: message,
+		cause:   err,
+	}
+	if !hasStack(err) {
+		wrapped.stack = callers()
+	}
+
+	return wrapped
+}
+
+// WithKind sets the kind of the error and returns it
+func (e *Error) WithKind(kind *Kind) *Error {
+	e.kind = kind
+
+	return e
+}
+
+// With adds a key/value field written to logs by ErrorTraceLogField
+func (e *Error) With(key string, value interface{}) *Error {
+	e.fields = append(e.fields, zap.Any(key, value))
+
+	return e
 }
 
-// getTrace ...
-func getTrace(err *Error) string {
+func (e *Error) Error() string {
+	if e == nil {
+		return "<nil>"
+	}
+	switch {
+	case e.cause == nil:
+		return e.message
+	case e.message == "":
+		return e.cause.Error()
+	default:
+		return e.message + ": " + e.cause.Error()
+	}
+}
+
+func (e *Error) Unwrap() error {
+	if e == nil {
+		return nil
+	}
+
+	return e.cause
+}
+
+// Is reports whether the error is of the target kind
+func (e *Error) Is(target error) bool {
+	if e == nil || e.kind == nil {
+		return false
+	}
+
+	return target == error(e.kind)
+}
+
+// Is, As and Unwrap are the standard library functions, so callers need
+// only this package
+func Is(err, target error) bool {
+	return stderrors.Is(err, target)
+}
+
+func As(err error, target interface{}) bool {
+	return stderrors.As(err, target)
+}
+
+func Unwrap(err error) error {
+	return stderrors.Unwrap(err)
+}
+
+// ErrorTraceLogField adds the stack trace, the kind and the fields of every
+// error in the chain to a log entry
+func ErrorTraceLogField(err error) zap.Field {
+	return zap.Inline(logDetails{err: err})
+}
+
+type logDetails struct {
+	err error
+}
+
+func (d logDetails) MarshalLogObject(encoder zapcore.ObjectEncoder) error {
+	encoder.AddString("error_stacktrace", getTrace(d.err))
+
+	var kinds []string
+	for err := d.err; err != nil; err = stderrors.Unwrap(err) {
+		e, ok := err.(*Error)
+		if !ok || e == nil {
+			continue
+		}
+		if e.kind != nil {
+			kinds = append(kinds, e.kind.name)
+		}
+		for _, field := range e.fields {
+			field.AddTo(encoder)
+		}
+	}
+	if len(kinds) > 0 {
+		encoder.AddString("error_kind", strings.Join(kinds, ","))
+	}
+
+	return nil
+}
+
+// getTrace returns the deepest stack trace of the chain, that is the origin
+func getTrace(err error) string {
 	var stackTrace string
-	if err, ok := err.originalError.(stackTracer); ok {
-		for _, f := range err.StackTrace() {
-			s, err := f.MarshalText()
-			if err != nil {
-				log.Panic(err.Error())
+	for ; err != nil; err = stderrors.Unwrap(err) {
+		switch e := err.(type) {
+		case *Error:
+			if e != nil && e.stack != nil {
+				stackTrace = formatStack(e.stack)
+			}
+		case stackTracer:
+			stackTrace = ""
+			for _, frame := range e.StackTrace() {
+				stackTrace += fmt.Sprintf("%+v\n", frame)
 			}
-
-			stackTrace = stackTrace + string(s) + "\n"
 		}
 	}
 
 	return stackTrace
 }
 
-// Wrap ...
-func Wrap(err error, errorType string) *Error {
-	return &Error{
-		Type:          errorType,
-		originalError: errors.Wrap(err, ""),
+func hasStack(err error) bool {
+	for ; err != nil; err = stderrors.Unwrap(err) {
+		switch e := err.(type) {
+		case *Error:
+			if e != nil && e.stack != nil {
+				return true
+			}
+		case stackTracer:
+			return true
+		}
 	}
+
+	return false
 }
 
-// New ...
-func New(message string, errorType string) *Error {
-	return &Error{
-		Type:          errorType,
-		originalError: errors.New(message),
-	}
+func callers() []uintptr {
+	const depth = 32
+	pcs := make([]uintptr, depth)
+	// skip runtime.Callers, callers and the constructor
+	n := runtime.Callers(3, pcs)
+
+	return pcs[:n]
 }
 
-func (e *Error) Error() string {
-	return e.originalError.Error()
+func formatStack(stack []uintptr) string {
+	var builder strings.Builder
+	frames := runtime.CallersFrames(stack)
+	for {
+		frame, more := frames.Next()
+		fmt.Fprintf(&builder, "%s\n\t%s:%d\n", frame.Function, frame.File, frame.Line)
+		if !more {
+			break
+		}
+	}
+
+	return builder.String()
 }
@@ -0,0 +1,142 @@
+package errors_test
+
+import (
+	"fmt"
+	"io"
+	"strings"
+	"testing"
+
+	pkgerrors "github.com/pkg/errors"
+	"go.uber.org/zap/zapcore"
+
+	"github.com/kranikitao/fxhash-telegram-bot/src/errors"
+)
+
+var (
+	errNotFound = errors.NewKind("not_found")
+	errInvalid  = errors.NewKind("invalid")
+)
+
+func TestIs(t *testing.T) {
+	var nilError *errors.Error
+	for _, test := range []struct {
+		name   string
+		err    error
+		target error
+		want   bool
+	}{
+		{name: "kind", err: errors.New("no row", errNotFound), target: errNotFound, want: true},
+		{name: "other kind", err: errors.New("no row", errNotFound), target: errInvalid},
+		{name: "no kind", err: errors.New("no row", nil), target: errNotFound},
+		{name: "nil error", err: nilError, target: errNotFound},
+		{name: "wrapped", err: errors.Wrap(errors.Wrap(errors.New("no row", errNotFound), "can't get item"), "can't send"), target: errNotFound, want: true},
+		{name: "wrapped by fmt", err: fmt.Errorf("can't send: %w", errors.New("no row", errNotFound)), target: errNotFound, want: true},
+		{name: "kind of the wrapper", err: errors.Wrap(io.EOF, "can't read").WithKind(errInvalid), target: errInvalid, want: true},
+		{name: "kind of the wrapper is not the cause", err: errors.Wrap(io.EOF, "can't read").WithKind(errInvalid), target: errNotFound},
+		{name: "inner kind under another kind", err: errors.Wrap(errors.New("no row", errNotFound), "can't read").WithKind(errInvalid), target: errNotFound, want: true},
+		{name: "standard sentinel", err: errors.Wrap(errors.Wrap(io.EOF, "can't read"), "can't load"), target: io.EOF, want: true},
+		{name: "kind is not a message", err: errors.New("not_found", nil), target: errNotFound},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			if got := errors.Is(test.err, test.target); got != test.want {
+				t.Fatalf("Is(%v, %v): want %v, got %v", test.err, test.target, test.want, got)
+			}
+		})
+	}
+}
+
+func TestWrap(t *testing.T) {
+	var nilError *errors.Error
+	if err := errors.Wrap(nil, "can't read"); err != nil {
+		t.Fatalf("Wrap(nil): want nil, got %v", err)
+	}
+	if err := errors.Wrap(nilError, "can't read"); err != nil {
+		t.Fatalf("Wrap of a nil *Error: want nil, got %v", err)
+	}
+
+	for _, test := range []struct {
+		err  error
+		want string
+	}{
+		{err: errors.New("no row", errNotFound), want: "no row"},
+		{err: errors.Wrap(errors.New("no row", errNotFound), "can't get item"), want: "can't get item: no row"},
+		{err: errors.Wrap(io.EOF, ""), want: "EOF"},
+		{err: errors.Wrap(errors.Wrap(io.EOF, "can't read"), "can't load"), want: "can't load: can't read: EOF"},
+	} {
+		if got := test.err.Error(); got != test.want {
+			t.Fatalf("Error: want %q, got %q", test.want, got)
+		}
+	}
+	cause := errors.New("no row", errNotFound)
+	if unwrapped := errors.Unwrap(errors.Wrap(cause, "can't get item")); unwrapped != error(cause) {
+		t.Fatalf("Unwrap: want the cause, got %v", unwrapped)
+	}
+}
+
+// logFields returns the fields ErrorTraceLogField adds to a log entry
+func logFields(err error) map[string]interface{} {
+	encoder := zapcore.NewMapObjectEncoder()
+	errors.ErrorTraceLogField(err).AddTo(encoder)
+
+	return encoder.Fields
+}
+
+func failWithKind() error {
+	return errors.New("no row", errNotFound)
+}
+
+func failWithStd() error {
+	return errors.Wrap(io.EOF, "can't read")
+}
+
+func failWithPkg() error {
+	return pkgerrors.New("no row")
+}
+
+// wrapTwice wraps err like two layers above the failure do
+func wrapTwice(err error) error {
+	return errors.Wrap(errors.Wrap(err, "can't get item"), "can't send")
+}
+
+func TestStackCapturedOnce(t *testing.T) {
+	for _, test := range []struct {
+		name   string
+		fail   func() error
+		origin string
+	}{
+		{name: "new", fail: failWithKind, origin: "errors_test.failWithKind"},
+		{name: "wrapped standard error", fail: failWithStd, origin: "errors_test.failWithStd"},
+		{name: "pkg/errors", fail: failWithPkg, origin: "errors_test.failWithPkg"},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			trace, _ := logFields(wrapTwice(test.fail()))["error_stacktrace"].(string)
+			first := strings.SplitN(trace, "\n", 2)[0]
+			if !strings.HasSuffix(first, test.origin) {
+				t.Fatalf("the trace must start at %s, got %q", test.origin, first)
+			}
+			if strings.Contains(trace, "wrapTwice") {
+				t.Fatalf("wrapping must keep the origin trace, got a trace of the wrappers:\n%s", trace)
+			}
+		})
+	}
+
+	// an error wrapped without a trace gets the trace of the first wrapper
+	trace, _ := logFields(wrapTwice(io.EOF))["error_stacktrace"].(string)
+	if first := strings.SplitN(trace, "\n", 2)[0]; !strings.HasSuffix(first, "errors_test.wrapTwice") {
+		t.Fatalf("the trace must start at the first wrapper, got %q", first)
+	}
+}
+
+func TestErrorTraceLogField(t *testing.T) {
+	err := errors.Wrap(errors.New("no row", errNotFound).With("id", 15021), "can't get item").WithKind(errInvalid).With("chatID", 1)
+	fields := logFields(err)
+	if fields["error_kind"] != "invalid,not_found" {
+		t.Fatalf("error_kind: want the kinds of the chain outermost first, got %v", fields["error_kind"])
+	}
+	if fields["id"] != int64(15021) || fields["chatID"] != int64(1) {
+		t.Fatalf("want the fields of every error in the chain, got %v", fields)
+	}
+	if _, ok := logFields(io.EOF)["error_kind"]; ok {
+		t.Fatal("error_kind: want nothing for an error without a kind")
+	}
+}
@@ -5,24 +5,120 @@ import (
 	"encoding/json"
 	"fmt"
 	"net/http"
+	"strconv"
+	"strings"
 	"time"
 
 	"github.com/kranikitao/fxhash-telegram-bot/src/errors"
+	"github.com/kranikitao/fxhash-telegram-bot/src/metrics"
 )
 
 type FxHash struct {
+	config  Config
+	client  *http.Client
+	metrics *metrics.Metrics
 }
 
+type Config struct {
+	// Endpoint is the GraphQL api url
+	Endpoint string
+	// IPFSGateway serves ipfs:// uris over http
+	IPFSGateway string
+	// PageSize is the number of generatives taken per poll, also the number
+	// of actions taken per followed collector
+	PageSize int
+	// Timeout of a single request
+	Timeout time.Duration
+}
+
+const (
+	DefaultEndpoint    = "https://api.fxhash.xyz/graphql"
+	DefaultIPFSGateway = "https://gateway.fxhash.xyz/ipfs/"
+	DefaultPageSize    = 50
+	DefaultTimeout     = 30 * time.Second
+	// MaxPageSize is the largest take accepted by the api
+	MaxPageSize = 50
+)
+
+var (
+	ErrUserNotFound        = errors.NewKind("fx_hash_user_not_found")
+	ErrGenerativesNotFound = errors.NewKind("fx_hash_generatives_not_found")
+	ErrGenerativeNotFound  = errors.NewKind("fx_hash_generative_not_found")
+)
+
+const (
+	queryLastGeneratives = "last_generatives"
+	queryFreeGeneratives = "free_generatives"
+	queryUser            = "user"
+	queryUserActions     = "user_actions"
+	queryArtistTokens    = "artist_tokens"
+	queryWalletObjkts    = "wallet_objkts"
+	queryTokenListings   = "token_listings"
+	queryArtistListings  = "artist_listings"
+	queryWalletActivity  = "wallet_activity"
+)
+
+// action types telling that the issuer or the target got an objkt
+const (
+	ActionTypeMinted                  = "MINTED_FROM"
+	ActionTypeListingV1Accepted       = "LISTING_V1_ACCEPTED"
+	ActionTypeListingV2Accepted       = "LISTING_V2_ACCEPTED"
+	ActionTypeOfferAccepted           = "OFFER_ACCEPTED"
+	ActionTypeCollectionOfferAccepted = "COLLECTION_OFFER_ACCEPTED"
+	// ActionTypeTransfered is a transfer from the issuer to the target
+	ActionTypeTransfered = "TRANSFERED"
+)
+
+// action types of offers made and of a token minted out
 const (
-	ErrTypeUserNotFound = "fx_hash_user_not_found"
+	ActionTypeOffer           = "OFFER"
+	ActionTypeCollectionOffer = "COLLECTION_OFFER"
+	ActionTypeCompleted       = "COMPLETED"
 )
 
-func New() *FxHash {
-	return &FxHash{}
+func New(metrics *metrics.Metrics, config Config) *FxHash {
+	if config.IPFSGateway == "" {
+		config.IPFSGateway = DefaultIPFSGateway
+	}
+	if config.PageSize <= 0 || config.PageSize > MaxPageSize {
+		config.PageSize = DefaultPageSize
+	}
+	if config.Timeout <= 0 {
+		config.Timeout = DefaultTimeout
+	}
+
+	return &FxHash{
+		config:  config,
+		client:  &http.Client{Timeout: config.Timeout},
+		metrics: metrics,
+	}
+}
+
+// GatewayURL turns an ipfs:// uri into an http url of the configured gateway.
+// Other uris are returned as is.
+func (fxHash *FxHash) GatewayURL(uri string) string {
+	if !strings.HasPrefix(uri, "ipfs://") {
+		return uri
+	}
+
+	return strings.TrimSuffix(fxHash.config.IPFSGateway, "/") + "/" + strings.TrimPrefix(uri, "ipfs://")
+}
+
+type GraphQLError struct {
+	Message string `json:"message"`
+}
+
+type graphQLResponse interface {
+	graphQLErrors() []*GraphQLError
 }
 
 type GenerativeTokensResponse struct {
-	Data *GenerativeTokensDataResponse `json:"data"`
+	Data   *GenerativeTokensDataResponse `json:"data"`
+	Errors []*GraphQLError               `json:"errors"`
+}
+
+func (r *GenerativeTokensResponse) graphQLErrors() []*GraphQLError {
+	return r.Errors
 }
 
 type GenerativeTokensDataResponse struct {
@@ -39,10 +135,54 @@ type GenerativeToken struct {
 	Flag                string               `json:"flag"`
 	Reserves            []*Reserve           `json:"reserves"`
 	Author              *Author              `json:"author"`
-	Collaborators       []*Author            `json:"collaborators"`
 	MintOpensAt         time.Time            `json:"mintOpensAt"`
 	PricingFixed        *PricingFixed        `json:"pricingFixed"`
 	PricingDutchAuction *PricingDutchAuction `json:"pricingDutchAuction"`
+	// Royalties of secondary sales in permille
+	Royalties int `json:"royalties"`
+	// Actions are only queried by GetArtistTokens
+	Actions []*Action `json:"actions"`
+	// Listings are only queried by GetTokenListings and GetArtistListings
+	Listings []*Listing `json:"listings"`
+	// CollectionOffers are only queried by GetWalletActivity
+	CollectionOffers []*Offer `json:"collectionOffers"`
+}
+
+// Price returns the fixed price or the resting price of the dutch auction in mutez
+func (t *GenerativeToken) Price() (int64, bool) {
+	if t.PricingFixed != nil {
+		return int64(t.PricingFixed.Price), true
+	}
+	if t.PricingDutchAuction != nil {
+		return int64(t.PricingDutchAuction.RestingPrice), true
+	}
+
+	return 0, false
+}
+
+// Artists returns the collaborators when the author is a collaboration
+// contract, the author otherwise
+func (t *GenerativeToken) Artists() []*Author {
+	if t.Author == nil {
+		return nil
+	}
+	if t.Author.IsCollaboration() {
+		return t.Author.Collaborators
+	}
+
+	return []*Author{t.Author}
+}
+
+// AuthorName returns the author name or names of the collaborators
+func (t *GenerativeToken) AuthorName() string {
+	var names []string
+	for _, artist := range t.Artists() {
+		if artist != nil && artist.Name != "" {
+			names = append(names, artist.Name)
+		}
+	}
+
+	return strings.Join(names, ", ")
 }
 
 type PricingFixed struct {
@@ -59,47 +199,106 @@ type Reserve struct {
 type Author struct {
 	Name string `json:"name"`
 	Id   string `json:"id"`
+	// Type is like COLLAB_CONTRACT_V1 for collaboration contracts, it is
+	// only queried with generatives
+	Type string `json:"type"`
+	// Collaborators are the artists behind a collaboration contract
+	Collaborators []*Author `json:"collaborators"`
+}
+
+// IsCollaboration reports whether the author is a collaboration contract
+func (a *Author) IsCollaboration() bool {
+	return strings.HasPrefix(a.Type, "COLLAB_CONTRACT") || len(a.Collaborators) > 0
 }
 
 func (fxHash *FxHash) GetLastGeneratives() ([]*GenerativeToken, *errors.Error) {
-	bodyString := `{"query":"query Query($filters: GenerativeTokenFilter, $sort: GenerativeSortInput, $take: Int) {\n  generativeTokens(filters: $filters, sort: $sort, take: $take) {\n    author {\n      name\n      id\n      collaborators {\n        name\n        id\n      }\n      type\n    }\n    name\n    slug\n    createdAt\n    id\n    flag\n    balance\n    objktsCount\n    supply\n    mintOpensAt\n    reserves {\n      amount\n    }\n    enabled\n  }\n}","variables":{"sort":{"mintOpensAt":"DESC"},"take":50}}`
+	bodyString := fmt.Sprintf(`{"query":"query Query($filters: GenerativeTokenFilter, $sort: GenerativeSortInput, $take: Int) {\n  generativeTokens(filters: $filters, sort: $sort, take: $take) {\n    author {\n      name\n      id\n      collaborators {\n        name\n        id\n      }\n      type\n    }\n    name\n    slug\n    createdAt\n    id\n    flag\n    balance\n    objktsCount\n    supply\n    mintOpensAt\n    reserves {\n      amount\n    }\n    enabled\n    pricingFixed {\n      price\n    }\n    pricingDutchAuction {\n      restingPrice\n    }\n  }\n}","variables":{"sort":{"mintOpensAt":"DESC"},"take":%d}}`, fxHash.config.PageSize)
 
-	response, err := fxHash.request(bodyString)
+	response, err := fxHash.request(queryLastGeneratives, bodyString)
 	if err != nil {
 		return nil, err
 	}
 
-	var result []*GenerativeToken
-	for _, token := range response.Data.GenerativeTokens {
-		if !fxHash.isAvailableToMint(token) {
-			continue
-		}
-		result = append(result, token)
-	}
+	result := fxHash.filterAvailableToMint(queryLastGeneratives, response.Data.GenerativeTokens, func(token *GenerativeToken) bool {
+		return true
+	})
 	if len(result) == 0 {
-		return nil, errors.New("not found generatives", "")
+		return nil, errors.New("not found generatives", ErrGenerativesNotFound)
 	}
 	return result, nil
 }
 
-func (*FxHash) request(bodyString string) (*GenerativeTokensResponse, *errors.Error) {
-	postBody := []byte(bodyString)
-	responseBody := bytes.NewBuffer(postBody)
-	resp, err := http.Post("https://api.fxhash.xyz/graphql", "application/json", responseBody)
+func (fxHash *FxHash) request(query string, bodyString string) (*GenerativeTokensResponse, *errors.Error) {
+	response := &GenerativeTokensResponse{}
+	if err := fxHash.post(query, bodyString, response); err != nil {
+		return nil, err
+	}
+
+	if response.Data == nil {
+		return nil, errors.New("empty result", nil)
+	}
+
+	return response, nil
+}
+
+// post sends the GraphQL request, decodes the response body into response
+// and reports the request to metrics under the query label
+func (fxHash *FxHash) post(query string, bodyString string, response graphQLResponse) *errors.Error {
+	startedAt := time.Now()
+	err := fxHash.doPost(bodyString, response)
 	if err != nil {
-		return nil, errors.Wrap(err, "")
+		err.With("query", query)
 	}
-	response := &GenerativeTokensResponse{}
-	err = json.NewDecoder(resp.Body).Decode(response)
+	fxHash.metrics.FxHashRequestDuration.WithLabelValues(query).Observe(time.Since(startedAt).Seconds())
+	if err != nil {
+		fxHash.metrics.FxHashRequestErrors.WithLabelValues(query).Inc()
+	}
+
+	return err
+}
+
+func (fxHash *FxHash) doPost(bodyString string, response graphQLResponse) *errors.Error {
+	resp, err := fxHash.client.Post(fxHash.config.Endpoint, "application/json", bytes.NewBufferString(bodyString))
 	if err != nil {
-		return nil, errors.Wrap(err, "")
+		return errors.Wrap(err, "fxhash request failed")
 	}
+	defer resp.Body.Close()
 
-	if response == nil || response.Data == nil {
-		return nil, errors.New("empty result", "")
+	if resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusBadRequest {
+		return errors.New(fmt.Sprintf("unexpected status %s", resp.Status), nil)
+	}
+	if err := json.NewDecoder(resp.Body).Decode(response); err != nil {
+		return errors.Wrap(err, "can't decode fxhash response")
 	}
 
-	return response, nil
+	return graphQLError(response.graphQLErrors())
+}
+
+func graphQLError(graphQLErrors []*GraphQLError) *errors.Error {
+	if len(graphQLErrors) == 0 {
+		return nil
+	}
+	messages := make([]string, 0, len(graphQLErrors))
+	for _, graphQLError := range graphQLErrors {
+		messages = append(messages, graphQLError.Message)
+	}
+
+	return errors.New("graphql error: "+strings.Join(messages, "; "), nil)
+}
+
+// filterAvailableToMint reports seen and filtered out tokens of the poll
+func (fxHash *FxHash) filterAvailableToMint(poll string, tokens []*GenerativeToken, accept func(token *GenerativeToken) bool) []*GenerativeToken {
+	var result []*GenerativeToken
+	for _, token := range tokens {
+		if !fxHash.isAvailableToMint(token) || !accept(token) {
+			continue
+		}
+		result = append(result, token)
+	}
+	fxHash.metrics.TokensSeen.WithLabelValues(poll).Add(float64(len(tokens)))
+	fxHash.metrics.TokensFiltered.WithLabelValues(poll).Add(float64(len(tokens) - len(result)))
+
+	return result
 }
 
 func (*FxHash) isAvailableToMint(token *GenerativeToken) bool {
@@ -130,62 +329,338 @@ func (*FxHash) isAvailableToMint(token *GenerativeToken) bool {
 }
 
 func (fxHash *FxHash) GetFreeGeneratives() ([]*GenerativeToken, *errors.Error) {
-	bodyString := `{"query":"query Query($filters: GenerativeTokenFilter, $sort: GenerativeSortInput, $take: Int) {\n  generativeTokens(filters: $filters, sort: $sort, take: $take) {\n    author {\n      name\n      id\n      collaborators {\n        name\n        id\n      }\n      type\n    }\n    name\n    slug\n    createdAt\n    id\n    flag\n    balance\n    objktsCount\n    supply\n    mintOpensAt\n    reserves {\n      amount\n    }\n    enabled\n    pricingFixed {\n      price\n    }\n    pricingDutchAuction {\n      finalPrice\n      restingPrice\n      levels\n      decrementDuration\n      opensAt\n    }\n  }\n}","variables":{"sort":{"mintOpensAt":"DESC"},"take":50,"filters":{"price_lte":1}}}`
+	bodyString := fmt.Sprintf(`{"query":"query Query($filters: GenerativeTokenFilter, $sort: GenerativeSortInput, $take: Int) {\n  generativeTokens(filters: $filters, sort: $sort, take: $take) {\n    author {\n      name\n      id\n      collaborators {\n        name\n        id\n      }\n      type\n    }\n    name\n    slug\n    createdAt\n    id\n    flag\n    balance\n    objktsCount\n    supply\n    mintOpensAt\n    reserves {\n      amount\n    }\n    enabled\n    pricingFixed {\n      price\n    }\n    pricingDutchAuction {\n      finalPrice\n      restingPrice\n      levels\n      decrementDuration\n      opensAt\n    }\n  }\n}","variables":{"sort":{"mintOpensAt":"DESC"},"take":%d,"filters":{"price_lte":1}}}`, fxHash.config.PageSize)
 
-	response, err := fxHash.request(bodyString)
+	response, err := fxHash.request(queryFreeGeneratives, bodyString)
 	if err != nil {
 		return nil, err
 	}
 
-	var result []*GenerativeToken
-	for _, token := range response.Data.GenerativeTokens {
-		if !fxHash.isAvailableToMint(token) {
-			continue
-		}
-
+	result := fxHash.filterAvailableToMint(queryFreeGeneratives, response.Data.GenerativeTokens, func(token *GenerativeToken) bool {
 		hasZeroCost := token.PricingFixed != nil && token.PricingFixed.Price == 0
 		// (token.PricingDutchAuction != nil && token.PricingDutchAuction.RestingPrice == 0)
-		if !hasZeroCost {
-			continue
-		}
-
-		result = append(result, token)
-	}
+		return hasZeroCost
+	})
 	if len(result) == 0 {
-		return nil, errors.New("not found generatives", "")
+		return nil, errors.New("not found generatives", ErrGenerativesNotFound)
 	}
 	return result, nil
 }
 
 type UserResponse struct {
-	Data *UserDataResponse `json:"data"`
+	Data   *UserDataResponse `json:"data"`
+	Errors []*GraphQLError   `json:"errors"`
+}
+
+func (r *UserResponse) graphQLErrors() []*GraphQLError {
+	return r.Errors
 }
 
 type UserDataResponse struct {
 	User *User `json:"user"`
 }
 type User struct {
-	Name string `json:"name"`
-	Id   string `json:"id"`
-	Flag string `json:"flag"`
+	Name        string `json:"name"`
+	Id          string `json:"id"`
+	Flag        string `json:"flag"`
+	Description string `json:"description"`
 }
 
 func (fxHash *FxHash) GetFxHashUser(fxHashUserName string) (*User, *errors.Error) {
-	bodyString := fmt.Sprintf(`{"query":"query User($name: String) {\n  user(name: $name) {\n    name\n    id\n    flag\n  }\n}","variables":{"name":"%s"}}`, fxHashUserName)
-	postBody := []byte(bodyString)
-	responseBody := bytes.NewBuffer(postBody)
-	resp, err := http.Post("https://api.fxhash.xyz/graphql", "application/json", responseBody)
-	if err != nil {
-		return nil, errors.Wrap(err, "")
+	variables, jsonErr := json.Marshal(map[string]string{"name": fxHashUserName})
+	if jsonErr != nil {
+		return nil, errors.Wrap(jsonErr, "can't encode variables")
 	}
+	bodyString := fmt.Sprintf(`{"query":"query User($name: String) {\n  user(name: $name) {\n    name\n    id\n    flag\n    description\n  }\n}","variables":%s}`, variables)
+
 	response := &UserResponse{}
-	err = json.NewDecoder(resp.Body).Decode(response)
-	if err != nil {
-		return nil, errors.Wrap(err, "")
+	if err := fxHash.post(queryUser, bodyString, response); err != nil {
+		return nil, err
+	}
+
+	if response.Data == nil || response.Data.User == nil {
+		return nil, errors.New("User not found", ErrUserNotFound).With("fxHashUserName", fxHashUserName)
+	}
+	return response.Data.User, nil
+}
+
+type UserActionsResponse struct {
+	Data   *UserActionsDataResponse `json:"data"`
+	Errors []*GraphQLError          `json:"errors"`
+}
+
+func (r *UserActionsResponse) graphQLErrors() []*GraphQLError {
+	return r.Errors
+}
+
+type UserActionsDataResponse struct {
+	User *UserActions `json:"user"`
+}
+type UserActions struct {
+	Id      string    `json:"id"`
+	Name    string    `json:"name"`
+	Actions []*Action `json:"actions"`
+	// GenerativeTokens are only queried by GetArtistTokens and GetArtistListings
+	GenerativeTokens []*GenerativeToken `json:"generativeTokens"`
+	// Objkts are only queried by GetWalletObjkts and GetWalletActivity
+	Objkts []*Objkt `json:"objkts"`
+	// Auctions the user bid on are only queried by GetWalletActivity
+	Auctions []*Auction `json:"auctions"`
+}
+
+// Action is an event of the fxhash history. Buyers are the issuer of
+// accepted listings and the target of accepted offers.
+type Action struct {
+	Id        string           `json:"id"`
+	Type      string           `json:"type"`
+	CreatedAt time.Time        `json:"createdAt"`
+	Issuer    *Author          `json:"issuer"`
+	Target    *Author          `json:"target"`
+	Token     *GenerativeToken `json:"token"`
+	Objkt     *Objkt           `json:"objkt"`
+	// NumericValue is the price in mutez
+	NumericValue *float64 `json:"numericValue"`
+}
+
+// Objkt is an iteration of a generative token, fields besides Id and Name are
+// only queried by GetWalletObjkts
+type Objkt struct {
+	Id        int64            `json:"id"`
+	Name      string           `json:"name"`
+	Iteration int              `json:"iteration"`
+	CreatedAt time.Time        `json:"createdAt"`
+	Issuer    *GenerativeToken `json:"issuer"`
+	Features  []*Feature       `json:"features"`
+	// Rarity is between 0 and 1, lower is rarer, nil until fxhash computes it
+	Rarity  *float64  `json:"rarity"`
+	Actions []*Action `json:"actions"`
+	// Offers are only queried by GetWalletActivity
+	Offers []*Offer `json:"offers"`
+}
+
+// Feature is a trait of an objkt, values are strings, numbers or booleans
+type Feature struct {
+	Name  string      `json:"name"`
+	Value interface{} `json:"value"`
+}
+
+// Collector returns the user who minted or bought the objkt of the action,
+// nil for actions which are neither
+func (a *Action) Collector() *Author {
+	switch a.Type {
+	case ActionTypeMinted, ActionTypeListingV1Accepted, ActionTypeListingV2Accepted:
+		return a.Issuer
+	case ActionTypeOfferAccepted, ActionTypeCollectionOfferAccepted:
+		return a.Target
+	}
+
+	return nil
+}
+
+// Price returns the price of the action in mutez
+func (a *Action) Price() (int64, bool) {
+	if a.NumericValue == nil {
+		return 0, false
+	}
+
+	return int64(*a.NumericValue), true
+}
+
+// GetUserActions returns the latest actions of the user, newest first
+func (fxHash *FxHash) GetUserActions(fxHashUserID string) ([]*Action, *errors.Error) {
+	variables, jsonErr := json.Marshal(map[string]interface{}{"id": fxHashUserID, "take": fxHash.config.PageSize})
+	if jsonErr != nil {
+		return nil, errors.Wrap(jsonErr, "can't encode variables")
+	}
+	bodyString := fmt.Sprintf(`{"query":"query UserActions($id: String, $take: Int) {\n  user(id: $id) {\n    id\n    name\n    actions(take: $take, skip: 0) {\n      id\n      type\n      createdAt\n      numericValue\n      issuer {\n        id\n        name\n      }\n      target {\n        id\n        name\n      }\n      objkt {\n        id\n        name\n      }\n      token {\n        id\n        name\n        slug\n        author {\n          id\n          name\n          collaborators {\n            id\n            name\n          }\n        }\n      }\n    }\n  }\n}","variables":%s}`, variables)
+
+	response := &UserActionsResponse{}
+	if err := fxHash.post(queryUserActions, bodyString, response); err != nil {
+		return nil, err
+	}
+
+	if response.Data == nil || response.Data.User == nil {
+		return nil, errors.New("User not found", ErrUserNotFound).With("fxHashUserID", fxHashUserID)
+	}
+	return response.Data.User.Actions, nil
+}
+
+// GetArtistTokens returns the latest generative tokens of the artist with
+// their latest actions, newest first
+func (fxHash *FxHash) GetArtistTokens(fxHashUserID string) ([]*GenerativeToken, *errors.Error) {
+	variables, jsonErr := json.Marshal(map[string]interface{}{"id": fxHashUserID, "take": fxHash.config.PageSize})
+	if jsonErr != nil {
+		return nil, errors.Wrap(jsonErr, "can't encode variables")
+	}
+	bodyString := fmt.Sprintf(`{"query":"query ArtistTokens($id: String, $take: Int) {\n  user(id: $id) {\n    id\n    name\n    generativeTokens(take: $take, skip: 0) {\n      id\n      name\n      slug\n      supply\n      balance\n      royalties\n      actions(take: $take, skip: 0) {\n        id\n        type\n        createdAt\n        numericValue\n        issuer {\n          id\n          name\n        }\n        target {\n          id\n          name\n        }\n        objkt {\n          id\n          name\n        }\n      }\n    }\n  }\n}","variables":%s}`, variables)
+
+	response := &UserActionsResponse{}
+	if err := fxHash.post(queryArtistTokens, bodyString, response); err != nil {
+		return nil, err
+	}
+
+	if response.Data == nil || response.Data.User == nil {
+		return nil, errors.New("User not found", ErrUserNotFound).With("fxHashUserID", fxHashUserID)
+	}
+	return response.Data.User.GenerativeTokens, nil
+}
+
+// GetWalletObjkts returns the latest objkts owned by the address with their
+// latest actions, newest first. An address unknown to fxhash owns nothing.
+func (fxHash *FxHash) GetWalletObjkts(address string) ([]*Objkt, *errors.Error) {
+	variables, jsonErr := json.Marshal(map[string]interface{}{"id": address, "take": fxHash.config.PageSize})
+	if jsonErr != nil {
+		return nil, errors.Wrap(jsonErr, "can't encode variables")
+	}
+	bodyString := fmt.Sprintf(`{"query":"query WalletObjkts($id: String, $take: Int) {\n  user(id: $id) {\n    id\n    name\n    objkts(take: $take, skip: 0, sort: {createdAt: \"DESC\"}) {\n      id\n      name\n      iteration\n      createdAt\n      rarity\n      features\n      issuer {\n        id\n        name\n        slug\n        supply\n      }\n      actions(take: 10, skip: 0) {\n        id\n        type\n        createdAt\n        numericValue\n        issuer {\n          id\n          name\n        }\n        target {\n          id\n          name\n        }\n      }\n    }\n  }\n}","variables":%s}`, variables)
+
+	response := &UserActionsResponse{}
+	if err := fxHash.post(queryWalletObjkts, bodyString, response); err != nil {
+		return nil, err
+	}
+
+	if response.Data == nil || response.Data.User == nil {
+		return nil, nil
+	}
+	return response.Data.User.Objkts, nil
+}
+
+// Listing is an objkt offered for sale on the marketplace
+type Listing struct {
+	Id        int64     `json:"id"`
+	Version   int       `json:"version"`
+	Price     int64     `json:"price"`
+	CreatedAt time.Time `json:"createdAt"`
+	Issuer    *Author   `json:"issuer"`
+	Objkt     *Objkt    `json:"objkt"`
+}
+
+// Key identifies the listing across versions of the marketplace contract
+func (l *Listing) Key() string {
+	return strconv.Itoa(l.Version) + "-" + strconv.FormatInt(l.Id, 10)
+}
+
+type GenerativeTokenResponse struct {
+	Data   *GenerativeTokenDataResponse `json:"data"`
+	Errors []*GraphQLError              `json:"errors"`
+}
+
+func (r *GenerativeTokenResponse) graphQLErrors() []*GraphQLError {
+	return r.Errors
+}
+
+type GenerativeTokenDataResponse struct {
+	GenerativeToken *GenerativeToken `json:"generativeToken"`
+}
+
+// GetTokenListings returns the generative token with the given id or slug and
+// its cheapest active listings
+func (fxHash *FxHash) GetTokenListings(id int64, slug string) (*GenerativeToken, *errors.Error) {
+	filters := map[string]interface{}{"take": fxHash.config.PageSize}
+	if id != 0 {
+		filters["id"] = id
+	}
+	if slug != "" {
+		filters["slug"] = slug
+	}
+	variables, jsonErr := json.Marshal(filters)
+	if jsonErr != nil {
+		return nil, errors.Wrap(jsonErr, "can't encode variables")
+	}
+	bodyString := fmt.Sprintf(`{"query":"query TokenListings($id: Float, $slug: String, $take: Int) {\n  generativeToken(id: $id, slug: $slug) {\n    id\n    name\n    slug\n    supply\n    author {\n      id\n      name\n    }\n    listings(take: $take, skip: 0, filters: {active_eq: true}, sort: {price: \"ASC\"}) {\n      id\n      version\n      price\n      createdAt\n      issuer {\n        id\n        name\n      }\n      objkt {\n        id\n        name\n        iteration\n      }\n    }\n  }\n}","variables":%s}`, variables)
+
+	response := &GenerativeTokenResponse{}
+	if err := fxHash.post(queryTokenListings, bodyString, response); err != nil {
+		return nil, err
+	}
+
+	if response.Data == nil || response.Data.GenerativeToken == nil {
+		return nil, errors.New("generative not found", ErrGenerativeNotFound).With("id", id).With("slug", slug)
+	}
+	return response.Data.GenerativeToken, nil
+}
+
+// GetArtistListings returns the latest generative tokens of the artist with
+// their cheapest active listings
+func (fxHash *FxHash) GetArtistListings(fxHashUserID string) ([]*GenerativeToken, *errors.Error) {
+	variables, jsonErr := json.Marshal(map[string]interface{}{"id": fxHashUserID, "take": fxHash.config.PageSize})
+	if jsonErr != nil {
+		return nil, errors.Wrap(jsonErr, "can't encode variables")
+	}
+	bodyString := fmt.Sprintf(`{"query":"query ArtistListings($id: String, $take: Int) {\n  user(id: $id) {\n    id\n    name\n    generativeTokens(take: $take, skip: 0) {\n      id\n      name\n      slug\n      supply\n      listings(take: 10, skip: 0, filters: {active_eq: true}, sort: {price: \"ASC\"}) {\n        id\n        version\n        price\n        createdAt\n        issuer {\n          id\n          name\n        }\n        objkt {\n          id\n          name\n          iteration\n        }\n      }\n    }\n  }\n}","variables":%s}`, variables)
+
+	response := &UserActionsResponse{}
+	if err := fxHash.post(queryArtistListings, bodyString, response); err != nil {
+		return nil, err
+	}
+
+	if response.Data == nil || response.Data.User == nil {
+		return nil, errors.New("User not found", ErrUserNotFound).With("fxHashUserID", fxHashUserID)
+	}
+	return response.Data.User.GenerativeTokens, nil
+}
+
+// Offer is an offer to buy an objkt or, for collection offers, any objkt of
+// a generative token
+type Offer struct {
+	Id        int64     `json:"id"`
+	Version   int       `json:"version"`
+	Price     int64     `json:"price"`
+	CreatedAt time.Time `json:"createdAt"`
+	Buyer     *Author   `json:"buyer"`
+}
+
+// Key identifies the offer across versions of the marketplace contract
+func (o *Offer) Key() string {
+	return strconv.Itoa(o.Version) + "-" + strconv.FormatInt(o.Id, 10)
+}
+
+// Auction sells an objkt to the highest bid once it ends
+type Auction struct {
+	Id     int64     `json:"id"`
+	EndsAt time.Time `json:"endsAt"`
+	Objkt  *Objkt    `json:"objkt"`
+	// Bids come newest first
+	Bids []*Bid `json:"bids"`
+}
+
+type Bid struct {
+	Id        int64     `json:"id"`
+	Amount    int64     `json:"amount"`
+	CreatedAt time.Time `json:"createdAt"`
+	Bidder    *Author   `json:"bidder"`
+}
+
+// HighestBid returns the highest bid of the auction, nil when there is none
+func (a *Auction) HighestBid() *Bid {
+	var highest *Bid
+	for _, bid := range a.Bids {
+		if highest == nil || bid.Amount > highest.Amount {
+			highest = bid
+		}
+	}
+
+	return highest
+}
+
+// GetWalletActivity returns the latest objkts owned by the address with their
+// active offers and the active collection offers of their generative tokens,
+// and the running auctions the address bid on. An address unknown to fxhash
+// has no activity.
+func (fxHash *FxHash) GetWalletActivity(address string) (*UserActions, *errors.Error) {
+	variables, jsonErr := json.Marshal(map[string]interface{}{"id": address, "take": fxHash.config.PageSize})
+	if jsonErr != nil {
+		return nil, errors.Wrap(jsonErr, "can't encode variables")
+	}
+	bodyString := fmt.Sprintf(`{"query":"query WalletActivity($id: String, $take: Int) {\n  user(id: $id) {\n    id\n    name\n    objkts(take: $take, skip: 0, sort: {createdAt: \"DESC\"}) {\n      id\n      name\n      issuer {\n        id\n        name\n        slug\n        collectionOffers(filters: {active_eq: true}) {\n          id\n          version\n          price\n          createdAt\n          buyer {\n            id\n            name\n          }\n        }\n      }\n      offers(filters: {active_eq: true}) {\n        id\n        version\n        price\n        createdAt\n        buyer {\n          id\n          name\n        }\n      }\n    }\n    auctions(take: $take, skip: 0, filters: {active_eq: true}) {\n      id\n      endsAt\n      objkt {\n        id\n        name\n      }\n      bids(take: 10, skip: 0, sort: {createdAt: \"DESC\"}) {\n        id\n        amount\n        createdAt\n        bidder {\n          id\n          name\n        }\n      }\n    }\n  }\n}","variables":%s}`, variables)
+
+	response := &UserActionsResponse{}
+	if err := fxHash.post(queryWalletActivity, bodyString, response); err != nil {
+		return nil, err
 	}
 
-	if response.Data.User == nil {
-		return nil, errors.New("User not found", ErrTypeUserNotFound)
+	if response.Data == nil || response.Data.User == nil {
+		return nil, nil
 	}
 	return response.Data.User, nil
 }
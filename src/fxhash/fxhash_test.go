@@ -0,0 +1,184 @@
+package fxhash_test
+
+import (
+	"strings"
+	"testing"
+	"testing/fstest"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+
+	"github.com/kranikitao/fxhash-telegram-bot/src/errors"
+	"github.com/kranikitao/fxhash-telegram-bot/src/fxhash"
+	"github.com/kranikitao/fxhash-telegram-bot/src/fxhash/fxhashtest"
+	"github.com/kranikitao/fxhash-telegram-bot/src/metrics"
+)
+
+func newClient(t *testing.T, config fxhash.Config) (*fxhash.FxHash, *fxhashtest.Server) {
+	server := fxhashtest.NewServer()
+	t.Cleanup(server.Close)
+	config.Endpoint = server.URL()
+
+	return fxhash.New(metrics.New(prometheus.NewRegistry()), config), server
+}
+
+func tokenIds(tokens []*fxhash.GenerativeToken) []int64 {
+	ids := make([]int64, 0, len(tokens))
+	for _, token := range tokens {
+		ids = append(ids, token.Id)
+	}
+
+	return ids
+}
+
+func equalIds(a, b []int64) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+
+	return true
+}
+
+func TestGetLastGeneratives(t *testing.T) {
+	client, _ := newClient(t, fxhash.Config{})
+
+	tokens, err := client.GetLastGeneratives()
+	if err != nil {
+		t.Fatalf("GetLastGeneratives: %v", err)
+	}
+	// sold out, hidden and scheduled fixtures are not available to mint
+	if ids := tokenIds(tokens); !equalIds(ids, []int64{15021, 15020, 15019}) {
+		t.Fatalf("GetLastGeneratives: want tokens 15021, 15020, 15019, got %v", ids)
+	}
+
+	ondulations := tokens[0]
+	if ondulations.Name != "Ondulations" || ondulations.Slug != "ondulations" || ondulations.Balance != 212 || ondulations.Supply != 256 {
+		t.Fatalf("Ondulations decoded as %+v", ondulations)
+	}
+	if ondulations.Author == nil || ondulations.Author.Name != "kranikitao" || ondulations.Author.IsCollaboration() {
+		t.Fatalf("Ondulations author decoded as %+v", ondulations.Author)
+	}
+	if price, ok := ondulations.Price(); !ok || price != 5000000 {
+		t.Fatalf("Ondulations price: want 5000000, got %d, %v", price, ok)
+	}
+	if artists := ondulations.Artists(); len(artists) != 1 || artists[0].Id != "tz1ZPfnRHtLtHoPiE9ibVFDhKXXLALwDfdsd" {
+		t.Fatalf("Ondulations artists: got %+v", artists)
+	}
+	if ondulations.MintOpensAt.IsZero() {
+		t.Fatal("Ondulations mintOpensAt is not decoded")
+	}
+
+	jointVenture := tokens[2]
+	if jointVenture.Author == nil || !jointVenture.Author.IsCollaboration() || jointVenture.Author.Type != "COLLAB_CONTRACT_V1" {
+		t.Fatalf("Joint venture author must be a collaboration contract, got %+v", jointVenture.Author)
+	}
+	artists := jointVenture.Artists()
+	if len(artists) != 2 || artists[0].Id != "tz1ZPfnRHtLtHoPiE9ibVFDhKXXLALwDfdsd" || artists[1].Id != "tz1Vs2H6bCGDZVb4CxWqj4zRLpsWnRCsWeYP" {
+		t.Fatalf("Joint venture artists: want the collaborators, got %+v", artists)
+	}
+	if name := jointVenture.AuthorName(); name != "kranikitao, zancan_fan" {
+		t.Fatalf("Joint venture author name: want %q, got %q", "kranikitao, zancan_fan", name)
+	}
+	if price, ok := jointVenture.Price(); !ok || price != 1000000 {
+		t.Fatalf("Joint venture price: want the resting price 1000000, got %d, %v", price, ok)
+	}
+}
+
+func TestGetFreeGeneratives(t *testing.T) {
+	client, _ := newClient(t, fxhash.Config{})
+
+	tokens, err := client.GetFreeGeneratives()
+	if err != nil {
+		t.Fatalf("GetFreeGeneratives: %v", err)
+	}
+	if ids := tokenIds(tokens); !equalIds(ids, []int64{15020}) {
+		t.Fatalf("GetFreeGeneratives: want token 15020, got %v", ids)
+	}
+	if price, ok := tokens[0].Price(); !ok || price != 0 {
+		t.Fatalf("Free lines price: want 0, got %d, %v", price, ok)
+	}
+}
+
+func TestGetFxHashUser(t *testing.T) {
+	client, _ := newClient(t, fxhash.Config{})
+
+	user, err := client.GetFxHashUser("kranikitao")
+	if err != nil {
+		t.Fatalf("GetFxHashUser: %v", err)
+	}
+	if user.Id != "tz1ZPfnRHtLtHoPiE9ibVFDhKXXLALwDfdsd" || user.Name != "kranikitao" {
+		t.Fatalf("GetFxHashUser: got %+v", user)
+	}
+
+	if _, err := client.GetFxHashUser("nobody"); err == nil || !errors.Is(err, fxhash.ErrUserNotFound) {
+		t.Fatalf("GetFxHashUser of an unknown name: want %s, got %v", fxhash.ErrUserNotFound, err)
+	}
+}
+
+func TestErrors(t *testing.T) {
+	for _, test := range []struct {
+		name  string
+		fault fxhashtest.Fault
+		want  string
+	}{
+		{name: "server error", fault: fxhashtest.FaultServerError, want: "unexpected status 502"},
+		{name: "malformed json", fault: fxhashtest.FaultMalformedJSON, want: "can't decode fxhash response"},
+		{name: "graphql errors", fault: fxhashtest.FaultGraphQLErrors, want: "graphql error: Internal server error"},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			client, server := newClient(t, fxhash.Config{})
+
+			server.FailNext(test.fault)
+			if _, err := client.GetLastGeneratives(); err == nil || !strings.Contains(err.Error(), test.want) {
+				t.Fatalf("GetLastGeneratives: want %q, got %v", test.want, err)
+			}
+			if _, err := client.GetFxHashUser("kranikitao"); err != nil {
+				t.Fatalf("the fault must only break one request, got %v", err)
+			}
+		})
+	}
+}
+
+func TestTimeout(t *testing.T) {
+	client, server := newClient(t, fxhash.Config{Timeout: 50 * time.Millisecond})
+
+	server.SetLatency(time.Second)
+	if _, err := client.GetLastGeneratives(); err == nil || !strings.Contains(err.Error(), "fxhash request failed") {
+		t.Fatalf("GetLastGeneratives: want a failed request, got %v", err)
+	}
+
+	server.SetLatency(0)
+	if _, err := client.GetLastGeneratives(); err != nil {
+		t.Fatalf("GetLastGeneratives after the latency is gone: %v", err)
+	}
+}
+
+func TestEmptyResults(t *testing.T) {
+	server, err := fxhashtest.NewServerWithFixtures(fstest.MapFS{})
+	if err != nil {
+		t.Fatalf("NewServerWithFixtures: %v", err)
+	}
+	t.Cleanup(server.Close)
+	client := fxhash.New(metrics.New(prometheus.NewRegistry()), fxhash.Config{Endpoint: server.URL()})
+
+	if _, err := client.GetLastGeneratives(); err == nil || !errors.Is(err, fxhash.ErrGenerativesNotFound) {
+		t.Fatalf("GetLastGeneratives: want %s, got %v", fxhash.ErrGenerativesNotFound, err)
+	}
+	if _, err := client.GetFreeGeneratives(); err == nil || !errors.Is(err, fxhash.ErrGenerativesNotFound) {
+		t.Fatalf("GetFreeGeneratives: want %s, got %v", fxhash.ErrGenerativesNotFound, err)
+	}
+	if _, err := client.GetFxHashUser("kranikitao"); err == nil || !errors.Is(err, fxhash.ErrUserNotFound) {
+		t.Fatalf("GetFxHashUser: want %s, got %v", fxhash.ErrUserNotFound, err)
+	}
+	if _, err := client.GetTokenListings(15021, ""); err == nil || !errors.Is(err, fxhash.ErrGenerativeNotFound) {
+		t.Fatalf("GetTokenListings: want %s, got %v", fxhash.ErrGenerativeNotFound, err)
+	}
+	if activity, err := client.GetWalletActivity("tz1ZPfnRHtLtHoPiE9ibVFDhKXXLALwDfdsd"); err != nil || activity != nil {
+		t.Fatalf("GetWalletActivity of an unknown wallet: want nothing, got %+v, %v", activity, err)
+	}
+}
@@ -0,0 +1,134 @@
+package fxhashtest
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+)
+
+// Recorder proxies GraphQL requests to a real endpoint and merges the data
+// of every response into fixture files, so the fakes follow the real API.
+type Recorder struct {
+	endpoint string
+	dir      string
+	client   *http.Client
+	mu       sync.Mutex
+}
+
+func NewRecorder(endpoint string, dir string) *Recorder {
+	return &Recorder{
+		endpoint: endpoint,
+		dir:      dir,
+		client:   &http.Client{},
+	}
+}
+
+func (r *Recorder) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	body, err := io.ReadAll(req.Body)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	resp, err := r.client.Post(r.endpoint, "application/json", bytes.NewReader(body))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadGateway)
+		return
+	}
+	defer resp.Body.Close()
+	responseBody, err := io.ReadAll(resp.Body)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadGateway)
+		return
+	}
+
+	if resp.StatusCode == http.StatusOK {
+		if err := r.record(responseBody); err != nil {
+			http.Error(w, "can't record fixture: "+err.Error(), http.StatusInternalServerError)
+			return
+		}
+	}
+
+	w.Header().Set("Content-Type", resp.Header.Get("Content-Type"))
+	w.WriteHeader(resp.StatusCode)
+	w.Write(responseBody)
+}
+
+func (r *Recorder) record(responseBody []byte) error {
+	response := struct {
+		Data map[string]json.RawMessage `json:"data"`
+	}{}
+	if err := json.Unmarshal(responseBody, &response); err != nil {
+		return err
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for field, data := range response.Data {
+		var objects []map[string]interface{}
+		switch field {
+		case "generativeTokens":
+			if err := json.Unmarshal(data, &objects); err != nil {
+				return err
+			}
+			if err := r.merge(GenerativeTokensFixture, objects); err != nil {
+				return err
+			}
+		case "generativeToken", "user":
+			var object map[string]interface{}
+			if err := json.Unmarshal(data, &object); err != nil {
+				return err
+			}
+			if object == nil {
+				continue
+			}
+			name := GenerativeTokensFixture
+			if field == "user" {
+				name = UsersFixture
+			}
+			if err := r.merge(name, []map[string]interface{}{object}); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+// merge adds objects to the fixture replacing the ones with the same id
+func (r *Recorder) merge(name string, objects []map[string]interface{}) error {
+	path := filepath.Join(r.dir, name)
+	var existing []map[string]interface{}
+	if data, err := os.ReadFile(path); err == nil {
+		if err := json.Unmarshal(data, &existing); err != nil {
+			return fmt.Errorf("%s: %w", path, err)
+		}
+	} else if !os.IsNotExist(err) {
+		return err
+	}
+
+	byID := map[string]map[string]interface{}{}
+	for _, object := range existing {
+		byID[fmt.Sprint(object["id"])] = object
+	}
+	for _, object := range objects {
+		byID[fmt.Sprint(object["id"])] = object
+	}
+	merged := make([]map[string]interface{}, 0, len(byID))
+	for _, object := range byID {
+		merged = append(merged, object)
+	}
+	sort.Slice(merged, func(i, j int) bool { return less(merged[j]["id"], merged[i]["id"]) })
+
+	data, err := json.MarshalIndent(merged, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	return os.WriteFile(path, append(data, '\n'), 0644)
+}
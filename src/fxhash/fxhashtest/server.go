@@ -0,0 +1,459 @@
+// Package fxhashtest provides a local stand-in for the fxhash GraphQL API.
+// It answers generativeTokens, generativeToken and user queries, with the
+// actions of the user and the listings of tokens, from JSON fixtures and can simulate slow responses and broken replies.
+package fxhashtest
+
+import (
+	"embed"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+//go:embed fixtures/*.json
+var defaultFixtures embed.FS
+
+const (
+	GenerativeTokensFixture = "generativeTokens.json"
+	UsersFixture            = "users.json"
+
+	// maxTake is the largest page the real API returns
+	maxTake     = 50
+	defaultTake = 20
+)
+
+type Fault int
+
+const (
+	// FaultServerError answers with 502 Bad Gateway
+	FaultServerError Fault = iota + 1
+	// FaultMalformedJSON answers with a truncated JSON document
+	FaultMalformedJSON
+	// FaultGraphQLErrors answers with a GraphQL error and no data
+	FaultGraphQLErrors
+)
+
+// Request is a GraphQL request received by the server
+type Request struct {
+	Field     string
+	Query     string
+	Variables map[string]interface{}
+}
+
+type graphQLRequest struct {
+	Query     string                 `json:"query"`
+	Variables map[string]interface{} `json:"variables"`
+}
+
+type Server struct {
+	server *httptest.Server
+
+	mu       sync.Mutex
+	tokens   []map[string]interface{}
+	users    []map[string]interface{}
+	latency  time.Duration
+	faults   []Fault
+	requests []Request
+}
+
+// NewServer starts a server answering from the fixtures shipped with the package
+func NewServer() *Server {
+	fixtures, err := fs.Sub(defaultFixtures, "fixtures")
+	if err != nil {
+		panic(err)
+	}
+	s, err := NewServerWithFixtures(fixtures)
+	if err != nil {
+		panic(err)
+	}
+
+	return s
+}
+
+// NewServerWithFixtures starts a server answering from generativeTokens.json
+// and users.json found in fixtures, missing files mean empty collections
+func NewServerWithFixtures(fixtures fs.FS) (*Server, error) {
+	s := &Server{}
+	if err := loadFixture(fixtures, GenerativeTokensFixture, &s.tokens); err != nil {
+		return nil, err
+	}
+	if err := loadFixture(fixtures, UsersFixture, &s.users); err != nil {
+		return nil, err
+	}
+	s.server = httptest.NewServer(http.HandlerFunc(s.handle))
+
+	return s, nil
+}
+
+func loadFixture(fixtures fs.FS, name string, target *[]map[string]interface{}) error {
+	data, err := fs.ReadFile(fixtures, name)
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return nil
+		}
+		return err
+	}
+
+	return json.Unmarshal(data, target)
+}
+
+// URL is the GraphQL endpoint for fxhash.Config
+func (s *Server) URL() string {
+	return s.server.URL
+}
+
+func (s *Server) Close() {
+	s.server.Close()
+}
+
+// SetLatency delays every following response
+func (s *Server) SetLatency(latency time.Duration) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.latency = latency
+}
+
+// FailNext makes the next request fail with the fault
+func (s *Server) FailNext(fault Fault) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.faults = append(s.faults, fault)
+}
+
+// PutGenerativeToken adds a token or replaces the one with the same id.
+// token is anything encoding to a generative token object, such as
+// fxhash.GenerativeToken.
+func (s *Server) PutGenerativeToken(token interface{}) error {
+	return s.put(&s.tokens, token)
+}
+
+// PutUser adds a user or replaces the one with the same id
+func (s *Server) PutUser(user interface{}) error {
+	return s.put(&s.users, user)
+}
+
+func (s *Server) put(collection *[]map[string]interface{}, value interface{}) error {
+	data, err := json.Marshal(value)
+	if err != nil {
+		return err
+	}
+	object := map[string]interface{}{}
+	if err := json.Unmarshal(data, &object); err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for i, existing := range *collection {
+		if fmt.Sprint(existing["id"]) == fmt.Sprint(object["id"]) {
+			(*collection)[i] = object
+			return nil
+		}
+	}
+	*collection = append(*collection, object)
+
+	return nil
+}
+
+// Requests returns received requests in order
+func (s *Server) Requests() []Request {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return append([]Request(nil), s.requests...)
+}
+
+var rootFieldPattern = regexp.MustCompile(`^[^{]*\{\s*([A-Za-z_][A-Za-z0-9_]*)`)
+
+func (s *Server) handle(w http.ResponseWriter, r *http.Request) {
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	request := &graphQLRequest{}
+	if err := json.Unmarshal(body, request); err != nil {
+		writeErrors(w, http.StatusBadRequest, "POST body sent invalid JSON.")
+		return
+	}
+	field := ""
+	if match := rootFieldPattern.FindStringSubmatch(request.Query); match != nil {
+		field = match[1]
+	}
+
+	s.mu.Lock()
+	s.requests = append(s.requests, Request{Field: field, Query: request.Query, Variables: request.Variables})
+	latency := s.latency
+	var fault Fault
+	if len(s.faults) > 0 {
+		fault = s.faults[0]
+		s.faults = s.faults[1:]
+	}
+	s.mu.Unlock()
+
+	if latency > 0 {
+		select {
+		case <-time.After(latency):
+		case <-r.Context().Done():
+			return
+		}
+	}
+
+	switch fault {
+	case FaultServerError:
+		http.Error(w, "<html><body>502 Bad Gateway</body></html>", http.StatusBadGateway)
+		return
+	case FaultMalformedJSON:
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"data":{"`))
+		return
+	case FaultGraphQLErrors:
+		writeErrors(w, http.StatusOK, "Internal server error")
+		return
+	}
+
+	s.mu.Lock()
+	data, err := s.resolve(field, request.Variables)
+	s.mu.Unlock()
+	if err != nil {
+		writeErrors(w, http.StatusOK, err.Error())
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]interface{}{"data": map[string]interface{}{field: data}})
+}
+
+// resolve must be called under lock
+func (s *Server) resolve(field string, variables map[string]interface{}) (interface{}, error) {
+	switch field {
+	case "generativeTokens":
+		return s.generativeTokens(variables)
+	case "generativeToken":
+		for _, token := range s.tokens {
+			if matchesVariable(token, variables, "id") && matchesVariable(token, variables, "slug") {
+				return tokenWithListings(token), nil
+			}
+		}
+		return nil, nil
+	case "user":
+		for _, user := range s.users {
+			if matchesVariable(user, variables, "id") && matchesVariable(user, variables, "name") {
+				return userWithActions(user, variables), nil
+			}
+		}
+		return nil, nil
+	default:
+		return nil, fmt.Errorf("Cannot query field \"%s\" on type \"Query\".", field)
+	}
+}
+
+// userWithActions returns a copy of the user with its latest actions and
+// objkts first, up to the take variable
+func userWithActions(user map[string]interface{}, variables map[string]interface{}) map[string]interface{} {
+	result := map[string]interface{}{}
+	for key, value := range user {
+		result[key] = value
+	}
+	for _, key := range []string{"actions", "objkts"} {
+		list, ok := user[key].([]interface{})
+		if !ok {
+			continue
+		}
+		list = append([]interface{}(nil), list...)
+		sort.SliceStable(list, func(i, j int) bool {
+			a, _ := list[i].(map[string]interface{})
+			b, _ := list[j].(map[string]interface{})
+			return less(b["createdAt"], a["createdAt"])
+		})
+		if take := intVariable(variables, "take", defaultTake); take < len(list) {
+			list = list[:take]
+		}
+		result[key] = list
+	}
+	if tokens, ok := user["generativeTokens"].([]interface{}); ok {
+		list := make([]interface{}, 0, len(tokens))
+		for _, token := range tokens {
+			if token, ok := token.(map[string]interface{}); ok {
+				list = append(list, tokenWithListings(token))
+			}
+		}
+		result["generativeTokens"] = list
+	}
+
+	return result
+}
+
+// tokenWithListings returns a copy of the token with its cheapest listings
+// first
+func tokenWithListings(token map[string]interface{}) map[string]interface{} {
+	listings, ok := token["listings"].([]interface{})
+	if !ok {
+		return token
+	}
+	result := map[string]interface{}{}
+	for key, value := range token {
+		result[key] = value
+	}
+	listings = append([]interface{}(nil), listings...)
+	sort.SliceStable(listings, func(i, j int) bool {
+		a, _ := listings[i].(map[string]interface{})
+		b, _ := listings[j].(map[string]interface{})
+		return less(a["price"], b["price"])
+	})
+	result["listings"] = listings
+
+	return result
+}
+
+func matchesVariable(object map[string]interface{}, variables map[string]interface{}, name string) bool {
+	value, ok := variables[name]
+	if !ok || value == nil {
+		return true
+	}
+
+	return fmt.Sprint(object[name]) == fmt.Sprint(value)
+}
+
+func (s *Server) generativeTokens(variables map[string]interface{}) (interface{}, error) {
+	filters, _ := variables["filters"].(map[string]interface{})
+	result := []map[string]interface{}{}
+	for _, token := range s.tokens {
+		ok, err := matchesFilters(token, filters)
+		if err != nil {
+			return nil, err
+		}
+		if ok {
+			result = append(result, token)
+		}
+	}
+
+	if sortInput, _ := variables["sort"].(map[string]interface{}); len(sortInput) > 0 {
+		for key, direction := range sortInput {
+			descending := direction == "DESC"
+			sort.SliceStable(result, func(i, j int) bool {
+				if descending {
+					return less(result[j][key], result[i][key])
+				}
+				return less(result[i][key], result[j][key])
+			})
+		}
+	} else {
+		sort.SliceStable(result, func(i, j int) bool { return less(result[j]["id"], result[i]["id"]) })
+	}
+
+	skip := intVariable(variables, "skip", 0)
+	take := intVariable(variables, "take", defaultTake)
+	if take > maxTake {
+		return nil, fmt.Errorf("take must be lower than or equal to %d", maxTake)
+	}
+	if skip > len(result) {
+		skip = len(result)
+	}
+	result = result[skip:]
+	if take < len(result) {
+		result = result[:take]
+	}
+
+	return result, nil
+}
+
+func matchesFilters(token map[string]interface{}, filters map[string]interface{}) (bool, error) {
+	for name, value := range filters {
+		switch name {
+		case "price_lte", "price_gte":
+			price, ok := tokenPrice(token)
+			if !ok {
+				return false, nil
+			}
+			limit, _ := value.(float64)
+			if name == "price_lte" && price > limit || name == "price_gte" && price < limit {
+				return false, nil
+			}
+		case "flag_eq":
+			if token["flag"] != value {
+				return false, nil
+			}
+		case "flag_neq":
+			if token["flag"] == value {
+				return false, nil
+			}
+		case "id_in":
+			values, _ := value.([]interface{})
+			found := false
+			for _, id := range values {
+				found = found || fmt.Sprint(token["id"]) == fmt.Sprint(id)
+			}
+			if !found {
+				return false, nil
+			}
+		case "mintOpened_eq":
+			opensAt, _ := time.Parse(time.RFC3339, fmt.Sprint(token["mintOpensAt"]))
+			if time.Now().After(opensAt) != (value == true) {
+				return false, nil
+			}
+		case "searchQuery_eq":
+			if !strings.Contains(strings.ToLower(fmt.Sprint(token["name"])), strings.ToLower(fmt.Sprint(value))) {
+				return false, nil
+			}
+		default:
+			return false, fmt.Errorf("Field \"%s\" is not defined by type \"GenerativeTokenFilter\".", name)
+		}
+	}
+
+	return true, nil
+}
+
+// tokenPrice is the fixed price or the current dutch auction resting price
+func tokenPrice(token map[string]interface{}) (float64, bool) {
+	if pricing, ok := token["pricingFixed"].(map[string]interface{}); ok {
+		price, ok := pricing["price"].(float64)
+		return price, ok
+	}
+	if pricing, ok := token["pricingDutchAuction"].(map[string]interface{}); ok {
+		price, ok := pricing["restingPrice"].(float64)
+		return price, ok
+	}
+
+	return 0, false
+}
+
+func less(a, b interface{}) bool {
+	switch a := a.(type) {
+	case float64:
+		b, _ := b.(float64)
+		return a < b
+	case string:
+		return a < fmt.Sprint(b)
+	}
+
+	return a == nil && b != nil
+}
+
+func intVariable(variables map[string]interface{}, name string, fallback int) int {
+	if value, ok := variables[name].(float64); ok {
+		return int(value)
+	}
+
+	return fallback
+}
+
+func writeErrors(w http.ResponseWriter, status int, message string) {
+	writeJSON(w, status, map[string]interface{}{
+		"errors": []map[string]interface{}{{"message": message}},
+		"data":   nil,
+	})
+}
+
+func writeJSON(w http.ResponseWriter, status int, body interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(body)
+}
@@ -0,0 +1,183 @@
+// Package harness runs the chat, the collector and the sender against fake
+// Telegram and fxhash servers and in-memory stores, so tests can drive whole
+// conversations:
+//
+//	h := harness.New(t)
+//	alice := h.NewUser(1, "alice")
+//	alice.Say("/subscribeartist")
+//	alice.Say("https://www.fxhash.xyz/u/kranikitao")
+//	h.Collect()
+//	h.Deliver()
+//	alice.Say("/unsubscribe")
+//	alice.Press("✅ kranikitao")
+package harness
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/kranikitao/fxhash-telegram-bot/src/artcollector"
+	"github.com/kranikitao/fxhash-telegram-bot/src/chat"
+	"github.com/kranikitao/fxhash-telegram-bot/src/fxhash"
+	"github.com/kranikitao/fxhash-telegram-bot/src/fxhash/fxhashtest"
+	"github.com/kranikitao/fxhash-telegram-bot/src/messagesender"
+	"github.com/kranikitao/fxhash-telegram-bot/src/metrics"
+	"github.com/kranikitao/fxhash-telegram-bot/src/orm"
+	"github.com/kranikitao/fxhash-telegram-bot/src/orm/memory"
+	"github.com/kranikitao/fxhash-telegram-bot/src/telegramtest"
+	"github.com/kranikitao/fxhash-telegram-bot/src/templates"
+	"github.com/prometheus/client_golang/prometheus"
+	"go.uber.org/zap/zaptest"
+)
+
+// Timeout is how long the harness waits for the bot to handle an update
+var Timeout = 5 * time.Second
+
+// AdminChatID is the chat allowed to run admin commands
+const AdminChatID int64 = 1000
+
+type Harness struct {
+	t         *testing.T
+	Telegram  *telegramtest.Server
+	FxHash    *fxhashtest.Server
+	Stores    *orm.Stores
+	Registry  *prometheus.Registry
+	Chat      *chat.Chat
+	Collector *artcollector.ArtCollector
+	Sender    *messagesender.Sender
+}
+
+// New starts the chat polling the fake Telegram server, the chat and the
+// collector query the fake fxhash server loaded with the default fixtures.
+// Everything is stopped on cleanup.
+func New(t *testing.T) *Harness {
+	t.Helper()
+
+	return NewWithStores(t, memory.NewStores())
+}
+
+// NewWithStores is New with the given stores, tests wrap memory stores to
+// make them fail
+func NewWithStores(t *testing.T, stores *orm.Stores) *Harness {
+	t.Helper()
+
+	fxHashServer := fxhashtest.NewServer()
+	t.Cleanup(fxHashServer.Close)
+	telegram := telegramtest.NewServer()
+	bot, err := telegram.NewBot()
+	if err != nil {
+		telegram.Close()
+		t.Fatalf("can't connect to fake bot api: %v", err)
+	}
+
+	logger := zaptest.NewLogger(t)
+	registry := prometheus.NewRegistry()
+	botMetrics := metrics.New(registry)
+	metrics.RegisterStoreGauges(registry, stores)
+	fxHash := fxhash.New(botMetrics, fxhash.Config{Endpoint: fxHashServer.URL()})
+	h := &Harness{
+		t:         t,
+		Telegram:  telegram,
+		FxHash:    fxHashServer,
+		Registry:  registry,
+		Stores:    stores,
+		Chat:      chat.New(bot, logger.Named("bot"), fxHash, stores, botMetrics, templates.Default(), chat.Config{AdminChatIDs: []int64{AdminChatID}}),
+		Collector: artcollector.New(logger.Named("collector"), fxHash, stores, botMetrics, artcollector.Config{Interval: time.Hour}),
+		Sender: messagesender.New(logger.Named("sender"), bot, stores, botMetrics, templates.Default(), messagesender.Config{
+			Interval:     time.Hour,
+			BatchSize:    100,
+			Workers:      2,
+			QueueLength:  10,
+			RateLimit:    time.Millisecond,
+			ClaimTimeout: time.Minute,
+			Owner:        "harness",
+		}),
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		h.Chat.Start(ctx)
+	}()
+	t.Cleanup(func() {
+		cancel()
+		telegram.Close()
+		<-done
+	})
+
+	return h
+}
+
+// Collect runs a single collector poll
+func (h *Harness) Collect() {
+	h.Collector.CollectOnce()
+}
+
+// Deliver sends one batch of pending delivery items
+func (h *Harness) Deliver() {
+	h.Sender.SendBatch()
+}
+
+// User is a Telegram user talking to the bot in a private chat
+type User struct {
+	h        *Harness
+	ChatID   int64
+	UserName string
+	seen     int
+}
+
+func (h *Harness) NewUser(chatID int64, userName string) *User {
+	return &User{h: h, ChatID: chatID, UserName: userName}
+}
+
+// Say sends a text message to the bot and returns the messages the bot sent
+// to the user since the previous call
+func (u *User) Say(text string) []telegramtest.Call {
+	u.h.t.Helper()
+	u.wait(u.h.Telegram.PushMessage(u.ChatID, u.UserName, text))
+
+	return u.Received()
+}
+
+// Press presses the inline button with the given text on the latest bot
+// message having a keyboard and returns new messages like Say does
+func (u *User) Press(buttonText string) []telegramtest.Call {
+	u.h.t.Helper()
+	messages := u.h.Telegram.Messages(u.ChatID)
+	for i := len(messages) - 1; i >= 0; i-- {
+		keyboard := messages[i].InlineKeyboard()
+		if keyboard == nil {
+			continue
+		}
+		for _, row := range keyboard.InlineKeyboard {
+			for _, button := range row {
+				if button.Text == buttonText && button.CallbackData != nil {
+					u.wait(u.h.Telegram.PushCallback(u.ChatID, u.UserName, messages[i].MessageID, *button.CallbackData))
+					return u.Received()
+				}
+			}
+		}
+		break
+	}
+	u.h.t.Fatalf("button %q not found in chat %d", buttonText, u.ChatID)
+
+	return nil
+}
+
+// Received returns messages sent to the user since the previous call
+func (u *User) Received() []telegramtest.Call {
+	messages := u.h.Telegram.Messages(u.ChatID)
+	received := messages[u.seen:]
+	u.seen = len(messages)
+
+	return received
+}
+
+func (u *User) wait(updateID int) {
+	u.h.t.Helper()
+	if !u.h.Telegram.WaitProcessed(updateID, Timeout) {
+		u.h.t.Fatalf("update %d was not processed in %s", updateID, Timeout)
+	}
+}
@@ -0,0 +1,214 @@
+package harness_test
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/kranikitao/fxhash-telegram-bot/src/errors"
+	"github.com/kranikitao/fxhash-telegram-bot/src/fxhash"
+	"github.com/kranikitao/fxhash-telegram-bot/src/harness"
+	"github.com/kranikitao/fxhash-telegram-bot/src/orm"
+	"github.com/kranikitao/fxhash-telegram-bot/src/orm/memory"
+	"github.com/kranikitao/fxhash-telegram-bot/src/orm/model"
+	"github.com/kranikitao/fxhash-telegram-bot/src/telegramtest"
+)
+
+const kranikitaoID = "tz1ZPfnRHtLtHoPiE9ibVFDhKXXLALwDfdsd"
+
+func texts(calls []telegramtest.Call) []string {
+	result := make([]string, 0, len(calls))
+	for _, call := range calls {
+		result = append(result, call.Text())
+	}
+
+	return result
+}
+
+func TestSubscribeCollectDeliverUnsubscribe(t *testing.T) {
+	h := harness.New(t)
+	alice := h.NewUser(1, "alice")
+	bob := h.NewUser(2, "bob")
+
+	alice.Say("/start")
+	alice.Say("/subscribeartist")
+	reply := alice.Say("https://www.fxhash.xyz/u/kranikitao")
+	if len(reply) != 1 || !strings.Contains(reply[0].Text(), "kranikitao") {
+		t.Fatalf("subscribing: want a confirmation, got %q", texts(reply))
+	}
+	bob.Say("/start")
+	bob.Say("/subscribeartist")
+	bob.Say("https://www.fxhash.xyz/u/kranikitao")
+	carol := h.NewUser(3, "carol")
+	carol.Say("/start")
+
+	h.Collect()
+	h.Deliver()
+	received := texts(alice.Received())
+	if len(received) != 2 {
+		t.Fatalf("delivery: want Ondulations and Joint venture, got %q", received)
+	}
+	if !strings.Contains(received[0], "/ondulations") || !strings.Contains(received[1], "/joint-venture") {
+		t.Fatalf("delivery: want Ondulations and the collaboration Joint venture, got %q", received)
+	}
+	if got := bob.Received(); len(got) != 2 {
+		t.Fatalf("delivery: want both tokens for bob, got %q", texts(got))
+	}
+	if got := carol.Received(); len(got) != 0 {
+		t.Fatalf("delivery: carol follows nobody, got %q", texts(got))
+	}
+
+	// a second poll must not deliver the same tokens again
+	h.Collect()
+	h.Deliver()
+	if got := alice.Received(); len(got) != 0 {
+		t.Fatalf("second delivery: want nothing, got %q", texts(got))
+	}
+
+	alice.Say("/unsubscribe")
+	alice.Press("✅ kranikitao")
+	active, err := h.Stores.ArtistSubscriptions.FindActiveByKindAndFxHashArtistIds(model.SubscriptionKindArtist, []string{kranikitaoID})
+	if err != nil {
+		t.Fatalf("FindActiveByKindAndFxHashArtistIds: %v", err)
+	}
+	if len(active) != 1 || active[0].ChatID != bob.ChatID {
+		t.Fatalf("unsubscribing: want only the subscription of bob, got %+v", active)
+	}
+
+	putErr := h.FxHash.PutGenerativeToken(&fxhash.GenerativeToken{
+		Id:           15022,
+		Name:         "After unsubscribe",
+		Slug:         "after-unsubscribe",
+		Enabled:      true,
+		Balance:      10,
+		Supply:       10,
+		MintOpensAt:  time.Now().Add(-time.Minute),
+		Flag:         "NONE",
+		Author:       &fxhash.Author{Id: kranikitaoID, Name: "kranikitao", Type: "REGULAR"},
+		PricingFixed: &fxhash.PricingFixed{Price: 1000000},
+	})
+	if putErr != nil {
+		t.Fatalf("PutGenerativeToken: %v", putErr)
+	}
+	h.Collect()
+	h.Deliver()
+	if got := alice.Received(); len(got) != 0 {
+		t.Fatalf("delivery after unsubscribing: want nothing, got %q", texts(got))
+	}
+	if got := texts(bob.Received()); len(got) != 1 || !strings.Contains(got[0], "/after-unsubscribe") {
+		t.Fatalf("delivery after alice unsubscribed: want the new token for bob, got %q", got)
+	}
+}
+
+func TestBroadcast(t *testing.T) {
+	h := harness.New(t)
+	admin := h.NewUser(harness.AdminChatID, "admin")
+	alice := h.NewUser(1, "alice")
+	bob := h.NewUser(2, "bob")
+	admin.Say("/start")
+	alice.Say("/start")
+	bob.Say("/start")
+
+	admin.Say("/broadcast Maintenance tonight")
+	reply := admin.Press("Send")
+	if len(reply) != 1 || reply[0].Text() != "Broadcast was queued for 3 subscribers." {
+		t.Fatalf("confirming: got %q", texts(reply))
+	}
+
+	// the broadcast is queued per chat so a batch claims it chat by chat
+	pending, err := h.Stores.DeliveryItems.FindPending(10, 0)
+	if err != nil {
+		t.Fatalf("FindPending: %v", err)
+	}
+	chats := map[int64]bool{}
+	for _, item := range pending {
+		chats[item.ChatID] = true
+	}
+	if len(pending) != 3 || !chats[admin.ChatID] || !chats[alice.ChatID] || !chats[bob.ChatID] {
+		t.Fatalf("pending: want a broadcast item for each chat, got %+v", pending)
+	}
+
+	// a second tap on Send before the keyboard disappears queues nothing
+	h.Telegram.FailNext("editMessageReplyMarkup", http.StatusBadRequest, "Bad Request: message is not modified: specified new message content and reply markup are exactly the same")
+	if reply := admin.Press("Send"); len(reply) != 1 || reply[0].Text() != "This broadcast was queued already." {
+		t.Fatalf("confirming twice: got %q", texts(reply))
+	}
+	if pending, err := h.Stores.DeliveryItems.FindPending(10, 0); err != nil || len(pending) != 3 {
+		t.Fatalf("confirming twice must not queue the broadcast again, got %d items, %v", len(pending), err)
+	}
+
+	h.Deliver()
+	for _, user := range []*harness.User{admin, alice, bob} {
+		if got := texts(user.Received()); len(got) != 1 || got[0] != "Maintenance tonight" {
+			t.Fatalf("chat %d: want the broadcast, got %q", user.ChatID, got)
+		}
+	}
+}
+
+func TestBroadcastKeyboardFailure(t *testing.T) {
+	h := harness.New(t)
+	admin := h.NewUser(harness.AdminChatID, "admin")
+	admin.Say("/start")
+
+	admin.Say("/broadcast Maintenance tonight")
+	h.Telegram.FailNext("editMessageReplyMarkup", http.StatusInternalServerError, "Internal Server Error")
+	if reply := admin.Press("Send"); len(reply) != 1 || !strings.Contains(reply[0].Text(), "Unexpected error") {
+		t.Fatalf("confirming: want the error, got %q", texts(reply))
+	}
+	if pending, err := h.Stores.DeliveryItems.FindPending(10, 0); err != nil || len(pending) != 0 {
+		t.Fatalf("a broadcast whose keyboard stays must not be queued, got %d items, %v", len(pending), err)
+	}
+	if reply := admin.Press("Send"); len(reply) != 1 || reply[0].Text() != "Broadcast was queued for 1 subscriber." {
+		t.Fatalf("confirming again: got %q", texts(reply))
+	}
+}
+
+// failingSubscriptions can't save subscriptions
+type failingSubscriptions struct {
+	orm.ArtistSubscriptionStore
+}
+
+func (failingSubscriptions) Create(*model.ArtistSubscribtion) *errors.Error {
+	return errors.New("connection refused", nil)
+}
+
+func (failingSubscriptions) Update(*model.ArtistSubscribtion) *errors.Error {
+	return errors.New("connection refused", nil)
+}
+
+func TestFollowCollectorStoreFailure(t *testing.T) {
+	stores := memory.NewStores()
+	stores.ArtistSubscriptions = failingSubscriptions{stores.ArtistSubscriptions}
+	h := harness.NewWithStores(t, stores)
+	alice := h.NewUser(1, "alice")
+	alice.Say("/start")
+
+	alice.Say("/followcollector")
+	reply := alice.Say("https://www.fxhash.xyz/u/kranikitao")
+	if len(reply) != 1 || !strings.Contains(reply[0].Text(), "Unexpected error") || reply[0].InlineKeyboard() != nil {
+		t.Fatalf("following when the subscription can't be saved: want the error only, got %q", texts(reply))
+	}
+}
+
+func TestUpdatesOffsetIsKept(t *testing.T) {
+	stores := memory.NewStores()
+	// the previous leader handled the first two updates
+	if err := stores.Settings.Set(model.SettingUpdatesOffset, "3"); err != nil {
+		t.Fatalf("Set: %v", err)
+	}
+	h := harness.NewWithStores(t, stores)
+	alice := h.NewUser(1, "alice")
+
+	for i := 1; i <= 2; i++ {
+		if reply := alice.Say("/start"); len(reply) != 0 {
+			t.Fatalf("update %d was handled by the previous leader, got %q", i, texts(reply))
+		}
+	}
+	if reply := alice.Say("/start"); len(reply) != 1 {
+		t.Fatalf("update 3: want the welcome, got %q", texts(reply))
+	}
+	if offset, err := stores.Settings.Get(model.SettingUpdatesOffset); err != nil || offset != "4" {
+		t.Fatalf("Get %s: want 4, got %q, %v", model.SettingUpdatesOffset, offset, err)
+	}
+}
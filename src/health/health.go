@@ -0,0 +1,158 @@
+package health
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const checkTimeout = 5 * time.Second
+
+// Check returns a short description of the state and an error when the
+// checked dependency or component is not healthy
+type Check func(ctx context.Context) (string, error)
+
+type namedCheck struct {
+	name  string
+	check Check
+}
+
+type Status struct {
+	Name    string `json:"name"`
+	Healthy bool   `json:"healthy"`
+	Message string `json:"message"`
+}
+
+type Report struct {
+	Healthy bool      `json:"healthy"`
+	Checks  []*Status `json:"checks"`
+}
+
+// Health serves /healthz with liveness checks, failing when a component is
+// stuck and the process should be restarted, and /readyz with readiness
+// checks, failing when the bot can't reach its dependencies.
+type Health struct {
+	mu        sync.Mutex
+	liveness  []namedCheck
+	readiness []namedCheck
+}
+
+func New() *Health {
+	return &Health{}
+}
+
+func (h *Health) AddLiveness(name string, check Check) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.liveness = append(h.liveness, namedCheck{name: name, check: check})
+}
+
+func (h *Health) AddReadiness(name string, check Check) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.readiness = append(h.readiness, namedCheck{name: name, check: check})
+}
+
+func (h *Health) Register(mux *http.ServeMux) {
+	mux.Handle("/healthz", h.handler(func() []namedCheck { return h.liveness }))
+	mux.Handle("/readyz", h.handler(func() []namedCheck { return h.readiness }))
+}
+
+func (h *Health) handler(checks func() []namedCheck) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		h.mu.Lock()
+		selected := append([]namedCheck(nil), checks()...)
+		h.mu.Unlock()
+
+		report := run(r.Context(), selected)
+		w.Header().Set("Content-Type", "application/json")
+		if !report.Healthy {
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+		json.NewEncoder(w).Encode(report)
+	})
+}
+
+func run(ctx context.Context, checks []namedCheck) *Report {
+	report := &Report{Healthy: true, Checks: make([]*Status, len(checks))}
+	var wg sync.WaitGroup
+	for i, check := range checks {
+		wg.Add(1)
+		go func(i int, check namedCheck) {
+			defer wg.Done()
+			checkCtx, cancel := context.WithTimeout(ctx, checkTimeout)
+			defer cancel()
+			message, err := check.check(checkCtx)
+			status := &Status{Name: check.name, Healthy: err == nil, Message: message}
+			if err != nil {
+				status.Message = err.Error()
+			}
+			report.Checks[i] = status
+		}(i, check)
+	}
+	wg.Wait()
+
+	for _, status := range report.Checks {
+		report.Healthy = report.Healthy && status.Healthy
+	}
+
+	return report
+}
+
+// Heartbeat remembers when a component did its job successfully last time
+type Heartbeat struct {
+	last int64
+}
+
+func NewHeartbeat() *Heartbeat {
+	heartbeat := &Heartbeat{}
+	heartbeat.Beat()
+
+	return heartbeat
+}
+
+func (h *Heartbeat) Beat() {
+	atomic.StoreInt64(&h.last, time.Now().UnixNano())
+}
+
+func (h *Heartbeat) Last() time.Time {
+	return time.Unix(0, atomic.LoadInt64(&h.last))
+}
+
+// Cached runs check at most once per ttl and returns its last result in
+// between, probes then don't hit a rate limited dependency every time
+func Cached(check Check, ttl time.Duration) Check {
+	var (
+		mu        sync.Mutex
+		checkedAt time.Time
+		message   string
+		err       error
+	)
+
+	return func(ctx context.Context) (string, error) {
+		mu.Lock()
+		defer mu.Unlock()
+		if checkedAt.IsZero() || time.Since(checkedAt) >= ttl {
+			message, err = check(ctx)
+			checkedAt = time.Now()
+		}
+
+		return message, err
+	}
+}
+
+// Staleness fails when the last success happened more than threshold ago
+func Staleness(last func() time.Time, threshold time.Duration) Check {
+	return func(ctx context.Context) (string, error) {
+		since := time.Since(last()).Round(time.Second)
+		if since > threshold {
+			return "", fmt.Errorf("last success %s ago, threshold is %s", since, threshold)
+		}
+
+		return fmt.Sprintf("last success %s ago", since), nil
+	}
+}
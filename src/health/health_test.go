@@ -0,0 +1,124 @@
+package health_test
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/kranikitao/fxhash-telegram-bot/src/health"
+)
+
+func TestStaleness(t *testing.T) {
+	for _, test := range []struct {
+		name    string
+		since   time.Duration
+		healthy bool
+		message string
+	}{
+		{name: "fresh", since: 0, healthy: true, message: "last success 0s ago"},
+		{name: "below threshold", since: 4 * time.Minute, healthy: true, message: "last success 4m0s ago"},
+		{name: "at threshold", since: 5 * time.Minute, healthy: true, message: "last success 5m0s ago"},
+		{name: "over threshold", since: 6 * time.Minute, message: "last success 6m0s ago, threshold is 5m0s"},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			last := time.Now().Add(-test.since)
+			message, err := health.Staleness(func() time.Time { return last }, 5*time.Minute)(context.Background())
+			if healthy := err == nil; healthy != test.healthy {
+				t.Fatalf("Staleness: want healthy %v, got %q, %v", test.healthy, message, err)
+			}
+			if err != nil {
+				message = err.Error()
+			}
+			if message != test.message {
+				t.Fatalf("Staleness: want %q, got %q", test.message, message)
+			}
+		})
+	}
+}
+
+func TestHeartbeat(t *testing.T) {
+	heartbeat := health.NewHeartbeat()
+	if since := time.Since(heartbeat.Last()); since < 0 || since > time.Second {
+		t.Fatalf("NewHeartbeat must beat, last beat %s ago", since)
+	}
+	first := heartbeat.Last()
+	time.Sleep(time.Millisecond)
+	heartbeat.Beat()
+	if !heartbeat.Last().After(first) {
+		t.Fatalf("Beat: want a later beat than %s, got %s", first, heartbeat.Last())
+	}
+}
+
+func TestCached(t *testing.T) {
+	calls := 0
+	check := health.Cached(func(ctx context.Context) (string, error) {
+		calls++
+		if calls == 2 {
+			return "", fmt.Errorf("failure %d", calls)
+		}
+		return fmt.Sprintf("call %d", calls), nil
+	}, 50*time.Millisecond)
+
+	for i := 0; i < 3; i++ {
+		if message, err := check(context.Background()); err != nil || message != "call 1" {
+			t.Fatalf("within the ttl: want the first result, got %q, %v", message, err)
+		}
+	}
+	time.Sleep(60 * time.Millisecond)
+	// failures are cached too, a flapping dependency is not asked every probe
+	for i := 0; i < 2; i++ {
+		if _, err := check(context.Background()); err == nil || err.Error() != "failure 2" {
+			t.Fatalf("after the ttl: want the second result, got %v", err)
+		}
+	}
+	if calls != 2 {
+		t.Fatalf("want 2 calls, got %d", calls)
+	}
+}
+
+func TestHandler(t *testing.T) {
+	h := health.New()
+	h.AddLiveness("collector", func(ctx context.Context) (string, error) { return "fresh", nil })
+	h.AddReadiness("database", func(ctx context.Context) (string, error) { return "ok", nil })
+	h.AddReadiness("telegram", func(ctx context.Context) (string, error) { return "", fmt.Errorf("unauthorized") })
+	mux := http.NewServeMux()
+	h.Register(mux)
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	for _, test := range []struct {
+		path    string
+		status  int
+		healthy bool
+		checks  string
+	}{
+		{path: "/healthz", status: http.StatusOK, healthy: true, checks: "collector:fresh"},
+		{path: "/readyz", status: http.StatusServiceUnavailable, checks: "database:ok telegram:unauthorized"},
+	} {
+		response, err := http.Get(server.URL + test.path)
+		if err != nil {
+			t.Fatalf("GET %s: %v", test.path, err)
+		}
+		report := &health.Report{}
+		err = json.NewDecoder(response.Body).Decode(report)
+		response.Body.Close()
+		if err != nil {
+			t.Fatalf("GET %s: can't decode the report: %v", test.path, err)
+		}
+		if response.StatusCode != test.status || report.Healthy != test.healthy {
+			t.Fatalf("GET %s: want %d and healthy %v, got %d and %+v", test.path, test.status, test.healthy, response.StatusCode, report)
+		}
+		var checks []string
+		for _, status := range report.Checks {
+			checks = append(checks, status.Name+":"+status.Message)
+		}
+		if got := strings.Join(checks, " "); got != test.checks {
+			t.Fatalf("GET %s: want checks %q, got %q", test.path, test.checks, got)
+		}
+	}
+}
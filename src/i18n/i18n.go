@@ -0,0 +1,150 @@
+// Package i18n translates texts of the bot. Catalogs are embedded JSON files,
+// one per language, mapping a key to a fmt format or to plural forms of it:
+//
+//	{
+//	  "subscribe.artist.done": "You are subscribed to %s.",
+//	  "digest.hourly": {"one": "%d new generative", "other": "%d new generatives"}
+//	}
+//
+// Keys missing in a catalog fall back to DefaultLanguage.
+package i18n
+
+import (
+	"embed"
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+const DefaultLanguage = "en"
+
+// languages are ordered as they are offered to users
+var languages = []string{"en", "fr", "ja", "es"}
+
+// plural forms
+const (
+	one   = "one"
+	other = "other"
+)
+
+//go:embed locales/*.json
+var locales embed.FS
+
+type message struct {
+	text   string
+	plural map[string]string
+}
+
+func (m *message) UnmarshalJSON(data []byte) error {
+	if err := json.Unmarshal(data, &m.text); err == nil {
+		return nil
+	}
+
+	return json.Unmarshal(data, &m.plural)
+}
+
+var catalogs = load()
+
+// load panics on a broken catalog, they are embedded so it fails on start
+func load() map[string]map[string]*message {
+	result := map[string]map[string]*message{}
+	for _, language := range languages {
+		data, err := locales.ReadFile("locales/" + language + ".json")
+		if err != nil {
+			panic(fmt.Sprintf("i18n: can't read catalog %s: %v", language, err))
+		}
+		catalog := map[string]*message{}
+		if err := json.Unmarshal(data, &catalog); err != nil {
+			panic(fmt.Sprintf("i18n: can't parse catalog %s: %v", language, err))
+		}
+		result[language] = catalog
+	}
+
+	return result
+}
+
+// Languages returns supported language codes
+func Languages() []string {
+	return append([]string(nil), languages...)
+}
+
+// Match returns the supported language of a Telegram language code like
+// "fr" or "pt-br", DefaultLanguage when it is not supported
+func Match(code string) string {
+	code = strings.ToLower(code)
+	if i := strings.IndexAny(code, "-_"); i >= 0 {
+		code = code[:i]
+	}
+	if _, ok := catalogs[code]; ok {
+		return code
+	}
+
+	return DefaultLanguage
+}
+
+// T formats the text of key in language with args
+func T(language string, key string, args ...interface{}) string {
+	m := lookup(language, key)
+	if m == nil {
+		return key
+	}
+	text := m.text
+	if m.plural != nil {
+		text = m.plural[other]
+	}
+
+	return sprintf(text, args)
+}
+
+// N formats the plural form of key for count, count is the first argument
+// of the format followed by args
+func N(language string, key string, count int, args ...interface{}) string {
+	language = Match(language)
+	m := lookup(language, key)
+	if m == nil {
+		return key
+	}
+	text := m.text
+	if m.plural != nil {
+		var ok bool
+		if text, ok = m.plural[pluralForm(language, count)]; !ok {
+			text = m.plural[other]
+		}
+	}
+
+	return sprintf(text, append([]interface{}{count}, args...))
+}
+
+func lookup(language string, key string) *message {
+	if m, ok := catalogs[Match(language)][key]; ok {
+		return m
+	}
+
+	return catalogs[DefaultLanguage][key]
+}
+
+func sprintf(text string, args []interface{}) string {
+	if len(args) == 0 {
+		return text
+	}
+
+	return fmt.Sprintf(text, args...)
+}
+
+// pluralForm follows CLDR rules of the supported languages
+func pluralForm(language string, count int) string {
+	switch language {
+	case "ja":
+		return other
+	case "fr":
+		if count == 0 || count == 1 {
+			return one
+		}
+	default:
+		if count == 1 {
+			return one
+		}
+	}
+
+	return other
+}
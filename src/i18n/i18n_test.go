@@ -0,0 +1,133 @@
+package i18n_test
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"testing"
+
+	"github.com/kranikitao/fxhash-telegram-bot/src/i18n"
+)
+
+// catalog maps keys to their forms, a plain text is the "other" form
+type catalog map[string]map[string]string
+
+func readCatalog(t *testing.T, language string) catalog {
+	t.Helper()
+	data, err := os.ReadFile(filepath.Join("locales", language+".json"))
+	if err != nil {
+		t.Fatalf("ReadFile: %v", err)
+	}
+	var raw map[string]json.RawMessage
+	if err := json.Unmarshal(data, &raw); err != nil {
+		t.Fatalf("%s: %v", language, err)
+	}
+	result := catalog{}
+	for key, value := range raw {
+		var text string
+		if err := json.Unmarshal(value, &text); err == nil {
+			result[key] = map[string]string{"": text}
+			continue
+		}
+		forms := map[string]string{}
+		if err := json.Unmarshal(value, &forms); err != nil {
+			t.Fatalf("%s: %s is neither a text nor plural forms: %v", language, key, err)
+		}
+		result[key] = forms
+	}
+
+	return result
+}
+
+// verbPattern matches fmt verbs. A percent followed by a space is literal
+// text like "20% off", catalogs don't use the space flag.
+var verbPattern = regexp.MustCompile(`%(?:\[(\d+)\])?[-+#0]*\d*(?:\.\d+)?([a-zA-Z%])`)
+
+// verbs returns the verb formatting each argument, by argument number
+func verbs(text string) map[int]string {
+	result := map[int]string{}
+	argument := 1
+	for _, match := range verbPattern.FindAllStringSubmatch(text, -1) {
+		if match[2] == "%" {
+			continue
+		}
+		if match[1] != "" {
+			argument, _ = strconv.Atoi(match[1])
+		}
+		result[argument] = match[2]
+		argument++
+	}
+
+	return result
+}
+
+func sameVerbs(a map[int]string, b map[int]string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for argument, verb := range a {
+		if b[argument] != verb {
+			return false
+		}
+	}
+
+	return true
+}
+
+func formNames(forms map[string]string) []string {
+	var names []string
+	for name := range forms {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	return names
+}
+
+func TestCatalogsMatchDefaultLanguage(t *testing.T) {
+	base := readCatalog(t, i18n.DefaultLanguage)
+	for _, language := range i18n.Languages() {
+		t.Run(language, func(t *testing.T) {
+			translated := readCatalog(t, language)
+			for key := range base {
+				if _, ok := translated[key]; !ok {
+					t.Errorf("%s is missing", key)
+				}
+			}
+			for key, forms := range translated {
+				baseForms, ok := base[key]
+				if !ok {
+					t.Errorf("%s is not in %s", key, i18n.DefaultLanguage)
+					continue
+				}
+				_, plain := forms[""]
+				_, basePlain := baseForms[""]
+				if plain != basePlain {
+					t.Errorf("%s: want forms %q like %s, got %q", key, formNames(baseForms), i18n.DefaultLanguage, formNames(forms))
+					continue
+				}
+				if !plain {
+					// languages without a singular like ja have the other form only
+					if _, ok := forms["other"]; !ok {
+						t.Errorf("%s: the other form is missing", key)
+					}
+				}
+				want := verbs(baseForms["other"])
+				if plain {
+					want = verbs(baseForms[""])
+				}
+				for name, text := range forms {
+					if name != "" && name != "one" && name != "other" {
+						t.Errorf("%s: unknown plural form %q", key, name)
+					}
+					if got := verbs(text); !sameVerbs(got, want) {
+						t.Errorf("%s %s: want verbs %v like %s, got %v in %q", key, name, want, i18n.DefaultLanguage, got, text)
+					}
+				}
+			}
+		})
+	}
+}
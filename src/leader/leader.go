@@ -0,0 +1,137 @@
+package leader
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/kranikitao/fxhash-telegram-bot/src/errors"
+	"go.uber.org/zap"
+)
+
+// Elector elects a single leader among bot replicas sharing one database.
+// Leadership is a Postgres session level advisory lock, so it is released
+// automatically by the server when the leader's connection goes away.
+type Elector struct {
+	logger   *zap.Logger
+	db       *sql.DB
+	lockID   int64
+	interval time.Duration
+	isLeader int32
+}
+
+func New(logger *zap.Logger, db *sql.DB, lockID int64, interval time.Duration) *Elector {
+	return &Elector{
+		logger:   logger,
+		db:       db,
+		lockID:   lockID,
+		interval: interval,
+	}
+}
+
+// IsLeader reports whether this replica holds the leadership right now.
+func (e *Elector) IsLeader() bool {
+	return atomic.LoadInt32(&e.isLeader) == 1
+}
+
+// Run campaigns for leadership until ctx is done. Every time this replica
+// becomes the leader, lead is called with a context which is canceled as
+// soon as the leadership is lost. Run waits for lead to return before
+// campaigning again.
+func (e *Elector) Run(ctx context.Context, lead func(ctx context.Context)) {
+	for {
+		conn, err := e.acquire(ctx)
+		if err != nil {
+			e.logger.Error("can't acquire leadership",
+				zap.Error(err),
+				errors.ErrorTraceLogField(err),
+			)
+		}
+		if conn != nil {
+			e.hold(ctx, conn, lead)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(e.interval):
+		}
+	}
+}
+
+// acquire returns the connection holding the lock or nil if another replica
+// is the leader.
+func (e *Elector) acquire(ctx context.Context) (*sql.Conn, *errors.Error) {
+	conn, err := e.db.Conn(ctx)
+	if err != nil {
+		return nil, errors.Wrap(err, "can't get connection")
+	}
+
+	var acquired bool
+	if err := conn.QueryRowContext(ctx, "SELECT pg_try_advisory_lock($1)", e.lockID).Scan(&acquired); err != nil {
+		conn.Close()
+		return nil, errors.Wrap(err, "can't try advisory lock")
+	}
+	if !acquired {
+		conn.Close()
+		return nil, nil
+	}
+
+	return conn, nil
+}
+
+func (e *Elector) hold(ctx context.Context, conn *sql.Conn, lead func(ctx context.Context)) {
+	defer conn.Close()
+
+	leaderCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	atomic.StoreInt32(&e.isLeader, 1)
+	e.logger.Info("leadership acquired")
+
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		defer cancel()
+		lead(leaderCtx)
+	}()
+
+	ticker := time.NewTicker(e.interval)
+	defer ticker.Stop()
+	for leaderCtx.Err() == nil {
+		select {
+		case <-leaderCtx.Done():
+		case <-ticker.C:
+			if err := conn.PingContext(leaderCtx); err != nil && leaderCtx.Err() == nil {
+				err := errors.Wrap(err, "can't ping leader connection")
+				e.logger.Error("leader connection is lost",
+					zap.Error(err),
+					errors.ErrorTraceLogField(err),
+				)
+				cancel()
+			}
+		}
+	}
+	wg.Wait()
+
+	atomic.StoreInt32(&e.isLeader, 0)
+	e.logger.Info("leadership released")
+
+	unlockCtx, cancelUnlock := context.WithTimeout(context.Background(), e.interval)
+	defer cancelUnlock()
+	if _, err := conn.ExecContext(unlockCtx, "SELECT pg_advisory_unlock($1)", e.lockID); err != nil {
+		err := errors.Wrap(err, "can't release advisory lock")
+		e.logger.Warn("can't release advisory lock",
+			zap.Error(err),
+			errors.ErrorTraceLogField(err),
+		)
+		// the session may still hold the lock, so it must not go back to the pool
+		conn.Raw(func(interface{}) error {
+			return driver.ErrBadConn
+		})
+	}
+}
@@ -0,0 +1,289 @@
+package leader_test
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"go.uber.org/zap/zaptest"
+
+	"github.com/kranikitao/fxhash-telegram-bot/src/leader"
+)
+
+const (
+	lockID   = 7461626
+	interval = 10 * time.Millisecond
+	timeout  = 2 * time.Second
+)
+
+// fakeServer keeps advisory locks like Postgres does: a session may take a
+// lock again, the lock is released by as many unlocks or when the session
+// ends
+type fakeServer struct {
+	mu     sync.Mutex
+	owners map[int64]*fakeConn
+}
+
+var (
+	serversMu sync.Mutex
+	servers   = map[string]*fakeServer{}
+)
+
+func init() {
+	sql.Register("fakelock", fakeDriver{})
+}
+
+type fakeDriver struct{}
+
+func (fakeDriver) Open(name string) (driver.Conn, error) {
+	serversMu.Lock()
+	defer serversMu.Unlock()
+
+	return &fakeConn{server: servers[name], held: map[int64]int{}}, nil
+}
+
+// newDB returns a database on a new fake server
+func newDB(t *testing.T) (*sql.DB, *fakeServer) {
+	t.Helper()
+	server := &fakeServer{owners: map[int64]*fakeConn{}}
+	serversMu.Lock()
+	servers[t.Name()] = server
+	serversMu.Unlock()
+	db, err := sql.Open("fakelock", t.Name())
+	if err != nil {
+		t.Fatalf("Open: %v", err)
+	}
+	t.Cleanup(func() { db.Close() })
+
+	return db, server
+}
+
+// dropOwner breaks the connection holding the lock like a network failure
+func (s *fakeServer) dropOwner(lockID int64) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	owner := s.owners[lockID]
+	if owner == nil {
+		return false
+	}
+	owner.broken = true
+
+	return true
+}
+
+func (s *fakeServer) owned(lockID int64) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.owners[lockID] != nil
+}
+
+type fakeConn struct {
+	server *fakeServer
+	held   map[int64]int
+	broken bool
+}
+
+func (c *fakeConn) Prepare(string) (driver.Stmt, error) {
+	return nil, fmt.Errorf("prepared statements are not supported")
+}
+
+func (c *fakeConn) Begin() (driver.Tx, error) {
+	return nil, fmt.Errorf("transactions are not supported")
+}
+
+// Close ends the session, its locks are released
+func (c *fakeConn) Close() error {
+	c.server.mu.Lock()
+	defer c.server.mu.Unlock()
+	for id := range c.held {
+		delete(c.server.owners, id)
+	}
+	c.held = map[int64]int{}
+
+	return nil
+}
+
+func (c *fakeConn) Ping(context.Context) error {
+	c.server.mu.Lock()
+	defer c.server.mu.Unlock()
+	if c.broken {
+		return driver.ErrBadConn
+	}
+
+	return nil
+}
+
+func (c *fakeConn) QueryContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Rows, error) {
+	c.server.mu.Lock()
+	defer c.server.mu.Unlock()
+	if c.broken {
+		return nil, driver.ErrBadConn
+	}
+	if !strings.Contains(query, "pg_try_advisory_lock") {
+		return nil, fmt.Errorf("unexpected query %q", query)
+	}
+	id := args[0].Value.(int64)
+	owner := c.server.owners[id]
+	if owner != nil && owner != c {
+		return &boolRows{value: false}, nil
+	}
+	c.server.owners[id] = c
+	c.held[id]++
+
+	return &boolRows{value: true}, nil
+}
+
+func (c *fakeConn) ExecContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Result, error) {
+	c.server.mu.Lock()
+	defer c.server.mu.Unlock()
+	if c.broken {
+		return nil, driver.ErrBadConn
+	}
+	if !strings.Contains(query, "pg_advisory_unlock") {
+		return nil, fmt.Errorf("unexpected query %q", query)
+	}
+	id := args[0].Value.(int64)
+	if c.held[id] > 0 {
+		c.held[id]--
+		if c.held[id] == 0 {
+			delete(c.held, id)
+			delete(c.server.owners, id)
+		}
+	}
+
+	return driver.ResultNoRows, nil
+}
+
+type boolRows struct {
+	value bool
+	done  bool
+}
+
+func (r *boolRows) Columns() []string {
+	return []string{"acquired"}
+}
+
+func (r *boolRows) Close() error {
+	return nil
+}
+
+func (r *boolRows) Next(dest []driver.Value) error {
+	if r.done {
+		return io.EOF
+	}
+	r.done = true
+	dest[0] = r.value
+
+	return nil
+}
+
+// replica runs an elector and counts its terms
+type replica struct {
+	elector *leader.Elector
+	terms   int32
+	leading chan struct{}
+	ended   chan struct{}
+	cancel  context.CancelFunc
+	done    chan struct{}
+}
+
+func runReplica(t *testing.T, db *sql.DB) *replica {
+	t.Helper()
+	ctx, cancel := context.WithCancel(context.Background())
+	r := &replica{
+		elector: leader.New(zaptest.NewLogger(t), db, lockID, interval),
+		leading: make(chan struct{}, 10),
+		ended:   make(chan struct{}, 10),
+		cancel:  cancel,
+		done:    make(chan struct{}),
+	}
+	go func() {
+		defer close(r.done)
+		r.elector.Run(ctx, func(ctx context.Context) {
+			atomic.AddInt32(&r.terms, 1)
+			r.leading <- struct{}{}
+			<-ctx.Done()
+			r.ended <- struct{}{}
+		})
+	}()
+	t.Cleanup(func() {
+		cancel()
+		<-r.done
+	})
+
+	return r
+}
+
+func wait(t *testing.T, ch chan struct{}, what string) {
+	t.Helper()
+	select {
+	case <-ch:
+	case <-time.After(timeout):
+		t.Fatalf("timed out waiting until %s", what)
+	}
+}
+
+func TestElectorAcquiresOnce(t *testing.T) {
+	db, server := newDB(t)
+	first := runReplica(t, db)
+	wait(t, first.leading, "the first replica leads")
+	second := runReplica(t, db)
+
+	time.Sleep(10 * interval)
+	if !first.elector.IsLeader() || second.elector.IsLeader() {
+		t.Fatalf("IsLeader: want the first replica only, got %v and %v", first.elector.IsLeader(), second.elector.IsLeader())
+	}
+	if terms := atomic.LoadInt32(&second.terms); terms != 0 {
+		t.Fatalf("the second replica must not lead while the lock is held, led %d times", terms)
+	}
+	if !server.owned(lockID) {
+		t.Fatal("the leader must hold the lock")
+	}
+}
+
+func TestElectorLosesLeadership(t *testing.T) {
+	db, server := newDB(t)
+	r := runReplica(t, db)
+	wait(t, r.leading, "the replica leads")
+
+	if !server.dropOwner(lockID) {
+		t.Fatal("the lock must be held")
+	}
+	wait(t, r.ended, "the lost leadership is canceled")
+	// the broken session is closed and frees the lock, a new one takes it
+	wait(t, r.leading, "the replica leads again")
+	if terms := atomic.LoadInt32(&r.terms); terms != 2 || !r.elector.IsLeader() {
+		t.Fatalf("want a second term, got %d terms and IsLeader %v", terms, r.elector.IsLeader())
+	}
+}
+
+func TestElectorReleasesOnStop(t *testing.T) {
+	db, server := newDB(t)
+	first := runReplica(t, db)
+	wait(t, first.leading, "the first replica leads")
+
+	first.cancel()
+	wait(t, first.ended, "the leader is stopped")
+	wait(t, first.done, "Run returns")
+	if first.elector.IsLeader() {
+		t.Fatal("IsLeader: a stopped replica must not lead")
+	}
+	// the connection goes back to the pool, only the unlock frees the lock
+	if server.owned(lockID) {
+		t.Fatal("a stopped leader must release the lock")
+	}
+
+	second := runReplica(t, db)
+	wait(t, second.leading, "the second replica takes over")
+	if terms := atomic.LoadInt32(&first.terms); terms != 1 {
+		t.Fatalf("the stopped replica must not campaign again, led %d times", terms)
+	}
+}
@@ -0,0 +1,79 @@
+package messagesender
+
+import (
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+	"github.com/kranikitao/fxhash-telegram-bot/src/errors"
+	"github.com/kranikitao/fxhash-telegram-bot/src/metrics"
+	"github.com/kranikitao/fxhash-telegram-bot/src/templates"
+	"go.uber.org/zap"
+)
+
+// maxMessageLength is the Telegram limit of a message text, longer digests
+// are split between items
+const maxMessageLength = 4096
+
+// sendDigest sends items of the chat as one digest, it fails when any part of
+// the digest is not sent
+func (s *Sender) sendDigest(j *job) *errors.Error {
+	chatID, items := j.chatID, j.items
+	tokens := make([]templates.Token, 0, len(items))
+	for _, item := range items {
+		tokens = append(tokens, templates.NewToken(item))
+	}
+	messages, err := s.digestMessages(&templates.Data{Subscriber: j.recipient, Tokens: tokens, DigestMode: j.digest})
+	if err != nil {
+		s.logger.Error(
+			"can't render digest",
+			zap.Int64("chatID", chatID),
+			zap.Int("items", len(items)),
+			zap.Error(err),
+			errors.ErrorTraceLogField(err),
+		)
+		return err
+	}
+	for _, message := range messages {
+		digest := tgbotapi.NewMessage(chatID, message.Text)
+		digest.ParseMode = message.ParseMode
+		if _, err := s.bot.Send(digest); err != nil {
+			s.metrics.MessagesFailed.WithLabelValues(metrics.TelegramErrorCode(err)).Inc()
+			err := errors.Wrap(err, "can't send digest").With("chatID", chatID)
+			s.logger.Error(
+				"can't send digest",
+				zap.Int64("chatID", chatID),
+				zap.Int("items", len(items)),
+				zap.Error(err),
+				errors.ErrorTraceLogField(err),
+			)
+			return err
+		}
+		s.metrics.MessagesSent.Inc()
+	}
+
+	return nil
+}
+
+// digestMessages renders the digest, halving its tokens until every part
+// fits into a message
+func (s *Sender) digestMessages(data *templates.Data) ([]*templates.Message, *errors.Error) {
+	message, err := s.templates.Render(templates.KindDigest, data)
+	if err != nil {
+		return nil, err
+	}
+	if len(message.Text) <= maxMessageLength || len(data.Tokens) == 1 {
+		return []*templates.Message{message}, nil
+	}
+
+	half := len(data.Tokens) / 2
+	first, second := *data, *data
+	first.Tokens, second.Tokens = data.Tokens[:half], data.Tokens[half:]
+	messages, err := s.digestMessages(&first)
+	if err != nil {
+		return nil, err
+	}
+	rest, err := s.digestMessages(&second)
+	if err != nil {
+		return nil, err
+	}
+
+	return append(messages, rest...), nil
+}
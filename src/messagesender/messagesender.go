@@ -1,91 +1,606 @@
 package messagesender
 
 import (
+	"context"
+	"sync"
+	"sync/atomic"
 	"time"
 
 	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
 	"github.com/kranikitao/fxhash-telegram-bot/src/errors"
+	"github.com/kranikitao/fxhash-telegram-bot/src/health"
+	"github.com/kranikitao/fxhash-telegram-bot/src/i18n"
+	"github.com/kranikitao/fxhash-telegram-bot/src/metrics"
 	"github.com/kranikitao/fxhash-telegram-bot/src/orm"
 	"github.com/kranikitao/fxhash-telegram-bot/src/orm/model"
-	"gorm.io/gorm"
+	"github.com/kranikitao/fxhash-telegram-bot/src/supervisor"
+	"github.com/kranikitao/fxhash-telegram-bot/src/templates"
 
 	"go.uber.org/zap"
 )
 
+// maxFailures is how many times an item is tried before it is given up,
+// given up items are marked sent and listed as failed by the admin API
+const maxFailures = 5
+
+type Config struct {
+	// Interval between two batches
+	Interval time.Duration
+	// BatchSize is the maximum number of delivery items taken per batch
+	BatchSize int
+	// Workers is the number of goroutines sending messages
+	Workers int
+	// QueueLength is the capacity of each worker queue
+	QueueLength int
+	// RateLimit is the minimal pause between two Telegram calls shared by all workers
+	RateLimit time.Duration
+	// ClaimTimeout is the time after which items claimed by a dead replica are claimed again
+	ClaimTimeout time.Duration
+	// Owner identifies this replica in claimed items
+	Owner string
+}
+
 type Sender struct {
 	logger            *zap.Logger
 	bot               *tgbotapi.BotAPI
-	deliveryItemStore *orm.DeliveryItemStore
-	subscriberStore   *orm.SubscriberStore
+	config            Config
+	metrics           *metrics.Metrics
+	deliveryItemStore orm.DeliveryItemStore
+	subscriberStore   orm.SubscriberStore
+	templates         *templates.Set
+	// workersMu guards the pool, it is started by the first batch and
+	// stopped with Start
+	workersMu sync.Mutex
+	queues    []chan *job
+	limiter   *time.Ticker
+	workers   sync.WaitGroup
+	sent      *health.Heartbeat
+}
+
+// job sends a single item, or every item in one message when digest is set
+// to the digest mode of the chat
+type job struct {
+	chatID    int64
+	recipient templates.Subscriber
+	items     []*model.DeliveryItem
+	digest    string
+	batch     *batch
+}
+
+type batch struct {
+	wg     sync.WaitGroup
+	sent   int64
+	failed int64
+
+	mu       sync.Mutex
+	failures map[uint64]*itemFailures
+	// sharedFailures are chats a shared item failed to reach
+	sharedFailures []*sharedFailure
+}
+
+type itemFailures struct {
+	count     int64
+	lastError string
 }
 
-func New(logger *zap.Logger, bot *tgbotapi.BotAPI, gorm *gorm.DB) *Sender {
+type sharedFailure struct {
+	item      *model.DeliveryItem
+	chatID    int64
+	lastError string
+}
+
+// fail records a failed job, err is nil when sending panicked. Failures of
+// shared items are kept per chat, the item itself reached other chats.
+func (b *batch) fail(j *job, err *errors.Error) {
+	lastError := "panic"
+	if err != nil {
+		lastError = err.Error()
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	for _, item := range j.items {
+		if item.ChatID == model.NullChatID {
+			b.sharedFailures = append(b.sharedFailures, &sharedFailure{item: item, chatID: j.chatID, lastError: lastError})
+			continue
+		}
+		if b.failures == nil {
+			b.failures = map[uint64]*itemFailures{}
+		}
+		failures, ok := b.failures[item.ID]
+		if !ok {
+			failures = &itemFailures{}
+			b.failures[item.ID] = failures
+		}
+		failures.count++
+		failures.lastError = lastError
+	}
+}
+
+// apply adds failures recorded in the batch to the item and reports whether
+// there were any
+func (b *batch) apply(item *model.DeliveryItem) bool {
+	failures, ok := b.failures[item.ID]
+	if ok {
+		item.Failures += failures.count
+		item.LastError = failures.lastError
+	}
+
+	return ok
+}
+
+func New(logger *zap.Logger, bot *tgbotapi.BotAPI, stores *orm.Stores, metrics *metrics.Metrics, templates *templates.Set, config Config) *Sender {
+	if config.Workers < 1 {
+		config.Workers = 1
+	}
+
 	return &Sender{
 		logger:            logger,
 		bot:               bot,
-		deliveryItemStore: orm.GetDeliveryItemStore(gorm),
-		subscriberStore:   orm.GetSubscriberStore(gorm),
+		config:            config,
+		metrics:           metrics,
+		sent:              health.NewHeartbeat(),
+		deliveryItemStore: stores.DeliveryItems,
+		subscriberStore:   stores.Subscribers,
+		templates:         templates,
 	}
 }
 
-func (s *Sender) Start() {
-	done := make(chan bool)
-	ticker := time.NewTicker(60 * time.Second)
+// Start sends pending delivery items until ctx is done. Senders may run on
+// every replica at once: each batch is claimed before it is sent.
+func (s *Sender) Start(ctx context.Context) {
+	defer s.stopWorkers()
+	ticker := time.NewTicker(s.config.Interval)
+	defer ticker.Stop()
 	for {
 		select {
-		case <-done:
-			ticker.Stop()
+		case <-ctx.Done():
+			return
 		case <-ticker.C:
-			deliveryItems, err := s.deliveryItemStore.FindNotSent()
-			if err != nil {
-				s.logger.Error("can't get delivery items",
-					zap.Error(err),
-					errors.ErrorTraceLogField(err),
-				)
-				continue
-			}
-			subscribers, err := s.subscriberStore.FindSubscribed()
-			if err != nil && err.Type != orm.ErrNotFound {
-				s.logger.Error(
-					"can't get active subscribers",
-					zap.Error(err),
-					errors.ErrorTraceLogField(err),
-				)
+			s.SendBatch()
+		}
+	}
+}
+
+// startWorkers runs the worker pool unless it runs already. Every chat is
+// bound to a single worker, so messages to the same chat are delivered in the
+// order they were queued. Workers share the rate limiter, a zero RateLimit
+// sends without pauses.
+func (s *Sender) startWorkers() {
+	s.workersMu.Lock()
+	defer s.workersMu.Unlock()
+	if s.queues != nil {
+		return
+	}
+
+	var limiter <-chan time.Time
+	if s.config.RateLimit > 0 {
+		s.limiter = time.NewTicker(s.config.RateLimit)
+		limiter = s.limiter.C
+	}
+	s.queues = make([]chan *job, s.config.Workers)
+	for i := range s.queues {
+		s.queues[i] = make(chan *job, s.config.QueueLength)
+		s.workers.Add(1)
+		go s.work(s.queues[i], limiter)
+	}
+}
+
+// stopWorkers lets workers finish queued jobs and exit, the next batch
+// starts a new pool
+func (s *Sender) stopWorkers() {
+	s.workersMu.Lock()
+	defer s.workersMu.Unlock()
+	for _, queue := range s.queues {
+		close(queue)
+	}
+	s.workers.Wait()
+	if s.limiter != nil {
+		s.limiter.Stop()
+		s.limiter = nil
+	}
+	s.queues = nil
+}
+
+func (s *Sender) work(queue <-chan *job, limiter <-chan time.Time) {
+	defer s.workers.Done()
+	for j := range queue {
+		if limiter != nil {
+			<-limiter
+		}
+		s.process(j)
+	}
+}
+
+// process sends the job, a panic fails the job only and keeps the worker alive
+func (s *Sender) process(j *job) {
+	sent := false
+	var err *errors.Error
+	defer func() {
+		if sent {
+			atomic.AddInt64(&j.batch.sent, 1)
+		} else {
+			atomic.AddInt64(&j.batch.failed, 1)
+			j.batch.fail(j, err)
+		}
+		j.batch.wg.Done()
+	}()
+	defer supervisor.Recover(s.logger, "sender worker")
+
+	if j.digest != "" {
+		err = s.sendDigest(j)
+	} else {
+		err = s.sendMessage(j)
+	}
+	sent = err == nil
+}
+
+// enqueue sends the item to the subscriber, or to a chat without a subscriber
+// in UTC and the default language when subscriber is nil
+func (s *Sender) enqueue(b *batch, chatID int64, subscriber *model.Subscriber, location *time.Location, item *model.DeliveryItem) {
+	s.enqueueJob(&job{
+		chatID:    chatID,
+		recipient: templates.NewSubscriber(chatID, subscriber, location),
+		items:     []*model.DeliveryItem{item},
+		batch:     b,
+	})
+}
+
+func (s *Sender) enqueueJob(j *job) {
+	j.batch.wg.Add(1)
+	s.queues[uint64(j.chatID)%uint64(len(s.queues))] <- j
+}
+
+// SendBatch claims a batch of delivery items and waits until it is sent
+func (s *Sender) SendBatch() {
+	s.startWorkers()
+	startedAt := time.Now()
+	deliveryItems, err := s.deliveryItemStore.ClaimNotSent(s.config.Owner, s.config.BatchSize, s.config.ClaimTimeout)
+	if err != nil {
+		s.logger.Error("can't get delivery items",
+			zap.Error(err),
+			errors.ErrorTraceLogField(err),
+		)
+		return
+	}
+	if len(deliveryItems) == 0 {
+		s.sent.Beat()
+		return
+	}
+	// items are not sent to chats in quiet hours or waiting for a digest
+	// unless they are urgent, an item of a single chat is held until it is due
+	// and a shared item gets a held copy for the chat. Zero cost generatives
+	// are skipped for chats which muted them.
+	now := time.Now()
+	subscribers := s.findChatSubscribers(deliveryItems)
+	var recipients []*model.Subscriber
+	recipientsFound := false
+	locations := map[string]*time.Location{}
+	location := func(subscriber *model.Subscriber) *time.Location {
+		if _, ok := locations[subscriber.Timezone]; !ok {
+			locations[subscriber.Timezone] = subscriber.Location()
+		}
+		return locations[subscriber.Timezone]
+	}
+	held := map[uint64]bool{}
+	digests := map[int64][]*model.DeliveryItem{}
+	b := &batch{}
+	for _, item := range deliveryItems {
+		switch item.ChatID {
+		case model.NullChatID:
+			if !recipientsFound {
+				recipients = s.findRecipients()
+				recipientsFound = true
 			}
-			for _, item := range deliveryItems {
-				if item.ChatID == model.NullChatID {
-					for _, subscriber := range subscribers {
-						s.sendMessage(subscriber.ChatID, item)
-					}
-				} else {
-					s.sendMessage(item.ChatID, item)
+			for _, subscriber := range recipients {
+				if subscriber.IsFreeMuted(now) {
+					continue
 				}
-				item.IsSent = true
-				if err := s.deliveryItemStore.Update(item); err != nil {
-					s.logger.Error(
-						"can't update item",
-						zap.Any("item", item),
-						zap.Error(err),
-						errors.ErrorTraceLogField(err),
-					)
+				if until, hold := holdUntil(subscriber, item, now); hold {
+					s.holdCopy(item, subscriber.ChatID, until)
+					continue
 				}
+				s.enqueue(b, subscriber.ChatID, subscriber, location(subscriber), item)
 			}
+		default:
+			subscriber, ok := subscribers[item.ChatID]
+			if !ok {
+				s.enqueue(b, item.ChatID, nil, time.UTC, item)
+				continue
+			}
+			if item.Type == model.DeliveryItemTypeFree && subscriber.IsFreeMuted(now) {
+				continue
+			}
+			if until, hold := holdUntil(subscriber, item, now); hold {
+				held[item.ID] = true
+				item.HoldUntil = &until
+				item.ClaimedBy = ""
+				item.ClaimedAt = nil
+				continue
+			}
+			if inDigest(subscriber, item) {
+				digests[item.ChatID] = append(digests[item.ChatID], item)
+				continue
+			}
+			s.enqueue(b, item.ChatID, subscriber, location(subscriber), item)
 		}
 	}
+	for chatID, items := range digests {
+		s.enqueueJob(&job{
+			chatID:    chatID,
+			recipient: templates.NewSubscriber(chatID, subscribers[chatID], location(subscribers[chatID])),
+			items:     items,
+			digest:    subscribers[chatID].DigestMode,
+			batch:     b,
+		})
+	}
+	b.wg.Wait()
+
+	digested := map[uint64]bool{}
+	for _, items := range digests {
+		failed := false
+		for _, item := range items {
+			digested[item.ID] = true
+			if b.apply(item) {
+				failed = true
+			}
+		}
+		if failed {
+			// the whole digest is sent again with a later batch
+			for _, item := range items {
+				s.retryLater(item)
+				s.update(item)
+			}
+			continue
+		}
+		for _, item := range items {
+			item.LastError = ""
+		}
+		if err := s.deliveryItemStore.MarkSent(items); err != nil {
+			s.logger.Error(
+				"can't mark digest sent",
+				zap.Int64("chatID", items[0].ChatID),
+				zap.Int("items", len(items)),
+				zap.Error(err),
+				errors.ErrorTraceLogField(err),
+			)
+		}
+	}
+	for _, item := range deliveryItems {
+		if digested[item.ID] {
+			continue
+		}
+		switch {
+		case held[item.ID]:
+		case b.apply(item):
+			s.retryLater(item)
+		default:
+			// sent, skipped or shared with failed chats retried by copies
+			item.IsSent = true
+			item.LastError = ""
+		}
+		s.update(item)
+	}
+	for _, failure := range b.sharedFailures {
+		s.retryCopy(failure)
+	}
+
+	if b.sent > 0 || b.failed == 0 {
+		s.sent.Beat()
+	}
+	s.logger.Info(
+		"batch was sent",
+		zap.Int("items", len(deliveryItems)),
+		zap.Int64("sent", b.sent),
+		zap.Int64("failed", b.failed),
+		zap.Int("held", len(held)),
+		zap.Duration("duration", time.Since(startedAt)),
+	)
+}
+
+// retryLater releases the claim of a failed item, so a later batch sends it
+// again. An item failing maxFailures times is given up and marked sent.
+func (s *Sender) retryLater(item *model.DeliveryItem) {
+	if item.Failures >= maxFailures {
+		item.IsSent = true
+		s.logger.Warn(
+			"delivery item was given up",
+			zap.Uint64("id", item.ID),
+			zap.Int64("chatID", item.ChatID),
+			zap.Int64("failures", item.Failures),
+			zap.String("lastError", item.LastError),
+		)
+		return
+	}
+	item.ClaimedBy = ""
+	item.ClaimedAt = nil
 }
 
-func (s *Sender) sendMessage(ChatID int64, item *model.DeliveryItem) {
-	messageText := "A new generative art has appeared on the fxhash: " + item.Url
-	message := tgbotapi.NewMessage(ChatID, messageText)
+func (s *Sender) update(item *model.DeliveryItem) {
+	if err := s.deliveryItemStore.Update(item); err != nil {
+		s.logger.Error(
+			"can't update item",
+			zap.Any("item", item),
+			zap.Error(err),
+			errors.ErrorTraceLogField(err),
+		)
+	}
+}
+
+// holdUntil reports whether the item must wait before it is sent to the
+// subscriber and until when. Urgent items never wait, other items wait for
+// the next digest once and for the end of quiet hours.
+func holdUntil(subscriber *model.Subscriber, item *model.DeliveryItem, now time.Time) (time.Time, bool) {
+	if item.Urgent {
+		return time.Time{}, false
+	}
+	if subscriber.HasDigest() && !item.HasText() && item.HoldUntil == nil {
+		return subscriber.NextDigest(now), true
+	}
+
+	return subscriber.QuietUntil(now)
+}
+
+// inDigest reports whether the item due now goes into the digest of the chat
+func inDigest(subscriber *model.Subscriber, item *model.DeliveryItem) bool {
+	return subscriber.HasDigest() && !item.Urgent && !item.HasText()
+}
+
+// findRecipients returns subscribers of items sent to NullChatID
+func (s *Sender) findRecipients() []*model.Subscriber {
+	subscribers, err := s.subscriberStore.FindSubscribed()
+	if err != nil && !errors.Is(err, orm.ErrNotFound) {
+		s.logger.Error(
+			"can't get active subscribers",
+			zap.Error(err),
+			errors.ErrorTraceLogField(err),
+		)
+	}
+
+	return subscribers
+}
+
+// findChatSubscribers returns subscribers of items sent to a single chat by chat id
+func (s *Sender) findChatSubscribers(deliveryItems []*model.DeliveryItem) map[int64]*model.Subscriber {
+	var chatIDs []int64
+	for _, item := range deliveryItems {
+		if item.ChatID != model.NullChatID {
+			chatIDs = append(chatIDs, item.ChatID)
+		}
+	}
+	result := map[int64]*model.Subscriber{}
+	if len(chatIDs) == 0 {
+		return result
+	}
+	subscribers, err := s.subscriberStore.FindByChatIDs(chatIDs)
+	if err != nil {
+		s.logger.Error(
+			"can't get subscribers",
+			zap.Error(err),
+			errors.ErrorTraceLogField(err),
+		)
+	}
+	for _, subscriber := range subscribers {
+		result[subscriber.ChatID] = subscriber
+	}
+
+	return result
+}
+
+// holdCopy queues a copy of the shared item for a chat in quiet hours, the
+// copy is claimed once they end
+func (s *Sender) holdCopy(item *model.DeliveryItem, chatID int64, until time.Time) {
+	s.createCopy(item, chatID, func(copied *model.DeliveryItem) {
+		copied.HoldUntil = &until
+	})
+}
+
+// retryCopy queues a copy of the shared item for a chat it failed to reach,
+// so only that chat gets it again
+func (s *Sender) retryCopy(failure *sharedFailure) {
+	s.createCopy(failure.item, failure.chatID, func(copied *model.DeliveryItem) {
+		copied.Failures = 1
+		copied.LastError = failure.lastError
+	})
+}
+
+// createCopy queues a copy of the shared item for the chat unless the chat
+// has one already
+func (s *Sender) createCopy(item *model.DeliveryItem, chatID int64, configure func(copied *model.DeliveryItem)) {
+	_, err := s.deliveryItemStore.FindByTypeAndChatIdAndDedupeKey(model.DeliveryItemTypeFree, chatID, item.DedupeKey)
+	if err == nil {
+		return
+	}
+	if !errors.Is(err, orm.ErrNotFound) {
+		s.logger.Error(
+			"can't get delivery item",
+			zap.Int64("chatID", chatID),
+			zap.String("dedupeKey", item.DedupeKey),
+			zap.Error(err),
+			errors.ErrorTraceLogField(err),
+		)
+		return
+	}
+
+	copied := &model.DeliveryItem{
+		Type:           model.DeliveryItemTypeFree,
+		ChatID:         chatID,
+		DedupeKey:      item.DedupeKey,
+		GenerativeId:   item.GenerativeId,
+		GenerativeSlug: item.GenerativeSlug,
+		Url:            item.Url,
+		Text:           item.Text,
+		MintOpensAt:    item.MintOpensAt,
+		Name:           item.Name,
+		Author:         item.Author,
+		Price:          item.Price,
+	}
+	configure(copied)
+	if err := s.deliveryItemStore.Create(copied); err != nil {
+		s.logger.Error(
+			"can't copy delivery item",
+			zap.Any("item", copied),
+			zap.Error(err),
+			errors.ErrorTraceLogField(err),
+		)
+	}
+}
+
+// LastBatch returns when a batch was handled successfully last time, an empty
+// batch counts as well
+func (s *Sender) LastBatch() time.Time {
+	return s.sent.Last()
+}
+
+// linkButtons are the labels of the button opening the Url of text items
+var linkButtons = map[string]string{
+	model.DeliveryItemTypeListing:        "button.buy",
+	model.DeliveryItemTypeWalletActivity: "button.open",
+}
+
+func (s *Sender) sendMessage(j *job) *errors.Error {
+	item := j.items[0]
+	message := tgbotapi.NewMessage(j.chatID, item.Text)
+	if !item.HasText() {
+		kind := templates.KindNewToken
+		switch {
+		case item.ChatID == model.NullChatID || item.Type == model.DeliveryItemTypeFree:
+			kind = templates.KindFreeToken
+		case item.Type == model.DeliveryItemTypeByCollector:
+			kind = templates.KindCollected
+		}
+		rendered, err := s.templates.Render(kind, &templates.Data{Subscriber: j.recipient, Token: templates.NewToken(item)})
+		if err != nil {
+			s.logger.Error(
+				"can't render message",
+				zap.Any("item", item),
+				zap.Int64("chatID", j.chatID),
+				zap.Error(err),
+				errors.ErrorTraceLogField(err),
+			)
+			return err
+		}
+		message.Text, message.ParseMode = rendered.Text, rendered.ParseMode
+	}
+	if key, ok := linkButtons[item.Type]; ok && item.Url != "" {
+		message.ReplyMarkup = tgbotapi.NewInlineKeyboardMarkup(tgbotapi.NewInlineKeyboardRow(
+			tgbotapi.NewInlineKeyboardButtonURL(i18n.T(j.recipient.Language, key), item.Url),
+		))
+	}
 	_, err := s.bot.Send(message)
 	if err != nil {
-		err := errors.Wrap(err, "")
+		s.metrics.MessagesFailed.WithLabelValues(metrics.TelegramErrorCode(err)).Inc()
+		err := errors.Wrap(err, "can't send message").With("chatID", j.chatID)
 		s.logger.Error(
 			"can't send message with generative",
 			zap.Any("item", item),
-			zap.Int64("chatID", ChatID),
+			zap.Int64("chatID", j.chatID),
 			zap.Error(err),
 			errors.ErrorTraceLogField(err),
 		)
+		return err
 	}
+	s.metrics.MessagesSent.Inc()
+
+	return nil
 }
@@ -0,0 +1,267 @@
+package messagesender_test
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"go.uber.org/zap/zaptest"
+
+	"github.com/kranikitao/fxhash-telegram-bot/src/messagesender"
+	"github.com/kranikitao/fxhash-telegram-bot/src/metrics"
+	"github.com/kranikitao/fxhash-telegram-bot/src/orm"
+	"github.com/kranikitao/fxhash-telegram-bot/src/orm/memory"
+	"github.com/kranikitao/fxhash-telegram-bot/src/orm/model"
+	"github.com/kranikitao/fxhash-telegram-bot/src/telegramtest"
+	"github.com/kranikitao/fxhash-telegram-bot/src/templates"
+)
+
+func testConfig() messagesender.Config {
+	return messagesender.Config{
+		Interval:     time.Hour,
+		BatchSize:    100,
+		Workers:      2,
+		QueueLength:  10,
+		ClaimTimeout: time.Minute,
+		Owner:        "test",
+	}
+}
+
+func newSender(t *testing.T, config messagesender.Config) (*messagesender.Sender, *telegramtest.Server, *orm.Stores) {
+	t.Helper()
+	telegram := telegramtest.NewServer()
+	t.Cleanup(telegram.Close)
+	bot, err := telegram.NewBot()
+	if err != nil {
+		t.Fatalf("can't connect to fake bot api: %v", err)
+	}
+	stores := memory.NewStores()
+	sender := messagesender.New(zaptest.NewLogger(t), bot, stores, metrics.New(prometheus.NewRegistry()), templates.Default(), config)
+
+	return sender, telegram, stores
+}
+
+func createSubscriber(t *testing.T, stores *orm.Stores, subscriber *model.Subscriber) {
+	t.Helper()
+	if err := stores.Subscribers.Create(subscriber); err != nil {
+		t.Fatalf("Create subscriber: %v", err)
+	}
+}
+
+func createItem(t *testing.T, stores *orm.Stores, item *model.DeliveryItem) *model.DeliveryItem {
+	t.Helper()
+	if err := stores.DeliveryItems.Create(item); err != nil {
+		t.Fatalf("Create item: %v", err)
+	}
+
+	return item
+}
+
+func pending(t *testing.T, stores *orm.Stores) []*model.DeliveryItem {
+	t.Helper()
+	items, err := stores.DeliveryItems.FindPending(100, 0)
+	if err != nil {
+		t.Fatalf("FindPending: %v", err)
+	}
+
+	return items
+}
+
+func TestFailedDigestStaysPending(t *testing.T) {
+	sender, telegram, stores := newSender(t, testConfig())
+	createSubscriber(t, stores, &model.Subscriber{ChatID: 1, Subscribed: true, DigestMode: model.DigestModeHourly})
+	// the items waited for this digest already
+	due := time.Now().Add(-time.Minute)
+	for i, name := range []string{"Ondulations", "Joint venture"} {
+		createItem(t, stores, &model.DeliveryItem{
+			Type:           model.DeliveryItemTypeByArtist,
+			ChatID:         1,
+			DedupeKey:      strconv.Itoa(15021 - i),
+			GenerativeId:   int64(15021 - i),
+			GenerativeSlug: "token",
+			Url:            "https://www.fxhash.xyz/generative/slug/token",
+			Name:           name,
+			HoldUntil:      &due,
+		})
+	}
+
+	telegram.FailNext("sendMessage", http.StatusInternalServerError, "Internal Server Error")
+	sender.SendBatch()
+	items := pending(t, stores)
+	if len(items) != 2 {
+		t.Fatalf("a failed digest must stay pending, got %d pending items", len(items))
+	}
+	for _, item := range items {
+		if item.Failures != 1 || item.LastError == "" || item.ClaimedAt != nil {
+			t.Fatalf("a failed digest item must keep its failure and be released, got %+v", item)
+		}
+	}
+
+	sender.SendBatch()
+	if items := pending(t, stores); len(items) != 0 {
+		t.Fatalf("the digest must be sent by the next batch, got %d pending items", len(items))
+	}
+	if messages := telegram.Messages(1); len(messages) != 2 {
+		t.Fatalf("want the failed digest and the sent one, got %d messages", len(messages))
+	}
+}
+
+func TestFailingDigestIsGivenUp(t *testing.T) {
+	sender, telegram, stores := newSender(t, testConfig())
+	createSubscriber(t, stores, &model.Subscriber{ChatID: 1, Subscribed: true, DigestMode: model.DigestModeDaily})
+	due := time.Now().Add(-time.Minute)
+	createItem(t, stores, &model.DeliveryItem{Type: model.DeliveryItemTypeByArtist, ChatID: 1, DedupeKey: "15021", GenerativeId: 15021, Name: "Ondulations", HoldUntil: &due})
+
+	for i := 0; i < 5; i++ {
+		telegram.FailNext("sendMessage", http.StatusForbidden, "Forbidden: bot was blocked by the user")
+		sender.SendBatch()
+	}
+	if items := pending(t, stores); len(items) != 0 {
+		t.Fatalf("a digest failing 5 times must be given up, got %+v", items)
+	}
+	failed, err := stores.DeliveryItems.FindFailed(10, 0)
+	if err != nil || len(failed) != 1 || failed[0].Failures != 5 {
+		t.Fatalf("FindFailed: want the given up item, got %v, %v", failed, err)
+	}
+}
+
+// notice returns a text item for the chat, key keeps it unique
+func notice(chatID int64, key string, text string) *model.DeliveryItem {
+	return &model.DeliveryItem{Type: model.DeliveryItemTypeNotice, ChatID: chatID, DedupeKey: key, Text: text}
+}
+
+func TestFailedItemIsRetried(t *testing.T) {
+	sender, telegram, stores := newSender(t, testConfig())
+	item := createItem(t, stores, notice(1, "1", "hello"))
+
+	telegram.FailNext("sendMessage", http.StatusTooManyRequests, "Too Many Requests: retry after 1")
+	sender.SendBatch()
+	items := pending(t, stores)
+	if len(items) != 1 || items[0].Failures != 1 || items[0].LastError == "" || items[0].ClaimedAt != nil {
+		t.Fatalf("a failed item must stay pending with its failure and be released, got %+v", items)
+	}
+
+	sender.SendBatch()
+	if items := pending(t, stores); len(items) != 0 {
+		t.Fatalf("the item must be sent by the next batch, got %+v", items)
+	}
+	sent, err := stores.DeliveryItems.FindByID(item.ID)
+	if err != nil || !sent.IsSent || sent.Failures != 1 || sent.LastError != "" {
+		t.Fatalf("a sent item keeps the failure count only, got %+v, %v", sent, err)
+	}
+	if failed, err := stores.DeliveryItems.FindFailed(10, 0); err != nil || len(failed) != 0 {
+		t.Fatalf("FindFailed: want nothing, got %v, %v", failed, err)
+	}
+}
+
+func TestFailingItemIsGivenUp(t *testing.T) {
+	sender, telegram, stores := newSender(t, testConfig())
+	createItem(t, stores, notice(1, "1", "hello"))
+
+	for i := 0; i < 5; i++ {
+		if items := pending(t, stores); len(items) != 1 {
+			t.Fatalf("attempt %d: the item must be pending, got %+v", i+1, items)
+		}
+		telegram.FailNext("sendMessage", http.StatusForbidden, "Forbidden: bot was blocked by the user")
+		sender.SendBatch()
+	}
+	if items := pending(t, stores); len(items) != 0 {
+		t.Fatalf("an item failing 5 times must be given up, got %+v", items)
+	}
+	failed, err := stores.DeliveryItems.FindFailed(10, 0)
+	if err != nil || len(failed) != 1 || failed[0].Failures != 5 {
+		t.Fatalf("FindFailed: want the given up item, got %v, %v", failed, err)
+	}
+	if calls := telegram.Calls("sendMessage"); len(calls) != 5 {
+		t.Fatalf("want 5 attempts, got %d", len(calls))
+	}
+}
+
+func TestSharedItemIsRetriedForFailedChats(t *testing.T) {
+	config := testConfig()
+	config.Workers = 1
+	sender, telegram, stores := newSender(t, config)
+	createSubscriber(t, stores, &model.Subscriber{ChatID: 1, Subscribed: true})
+	createSubscriber(t, stores, &model.Subscriber{ChatID: 2, Subscribed: true})
+	shared := createItem(t, stores, &model.DeliveryItem{
+		Type:           model.DeliveryItemTypeFree,
+		ChatID:         model.NullChatID,
+		DedupeKey:      "15020",
+		GenerativeId:   15020,
+		GenerativeSlug: "free-lines",
+		Url:            "https://www.fxhash.xyz/generative/slug/free-lines",
+		Name:           "Free lines",
+	})
+
+	// the only worker sends to chat 1 first
+	telegram.FailNext("sendMessage", http.StatusInternalServerError, "Internal Server Error")
+	sender.SendBatch()
+	if item, err := stores.DeliveryItems.FindByID(shared.ID); err != nil || !item.IsSent {
+		t.Fatalf("the shared item reached chat 2 and must be sent, got %+v, %v", item, err)
+	}
+	items := pending(t, stores)
+	if len(items) != 1 || items[0].ChatID != 1 || items[0].Type != model.DeliveryItemTypeFree || items[0].Failures != 1 {
+		t.Fatalf("want a copy for chat 1 with its failure, got %+v", items)
+	}
+
+	sender.SendBatch()
+	if items := pending(t, stores); len(items) != 0 {
+		t.Fatalf("the copy must be sent by the next batch, got %+v", items)
+	}
+	if first, second := telegram.Messages(1), telegram.Messages(2); len(first) != 2 || len(second) != 1 {
+		t.Fatalf("want a failed and a sent message for chat 1 and one for chat 2, got %d and %d", len(first), len(second))
+	}
+}
+
+func TestWorkersKeepOrderOfChats(t *testing.T) {
+	config := testConfig()
+	config.Workers = 3
+	// an unbuffered queue makes the batch wait for workers, nothing is dropped
+	config.QueueLength = 0
+	sender, telegram, stores := newSender(t, config)
+	for i := 1; i <= 5; i++ {
+		for chatID := int64(1); chatID <= 4; chatID++ {
+			createItem(t, stores, notice(chatID, strconv.Itoa(i), fmt.Sprintf("chat %d #%d", chatID, i)))
+		}
+	}
+
+	sender.SendBatch()
+	if items := pending(t, stores); len(items) != 0 {
+		t.Fatalf("every item must be sent, got %d pending", len(items))
+	}
+	for chatID := int64(1); chatID <= 4; chatID++ {
+		messages := telegram.Messages(chatID)
+		if len(messages) != 5 {
+			t.Fatalf("chat %d: want 5 messages, got %d", chatID, len(messages))
+		}
+		for i, message := range messages {
+			if want := fmt.Sprintf("chat %d #%d", chatID, i+1); message.Text() != want {
+				t.Fatalf("chat %d: want %q at %d, got %q", chatID, want, i, message.Text())
+			}
+		}
+	}
+}
+
+func TestWorkersShareRateLimit(t *testing.T) {
+	config := testConfig()
+	config.Workers = 4
+	config.RateLimit = 20 * time.Millisecond
+	sender, telegram, stores := newSender(t, config)
+	for chatID := int64(1); chatID <= 10; chatID++ {
+		createItem(t, stores, notice(chatID, "1", "hello"))
+	}
+
+	startedAt := time.Now()
+	sender.SendBatch()
+	elapsed := time.Since(startedAt)
+	if calls := telegram.Calls("sendMessage"); len(calls) != 10 {
+		t.Fatalf("want 10 messages, got %d", len(calls))
+	}
+	// 4 workers with a limiter each would need 3 pauses
+	if minimum := 9 * config.RateLimit; elapsed < minimum {
+		t.Fatalf("10 messages must take at least %s with a shared limiter, took %s", minimum, elapsed)
+	}
+}
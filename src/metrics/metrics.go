@@ -0,0 +1,105 @@
+package metrics
+
+import (
+	"net/http"
+	"strconv"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+const namespace = "fxbot"
+
+// Metrics holds every metric reported by the components. It is created
+// once per registry and handed to the components which report to it.
+type Metrics struct {
+	FxHashRequestDuration *prometheus.HistogramVec
+	FxHashRequestErrors   *prometheus.CounterVec
+	TokensSeen            *prometheus.CounterVec
+	TokensFiltered        *prometheus.CounterVec
+	DeliveryItemsCreated  *prometheus.CounterVec
+	MessagesSent          prometheus.Counter
+	MessagesFailed        *prometheus.CounterVec
+	UpdatesProcessed      *prometheus.CounterVec
+	ComponentRestarts     *prometheus.CounterVec
+}
+
+func New(registerer prometheus.Registerer) *Metrics {
+	m := &Metrics{
+		FxHashRequestDuration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: namespace,
+			Name:      "fxhash_request_duration_seconds",
+			Help:      "Duration of fxhash GraphQL requests by query.",
+			Buckets:   prometheus.DefBuckets,
+		}, []string{"query"}),
+		FxHashRequestErrors: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "fxhash_request_errors_total",
+			Help:      "Failed fxhash GraphQL requests by query.",
+		}, []string{"query"}),
+		TokensSeen: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "tokens_seen_total",
+			Help:      "Generative tokens returned by fxhash by poll.",
+		}, []string{"poll"}),
+		TokensFiltered: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "tokens_filtered_total",
+			Help:      "Generative tokens skipped as not available to mint by poll.",
+		}, []string{"poll"}),
+		DeliveryItemsCreated: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "delivery_items_created_total",
+			Help:      "Delivery items created by type.",
+		}, []string{"type"}),
+		MessagesSent: prometheus.NewCounter(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "messages_sent_total",
+			Help:      "Notifications sent to Telegram.",
+		}),
+		MessagesFailed: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "messages_failed_total",
+			Help:      "Notifications rejected by Telegram by error code.",
+		}, []string{"code"}),
+		UpdatesProcessed: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "updates_processed_total",
+			Help:      "Telegram updates processed by command.",
+		}, []string{"command"}),
+		ComponentRestarts: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "component_restarts_total",
+			Help:      "Restarts of background components after a panic or an unexpected stop.",
+		}, []string{"component"}),
+	}
+
+	registerer.MustRegister(
+		m.FxHashRequestDuration,
+		m.FxHashRequestErrors,
+		m.TokensSeen,
+		m.TokensFiltered,
+		m.DeliveryItemsCreated,
+		m.MessagesSent,
+		m.MessagesFailed,
+		m.UpdatesProcessed,
+		m.ComponentRestarts,
+	)
+
+	return m
+}
+
+// TelegramErrorCode is the code label of a Telegram call error
+func TelegramErrorCode(err error) string {
+	if tgErr, ok := err.(*tgbotapi.Error); ok {
+		return strconv.Itoa(tgErr.Code)
+	}
+
+	return "network"
+}
+
+// Handler serves metrics of the gatherer in the Prometheus text format
+func Handler(gatherer prometheus.Gatherer) http.Handler {
+	return promhttp.HandlerFor(gatherer, promhttp.HandlerOpts{})
+}
@@ -0,0 +1,49 @@
+package metrics
+
+import (
+	"time"
+
+	"github.com/kranikitao/fxhash-telegram-bot/src/orm"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// RegisterStoreGauges registers gauges computed from the stores on every scrape
+func RegisterStoreGauges(registerer prometheus.Registerer, stores *orm.Stores) {
+	registerer.MustRegister(
+		prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+			Namespace: namespace,
+			Name:      "delivery_backlog_age_seconds",
+			Help:      "Age of the oldest not sent delivery item.",
+		}, func() float64 {
+			item, err := stores.DeliveryItems.FindOldestNotSent()
+			if err != nil {
+				return 0
+			}
+			return time.Since(item.CreatedAt).Seconds()
+		}),
+		prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+			Namespace: namespace,
+			Name:      "free_feed_subscribers",
+			Help:      "Subscribers of zero cost generatives.",
+		}, func() float64 {
+			count, _ := stores.Subscribers.CountSubscribed()
+			return float64(count)
+		}),
+		prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+			Namespace: namespace,
+			Name:      "artist_subscribers",
+			Help:      "Chats with at least one active artist subscription.",
+		}, func() float64 {
+			count, _ := stores.ArtistSubscriptions.CountActiveChats()
+			return float64(count)
+		}),
+		prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+			Namespace: namespace,
+			Name:      "artist_subscriptions",
+			Help:      "Active artist subscriptions.",
+		}, func() float64 {
+			count, _ := stores.ArtistSubscriptions.CountActive()
+			return float64(count)
+		}),
+	)
+}
@@ -0,0 +1,2 @@
+ALTER TABLE delivery_items DROP COLUMN claimed_by;
+ALTER TABLE delivery_items DROP COLUMN claimed_at;
@@ -0,0 +1,2 @@
+ALTER TABLE delivery_items ADD COLUMN claimed_by text;
+ALTER TABLE delivery_items ADD COLUMN claimed_at timestamp with time zone;
@@ -0,0 +1,3 @@
+DROP INDEX idx_events_chat_id;
+DROP INDEX idx_fx_hash_artist_id;
+DROP INDEX uidx_chat_id_fx_hash_artist_id;
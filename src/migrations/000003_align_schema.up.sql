@@ -0,0 +1,15 @@
+UPDATE artist_subscriptions a SET is_active = true
+WHERE EXISTS (
+    SELECT 1 FROM artist_subscriptions b
+    WHERE b.chat_id = a.chat_id AND b.fx_hash_artist_id = a.fx_hash_artist_id AND b.is_active
+);
+
+DELETE FROM artist_subscriptions a
+USING artist_subscriptions b
+WHERE a.chat_id = b.chat_id AND a.fx_hash_artist_id = b.fx_hash_artist_id AND a.id > b.id;
+
+CREATE UNIQUE INDEX uidx_chat_id_fx_hash_artist_id ON artist_subscriptions USING btree (chat_id, fx_hash_artist_id);
+
+CREATE INDEX idx_fx_hash_artist_id ON artist_subscriptions USING btree (fx_hash_artist_id);
+
+CREATE INDEX idx_events_chat_id ON events USING btree (chat_id);
@@ -0,0 +1,3 @@
+DROP INDEX idx_subscribers_username;
+DROP TABLE settings;
+ALTER TABLE delivery_items DROP COLUMN text;
@@ -0,0 +1,9 @@
+ALTER TABLE delivery_items ADD COLUMN text text;
+
+CREATE TABLE settings (
+    key text PRIMARY KEY,
+    value text,
+    updated_at timestamp with time zone
+);
+
+CREATE INDEX idx_subscribers_username ON subscribers USING btree (username);
@@ -0,0 +1,2 @@
+ALTER TABLE delivery_items DROP COLUMN failures;
+ALTER TABLE delivery_items DROP COLUMN last_error;
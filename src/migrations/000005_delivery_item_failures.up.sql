@@ -0,0 +1,2 @@
+ALTER TABLE delivery_items ADD COLUMN last_error text;
+ALTER TABLE delivery_items ADD COLUMN failures bigint NOT NULL DEFAULT 0;
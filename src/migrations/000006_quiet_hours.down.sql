@@ -0,0 +1,7 @@
+ALTER TABLE delivery_items DROP COLUMN mint_opens_at;
+ALTER TABLE delivery_items DROP COLUMN hold_until;
+ALTER TABLE delivery_items DROP COLUMN urgent;
+ALTER TABLE artist_subscriptions DROP COLUMN always_notify;
+ALTER TABLE subscribers DROP COLUMN quiet_to;
+ALTER TABLE subscribers DROP COLUMN quiet_from;
+ALTER TABLE subscribers DROP COLUMN timezone;
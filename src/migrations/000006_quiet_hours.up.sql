@@ -0,0 +1,7 @@
+ALTER TABLE subscribers ADD COLUMN timezone text NOT NULL DEFAULT '';
+ALTER TABLE subscribers ADD COLUMN quiet_from smallint NOT NULL DEFAULT 0;
+ALTER TABLE subscribers ADD COLUMN quiet_to smallint NOT NULL DEFAULT 0;
+ALTER TABLE artist_subscriptions ADD COLUMN always_notify boolean NOT NULL DEFAULT false;
+ALTER TABLE delivery_items ADD COLUMN urgent boolean NOT NULL DEFAULT false;
+ALTER TABLE delivery_items ADD COLUMN hold_until timestamp with time zone;
+ALTER TABLE delivery_items ADD COLUMN mint_opens_at timestamp with time zone;
@@ -0,0 +1,5 @@
+ALTER TABLE delivery_items DROP COLUMN price;
+ALTER TABLE delivery_items DROP COLUMN author;
+ALTER TABLE delivery_items DROP COLUMN name;
+ALTER TABLE subscribers DROP COLUMN digest_hour;
+ALTER TABLE subscribers DROP COLUMN digest_mode;
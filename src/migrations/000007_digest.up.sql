@@ -0,0 +1,5 @@
+ALTER TABLE subscribers ADD COLUMN digest_mode text NOT NULL DEFAULT '';
+ALTER TABLE subscribers ADD COLUMN digest_hour smallint NOT NULL DEFAULT 0;
+ALTER TABLE delivery_items ADD COLUMN name text;
+ALTER TABLE delivery_items ADD COLUMN author text;
+ALTER TABLE delivery_items ADD COLUMN price bigint;
@@ -0,0 +1 @@
+ALTER TABLE subscribers ADD COLUMN language text NOT NULL DEFAULT '';
@@ -0,0 +1,2 @@
+ALTER TABLE subscribers DROP COLUMN free_muted_until;
+ALTER TABLE artist_subscriptions DROP COLUMN muted_until;
@@ -0,0 +1,2 @@
+ALTER TABLE artist_subscriptions ADD COLUMN muted_until timestamp with time zone;
+ALTER TABLE subscribers ADD COLUMN free_muted_until timestamp with time zone;
@@ -0,0 +1,11 @@
+ALTER TABLE delivery_items DROP COLUMN action;
+ALTER TABLE delivery_items DROP COLUMN collector;
+
+DELETE FROM artist_subscriptions WHERE kind <> 'artist';
+
+DROP INDEX uidx_chat_id_kind_fx_hash_artist_id;
+
+CREATE UNIQUE INDEX uidx_chat_id_fx_hash_artist_id ON artist_subscriptions USING btree (chat_id, fx_hash_artist_id);
+
+ALTER TABLE artist_subscriptions DROP COLUMN first_touch_only;
+ALTER TABLE artist_subscriptions DROP COLUMN kind;
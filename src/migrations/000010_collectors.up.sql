@@ -0,0 +1,9 @@
+ALTER TABLE artist_subscriptions ADD COLUMN kind text NOT NULL DEFAULT 'artist';
+ALTER TABLE artist_subscriptions ADD COLUMN first_touch_only boolean NOT NULL DEFAULT false;
+
+DROP INDEX uidx_chat_id_fx_hash_artist_id;
+
+CREATE UNIQUE INDEX uidx_chat_id_kind_fx_hash_artist_id ON artist_subscriptions USING btree (chat_id, kind, fx_hash_artist_id);
+
+ALTER TABLE delivery_items ADD COLUMN collector text NOT NULL DEFAULT '';
+ALTER TABLE delivery_items ADD COLUMN action text NOT NULL DEFAULT '';
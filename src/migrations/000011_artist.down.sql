@@ -0,0 +1,4 @@
+ALTER TABLE subscribers DROP COLUMN artist_linked_at;
+ALTER TABLE subscribers DROP COLUMN artist_code;
+ALTER TABLE subscribers DROP COLUMN artist_name;
+ALTER TABLE subscribers DROP COLUMN artist_id;
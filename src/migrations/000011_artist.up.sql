@@ -0,0 +1,4 @@
+ALTER TABLE subscribers ADD COLUMN artist_id text NOT NULL DEFAULT '';
+ALTER TABLE subscribers ADD COLUMN artist_name text NOT NULL DEFAULT '';
+ALTER TABLE subscribers ADD COLUMN artist_code text NOT NULL DEFAULT '';
+ALTER TABLE subscribers ADD COLUMN artist_linked_at timestamp with time zone;
@@ -0,0 +1,4 @@
+ALTER TABLE subscribers DROP COLUMN wallet_nonce_expires_at;
+ALTER TABLE subscribers DROP COLUMN wallet_nonce;
+
+DROP TABLE wallets;
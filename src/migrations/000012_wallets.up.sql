@@ -0,0 +1,14 @@
+CREATE TABLE wallets (
+    id bigserial PRIMARY KEY,
+    created_at timestamp with time zone,
+    chat_id bigint NOT NULL,
+    address text NOT NULL,
+    public_key text NOT NULL
+);
+
+CREATE UNIQUE INDEX uidx_wallets_chat_id_address ON wallets USING btree (chat_id, address);
+
+CREATE INDEX idx_wallets_address ON wallets USING btree (address);
+
+ALTER TABLE subscribers ADD COLUMN wallet_nonce text NOT NULL DEFAULT '';
+ALTER TABLE subscribers ADD COLUMN wallet_nonce_expires_at timestamp with time zone;
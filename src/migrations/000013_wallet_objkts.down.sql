@@ -0,0 +1 @@
+ALTER TABLE wallets DROP COLUMN last_objkt_at;
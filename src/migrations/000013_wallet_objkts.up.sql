@@ -0,0 +1 @@
+ALTER TABLE wallets ADD COLUMN last_objkt_at timestamp with time zone;
@@ -0,0 +1,13 @@
+CREATE TABLE listing_watches (
+    id bigserial PRIMARY KEY,
+    created_at timestamp with time zone,
+    updated_at timestamp with time zone,
+    chat_id bigint NOT NULL,
+    kind text NOT NULL,
+    target_id text NOT NULL,
+    target_name text NOT NULL DEFAULT '',
+    max_price bigint,
+    below_floor integer NOT NULL DEFAULT 0
+);
+
+CREATE UNIQUE INDEX uidx_listing_watches_chat_id_kind_target_id ON listing_watches USING btree (chat_id, kind, target_id);
@@ -0,0 +1 @@
+ALTER TABLE delivery_items DROP COLUMN collector_id;
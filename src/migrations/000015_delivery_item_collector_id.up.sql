@@ -0,0 +1 @@
+ALTER TABLE delivery_items ADD COLUMN collector_id text NOT NULL DEFAULT '';
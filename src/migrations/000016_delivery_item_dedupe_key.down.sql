@@ -0,0 +1,8 @@
+DROP INDEX uidx_type_chat_id_dedupe_key;
+
+UPDATE delivery_items SET generative_id = dedupe_key::bigint
+WHERE type IN ('by_collector', 'broadcast', 'notice', 'artist_event', 'artist_summary', 'wallet_objkt', 'listing', 'wallet_activity');
+
+CREATE UNIQUE INDEX uidx_type_chat_id_generative_id ON delivery_items USING btree (type, chat_id, generative_id);
+
+ALTER TABLE delivery_items DROP COLUMN dedupe_key;
@@ -0,0 +1,10 @@
+ALTER TABLE delivery_items ADD COLUMN dedupe_key text NOT NULL DEFAULT '';
+
+UPDATE delivery_items SET dedupe_key = generative_id::text WHERE generative_id IS NOT NULL;
+
+UPDATE delivery_items SET generative_id = 0
+WHERE type IN ('by_collector', 'broadcast', 'notice', 'artist_event', 'artist_summary', 'wallet_objkt', 'listing', 'wallet_activity');
+
+DROP INDEX uidx_type_chat_id_generative_id;
+
+CREATE UNIQUE INDEX uidx_type_chat_id_dedupe_key ON delivery_items USING btree (type, chat_id, dedupe_key);
@@ -0,0 +1,8 @@
+package migrations
+
+import "embed"
+
+// FS contains the SQL migrations, they are shipped inside the binary
+//
+//go:embed *.sql
+var FS embed.FS
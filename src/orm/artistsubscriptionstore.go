@@ -1,6 +1,7 @@
 package orm
 
 import (
+	"strings"
 	"time"
 
 	"github.com/kranikitao/fxhash-telegram-bot/src/errors"
@@ -8,54 +9,158 @@ import (
 	"gorm.io/gorm"
 )
 
-type ArtistSubscriptionStore struct {
+// likeEscaper escapes wildcards of a LIKE pattern
+var likeEscaper = strings.NewReplacer(`\`, `\\`, "%", `\%`, "_", `\_`)
+
+type artistSubscriptionStore struct {
 	gorm *gorm.DB
 }
 
-func GetArtistSubscriptionStore(gorm *gorm.DB) *ArtistSubscriptionStore {
-	return &ArtistSubscriptionStore{
+func GetArtistSubscriptionStore(gorm *gorm.DB) ArtistSubscriptionStore {
+	return &artistSubscriptionStore{
 		gorm: gorm,
 	}
 }
 
-func (s *ArtistSubscriptionStore) Create(m *model.ArtistSubscribtion) *errors.Error {
+func (s *artistSubscriptionStore) Create(m *model.ArtistSubscribtion) *errors.Error {
+	if m.Kind == "" {
+		m.Kind = model.SubscriptionKindArtist
+	}
 	m.CreatedAt = time.Now()
 	m.UpdatedAt = time.Now()
 	result := s.gorm.Create(&m)
 	if result.Error != nil {
-		return errors.Wrap(result.Error, "")
+		return errors.Wrap(result.Error, "can't create artist subscription")
 	}
 
 	return nil
 }
 
-func (s *ArtistSubscriptionStore) Update(m *model.ArtistSubscribtion) *errors.Error {
+func (s *artistSubscriptionStore) Update(m *model.ArtistSubscribtion) *errors.Error {
 	m.UpdatedAt = time.Now()
 	result := s.gorm.Save(&m)
 	if result.Error != nil {
-		return errors.Wrap(result.Error, "")
+		return errors.Wrap(result.Error, "can't update artist subscription")
 	}
 
 	return nil
 }
 
-func (s *ArtistSubscriptionStore) FindByChatIDAndFxHashArtistName(chatID int64, FxHashArtistName string) (*model.ArtistSubscribtion, *errors.Error) {
+func (s *artistSubscriptionStore) FindByID(id uint64) (*model.ArtistSubscribtion, *errors.Error) {
+	var m *model.ArtistSubscribtion
+	result := s.gorm.Where("id = ?", id).First(&m)
+
+	return wrapSingleResult(m, result.Error)
+}
+
+func (s *artistSubscriptionStore) FindByChatIDAndKindAndFxHashArtistName(chatID int64, kind string, FxHashArtistName string) (*model.ArtistSubscribtion, *errors.Error) {
 	var m *model.ArtistSubscribtion
-	result := s.gorm.Where("chat_id = ? AND fx_hash_artist_name = ?", chatID, FxHashArtistName).First(&m)
+	result := s.gorm.Where("chat_id = ? AND kind = ? AND fx_hash_artist_name = ?", chatID, kind, FxHashArtistName).First(&m)
 
 	return wrapSingleResult(m, result.Error)
 }
 
-func (s *ArtistSubscriptionStore) FindActiveByChatId(chatID int64) ([]*model.ArtistSubscribtion, *errors.Error) {
+func (s *artistSubscriptionStore) FindByChatId(chatID int64) ([]*model.ArtistSubscribtion, *errors.Error) {
+	var m []*model.ArtistSubscribtion
+	result := s.gorm.Where("chat_id = ?", chatID).Order("id").Find(&m)
+
+	return wrapListResult(m, result.Error)
+}
+
+func (s *artistSubscriptionStore) FindActiveByChatId(chatID int64) ([]*model.ArtistSubscribtion, *errors.Error) {
 	var m []*model.ArtistSubscribtion
 	result := s.gorm.Where("chat_id = ? AND is_active = true", chatID).Find(&m)
 
 	return wrapListResult(m, result.Error)
 }
 
-func (s *ArtistSubscriptionStore) FindActiveByFxHashArtistIds(fxHashArtistIds []string) ([]*model.ArtistSubscribtion, *errors.Error) {
+func (s *artistSubscriptionStore) SearchByChatID(chatID int64, prefix string, limit int, offset int) ([]*model.ArtistSubscribtion, *errors.Error) {
+	var m []*model.ArtistSubscribtion
+	result := s.byChatID(chatID, prefix).Order("LOWER(fx_hash_artist_name), id").Limit(limit).Offset(offset).Find(&m)
+
+	return wrapListResult(m, result.Error)
+}
+
+func (s *artistSubscriptionStore) CountByChatID(chatID int64, prefix string) (int64, *errors.Error) {
+	var count int64
+	result := s.byChatID(chatID, prefix).Count(&count)
+	if result.Error != nil {
+		return 0, errors.Wrap(result.Error, "can't count artist subscriptions").With("chatID", chatID)
+	}
+
+	return count, nil
+}
+
+func (s *artistSubscriptionStore) FindMuteEnded(now time.Time) ([]*model.ArtistSubscribtion, *errors.Error) {
 	var m []*model.ArtistSubscribtion
-	result := s.gorm.Where("fx_hash_artist_id IN ? AND is_active = true", fxHashArtistIds).Find(&m)
+	result := s.gorm.Where("muted_until <= ?", now).Order("id").Find(&m)
+
+	return wrapListResult(m, result.Error)
+}
+
+func (s *artistSubscriptionStore) ResumeMuted(m *model.ArtistSubscribtion) (bool, *errors.Error) {
+	result := s.gorm.Model(&model.ArtistSubscribtion{}).
+		Where("id = ? AND muted_until = ?", m.ID, m.MutedUntil).
+		Updates(map[string]interface{}{"muted_until": nil, "updated_at": time.Now()})
+	if result.Error != nil {
+		return false, errors.Wrap(result.Error, "can't resume artist subscription").With("id", m.ID)
+	}
+
+	return result.RowsAffected > 0, nil
+}
+
+func (s *artistSubscriptionStore) byChatID(chatID int64, prefix string) *gorm.DB {
+	db := s.gorm.Model(&model.ArtistSubscribtion{}).Where("chat_id = ?", chatID)
+	if prefix != "" {
+		db = db.Where("fx_hash_artist_name ILIKE ?", likeEscaper.Replace(prefix)+"%")
+	}
+
+	return db
+}
+
+func (s *artistSubscriptionStore) FindActiveByKindAndFxHashArtistIds(kind string, fxHashArtistIds []string) ([]*model.ArtistSubscribtion, *errors.Error) {
+	var m []*model.ArtistSubscribtion
+	result := s.gorm.Where("kind = ? AND fx_hash_artist_id IN ? AND is_active = true", kind, fxHashArtistIds).Find(&m)
+
+	return wrapListResult(m, result.Error)
+}
+
+func (s *artistSubscriptionStore) FindActiveByKind(kind string) ([]*model.ArtistSubscribtion, *errors.Error) {
+	var m []*model.ArtistSubscribtion
+	result := s.gorm.Where("kind = ? AND is_active = true", kind).Order("id").Find(&m)
+
+	return wrapListResult(m, result.Error)
+}
+
+func (s *artistSubscriptionStore) CountActive() (int64, *errors.Error) {
+	var count int64
+	result := s.gorm.Model(&model.ArtistSubscribtion{}).Where("kind = ? AND is_active = true", model.SubscriptionKindArtist).Count(&count)
+	if result.Error != nil {
+		return 0, errors.Wrap(result.Error, "can't count artist subscriptions")
+	}
+
+	return count, nil
+}
+
+func (s *artistSubscriptionStore) CountActiveChats() (int64, *errors.Error) {
+	var count int64
+	result := s.gorm.Model(&model.ArtistSubscribtion{}).Where("kind = ? AND is_active = true", model.SubscriptionKindArtist).Distinct("chat_id").Count(&count)
+	if result.Error != nil {
+		return 0, errors.Wrap(result.Error, "can't count artist subscriptions")
+	}
+
+	return count, nil
+}
+
+func (s *artistSubscriptionStore) FindTopArtists(limit int) ([]*ArtistFollowers, *errors.Error) {
+	var m []*ArtistFollowers
+	result := s.gorm.Model(&model.ArtistSubscribtion{}).
+		Select("fx_hash_artist_id, MAX(fx_hash_artist_name) AS fx_hash_artist_name, COUNT(*) AS followers").
+		Where("kind = ? AND is_active = true", model.SubscriptionKindArtist).
+		Group("fx_hash_artist_id").
+		Order("followers DESC, fx_hash_artist_id").
+		Limit(limit).
+		Scan(&m)
 
 	return wrapListResult(m, result.Error)
 }
@@ -0,0 +1,13 @@
+package orm_test
+
+import (
+	"testing"
+
+	"github.com/kranikitao/fxhash-telegram-bot/src/orm/ormtest"
+)
+
+// TestContract runs against the database named by FXBOT_TEST_DB_DSN and is
+// skipped without it
+func TestContract(t *testing.T) {
+	ormtest.RunContract(t, ormtest.NewPostgresStores)
+}
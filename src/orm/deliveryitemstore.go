@@ -8,47 +8,157 @@ import (
 	"gorm.io/gorm"
 )
 
-type DeliveryItemStore struct {
+type deliveryItemStore struct {
 	gorm *gorm.DB
 }
 
-func GetDeliveryItemStore(gorm *gorm.DB) *DeliveryItemStore {
-	return &DeliveryItemStore{
+func GetDeliveryItemStore(gorm *gorm.DB) DeliveryItemStore {
+	return &deliveryItemStore{
 		gorm: gorm,
 	}
 }
 
-func (s *DeliveryItemStore) Create(m *model.DeliveryItem) *errors.Error {
+func (s *deliveryItemStore) Create(m *model.DeliveryItem) *errors.Error {
 	m.CreatedAt = time.Now()
 	m.UpdatedAt = time.Now()
 	result := s.gorm.Create(&m)
 	if result.Error != nil {
-		return errors.Wrap(result.Error, "")
+		return errors.Wrap(result.Error, "can't create delivery item")
 	}
 
 	return nil
 }
 
-func (s *DeliveryItemStore) Update(m *model.DeliveryItem) *errors.Error {
+// createBatchSize bounds the rows of one INSERT, a broadcast to every
+// subscriber is inserted in a few statements of one transaction
+const createBatchSize = 500
+
+func (s *deliveryItemStore) CreateBatch(items []*model.DeliveryItem) *errors.Error {
+	if len(items) == 0 {
+		return nil
+	}
+	now := time.Now()
+	for _, m := range items {
+		m.CreatedAt = now
+		m.UpdatedAt = now
+	}
+	err := s.gorm.Transaction(func(tx *gorm.DB) error {
+		return tx.CreateInBatches(items, createBatchSize).Error
+	})
+	if err != nil {
+		return errors.Wrap(err, "can't create delivery items").With("count", len(items))
+	}
+
+	return nil
+}
+
+func (s *deliveryItemStore) Update(m *model.DeliveryItem) *errors.Error {
 	m.UpdatedAt = time.Now()
 	result := s.gorm.Save(&m)
 	if result.Error != nil {
-		return errors.Wrap(result.Error, "")
+		return errors.Wrap(result.Error, "can't update delivery item")
 	}
 
 	return nil
 }
 
-func (s *DeliveryItemStore) FindByTypeAndChatIdAndGenerativeId(Type string, chatId int64, generativeId int64) (*model.DeliveryItem, *errors.Error) {
+func (s *deliveryItemStore) Delete(m *model.DeliveryItem) *errors.Error {
+	result := s.gorm.Delete(&m)
+	if result.Error != nil {
+		return errors.Wrap(result.Error, "can't delete delivery item")
+	}
+
+	return nil
+}
+
+func (s *deliveryItemStore) MarkSent(items []*model.DeliveryItem) *errors.Error {
+	err := s.gorm.Transaction(func(tx *gorm.DB) error {
+		for _, m := range items {
+			m.IsSent = true
+			m.UpdatedAt = time.Now()
+			if result := tx.Save(&m); result.Error != nil {
+				return result.Error
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return errors.Wrap(err, "can't mark delivery items sent")
+	}
+
+	return nil
+}
+
+func (s *deliveryItemStore) FindByID(id uint64) (*model.DeliveryItem, *errors.Error) {
 	m := &model.DeliveryItem{}
-	result := s.gorm.Where("type = ? AND chat_id = ? AND generative_id = ?", Type, chatId, generativeId).First(&m)
+	result := s.gorm.Where("id = ?", id).First(&m)
 
 	return wrapSingleResult(m, result.Error)
 }
 
-func (s *DeliveryItemStore) FindNotSent() ([]*model.DeliveryItem, *errors.Error) {
+func (s *deliveryItemStore) FindByTypeAndChatIdAndDedupeKey(Type string, chatId int64, dedupeKey string) (*model.DeliveryItem, *errors.Error) {
+	m := &model.DeliveryItem{}
+	result := s.gorm.Where("type = ? AND chat_id = ? AND dedupe_key = ?", Type, chatId, dedupeKey).First(&m)
+
+	return wrapSingleResult(m, result.Error)
+}
+
+func (s *deliveryItemStore) FindByChatIdAndCollectorIdAndGenerativeSlug(chatId int64, collectorId string, generativeSlug string) (*model.DeliveryItem, *errors.Error) {
+	m := &model.DeliveryItem{}
+	result := s.gorm.Where("type = ? AND chat_id = ? AND collector_id = ? AND generative_slug = ?", model.DeliveryItemTypeByCollector, chatId, collectorId, generativeSlug).First(&m)
+
+	return wrapSingleResult(m, result.Error)
+}
+
+// ClaimNotSent marks up to limit not sent items as owned by owner and returns
+// them. Items claimed by another owner are skipped until claimTimeout passes,
+// so concurrent senders never get the same item.
+func (s *deliveryItemStore) ClaimNotSent(owner string, limit int, claimTimeout time.Duration) ([]*model.DeliveryItem, *errors.Error) {
+	var m []*model.DeliveryItem
+	result := s.gorm.Raw(`
+		UPDATE delivery_items SET claimed_by = ?, claimed_at = ?
+		WHERE id IN (
+			SELECT id FROM delivery_items
+			WHERE is_sent = false AND deleted_at IS NULL AND (claimed_at IS NULL OR claimed_at < ?)
+				AND (hold_until IS NULL OR hold_until <= ?)
+			ORDER BY id
+			LIMIT ?
+			FOR UPDATE SKIP LOCKED
+		)
+		RETURNING *`,
+		owner, time.Now(), time.Now().Add(-claimTimeout), time.Now(), limit,
+	).Scan(&m)
+
+	return wrapListResult(m, result.Error)
+}
+
+func (s *deliveryItemStore) FindOldestNotSent() (*model.DeliveryItem, *errors.Error) {
+	m := &model.DeliveryItem{}
+	result := s.gorm.Where("is_sent = false AND (hold_until IS NULL OR hold_until <= ?)", time.Now()).Order("id").First(&m)
+
+	return wrapSingleResult(m, result.Error)
+}
+
+func (s *deliveryItemStore) CountSentSince(since time.Time) (int64, *errors.Error) {
+	var count int64
+	result := s.gorm.Model(&model.DeliveryItem{}).Where("is_sent = true AND updated_at >= ?", since).Count(&count)
+	if result.Error != nil {
+		return 0, errors.Wrap(result.Error, "can't count delivery items")
+	}
+
+	return count, nil
+}
+
+func (s *deliveryItemStore) FindPending(limit int, offset int) ([]*model.DeliveryItem, *errors.Error) {
+	var m []*model.DeliveryItem
+	result := s.gorm.Where("is_sent = false").Order("id").Limit(limit).Offset(offset).Find(&m)
+
+	return wrapListResult(m, result.Error)
+}
+
+func (s *deliveryItemStore) FindFailed(limit int, offset int) ([]*model.DeliveryItem, *errors.Error) {
 	var m []*model.DeliveryItem
-	result := s.gorm.Where("is_sent = false").Find(&m)
+	result := s.gorm.Where("is_sent = true AND last_error <> ''").Order("id DESC").Limit(limit).Offset(offset).Find(&m)
 
 	return wrapListResult(m, result.Error)
 }
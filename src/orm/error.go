@@ -5,17 +5,17 @@ import (
 	"gorm.io/gorm"
 )
 
-const (
-	ErrNotFound = "not_found"
+var (
+	ErrNotFound = errors.NewKind("not_found")
 )
 
 func wrapListResult[T any](m []*T, err error) ([]*T, *errors.Error) {
 	if err != nil {
 		if err == gorm.ErrRecordNotFound {
 			var emptyList []*T
-			return emptyList, errors.Wrap(err, ErrNotFound)
+			return emptyList, errors.Wrap(err, "record not found").WithKind(ErrNotFound)
 		}
-		return nil, errors.Wrap(err, "")
+		return nil, errors.Wrap(err, "query failed")
 	}
 
 	return m, nil
@@ -24,9 +24,9 @@ func wrapListResult[T any](m []*T, err error) ([]*T, *errors.Error) {
 func wrapSingleResult[T any](m *T, err error) (*T, *errors.Error) {
 	if err != nil {
 		if err == gorm.ErrRecordNotFound {
-			return nil, errors.Wrap(err, ErrNotFound)
+			return nil, errors.Wrap(err, "record not found").WithKind(ErrNotFound)
 		}
-		return nil, errors.Wrap(err, "")
+		return nil, errors.Wrap(err, "query failed")
 	}
 
 	return m, nil
@@ -6,17 +6,17 @@ import (
 	"gorm.io/gorm"
 )
 
-type EventStore struct {
+type eventStore struct {
 	gorm *gorm.DB
 }
 
-func GetEventStore(gorm *gorm.DB) *EventStore {
-	return &EventStore{
+func GetEventStore(gorm *gorm.DB) EventStore {
+	return &eventStore{
 		gorm: gorm,
 	}
 }
 
-func (s *EventStore) Push(chatId int64, eventCode string, eventData string) *errors.Error {
+func (s *eventStore) Push(chatId int64, eventCode string, eventData string) *errors.Error {
 	e := &model.Event{
 		ChatID:    chatId,
 		EventCode: eventCode,
@@ -24,8 +24,28 @@ func (s *EventStore) Push(chatId int64, eventCode string, eventData string) *err
 	}
 	result := s.gorm.Create(&e)
 	if result.Error != nil {
-		return errors.Wrap(result.Error, "")
+		return errors.Wrap(result.Error, "can't push event")
 	}
 
 	return nil
 }
+
+func (s *eventStore) Find(filter EventFilter) ([]*model.Event, *errors.Error) {
+	var m []*model.Event
+	db := s.gorm.Order("id DESC")
+	if filter.ChatID != 0 {
+		db = db.Where("chat_id = ?", filter.ChatID)
+	}
+	if filter.EventCode != "" {
+		db = db.Where("event_code = ?", filter.EventCode)
+	}
+	if !filter.Since.IsZero() {
+		db = db.Where("created_at >= ?", filter.Since)
+	}
+	if filter.Limit > 0 {
+		db = db.Limit(filter.Limit)
+	}
+	result := db.Find(&m)
+
+	return wrapListResult(m, result.Error)
+}
@@ -0,0 +1,77 @@
+package orm
+
+import (
+	"time"
+
+	"github.com/kranikitao/fxhash-telegram-bot/src/errors"
+	"github.com/kranikitao/fxhash-telegram-bot/src/orm/model"
+	"gorm.io/gorm"
+)
+
+type listingWatchStore struct {
+	gorm *gorm.DB
+}
+
+func GetListingWatchStore(gorm *gorm.DB) ListingWatchStore {
+	return &listingWatchStore{
+		gorm: gorm,
+	}
+}
+
+func (s *listingWatchStore) Create(m *model.ListingWatch) *errors.Error {
+	m.CreatedAt = time.Now()
+	m.UpdatedAt = time.Now()
+	result := s.gorm.Create(&m)
+	if result.Error != nil {
+		return errors.Wrap(result.Error, "can't create listing watch")
+	}
+
+	return nil
+}
+
+func (s *listingWatchStore) Update(m *model.ListingWatch) *errors.Error {
+	m.UpdatedAt = time.Now()
+	result := s.gorm.Save(&m)
+	if result.Error != nil {
+		return errors.Wrap(result.Error, "can't update listing watch")
+	}
+
+	return nil
+}
+
+func (s *listingWatchStore) Delete(m *model.ListingWatch) *errors.Error {
+	result := s.gorm.Delete(&m)
+	if result.Error != nil {
+		return errors.Wrap(result.Error, "can't delete listing watch")
+	}
+
+	return nil
+}
+
+func (s *listingWatchStore) FindByID(id uint64) (*model.ListingWatch, *errors.Error) {
+	var m *model.ListingWatch
+	result := s.gorm.Where("id = ?", id).First(&m)
+
+	return wrapSingleResult(m, result.Error)
+}
+
+func (s *listingWatchStore) FindAll() ([]*model.ListingWatch, *errors.Error) {
+	var m []*model.ListingWatch
+	result := s.gorm.Order("id").Find(&m)
+
+	return wrapListResult(m, result.Error)
+}
+
+func (s *listingWatchStore) FindByChatID(chatID int64) ([]*model.ListingWatch, *errors.Error) {
+	var m []*model.ListingWatch
+	result := s.gorm.Where("chat_id = ?", chatID).Order("id").Find(&m)
+
+	return wrapListResult(m, result.Error)
+}
+
+func (s *listingWatchStore) FindByChatIDAndKindAndTargetID(chatID int64, kind string, targetID string) (*model.ListingWatch, *errors.Error) {
+	var m *model.ListingWatch
+	result := s.gorm.Where("chat_id = ? AND kind = ? AND target_id = ?", chatID, kind, targetID).First(&m)
+
+	return wrapSingleResult(m, result.Error)
+}
@@ -0,0 +1,13 @@
+package memory_test
+
+import (
+	"testing"
+
+	"github.com/kranikitao/fxhash-telegram-bot/src/orm"
+	"github.com/kranikitao/fxhash-telegram-bot/src/orm/memory"
+	"github.com/kranikitao/fxhash-telegram-bot/src/orm/ormtest"
+)
+
+func TestContract(t *testing.T) {
+	ormtest.RunContract(t, func(t *testing.T) *orm.Stores { return memory.NewStores() })
+}
@@ -0,0 +1,743 @@
+package memory
+
+import (
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/kranikitao/fxhash-telegram-bot/src/errors"
+	"github.com/kranikitao/fxhash-telegram-bot/src/orm"
+	"github.com/kranikitao/fxhash-telegram-bot/src/orm/model"
+)
+
+// NewStores returns empty thread safe stores kept in memory. They follow the
+// same contract as the Postgres stores, including unique indexes.
+func NewStores() *orm.Stores {
+	return &orm.Stores{
+		Subscribers:         NewSubscriberStore(),
+		ArtistSubscriptions: NewArtistSubscriptionStore(),
+		DeliveryItems:       NewDeliveryItemStore(),
+		Events:              NewEventStore(),
+		Settings:            NewSettingStore(),
+		Wallets:             NewWalletStore(),
+		ListingWatches:      NewListingWatchStore(),
+	}
+}
+
+type SubscriberStore struct {
+	*table[model.Subscriber]
+}
+
+func NewSubscriberStore() *SubscriberStore {
+	return &SubscriberStore{newTable(func(m *model.Subscriber) *uint64 { return &m.ID })}
+}
+
+func (s *SubscriberStore) Create(m *model.Subscriber) *errors.Error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.exists(func(row *model.Subscriber) bool { return row.ChatID == m.ChatID }, 0) {
+		return errDuplicate("uidx_chat_id")
+	}
+	m.CreatedAt = time.Now()
+	m.UpdatedAt = time.Now()
+	s.insert(m)
+
+	return nil
+}
+
+func (s *SubscriberStore) Update(m *model.Subscriber) *errors.Error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.exists(func(row *model.Subscriber) bool { return row.ChatID == m.ChatID }, m.ID) {
+		return errDuplicate("uidx_chat_id")
+	}
+	m.UpdatedAt = time.Now()
+
+	return s.replace(m)
+}
+
+func (s *SubscriberStore) FindByChatID(chatID int64) (*model.Subscriber, *errors.Error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	return s.first(func(row *model.Subscriber) bool { return row.ChatID == chatID })
+}
+
+func (s *SubscriberStore) FindByUsername(username string) (*model.Subscriber, *errors.Error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	return s.first(func(row *model.Subscriber) bool { return row.Username == username })
+}
+
+func (s *SubscriberStore) FindByChatIDs(chatIDs []int64) ([]*model.Subscriber, *errors.Error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	ids := map[int64]bool{}
+	for _, id := range chatIDs {
+		ids[id] = true
+	}
+
+	return s.find(func(row *model.Subscriber) bool { return ids[row.ChatID] }), nil
+}
+
+func (s *SubscriberStore) Search(query string, limit int, offset int) ([]*model.Subscriber, *errors.Error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	query = strings.ToLower(query)
+	return page(s.find(func(row *model.Subscriber) bool {
+		return query == "" ||
+			strings.Contains(strings.ToLower(row.Username), query) ||
+			strconv.FormatInt(row.ChatID, 10) == query
+	}), limit, offset), nil
+}
+
+func (s *SubscriberStore) FindFreeMuteEnded(now time.Time) ([]*model.Subscriber, *errors.Error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	return s.find(func(row *model.Subscriber) bool {
+		return row.FreeMutedUntil != nil && !row.FreeMutedUntil.After(now)
+	}), nil
+}
+
+func (s *SubscriberStore) ResumeFreeMuted(m *model.Subscriber) (bool, *errors.Error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	row, ok := s.rows[m.ID]
+	if !ok || row.FreeMutedUntil == nil || m.FreeMutedUntil == nil || !row.FreeMutedUntil.Equal(*m.FreeMutedUntil) {
+		return false, nil
+	}
+	row.FreeMutedUntil = nil
+	row.UpdatedAt = time.Now()
+
+	return true, nil
+}
+
+func (s *SubscriberStore) FindLinkedArtists() ([]*model.Subscriber, *errors.Error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	return s.find(func(row *model.Subscriber) bool { return row.IsArtistLinked() }), nil
+}
+
+func (s *SubscriberStore) FindSubscribed() ([]*model.Subscriber, *errors.Error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	return s.find(func(row *model.Subscriber) bool { return row.Subscribed }), nil
+}
+
+func (s *SubscriberStore) CountSubscribed() (int64, *errors.Error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	return int64(len(s.find(func(row *model.Subscriber) bool { return row.Subscribed }))), nil
+}
+
+func (s *SubscriberStore) FindAll() ([]*model.Subscriber, *errors.Error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	return s.find(func(row *model.Subscriber) bool { return true }), nil
+}
+
+func (s *SubscriberStore) CountAll() (int64, *errors.Error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	return int64(len(s.rows)), nil
+}
+
+type ArtistSubscriptionStore struct {
+	*table[model.ArtistSubscribtion]
+}
+
+func NewArtistSubscriptionStore() *ArtistSubscriptionStore {
+	return &ArtistSubscriptionStore{newTable(func(m *model.ArtistSubscribtion) *uint64 { return &m.ID })}
+}
+
+func (s *ArtistSubscriptionStore) sameArtist(m *model.ArtistSubscribtion) func(row *model.ArtistSubscribtion) bool {
+	return func(row *model.ArtistSubscribtion) bool {
+		return row.ChatID == m.ChatID && row.Kind == m.Kind && row.FxHashArtistID == m.FxHashArtistID
+	}
+}
+
+func (s *ArtistSubscriptionStore) Create(m *model.ArtistSubscribtion) *errors.Error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if m.Kind == "" {
+		m.Kind = model.SubscriptionKindArtist
+	}
+	if s.exists(s.sameArtist(m), 0) {
+		return errDuplicate("uidx_chat_id_kind_fx_hash_artist_id")
+	}
+	m.CreatedAt = time.Now()
+	m.UpdatedAt = time.Now()
+	s.insert(m)
+
+	return nil
+}
+
+func (s *ArtistSubscriptionStore) Update(m *model.ArtistSubscribtion) *errors.Error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.exists(s.sameArtist(m), m.ID) {
+		return errDuplicate("uidx_chat_id_kind_fx_hash_artist_id")
+	}
+	m.UpdatedAt = time.Now()
+
+	return s.replace(m)
+}
+
+func (s *ArtistSubscriptionStore) FindByID(id uint64) (*model.ArtistSubscribtion, *errors.Error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	return s.first(func(row *model.ArtistSubscribtion) bool { return row.ID == id })
+}
+
+func (s *ArtistSubscriptionStore) FindByChatIDAndKindAndFxHashArtistName(chatID int64, kind string, FxHashArtistName string) (*model.ArtistSubscribtion, *errors.Error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	return s.first(func(row *model.ArtistSubscribtion) bool {
+		return row.ChatID == chatID && row.Kind == kind && row.FxHashArtistName == FxHashArtistName
+	})
+}
+
+func (s *ArtistSubscriptionStore) FindByChatId(chatID int64) ([]*model.ArtistSubscribtion, *errors.Error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	return s.find(func(row *model.ArtistSubscribtion) bool { return row.ChatID == chatID }), nil
+}
+
+func (s *ArtistSubscriptionStore) FindActiveByChatId(chatID int64) ([]*model.ArtistSubscribtion, *errors.Error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	return s.find(func(row *model.ArtistSubscribtion) bool { return row.ChatID == chatID && row.IsActive }), nil
+}
+
+func (s *ArtistSubscriptionStore) SearchByChatID(chatID int64, prefix string, limit int, offset int) ([]*model.ArtistSubscribtion, *errors.Error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	rows := s.find(s.byChatID(chatID, prefix))
+	sort.SliceStable(rows, func(i, j int) bool {
+		return strings.ToLower(rows[i].FxHashArtistName) < strings.ToLower(rows[j].FxHashArtistName)
+	})
+
+	return page(rows, limit, offset), nil
+}
+
+func (s *ArtistSubscriptionStore) CountByChatID(chatID int64, prefix string) (int64, *errors.Error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	return int64(len(s.find(s.byChatID(chatID, prefix)))), nil
+}
+
+func (s *ArtistSubscriptionStore) FindMuteEnded(now time.Time) ([]*model.ArtistSubscribtion, *errors.Error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	return s.find(func(row *model.ArtistSubscribtion) bool {
+		return row.MutedUntil != nil && !row.MutedUntil.After(now)
+	}), nil
+}
+
+func (s *ArtistSubscriptionStore) ResumeMuted(m *model.ArtistSubscribtion) (bool, *errors.Error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	row, ok := s.rows[m.ID]
+	if !ok || row.MutedUntil == nil || m.MutedUntil == nil || !row.MutedUntil.Equal(*m.MutedUntil) {
+		return false, nil
+	}
+	row.MutedUntil = nil
+	row.UpdatedAt = time.Now()
+
+	return true, nil
+}
+
+func (s *ArtistSubscriptionStore) byChatID(chatID int64, prefix string) func(row *model.ArtistSubscribtion) bool {
+	prefix = strings.ToLower(prefix)
+	return func(row *model.ArtistSubscribtion) bool {
+		return row.ChatID == chatID && strings.HasPrefix(strings.ToLower(row.FxHashArtistName), prefix)
+	}
+}
+
+func (s *ArtistSubscriptionStore) FindActiveByKindAndFxHashArtistIds(kind string, fxHashArtistIds []string) ([]*model.ArtistSubscribtion, *errors.Error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	ids := map[string]bool{}
+	for _, id := range fxHashArtistIds {
+		ids[id] = true
+	}
+
+	return s.find(func(row *model.ArtistSubscribtion) bool {
+		return row.Kind == kind && ids[row.FxHashArtistID] && row.IsActive
+	}), nil
+}
+
+func (s *ArtistSubscriptionStore) FindActiveByKind(kind string) ([]*model.ArtistSubscribtion, *errors.Error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	return s.find(func(row *model.ArtistSubscribtion) bool { return row.Kind == kind && row.IsActive }), nil
+}
+
+func (s *ArtistSubscriptionStore) CountActive() (int64, *errors.Error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	return int64(len(s.find(func(row *model.ArtistSubscribtion) bool {
+		return row.Kind == model.SubscriptionKindArtist && row.IsActive
+	}))), nil
+}
+
+func (s *ArtistSubscriptionStore) CountActiveChats() (int64, *errors.Error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	chats := map[int64]bool{}
+	for _, row := range s.find(func(row *model.ArtistSubscribtion) bool {
+		return row.Kind == model.SubscriptionKindArtist && row.IsActive
+	}) {
+		chats[row.ChatID] = true
+	}
+
+	return int64(len(chats)), nil
+}
+
+func (s *ArtistSubscriptionStore) FindTopArtists(limit int) ([]*orm.ArtistFollowers, *errors.Error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	byArtist := map[string]*orm.ArtistFollowers{}
+	result := []*orm.ArtistFollowers{}
+	for _, row := range s.find(func(row *model.ArtistSubscribtion) bool {
+		return row.Kind == model.SubscriptionKindArtist && row.IsActive
+	}) {
+		artist, ok := byArtist[row.FxHashArtistID]
+		if !ok {
+			artist = &orm.ArtistFollowers{FxHashArtistID: row.FxHashArtistID}
+			byArtist[row.FxHashArtistID] = artist
+			result = append(result, artist)
+		}
+		if row.FxHashArtistName > artist.FxHashArtistName {
+			artist.FxHashArtistName = row.FxHashArtistName
+		}
+		artist.Followers++
+	}
+	sort.Slice(result, func(i, j int) bool {
+		if result[i].Followers != result[j].Followers {
+			return result[i].Followers > result[j].Followers
+		}
+		return result[i].FxHashArtistID < result[j].FxHashArtistID
+	})
+	if len(result) > limit {
+		result = result[:limit]
+	}
+
+	return result, nil
+}
+
+type DeliveryItemStore struct {
+	*table[model.DeliveryItem]
+}
+
+func NewDeliveryItemStore() *DeliveryItemStore {
+	return &DeliveryItemStore{newTable(func(m *model.DeliveryItem) *uint64 { return &m.ID })}
+}
+
+func (s *DeliveryItemStore) sameItem(m *model.DeliveryItem) func(row *model.DeliveryItem) bool {
+	return func(row *model.DeliveryItem) bool {
+		return row.Type == m.Type && row.ChatID == m.ChatID && row.DedupeKey == m.DedupeKey
+	}
+}
+
+func (s *DeliveryItemStore) Create(m *model.DeliveryItem) *errors.Error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.exists(s.sameItem(m), 0) {
+		return errDuplicate("uidx_type_chat_id_dedupe_key")
+	}
+	m.CreatedAt = time.Now()
+	m.UpdatedAt = time.Now()
+	s.insert(m)
+
+	return nil
+}
+
+func (s *DeliveryItemStore) CreateBatch(items []*model.DeliveryItem) *errors.Error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for i, m := range items {
+		if s.exists(s.sameItem(m), 0) {
+			return errDuplicate("uidx_type_chat_id_dedupe_key")
+		}
+		for _, previous := range items[:i] {
+			if s.sameItem(m)(previous) {
+				return errDuplicate("uidx_type_chat_id_dedupe_key")
+			}
+		}
+	}
+	now := time.Now()
+	for _, m := range items {
+		m.CreatedAt = now
+		m.UpdatedAt = now
+		s.insert(m)
+	}
+
+	return nil
+}
+
+func (s *DeliveryItemStore) Update(m *model.DeliveryItem) *errors.Error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.exists(s.sameItem(m), m.ID) {
+		return errDuplicate("uidx_type_chat_id_dedupe_key")
+	}
+	m.UpdatedAt = time.Now()
+
+	return s.replace(m)
+}
+
+func (s *DeliveryItemStore) Delete(m *model.DeliveryItem) *errors.Error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.remove(m)
+
+	return nil
+}
+
+func (s *DeliveryItemStore) MarkSent(items []*model.DeliveryItem) *errors.Error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, m := range items {
+		if s.exists(s.sameItem(m), m.ID) {
+			return errDuplicate("uidx_type_chat_id_dedupe_key")
+		}
+	}
+	for _, m := range items {
+		m.IsSent = true
+		m.UpdatedAt = time.Now()
+		s.replace(m)
+	}
+
+	return nil
+}
+
+func (s *DeliveryItemStore) FindByID(id uint64) (*model.DeliveryItem, *errors.Error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	return s.first(func(row *model.DeliveryItem) bool { return row.ID == id })
+}
+
+func (s *DeliveryItemStore) FindByTypeAndChatIdAndDedupeKey(Type string, chatId int64, dedupeKey string) (*model.DeliveryItem, *errors.Error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	return s.first(func(row *model.DeliveryItem) bool {
+		return row.Type == Type && row.ChatID == chatId && row.DedupeKey == dedupeKey
+	})
+}
+
+func (s *DeliveryItemStore) FindByChatIdAndCollectorIdAndGenerativeSlug(chatId int64, collectorId string, generativeSlug string) (*model.DeliveryItem, *errors.Error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	return s.first(func(row *model.DeliveryItem) bool {
+		return row.Type == model.DeliveryItemTypeByCollector && row.ChatID == chatId &&
+			row.CollectorID == collectorId && row.GenerativeSlug == generativeSlug
+	})
+}
+
+func (s *DeliveryItemStore) ClaimNotSent(owner string, limit int, claimTimeout time.Duration) ([]*model.DeliveryItem, *errors.Error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	expiredAt := now.Add(-claimTimeout)
+	items := s.find(func(row *model.DeliveryItem) bool {
+		return !row.IsSent && (row.ClaimedAt == nil || row.ClaimedAt.Before(expiredAt)) && !held(row, now)
+	})
+	if len(items) > limit {
+		items = items[:limit]
+	}
+	for _, item := range items {
+		claimedAt := now
+		item.ClaimedBy = owner
+		item.ClaimedAt = &claimedAt
+		s.replace(item)
+	}
+
+	return items, nil
+}
+
+func (s *DeliveryItemStore) FindOldestNotSent() (*model.DeliveryItem, *errors.Error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	now := time.Now()
+	return s.first(func(row *model.DeliveryItem) bool { return !row.IsSent && !held(row, now) })
+}
+
+func held(item *model.DeliveryItem, now time.Time) bool {
+	return item.HoldUntil != nil && item.HoldUntil.After(now)
+}
+
+func (s *DeliveryItemStore) CountSentSince(since time.Time) (int64, *errors.Error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	return int64(len(s.find(func(row *model.DeliveryItem) bool {
+		return row.IsSent && !row.UpdatedAt.Before(since)
+	}))), nil
+}
+
+func (s *DeliveryItemStore) FindPending(limit int, offset int) ([]*model.DeliveryItem, *errors.Error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	return page(s.find(func(row *model.DeliveryItem) bool { return !row.IsSent }), limit, offset), nil
+}
+
+func (s *DeliveryItemStore) FindFailed(limit int, offset int) ([]*model.DeliveryItem, *errors.Error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	failed := s.find(func(row *model.DeliveryItem) bool { return row.IsSent && row.LastError != "" })
+	for i, j := 0, len(failed)-1; i < j; i, j = i+1, j-1 {
+		failed[i], failed[j] = failed[j], failed[i]
+	}
+
+	return page(failed, limit, offset), nil
+}
+
+type EventStore struct {
+	*table[model.Event]
+}
+
+func NewEventStore() *EventStore {
+	return &EventStore{newTable(func(m *model.Event) *uint64 { return &m.ID })}
+}
+
+func (s *EventStore) Push(chatId int64, eventCode string, eventData string) *errors.Error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.insert(&model.Event{
+		ChatID:    chatId,
+		EventCode: eventCode,
+		EventData: eventData,
+		CreatedAt: time.Now(),
+	})
+
+	return nil
+}
+
+func (s *EventStore) Find(filter orm.EventFilter) ([]*model.Event, *errors.Error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	events := s.find(func(row *model.Event) bool {
+		return (filter.ChatID == 0 || row.ChatID == filter.ChatID) &&
+			(filter.EventCode == "" || row.EventCode == filter.EventCode) &&
+			!row.CreatedAt.Before(filter.Since)
+	})
+	for i, j := 0, len(events)-1; i < j; i, j = i+1, j-1 {
+		events[i], events[j] = events[j], events[i]
+	}
+	if filter.Limit > 0 {
+		events = page(events, filter.Limit, 0)
+	}
+
+	return events, nil
+}
+
+// FindByChatID returns pushed events of the chat, it is not a part of the
+// orm.EventStore contract and is meant for assertions in tests.
+func (s *EventStore) FindByChatID(chatID int64) []*model.Event {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	return s.find(func(row *model.Event) bool { return row.ChatID == chatID })
+}
+
+type SettingStore struct {
+	mu       sync.RWMutex
+	settings map[string]string
+}
+
+func NewSettingStore() *SettingStore {
+	return &SettingStore{settings: map[string]string{}}
+}
+
+func (s *SettingStore) Get(key string) (string, *errors.Error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	value, ok := s.settings[key]
+	if !ok {
+		return "", errors.New("record not found", orm.ErrNotFound).With("key", key)
+	}
+
+	return value, nil
+}
+
+func (s *SettingStore) Set(key string, value string) *errors.Error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.settings[key] = value
+
+	return nil
+}
+
+type WalletStore struct {
+	*table[model.Wallet]
+}
+
+func NewWalletStore() *WalletStore {
+	return &WalletStore{newTable(func(m *model.Wallet) *uint64 { return &m.ID })}
+}
+
+func (s *WalletStore) Create(m *model.Wallet) *errors.Error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.exists(func(row *model.Wallet) bool { return row.ChatID == m.ChatID && row.Address == m.Address }, 0) {
+		return errDuplicate("uidx_wallets_chat_id_address")
+	}
+	m.CreatedAt = time.Now()
+	s.insert(m)
+
+	return nil
+}
+
+func (s *WalletStore) Update(m *model.Wallet) *errors.Error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.exists(func(row *model.Wallet) bool { return row.ChatID == m.ChatID && row.Address == m.Address }, m.ID) {
+		return errDuplicate("uidx_wallets_chat_id_address")
+	}
+
+	return s.replace(m)
+}
+
+func (s *WalletStore) Delete(m *model.Wallet) *errors.Error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.remove(m)
+
+	return nil
+}
+
+func (s *WalletStore) FindByID(id uint64) (*model.Wallet, *errors.Error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	return s.first(func(row *model.Wallet) bool { return row.ID == id })
+}
+
+func (s *WalletStore) FindAll() ([]*model.Wallet, *errors.Error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	return s.find(func(row *model.Wallet) bool { return true }), nil
+}
+
+func (s *WalletStore) FindByChatID(chatID int64) ([]*model.Wallet, *errors.Error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	return s.find(func(row *model.Wallet) bool { return row.ChatID == chatID }), nil
+}
+
+func (s *WalletStore) FindByChatIDAndAddress(chatID int64, address string) (*model.Wallet, *errors.Error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	return s.first(func(row *model.Wallet) bool { return row.ChatID == chatID && row.Address == address })
+}
+
+type ListingWatchStore struct {
+	*table[model.ListingWatch]
+}
+
+func NewListingWatchStore() *ListingWatchStore {
+	return &ListingWatchStore{newTable(func(m *model.ListingWatch) *uint64 { return &m.ID })}
+}
+
+func (s *ListingWatchStore) sameTarget(m *model.ListingWatch) func(row *model.ListingWatch) bool {
+	return func(row *model.ListingWatch) bool {
+		return row.ChatID == m.ChatID && row.Kind == m.Kind && row.TargetID == m.TargetID
+	}
+}
+
+func (s *ListingWatchStore) Create(m *model.ListingWatch) *errors.Error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.exists(s.sameTarget(m), 0) {
+		return errDuplicate("uidx_listing_watches_chat_id_kind_target_id")
+	}
+	m.CreatedAt = time.Now()
+	m.UpdatedAt = time.Now()
+	s.insert(m)
+
+	return nil
+}
+
+func (s *ListingWatchStore) Update(m *model.ListingWatch) *errors.Error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.exists(s.sameTarget(m), m.ID) {
+		return errDuplicate("uidx_listing_watches_chat_id_kind_target_id")
+	}
+	m.UpdatedAt = time.Now()
+
+	return s.replace(m)
+}
+
+func (s *ListingWatchStore) Delete(m *model.ListingWatch) *errors.Error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.remove(m)
+
+	return nil
+}
+
+func (s *ListingWatchStore) FindByID(id uint64) (*model.ListingWatch, *errors.Error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	return s.first(func(row *model.ListingWatch) bool { return row.ID == id })
+}
+
+func (s *ListingWatchStore) FindAll() ([]*model.ListingWatch, *errors.Error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	return s.find(func(row *model.ListingWatch) bool { return true }), nil
+}
+
+func (s *ListingWatchStore) FindByChatID(chatID int64) ([]*model.ListingWatch, *errors.Error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	return s.find(func(row *model.ListingWatch) bool { return row.ChatID == chatID }), nil
+}
+
+func (s *ListingWatchStore) FindByChatIDAndKindAndTargetID(chatID int64, kind string, targetID string) (*model.ListingWatch, *errors.Error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	return s.first(func(row *model.ListingWatch) bool {
+		return row.ChatID == chatID && row.Kind == kind && row.TargetID == targetID
+	})
+}
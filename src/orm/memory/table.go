@@ -0,0 +1,108 @@
+package memory
+
+import (
+	"sort"
+	"sync"
+
+	"github.com/kranikitao/fxhash-telegram-bot/src/errors"
+	"github.com/kranikitao/fxhash-telegram-bot/src/orm"
+)
+
+// table keeps copies of rows, so callers never share memory with the store
+// and changes are only visible after Create or Update, like with Postgres.
+type table[T any] struct {
+	mu     sync.RWMutex
+	rows   map[uint64]*T
+	nextID uint64
+	id     func(*T) *uint64
+}
+
+func newTable[T any](id func(*T) *uint64) *table[T] {
+	return &table[T]{
+		rows: map[uint64]*T{},
+		id:   id,
+	}
+}
+
+// insert stores a copy of m after unique checks the caller already did under lock
+func (t *table[T]) insert(m *T) {
+	t.nextID++
+	*t.id(m) = t.nextID
+	row := *m
+	t.rows[t.nextID] = &row
+}
+
+// replace upserts m like gorm's Save does
+func (t *table[T]) replace(m *T) *errors.Error {
+	id := *t.id(m)
+	if id == 0 {
+		t.insert(m)
+		return nil
+	}
+	if id > t.nextID {
+		t.nextID = id
+	}
+	row := *m
+	t.rows[id] = &row
+
+	return nil
+}
+
+func (t *table[T]) remove(m *T) {
+	delete(t.rows, *t.id(m))
+}
+
+// find returns copies of matching rows ordered by id
+func (t *table[T]) find(match func(*T) bool) []*T {
+	var ids []uint64
+	for id, row := range t.rows {
+		if match(row) {
+			ids = append(ids, id)
+		}
+	}
+	sort.Slice(ids, func(i, j int) bool { return ids[i] < ids[j] })
+
+	result := []*T{}
+	for _, id := range ids {
+		row := *t.rows[id]
+		result = append(result, &row)
+	}
+
+	return result
+}
+
+func (t *table[T]) first(match func(*T) bool) (*T, *errors.Error) {
+	result := t.find(match)
+	if len(result) == 0 {
+		return nil, errors.New("record not found", orm.ErrNotFound)
+	}
+
+	return result[0], nil
+}
+
+func (t *table[T]) exists(match func(*T) bool, except uint64) bool {
+	for id, row := range t.rows {
+		if id != except && match(row) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// page returns rows[offset:offset+limit] like LIMIT and OFFSET do
+func page[T any](rows []*T, limit int, offset int) []*T {
+	if offset >= len(rows) {
+		return []*T{}
+	}
+	rows = rows[offset:]
+	if limit >= 0 && len(rows) > limit {
+		rows = rows[:limit]
+	}
+
+	return rows
+}
+
+func errDuplicate(index string) *errors.Error {
+	return errors.New("duplicate key value violates unique constraint "+index, nil)
+}
@@ -6,17 +6,48 @@ import (
 	"gorm.io/gorm"
 )
 
+// kinds of subscriptions, FxHashArtistID and FxHashArtistName hold the
+// followed collector of collector subscriptions and the linked wallet address
+// of wallet subscriptions to offers and auctions
+const (
+	SubscriptionKindArtist    = "artist"
+	SubscriptionKindCollector = "collector"
+	SubscriptionKindWallet    = "wallet"
+)
+
 type ArtistSubscribtion struct {
 	gorm.Model
 	ID               uint64    `gorm:"column:id"`
 	FxHashArtistName string    `gorm:"column:fx_hash_artist_name"`
-	FxHashArtistID   string    `gorm:"column:fx_hash_artist_id"`
-	ChatID           int64     `gorm:"column:chat_id"`
+	FxHashArtistID   string    `gorm:"column:fx_hash_artist_id;index:uidx_chat_id_kind_fx_hash_artist_id,unique,priority:3;index:idx_fx_hash_artist_id"`
+	ChatID           int64     `gorm:"column:chat_id;index:uidx_chat_id_kind_fx_hash_artist_id,unique,priority:1"`
+	Kind             string    `gorm:"column:kind;index:uidx_chat_id_kind_fx_hash_artist_id,unique,priority:2"`
 	IsActive         bool      `gorm:"column:is_active"`
 	CreatedAt        time.Time `gorm:"column:created_at"`
 	UpdatedAt        time.Time `gorm:"column:updated_at"`
+	// AlwaysNotify items are delivered during quiet hours too
+	AlwaysNotify bool `gorm:"column:always_notify"`
+	// MutedUntil snoozes new generatives of the artist, the subscription
+	// resumes by itself once it passes
+	MutedUntil *time.Time `gorm:"column:muted_until"`
+	// FirstTouchOnly notifies about the first mint or purchase of a collector
+	// from a generative token only
+	FirstTouchOnly bool `gorm:"column:first_touch_only"`
 }
 
 func (m ArtistSubscribtion) TableName() string {
 	return "artist_subscriptions"
 }
+
+// IsMuted reports whether the subscription is snoozed at now
+func (m *ArtistSubscribtion) IsMuted(now time.Time) bool {
+	return m.MutedUntil != nil && m.MutedUntil.After(now)
+}
+
+func (m *ArtistSubscribtion) IsCollector() bool {
+	return m.Kind == SubscriptionKindCollector
+}
+
+func (m *ArtistSubscribtion) IsWallet() bool {
+	return m.Kind == SubscriptionKindWallet
+}
@@ -6,25 +6,97 @@ import (
 	"gorm.io/gorm"
 )
 
+// Items are unique by Type, ChatID and DedupeKey. Token items keep the id of
+// the generative token in GenerativeId and in DedupeKey.
 const (
 	DeliveryItemTypeByArtist = "by_artist"
 	DeliveryItemTypeFree     = "free"
-	NullChatID               = -1
+	// DeliveryItemTypeByCollector items tell that a followed collector minted
+	// or bought a token, they keep the objkt id in DedupeKey
+	DeliveryItemTypeByCollector = "by_collector"
+	// DeliveryItemTypeBroadcast items carry their own Text. A broadcast is
+	// queued as an item per chat, they have no generative and keep the time
+	// the broadcast was queued in DedupeKey to stay unique.
+	DeliveryItemTypeBroadcast = "broadcast"
+	// DeliveryItemTypeNotice items carry their own Text like broadcasts and
+	// go to a single chat
+	DeliveryItemTypeNotice = "notice"
+	// DeliveryItemTypeArtistEvent items tell a linked artist about an action
+	// on one of their tokens, they keep a hash of the action id in
+	// DedupeKey. DeliveryItemTypeArtistSummary items keep the local date
+	// of the summary like 20220314. Both carry their own Text.
+	DeliveryItemTypeArtistEvent   = "artist_event"
+	DeliveryItemTypeArtistSummary = "artist_summary"
+	// DeliveryItemTypeWalletObjkt items tell that an objkt landed in a linked
+	// wallet, they keep a hash of the action which brought it in DedupeKey
+	// and carry their own Text
+	DeliveryItemTypeWalletObjkt = "wallet_objkt"
+	// DeliveryItemTypeListing items tell about a listing below a threshold
+	// of a watch, they keep a hash of the listing in DedupeKey, carry
+	// their own Text and the objkt page in Url for the buy button
+	DeliveryItemTypeListing = "listing"
+	// DeliveryItemTypeWalletActivity items tell about offers on objkts of a
+	// linked wallet and auctions it bid on, they keep a hash of the event in
+	// DedupeKey, carry their own Text, the amount in Price and the page to
+	// act on in Url
+	DeliveryItemTypeWalletActivity = "wallet_activity"
+	// NullChatID items go to every subscriber of free generatives
+	NullChatID = -1
 )
 
 type DeliveryItem struct {
 	gorm.Model
-	ID             uint64    `gorm:"column:id"`
-	Type           string    `gorm:"column:type;index:uidx_type_chat_id_generative_id,unique"`
-	ChatID         int64     `gorm:"column:chat_id;index:uidx_type_chat_id_generative_id,unique"`
-	GenerativeId   int64     `gorm:"column:generative_id;index:uidx_type_chat_id_generative_id,unique"`
-	GenerativeSlug string    `gorm:"column:generative_slug"`
-	IsSent         bool      `gorm:"column:is_sent;index:idx_is_sent"`
-	CreatedAt      time.Time `gorm:"column:created_at"`
-	UpdatedAt      time.Time `gorm:"column:updated_at"`
-	Url            string    `gorm:"column:url"`
+	ID             uint64     `gorm:"column:id"`
+	Type           string     `gorm:"column:type;index:uidx_type_chat_id_dedupe_key,unique"`
+	ChatID         int64      `gorm:"column:chat_id;index:uidx_type_chat_id_dedupe_key,unique"`
+	DedupeKey      string     `gorm:"column:dedupe_key;index:uidx_type_chat_id_dedupe_key,unique"`
+	GenerativeId   int64      `gorm:"column:generative_id"`
+	GenerativeSlug string     `gorm:"column:generative_slug"`
+	IsSent         bool       `gorm:"column:is_sent;index:idx_is_sent"`
+	CreatedAt      time.Time  `gorm:"column:created_at"`
+	UpdatedAt      time.Time  `gorm:"column:updated_at"`
+	Url            string     `gorm:"column:url"`
+	ClaimedBy      string     `gorm:"column:claimed_by"`
+	ClaimedAt      *time.Time `gorm:"column:claimed_at"`
+	Text           string     `gorm:"column:text"`
+	LastError      string     `gorm:"column:last_error"`
+	Failures       int64      `gorm:"column:failures"`
+	// Urgent items ignore quiet hours of the recipient
+	Urgent bool `gorm:"column:urgent"`
+	// HoldUntil keeps the item from being claimed until the quiet hours of
+	// the recipient end
+	HoldUntil   *time.Time `gorm:"column:hold_until"`
+	MintOpensAt *time.Time `gorm:"column:mint_opens_at"`
+	Name        string     `gorm:"column:name"`
+	Author      string     `gorm:"column:author"`
+	// Price is in mutez, nil when it is unknown
+	Price *int64 `gorm:"column:price"`
+	// Collector, CollectorID and Action are set for
+	// DeliveryItemTypeByCollector items, Collector is the name shown to the
+	// chat and CollectorID stays the same when the collector renames
+	Collector   string `gorm:"column:collector"`
+	CollectorID string `gorm:"column:collector_id"`
+	Action      string `gorm:"column:action"`
 }
 
+// actions of a followed collector
+const (
+	CollectorActionMinted = "minted"
+	CollectorActionBought = "bought"
+)
+
 func (m DeliveryItem) TableName() string {
 	return "delivery_items"
 }
+
+// HasText reports whether the item is sent as its own Text rather than as a
+// generative
+func (m *DeliveryItem) HasText() bool {
+	switch m.Type {
+	case DeliveryItemTypeBroadcast, DeliveryItemTypeNotice, DeliveryItemTypeArtistEvent, DeliveryItemTypeArtistSummary,
+		DeliveryItemTypeWalletObjkt, DeliveryItemTypeListing, DeliveryItemTypeWalletActivity:
+		return true
+	}
+
+	return false
+}
@@ -9,7 +9,7 @@ import (
 type Event struct {
 	gorm.Model
 	ID        uint64    `gorm:"column:id"`
-	ChatID    int64     `gorm:"column:chat_id"`
+	ChatID    int64     `gorm:"column:chat_id;index:idx_events_chat_id"`
 	EventCode string    `gorm:"column:event_code"`
 	EventData string    `gorm:"column:event_data"`
 	CreatedAt time.Time `gorm:"column:created_at"`
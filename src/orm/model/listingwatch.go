@@ -0,0 +1,49 @@
+package model
+
+import (
+	"time"
+)
+
+// kinds of listing watches, TargetID is the id of the generative token or
+// of the artist
+const (
+	ListingWatchKindToken  = "token"
+	ListingWatchKindArtist = "artist"
+)
+
+// ListingWatch alerts the chat about marketplace listings of a generative
+// token, or of every token of an artist, below a price or below the floor
+type ListingWatch struct {
+	ID         uint64 `gorm:"column:id;primaryKey"`
+	ChatID     int64  `gorm:"column:chat_id;index:uidx_listing_watches_chat_id_kind_target_id,unique,priority:1"`
+	Kind       string `gorm:"column:kind;index:uidx_listing_watches_chat_id_kind_target_id,unique,priority:2"`
+	TargetID   string `gorm:"column:target_id;index:uidx_listing_watches_chat_id_kind_target_id,unique,priority:3"`
+	TargetName string `gorm:"column:target_name"`
+	// MaxPrice is in mutez, listings at this price or lower match
+	MaxPrice *int64 `gorm:"column:max_price"`
+	// BelowFloor is a percent, listings at least this much cheaper than the
+	// cheapest other listing match
+	BelowFloor int       `gorm:"column:below_floor"`
+	CreatedAt  time.Time `gorm:"column:created_at"`
+	UpdatedAt  time.Time `gorm:"column:updated_at"`
+}
+
+func (m ListingWatch) TableName() string {
+	return "listing_watches"
+}
+
+// IsSet reports whether the watch has a threshold, watches are created
+// before the threshold is typed
+func (m *ListingWatch) IsSet() bool {
+	return m.MaxPrice != nil || m.BelowFloor > 0
+}
+
+// Matches reports whether a listing at price crosses a threshold, floor is
+// 0 when there is no other listing
+func (m *ListingWatch) Matches(price int64, floor int64) bool {
+	if m.MaxPrice != nil && price <= *m.MaxPrice {
+		return true
+	}
+
+	return m.BelowFloor > 0 && floor > 0 && price*100 <= floor*int64(100-m.BelowFloor)
+}
@@ -0,0 +1,28 @@
+package model
+
+import (
+	"time"
+)
+
+const (
+	SettingCollectorPaused = "collector_paused"
+	// SettingCollectorRunRequested keeps when a run of the collector was
+	// requested, it is emptied once the leader takes the request
+	SettingCollectorRunRequested = "collector_run_requested"
+	// SettingTemplatePrefix followed by a kind of templates replaces the
+	// template of the kind
+	SettingTemplatePrefix = "template."
+	// SettingUpdatesOffset keeps the getUpdates offset, a new leader goes on
+	// from it instead of handling the updates of the previous one again
+	SettingUpdatesOffset = "updates_offset"
+)
+
+type Setting struct {
+	Key       string    `gorm:"column:key;primaryKey"`
+	Value     string    `gorm:"column:value"`
+	UpdatedAt time.Time `gorm:"column:updated_at"`
+}
+
+func (m Setting) TableName() string {
+	return "settings"
+}
@@ -6,18 +6,117 @@ import (
 	"gorm.io/gorm"
 )
 
+const (
+	DigestModeInstant = ""
+	DigestModeHourly  = "hourly"
+	DigestModeDaily   = "daily"
+)
+
 type Subscriber struct {
 	gorm.Model
 	ID         uint64    `gorm:"column:id"`
 	CreatedAt  time.Time `gorm:"column:created_at"`
 	UpdatedAt  time.Time `gorm:"column:updated_at"`
 	ChatID     int64     `gorm:"column:chat_id;index:uidx_chat_id,unique"`
-	Username   string    `gorm:"column:username"`
+	Username   string    `gorm:"column:username;index:idx_subscribers_username"`
 	Subscribed bool      `gorm:"column:subscribed"`
 	State      string    `gorm:"column:state"`
 	RawUser    string    `gorm:"column:raw_user"`
+	// Timezone is an IANA name, empty means UTC
+	Timezone string `gorm:"column:timezone"`
+	// QuietFrom and QuietTo are hours of the local day, quiet hours are off
+	// when they are equal
+	QuietFrom int `gorm:"column:quiet_from"`
+	QuietTo   int `gorm:"column:quiet_to"`
+	// DigestMode collects generatives into a digest sent every hour or every
+	// day at DigestHour of the local day
+	DigestMode string `gorm:"column:digest_mode"`
+	DigestHour int    `gorm:"column:digest_hour"`
+	// Language is a code of i18n, empty means the default language
+	Language string `gorm:"column:language"`
+	// FreeMutedUntil snoozes zero cost generatives like
+	// ArtistSubscribtion.MutedUntil
+	FreeMutedUntil *time.Time `gorm:"column:free_muted_until"`
+	// ArtistID and ArtistName are the fxhash account the chat links to get
+	// notifications about its own tokens. The link is pending until the
+	// account shows ArtistCode in its description, ArtistLinkedAt is set then.
+	ArtistID       string     `gorm:"column:artist_id"`
+	ArtistName     string     `gorm:"column:artist_name"`
+	ArtistCode     string     `gorm:"column:artist_code"`
+	ArtistLinkedAt *time.Time `gorm:"column:artist_linked_at"`
+	// WalletNonce is the nonce the chat signs to link a wallet, it can't be
+	// used after WalletNonceExpiresAt
+	WalletNonce          string     `gorm:"column:wallet_nonce"`
+	WalletNonceExpiresAt *time.Time `gorm:"column:wallet_nonce_expires_at"`
 }
 
 func (m Subscriber) TableName() string {
 	return "subscribers"
 }
+
+// IsFreeMuted reports whether zero cost generatives are snoozed at now
+func (m *Subscriber) IsFreeMuted(now time.Time) bool {
+	return m.FreeMutedUntil != nil && m.FreeMutedUntil.After(now)
+}
+
+// IsArtistLinked reports whether the chat proved it owns the fxhash account
+func (m *Subscriber) IsArtistLinked() bool {
+	return m.ArtistLinkedAt != nil
+}
+
+// Location returns the subscriber timezone, UTC when it is not set or unknown
+func (m *Subscriber) Location() *time.Location {
+	if m.Timezone == "" {
+		return time.UTC
+	}
+	location, err := time.LoadLocation(m.Timezone)
+	if err != nil {
+		return time.UTC
+	}
+
+	return location
+}
+
+func (m *Subscriber) HasQuietHours() bool {
+	return m.QuietFrom != m.QuietTo
+}
+
+// QuietUntil reports whether now falls into the quiet hours and when they end
+func (m *Subscriber) QuietUntil(now time.Time) (time.Time, bool) {
+	if !m.HasQuietHours() {
+		return time.Time{}, false
+	}
+	local := now.In(m.Location())
+	hour := local.Hour()
+	quiet := hour >= m.QuietFrom && hour < m.QuietTo
+	if m.QuietFrom > m.QuietTo {
+		quiet = hour >= m.QuietFrom || hour < m.QuietTo
+	}
+	if !quiet {
+		return time.Time{}, false
+	}
+	until := time.Date(local.Year(), local.Month(), local.Day(), m.QuietTo, 0, 0, 0, local.Location())
+	if !until.After(local) {
+		until = time.Date(local.Year(), local.Month(), local.Day()+1, m.QuietTo, 0, 0, 0, local.Location())
+	}
+
+	return until, true
+}
+
+func (m *Subscriber) HasDigest() bool {
+	return m.DigestMode == DigestModeHourly || m.DigestMode == DigestModeDaily
+}
+
+// NextDigest returns when the next digest after now is due
+func (m *Subscriber) NextDigest(now time.Time) time.Time {
+	local := now.In(m.Location())
+	if m.DigestMode == DigestModeHourly {
+		return time.Date(local.Year(), local.Month(), local.Day(), local.Hour()+1, 0, 0, 0, local.Location())
+	}
+	next := time.Date(local.Year(), local.Month(), local.Day(), m.DigestHour, 0, 0, 0, local.Location())
+	if !next.After(local) {
+		next = time.Date(local.Year(), local.Month(), local.Day()+1, m.DigestHour, 0, 0, 0, local.Location())
+	}
+
+	return next
+}
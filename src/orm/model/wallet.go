@@ -0,0 +1,31 @@
+package model
+
+import (
+	"time"
+)
+
+// Wallet is a Tezos address the chat proved to own by signing a nonce with
+// the key of the address
+type Wallet struct {
+	ID        uint64    `gorm:"column:id;primaryKey"`
+	ChatID    int64     `gorm:"column:chat_id;index:uidx_wallets_chat_id_address,unique,priority:1"`
+	Address   string    `gorm:"column:address;index:uidx_wallets_chat_id_address,unique,priority:2;index:idx_wallets_address"`
+	PublicKey string    `gorm:"column:public_key"`
+	CreatedAt time.Time `gorm:"column:created_at"`
+	// LastObjktAt is when the latest objkt the chat was told about landed in
+	// the wallet, objkts are looked for since CreatedAt until it is set
+	LastObjktAt *time.Time `gorm:"column:last_objkt_at"`
+}
+
+func (m Wallet) TableName() string {
+	return "wallets"
+}
+
+// ObjktsSince returns the watermark of new objkts
+func (m *Wallet) ObjktsSince() time.Time {
+	if m.LastObjktAt != nil {
+		return *m.LastObjktAt
+	}
+
+	return m.CreatedAt
+}
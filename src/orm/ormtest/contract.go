@@ -0,0 +1,655 @@
+// Package ormtest holds the contract every orm.Stores implementation must
+// follow. Run it from a test of the implementation:
+//
+//	func TestMemoryStores(t *testing.T) {
+//		ormtest.RunContract(t, func(t *testing.T) *orm.Stores { return memory.NewStores() })
+//	}
+package ormtest
+
+import (
+	"fmt"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/kranikitao/fxhash-telegram-bot/src/errors"
+	"github.com/kranikitao/fxhash-telegram-bot/src/orm"
+	"github.com/kranikitao/fxhash-telegram-bot/src/orm/model"
+)
+
+// RunContract runs the contract against stores returned by newStores, which
+// must return empty stores on every call.
+func RunContract(t *testing.T, newStores func(t *testing.T) *orm.Stores) {
+	t.Run("Subscribers", func(t *testing.T) { testSubscribers(t, newStores(t)) })
+	t.Run("ArtistSubscriptions", func(t *testing.T) { testArtistSubscriptions(t, newStores(t)) })
+	t.Run("DeliveryItems", func(t *testing.T) { testDeliveryItems(t, newStores(t)) })
+	t.Run("Events", func(t *testing.T) { testEvents(t, newStores(t)) })
+	t.Run("Settings", func(t *testing.T) { testSettings(t, newStores(t)) })
+	t.Run("Wallets", func(t *testing.T) { testWallets(t, newStores(t)) })
+	t.Run("ListingWatches", func(t *testing.T) { testListingWatches(t, newStores(t)) })
+}
+
+func testSubscribers(t *testing.T, stores *orm.Stores) {
+	store := stores.Subscribers
+
+	if _, err := store.FindByChatID(1); err == nil || !errors.Is(err, orm.ErrNotFound) {
+		t.Fatalf("FindByChatID on empty store: want %s, got %v", orm.ErrNotFound, err)
+	}
+
+	subscriber := &model.Subscriber{ChatID: 1, Username: "alice"}
+	if err := store.Create(subscriber); err != nil {
+		t.Fatalf("Create: %v", err)
+	}
+	if subscriber.ID == 0 || subscriber.CreatedAt.IsZero() {
+		t.Fatalf("Create must set ID and CreatedAt, got %+v", subscriber)
+	}
+	if err := store.Create(&model.Subscriber{ChatID: 1}); err == nil {
+		t.Fatal("Create must reject a second subscriber with the same chat id")
+	}
+	if err := store.Create(&model.Subscriber{ChatID: 2, Subscribed: true}); err != nil {
+		t.Fatalf("Create: %v", err)
+	}
+
+	subscriber.State = "subscribeartist"
+	subscriber.Subscribed = true
+	if err := store.Update(subscriber); err != nil {
+		t.Fatalf("Update: %v", err)
+	}
+	found, err := store.FindByChatID(1)
+	if err != nil {
+		t.Fatalf("FindByChatID: %v", err)
+	}
+	if found.ID != subscriber.ID || found.State != "subscribeartist" || found.Username != "alice" {
+		t.Fatalf("FindByChatID: got %+v", found)
+	}
+
+	found.State = "changed"
+	if again, _ := store.FindByChatID(1); again.State != "subscribeartist" {
+		t.Fatal("changes must not be visible before Update")
+	}
+
+	subscribed, err := store.FindSubscribed()
+	if err != nil {
+		t.Fatalf("FindSubscribed: %v", err)
+	}
+	if len(subscribed) != 2 {
+		t.Fatalf("FindSubscribed: want 2 subscribers, got %d", len(subscribed))
+	}
+	if count, err := store.CountSubscribed(); err != nil || count != 2 {
+		t.Fatalf("CountSubscribed: want 2, got %d, %v", count, err)
+	}
+
+	if err := store.Create(&model.Subscriber{ChatID: 3, Username: "carol"}); err != nil {
+		t.Fatalf("Create: %v", err)
+	}
+	all, err := store.FindAll()
+	if err != nil || len(all) != 3 {
+		t.Fatalf("FindAll: want 3 subscribers, got %v, %v", all, err)
+	}
+	if count, err := store.CountAll(); err != nil || count != 3 {
+		t.Fatalf("CountAll: want 3, got %d, %v", count, err)
+	}
+	byUsername, err := store.FindByUsername("carol")
+	if err != nil || byUsername.ChatID != 3 {
+		t.Fatalf("FindByUsername: got %+v, %v", byUsername, err)
+	}
+	if _, err := store.FindByUsername("dave"); err == nil || !errors.Is(err, orm.ErrNotFound) {
+		t.Fatalf("FindByUsername: want %s, got %v", orm.ErrNotFound, err)
+	}
+	searched, err := store.Search("", 2, 1)
+	if err != nil || len(searched) != 2 || searched[0].ChatID != 2 {
+		t.Fatalf("Search: want the second page of everyone, got %v, %v", searched, err)
+	}
+	searched, err = store.Search("ARO", 10, 0)
+	if err != nil || len(searched) != 1 || searched[0].ChatID != 3 {
+		t.Fatalf("Search by username: got %v, %v", searched, err)
+	}
+	searched, err = store.Search("2", 10, 0)
+	if err != nil || len(searched) != 1 || searched[0].ChatID != 2 {
+		t.Fatalf("Search by chat id: got %v, %v", searched, err)
+	}
+	byChatIDs, err := store.FindByChatIDs([]int64{1, 3, 4})
+	if err != nil || len(byChatIDs) != 2 || byChatIDs[0].ChatID != 1 || byChatIDs[1].ChatID != 3 {
+		t.Fatalf("FindByChatIDs: got %v, %v", byChatIDs, err)
+	}
+
+	now := time.Now()
+	ended, later := now.Add(-time.Minute), now.Add(time.Hour)
+	byChatIDs[0].FreeMutedUntil = &ended
+	byChatIDs[1].FreeMutedUntil = &later
+	for _, subscriber := range byChatIDs {
+		if err := store.Update(subscriber); err != nil {
+			t.Fatalf("Update: %v", err)
+		}
+	}
+	muteEnded, err := store.FindFreeMuteEnded(now)
+	if err != nil || len(muteEnded) != 1 || muteEnded[0].ChatID != 1 {
+		t.Fatalf("FindFreeMuteEnded: want chat 1, got %v, %v", muteEnded, err)
+	}
+	stale := *muteEnded[0]
+	stale.FreeMutedUntil = &later
+	if resumed, err := store.ResumeFreeMuted(&stale); err != nil || resumed {
+		t.Fatalf("ResumeFreeMuted must skip a mute changed since it was read, got %v, %v", resumed, err)
+	}
+	for i, want := range []bool{true, false} {
+		if resumed, err := store.ResumeFreeMuted(muteEnded[0]); err != nil || resumed != want {
+			t.Fatalf("ResumeFreeMuted %d: want %v, got %v, %v", i+1, want, resumed, err)
+		}
+	}
+	if resumed, err := store.FindFreeMuteEnded(now); err != nil || len(resumed) != 0 {
+		t.Fatalf("FindFreeMuteEnded: want nothing after ResumeFreeMuted, got %v, %v", resumed, err)
+	}
+	muteEnded[0].FreeMutedUntil = nil
+
+	muteEnded[0].ArtistID, muteEnded[0].ArtistName, muteEnded[0].ArtistCode = "tz1a", "a", "fxbot-1"
+	if err := store.Update(muteEnded[0]); err != nil {
+		t.Fatalf("Update: %v", err)
+	}
+	if linked, err := store.FindLinkedArtists(); err != nil || len(linked) != 0 {
+		t.Fatalf("FindLinkedArtists must skip pending links, got %v, %v", linked, err)
+	}
+	muteEnded[0].ArtistLinkedAt = &now
+	if err := store.Update(muteEnded[0]); err != nil {
+		t.Fatalf("Update: %v", err)
+	}
+	if linked, err := store.FindLinkedArtists(); err != nil || len(linked) != 1 || linked[0].ArtistID != "tz1a" {
+		t.Fatalf("FindLinkedArtists: want chat 1, got %v, %v", linked, err)
+	}
+	if found, err := store.FindByChatID(1); err != nil || found.ArtistName != "a" || found.ArtistCode != "fxbot-1" || !found.IsArtistLinked() {
+		t.Fatalf("FindByChatID must return the artist link, got %+v, %v", found, err)
+	}
+	muteEnded[0].ArtistID, muteEnded[0].ArtistName, muteEnded[0].ArtistCode, muteEnded[0].ArtistLinkedAt = "", "", "", nil
+	if err := store.Update(muteEnded[0]); err != nil {
+		t.Fatalf("Update: %v", err)
+	}
+	if linked, err := store.FindLinkedArtists(); err != nil || len(linked) != 0 {
+		t.Fatalf("FindLinkedArtists must skip unlinked artists, got %v, %v", linked, err)
+	}
+}
+
+func testArtistSubscriptions(t *testing.T, stores *orm.Stores) {
+	store := stores.ArtistSubscriptions
+
+	active, err := store.FindActiveByChatId(1)
+	if err != nil || len(active) != 0 {
+		t.Fatalf("FindActiveByChatId on empty store: got %v, %v", active, err)
+	}
+
+	first := &model.ArtistSubscribtion{ChatID: 1, FxHashArtistID: "tz1a", FxHashArtistName: "a", IsActive: true}
+	second := &model.ArtistSubscribtion{ChatID: 1, FxHashArtistID: "tz1b", FxHashArtistName: "b", IsActive: true}
+	other := &model.ArtistSubscribtion{ChatID: 2, FxHashArtistID: "tz1a", FxHashArtistName: "a", IsActive: true}
+	for _, subscription := range []*model.ArtistSubscribtion{first, second, other} {
+		if err := store.Create(subscription); err != nil {
+			t.Fatalf("Create: %v", err)
+		}
+	}
+	if err := store.Create(&model.ArtistSubscribtion{ChatID: 1, FxHashArtistID: "tz1a"}); err == nil {
+		t.Fatal("Create must reject a second subscription of a chat to the same artist")
+	}
+
+	second.IsActive = false
+	if err := store.Update(second); err != nil {
+		t.Fatalf("Update: %v", err)
+	}
+
+	found, err := store.FindByChatIDAndKindAndFxHashArtistName(1, model.SubscriptionKindArtist, "b")
+	if err != nil {
+		t.Fatalf("FindByChatIDAndKindAndFxHashArtistName: %v", err)
+	}
+	if found.ID != second.ID || found.IsActive {
+		t.Fatalf("FindByChatIDAndKindAndFxHashArtistName: got %+v", found)
+	}
+	if _, err := store.FindByChatIDAndKindAndFxHashArtistName(2, model.SubscriptionKindArtist, "b"); err == nil || !errors.Is(err, orm.ErrNotFound) {
+		t.Fatalf("FindByChatIDAndKindAndFxHashArtistName: want %s, got %v", orm.ErrNotFound, err)
+	}
+
+	active, err = store.FindActiveByChatId(1)
+	if err != nil || len(active) != 1 || active[0].ID != first.ID {
+		t.Fatalf("FindActiveByChatId: got %v, %v", active, err)
+	}
+	all, err := store.FindByChatId(1)
+	if err != nil || len(all) != 2 {
+		t.Fatalf("FindByChatId must return inactive subscriptions too, got %v, %v", all, err)
+	}
+	if byID, err := store.FindByID(second.ID); err != nil || byID.FxHashArtistID != "tz1b" {
+		t.Fatalf("FindByID: got %+v, %v", byID, err)
+	}
+
+	if first.Kind != model.SubscriptionKindArtist {
+		t.Fatalf("Create must default the kind to %s, got %q", model.SubscriptionKindArtist, first.Kind)
+	}
+	byArtist, err := store.FindActiveByKindAndFxHashArtistIds(model.SubscriptionKindArtist, []string{"tz1a", "tz1b", "tz1c"})
+	if err != nil || len(byArtist) != 2 {
+		t.Fatalf("FindActiveByKindAndFxHashArtistIds: got %v, %v", byArtist, err)
+	}
+
+	if count, err := store.CountActive(); err != nil || count != 2 {
+		t.Fatalf("CountActive: want 2, got %d, %v", count, err)
+	}
+	if err := store.Create(&model.ArtistSubscribtion{ChatID: 2, FxHashArtistID: "tz1b", IsActive: true}); err != nil {
+		t.Fatalf("Create: %v", err)
+	}
+	if count, err := store.CountActiveChats(); err != nil || count != 2 {
+		t.Fatalf("CountActiveChats: want 2, got %d, %v", count, err)
+	}
+
+	top, err := store.FindTopArtists(1)
+	if err != nil || len(top) != 1 || top[0].FxHashArtistID != "tz1a" || top[0].FxHashArtistName != "a" || top[0].Followers != 2 {
+		t.Fatalf("FindTopArtists: want tz1a followed twice, got %v, %v", top, err)
+	}
+
+	for _, subscription := range []*model.ArtistSubscribtion{
+		{ChatID: 1, FxHashArtistID: "tz1c", FxHashArtistName: "bc"},
+		{ChatID: 1, FxHashArtistID: "tz1d", FxHashArtistName: "B2", IsActive: true},
+		{ChatID: 1, FxHashArtistID: "tz1e", FxHashArtistName: "_x"},
+	} {
+		if err := store.Create(subscription); err != nil {
+			t.Fatalf("Create: %v", err)
+		}
+	}
+	names := func(subscriptions []*model.ArtistSubscribtion) []string {
+		var result []string
+		for _, subscription := range subscriptions {
+			result = append(result, subscription.FxHashArtistName)
+		}
+		return result
+	}
+	if found, err := store.SearchByChatID(1, "b", 2, 0); err != nil || fmt.Sprint(names(found)) != "[b B2]" {
+		t.Fatalf("SearchByChatID: want [b B2], got %v, %v", names(found), err)
+	}
+	if found, err := store.SearchByChatID(1, "b", 2, 2); err != nil || fmt.Sprint(names(found)) != "[bc]" {
+		t.Fatalf("SearchByChatID: want [bc] on the second page, got %v, %v", names(found), err)
+	}
+	if count, err := store.CountByChatID(1, "B"); err != nil || count != 3 {
+		t.Fatalf("CountByChatID: want 3, got %d, %v", count, err)
+	}
+	if count, err := store.CountByChatID(1, "_"); err != nil || count != 1 {
+		t.Fatalf("CountByChatID must match wildcards literally, want 1, got %d, %v", count, err)
+	}
+	if count, err := store.CountByChatID(1, ""); err != nil || count != 5 {
+		t.Fatalf("CountByChatID: want 5, got %d, %v", count, err)
+	}
+
+	now := time.Now()
+	ended, later := now.Add(-time.Minute), now.Add(time.Hour)
+	first.MutedUntil = &ended
+	other.MutedUntil = &later
+	for _, subscription := range []*model.ArtistSubscribtion{first, other} {
+		if err := store.Update(subscription); err != nil {
+			t.Fatalf("Update: %v", err)
+		}
+	}
+	muteEnded, err := store.FindMuteEnded(now)
+	if err != nil || len(muteEnded) != 1 || muteEnded[0].ID != first.ID {
+		t.Fatalf("FindMuteEnded: want the first subscription, got %v, %v", muteEnded, err)
+	}
+	stale := *muteEnded[0]
+	stale.MutedUntil = &later
+	if resumed, err := store.ResumeMuted(&stale); err != nil || resumed {
+		t.Fatalf("ResumeMuted must skip a mute changed since it was read, got %v, %v", resumed, err)
+	}
+	for i, want := range []bool{true, false} {
+		if resumed, err := store.ResumeMuted(muteEnded[0]); err != nil || resumed != want {
+			t.Fatalf("ResumeMuted %d: want %v, got %v, %v", i+1, want, resumed, err)
+		}
+	}
+	if resumed, err := store.FindMuteEnded(now); err != nil || len(resumed) != 0 {
+		t.Fatalf("FindMuteEnded: want nothing after ResumeMuted, got %v, %v", resumed, err)
+	}
+	first.MutedUntil = nil
+
+	if count, err := store.CountActive(); err != nil || count != 4 {
+		t.Fatalf("CountActive: want 4, got %d, %v", count, err)
+	}
+	collector := &model.ArtistSubscribtion{ChatID: 1, Kind: model.SubscriptionKindCollector, FxHashArtistID: "tz1a", FxHashArtistName: "a", IsActive: true}
+	if err := store.Create(collector); err != nil {
+		t.Fatalf("Create must accept a collector followed by a chat subscribed to the same artist: %v", err)
+	}
+	if err := store.Create(&model.ArtistSubscribtion{ChatID: 3, Kind: model.SubscriptionKindWallet, FxHashArtistID: "tz1w", IsActive: true}); err != nil {
+		t.Fatalf("Create: %v", err)
+	}
+	if count, err := store.CountActive(); err != nil || count != 4 {
+		t.Fatalf("CountActive must skip collectors and wallets, want 4, got %d, %v", count, err)
+	}
+	if count, err := store.CountActiveChats(); err != nil || count != 2 {
+		t.Fatalf("CountActiveChats must skip chats following only collectors or wallets, want 2, got %d, %v", count, err)
+	}
+	if found, err := store.FindByChatIDAndKindAndFxHashArtistName(1, model.SubscriptionKindCollector, "a"); err != nil || found.ID != collector.ID {
+		t.Fatalf("FindByChatIDAndKindAndFxHashArtistName: want the collector, got %+v, %v", found, err)
+	}
+	if collectors, err := store.FindActiveByKind(model.SubscriptionKindCollector); err != nil || len(collectors) != 1 || collectors[0].ID != collector.ID {
+		t.Fatalf("FindActiveByKind: want the collector, got %v, %v", collectors, err)
+	}
+	if wallets, err := store.FindActiveByKind(model.SubscriptionKindWallet); err != nil || len(wallets) != 1 || wallets[0].FxHashArtistID != "tz1w" {
+		t.Fatalf("FindActiveByKind: want the wallet, got %v, %v", wallets, err)
+	}
+	if byArtist, err := store.FindActiveByKindAndFxHashArtistIds(model.SubscriptionKindArtist, []string{"tz1a"}); err != nil || len(byArtist) != 2 {
+		t.Fatalf("FindActiveByKindAndFxHashArtistIds must skip collectors, got %v, %v", byArtist, err)
+	}
+	if top, err := store.FindTopArtists(1); err != nil || len(top) != 1 || top[0].Followers != 2 {
+		t.Fatalf("FindTopArtists must skip collectors, got %v, %v", top, err)
+	}
+}
+
+func testDeliveryItems(t *testing.T, stores *orm.Stores) {
+	store := stores.DeliveryItems
+
+	if _, err := store.FindByTypeAndChatIdAndDedupeKey(model.DeliveryItemTypeByArtist, 1, "10"); err == nil || !errors.Is(err, orm.ErrNotFound) {
+		t.Fatalf("FindByTypeAndChatIdAndDedupeKey on empty store: want %s, got %v", orm.ErrNotFound, err)
+	}
+
+	if _, err := store.FindOldestNotSent(); err == nil || !errors.Is(err, orm.ErrNotFound) {
+		t.Fatalf("FindOldestNotSent on empty store: want %s, got %v", orm.ErrNotFound, err)
+	}
+
+	var items []*model.DeliveryItem
+	for i := int64(1); i <= 3; i++ {
+		item := &model.DeliveryItem{Type: model.DeliveryItemTypeByArtist, ChatID: 1, DedupeKey: strconv.FormatInt(i, 10), GenerativeId: i}
+		if err := store.Create(item); err != nil {
+			t.Fatalf("Create: %v", err)
+		}
+		items = append(items, item)
+	}
+	if err := store.Create(&model.DeliveryItem{Type: model.DeliveryItemTypeByArtist, ChatID: 1, DedupeKey: "1", GenerativeId: 1}); err == nil {
+		t.Fatal("Create must reject a duplicated delivery item")
+	}
+
+	items[0].IsSent = true
+	if err := store.Update(items[0]); err != nil {
+		t.Fatalf("Update: %v", err)
+	}
+
+	oldest, err := store.FindOldestNotSent()
+	if err != nil || oldest.ID != items[1].ID {
+		t.Fatalf("FindOldestNotSent: got %+v, %v", oldest, err)
+	}
+
+	claimed, err := store.ClaimNotSent("first", 1, time.Hour)
+	if err != nil || len(claimed) != 1 || claimed[0].ID != items[1].ID || claimed[0].ClaimedBy != "first" {
+		t.Fatalf("ClaimNotSent must return the oldest not sent item, got %v, %v", claimed, err)
+	}
+	claimed, err = store.ClaimNotSent("second", 10, time.Hour)
+	if err != nil || len(claimed) != 1 || claimed[0].ID != items[2].ID {
+		t.Fatalf("ClaimNotSent must skip claimed items, got %v, %v", claimed, err)
+	}
+	claimed, err = store.ClaimNotSent("third", 10, -time.Second)
+	if err != nil || len(claimed) != 2 {
+		t.Fatalf("ClaimNotSent must reclaim expired items, got %v, %v", claimed, err)
+	}
+
+	found, err := store.FindByTypeAndChatIdAndDedupeKey(model.DeliveryItemTypeByArtist, 1, "1")
+	if err != nil || found.ID != items[0].ID || !found.IsSent {
+		t.Fatalf("FindByTypeAndChatIdAndDedupeKey: got %+v, %v", found, err)
+	}
+
+	if count, err := store.CountSentSince(time.Now().Add(-time.Hour)); err != nil || count != 1 {
+		t.Fatalf("CountSentSince: want 1, got %d, %v", count, err)
+	}
+	if count, err := store.CountSentSince(time.Now().Add(time.Hour)); err != nil || count != 0 {
+		t.Fatalf("CountSentSince: want 0, got %d, %v", count, err)
+	}
+	pending, err := store.FindPending(10, 1)
+	if err != nil || len(pending) != 1 || pending[0].ID != items[2].ID {
+		t.Fatalf("FindPending: want the second not sent item, got %v, %v", pending, err)
+	}
+	// an item failing until it is given up is not failed yet
+	items[2].Failures = 1
+	items[2].LastError = "Too Many Requests: retry after 1"
+	if err := store.Update(items[2]); err != nil {
+		t.Fatalf("Update: %v", err)
+	}
+	if failed, err := store.FindFailed(10, 0); err != nil || len(failed) != 0 {
+		t.Fatalf("FindFailed: want nothing, got %v, %v", failed, err)
+	}
+	items[1].IsSent = true
+	items[1].Failures = 1
+	items[1].LastError = "Forbidden: bot was blocked by the user"
+	if err := store.Update(items[1]); err != nil {
+		t.Fatalf("Update: %v", err)
+	}
+	if failed, err := store.FindFailed(10, 0); err != nil || len(failed) != 1 || failed[0].LastError != items[1].LastError {
+		t.Fatalf("FindFailed: got %v, %v", failed, err)
+	}
+
+	if err := store.Delete(items[2]); err != nil {
+		t.Fatalf("Delete: %v", err)
+	}
+	if _, err := store.FindByID(items[2].ID); err == nil || !errors.Is(err, orm.ErrNotFound) {
+		t.Fatalf("FindByID of a deleted item: want %s, got %v", orm.ErrNotFound, err)
+	}
+	if byID, err := store.FindByID(items[1].ID); err != nil || byID.Failures != 1 {
+		t.Fatalf("FindByID: got %+v, %v", byID, err)
+	}
+
+	holdUntil := time.Now().Add(time.Hour)
+	held := &model.DeliveryItem{Type: model.DeliveryItemTypeByArtist, ChatID: 1, DedupeKey: "4", GenerativeId: 4, HoldUntil: &holdUntil}
+	if err := store.Create(held); err != nil {
+		t.Fatalf("Create: %v", err)
+	}
+	if claimed, err := store.ClaimNotSent("fourth", 10, -time.Second); err != nil || len(claimed) != 0 {
+		t.Fatalf("ClaimNotSent must skip held items, got %v, %v", claimed, err)
+	}
+	if _, err := store.FindOldestNotSent(); err == nil || !errors.Is(err, orm.ErrNotFound) {
+		t.Fatalf("FindOldestNotSent must skip held items, got %v", err)
+	}
+	released := time.Now().Add(-time.Second)
+	held.HoldUntil = &released
+	if err := store.Update(held); err != nil {
+		t.Fatalf("Update: %v", err)
+	}
+	if claimed, err := store.ClaimNotSent("fourth", 10, -time.Second); err != nil || len(claimed) != 1 || claimed[0].ID != held.ID {
+		t.Fatalf("ClaimNotSent must return released items, got %v, %v", claimed, err)
+	}
+
+	digest := []*model.DeliveryItem{held, {Type: model.DeliveryItemTypeByArtist, ChatID: 1, DedupeKey: "5", GenerativeId: 5}}
+	if err := store.Create(digest[1]); err != nil {
+		t.Fatalf("Create: %v", err)
+	}
+	if err := store.MarkSent(digest); err != nil {
+		t.Fatalf("MarkSent: %v", err)
+	}
+	for _, item := range digest {
+		if found, err := store.FindByID(item.ID); err != nil || !found.IsSent {
+			t.Fatalf("MarkSent must mark every item sent, got %+v, %v", found, err)
+		}
+	}
+	if claimed, err := store.ClaimNotSent("fourth", 10, -time.Second); err != nil || len(claimed) != 0 {
+		t.Fatalf("ClaimNotSent must skip deleted items, got %v, %v", claimed, err)
+	}
+
+	collected := &model.DeliveryItem{Type: model.DeliveryItemTypeByCollector, ChatID: 1, DedupeKey: "100", GenerativeId: 15021, GenerativeSlug: "waves", Collector: "a", CollectorID: "tz1a", IsSent: true}
+	if err := store.Create(collected); err != nil {
+		t.Fatalf("Create: %v", err)
+	}
+	// another objkt of the same token is another item
+	if err := store.Create(&model.DeliveryItem{Type: model.DeliveryItemTypeByCollector, ChatID: 1, DedupeKey: "101", GenerativeId: 15021, GenerativeSlug: "waves", IsSent: true}); err != nil {
+		t.Fatalf("Create: items are unique by their dedupe key, got %v", err)
+	}
+	if found, err := store.FindByChatIdAndCollectorIdAndGenerativeSlug(1, "tz1a", "waves"); err != nil || found.ID != collected.ID {
+		t.Fatalf("FindByChatIdAndCollectorIdAndGenerativeSlug: got %+v, %v", found, err)
+	}
+	if _, err := store.FindByChatIdAndCollectorIdAndGenerativeSlug(1, "a", "waves"); err == nil || !errors.Is(err, orm.ErrNotFound) {
+		t.Fatalf("FindByChatIdAndCollectorIdAndGenerativeSlug: want %s, got %v", orm.ErrNotFound, err)
+	}
+
+	broadcast := func(chatIDs ...int64) []*model.DeliveryItem {
+		var items []*model.DeliveryItem
+		for _, chatID := range chatIDs {
+			items = append(items, &model.DeliveryItem{Type: model.DeliveryItemTypeBroadcast, ChatID: chatID, DedupeKey: "200", Text: "hello"})
+		}
+		return items
+	}
+	batch := broadcast(1, 2)
+	if err := store.CreateBatch(batch); err != nil {
+		t.Fatalf("CreateBatch: %v", err)
+	}
+	for _, item := range batch {
+		if found, err := store.FindByID(item.ID); err != nil || item.ID == 0 || found.ChatID != item.ChatID {
+			t.Fatalf("CreateBatch must create every item, got %+v, %v", found, err)
+		}
+	}
+	for _, rejected := range [][]*model.DeliveryItem{broadcast(3, 2), broadcast(4, 4)} {
+		if err := store.CreateBatch(rejected); err == nil {
+			t.Fatal("CreateBatch must reject a duplicated delivery item")
+		}
+		if _, err := store.FindByTypeAndChatIdAndDedupeKey(model.DeliveryItemTypeBroadcast, rejected[0].ChatID, "200"); err == nil || !errors.Is(err, orm.ErrNotFound) {
+			t.Fatalf("CreateBatch must create nothing when an item is rejected, got %v", err)
+		}
+	}
+}
+
+func testEvents(t *testing.T, stores *orm.Stores) {
+	store := stores.Events
+
+	for _, event := range []struct {
+		chatID int64
+		code   string
+		data   string
+	}{{1, "chat", "/start"}, {2, "chat", "/start"}, {1, "callback", "/cancel"}} {
+		if err := store.Push(event.chatID, event.code, event.data); err != nil {
+			t.Fatalf("Push: %v", err)
+		}
+	}
+
+	found, err := store.Find(orm.EventFilter{ChatID: 1})
+	if err != nil || len(found) != 2 || found[0].EventCode != "callback" {
+		t.Fatalf("Find by chat: want 2 events latest first, got %v, %v", found, err)
+	}
+	found, err = store.Find(orm.EventFilter{EventCode: "chat", Limit: 1})
+	if err != nil || len(found) != 1 || found[0].ChatID != 2 {
+		t.Fatalf("Find by code: got %v, %v", found, err)
+	}
+	found, err = store.Find(orm.EventFilter{Since: time.Now().Add(time.Hour)})
+	if err != nil || len(found) != 0 {
+		t.Fatalf("Find since: want nothing, got %v, %v", found, err)
+	}
+}
+
+func testSettings(t *testing.T, stores *orm.Stores) {
+	store := stores.Settings
+
+	if _, err := store.Get(model.SettingCollectorPaused); err == nil || !errors.Is(err, orm.ErrNotFound) {
+		t.Fatalf("Get on empty store: want %s, got %v", orm.ErrNotFound, err)
+	}
+	for _, value := range []string{"true", "false"} {
+		if err := store.Set(model.SettingCollectorPaused, value); err != nil {
+			t.Fatalf("Set: %v", err)
+		}
+		if got, err := store.Get(model.SettingCollectorPaused); err != nil || got != value {
+			t.Fatalf("Get: want %q, got %q, %v", value, got, err)
+		}
+	}
+}
+
+func testWallets(t *testing.T, stores *orm.Stores) {
+	store := stores.Wallets
+
+	wallet := &model.Wallet{ChatID: 1, Address: "tz1a", PublicKey: "edpka"}
+	if err := store.Create(wallet); err != nil {
+		t.Fatalf("Create: %v", err)
+	}
+	if wallet.ID == 0 || wallet.CreatedAt.IsZero() {
+		t.Fatalf("Create must set ID and CreatedAt, got %+v", wallet)
+	}
+	if err := store.Create(&model.Wallet{ChatID: 1, Address: "tz1a"}); err == nil {
+		t.Fatal("Create must reject the same address twice in a chat")
+	}
+	for _, other := range []*model.Wallet{{ChatID: 1, Address: "tz2b"}, {ChatID: 2, Address: "tz1a"}} {
+		if err := store.Create(other); err != nil {
+			t.Fatalf("Create: %v", err)
+		}
+	}
+
+	found, err := store.FindByChatID(1)
+	if err != nil || len(found) != 2 || found[0].Address != "tz1a" {
+		t.Fatalf("FindByChatID: want 2 wallets in id order, got %v, %v", found, err)
+	}
+	if got, err := store.FindByChatIDAndAddress(2, "tz1a"); err != nil || got.ChatID != 2 {
+		t.Fatalf("FindByChatIDAndAddress: got %v, %v", got, err)
+	}
+	if got, err := store.FindByID(wallet.ID); err != nil || got.LastObjktAt != nil || !got.ObjktsSince().Equal(got.CreatedAt) {
+		t.Fatalf("FindByID: want objkts looked for since CreatedAt, got %+v, %v", got, err)
+	}
+	seen := time.Now().Add(time.Hour).Truncate(time.Second)
+	wallet.LastObjktAt = &seen
+	if err := store.Update(wallet); err != nil {
+		t.Fatalf("Update: %v", err)
+	}
+	if got, err := store.FindByID(wallet.ID); err != nil || !got.ObjktsSince().Equal(seen) {
+		t.Fatalf("FindByID after Update: want watermark %s, got %v, %v", seen, got, err)
+	}
+	if all, err := store.FindAll(); err != nil || len(all) != 3 {
+		t.Fatalf("FindAll: want 3 wallets, got %v, %v", all, err)
+	}
+	if err := store.Delete(wallet); err != nil {
+		t.Fatalf("Delete: %v", err)
+	}
+	if _, err := store.FindByID(wallet.ID); err == nil || !errors.Is(err, orm.ErrNotFound) {
+		t.Fatalf("FindByID after Delete: want %s, got %v", orm.ErrNotFound, err)
+	}
+	if err := store.Create(&model.Wallet{ChatID: 1, Address: "tz1a"}); err != nil {
+		t.Fatalf("Create after Delete: %v", err)
+	}
+}
+
+func testListingWatches(t *testing.T, stores *orm.Stores) {
+	store := stores.ListingWatches
+
+	watch := &model.ListingWatch{ChatID: 1, Kind: model.ListingWatchKindToken, TargetID: "10", TargetName: "token"}
+	if err := store.Create(watch); err != nil {
+		t.Fatalf("Create: %v", err)
+	}
+	if watch.ID == 0 || watch.CreatedAt.IsZero() || watch.IsSet() {
+		t.Fatalf("Create must set ID and CreatedAt and no threshold, got %+v", watch)
+	}
+	if err := store.Create(&model.ListingWatch{ChatID: 1, Kind: model.ListingWatchKindToken, TargetID: "10"}); err == nil {
+		t.Fatal("Create must reject the same target twice in a chat")
+	}
+	for _, other := range []*model.ListingWatch{
+		{ChatID: 1, Kind: model.ListingWatchKindArtist, TargetID: "10"},
+		{ChatID: 2, Kind: model.ListingWatchKindToken, TargetID: "10"},
+	} {
+		if err := store.Create(other); err != nil {
+			t.Fatalf("Create: %v", err)
+		}
+	}
+
+	found, err := store.FindByChatID(1)
+	if err != nil || len(found) != 2 || found[0].Kind != model.ListingWatchKindToken {
+		t.Fatalf("FindByChatID: want 2 watches in id order, got %v, %v", found, err)
+	}
+	if got, err := store.FindByChatIDAndKindAndTargetID(1, model.ListingWatchKindArtist, "10"); err != nil || got.ChatID != 1 {
+		t.Fatalf("FindByChatIDAndKindAndTargetID: got %v, %v", got, err)
+	}
+	if _, err := store.FindByChatIDAndKindAndTargetID(2, model.ListingWatchKindArtist, "10"); err == nil || !errors.Is(err, orm.ErrNotFound) {
+		t.Fatalf("FindByChatIDAndKindAndTargetID of another chat: want %s, got %v", orm.ErrNotFound, err)
+	}
+	if found, err := store.FindByChatID(3); err != nil || len(found) != 0 {
+		t.Fatalf("FindByChatID of a chat without watches: want none, got %v, %v", found, err)
+	}
+	maxPrice := int64(5000000)
+	watch.MaxPrice = &maxPrice
+	watch.BelowFloor = 20
+	if err := store.Update(watch); err != nil {
+		t.Fatalf("Update: %v", err)
+	}
+	got, err := store.FindByID(watch.ID)
+	if err != nil || got.MaxPrice == nil || *got.MaxPrice != maxPrice || got.BelowFloor != 20 {
+		t.Fatalf("FindByID after Update: want thresholds, got %v, %v", got, err)
+	}
+	if !got.Matches(maxPrice, 0) || !got.Matches(8000000, 10000000) || got.Matches(9000000, 10000000) {
+		t.Fatalf("Matches: unexpected result for %+v", got)
+	}
+	if all, err := store.FindAll(); err != nil || len(all) != 3 {
+		t.Fatalf("FindAll: want 3 watches, got %v, %v", all, err)
+	}
+	if err := store.Delete(watch); err != nil {
+		t.Fatalf("Delete: %v", err)
+	}
+	if _, err := store.FindByID(watch.ID); err == nil || !errors.Is(err, orm.ErrNotFound) {
+		t.Fatalf("FindByID after Delete: want %s, got %v", orm.ErrNotFound, err)
+	}
+	if found, err := store.FindByChatID(1); err != nil || len(found) != 1 || found[0].Kind != model.ListingWatchKindArtist {
+		t.Fatalf("FindByChatID after Delete: want the artist watch, got %v, %v", found, err)
+	}
+}
@@ -0,0 +1,93 @@
+package ormtest
+
+import (
+	"database/sql"
+	"os"
+	"strings"
+	"testing"
+
+	migrate "github.com/golang-migrate/migrate/v4"
+	pgmigrate "github.com/golang-migrate/migrate/v4/database/postgres"
+	"github.com/golang-migrate/migrate/v4/source/iofs"
+	"github.com/kranikitao/fxhash-telegram-bot/src/migrations"
+	"github.com/kranikitao/fxhash-telegram-bot/src/orm"
+	"gorm.io/driver/postgres"
+	"gorm.io/gorm"
+
+	_ "github.com/lib/pq"
+)
+
+// PostgresDSNEnv names the variable with the connection string of a
+// disposable database, Postgres tests are skipped when it is empty.
+const PostgresDSNEnv = "FXBOT_TEST_DB_DSN"
+
+// NewPostgresStores migrates the test database, truncates every table and
+// returns stores over it.
+func NewPostgresStores(t *testing.T) *orm.Stores {
+	t.Helper()
+
+	dsn := os.Getenv(PostgresDSNEnv)
+	if dsn == "" {
+		t.Skipf("%s is not set", PostgresDSNEnv)
+	}
+
+	db, err := sql.Open("postgres", dsn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+
+	driver, err := pgmigrate.WithInstance(db, &pgmigrate.Config{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	source, err := iofs.New(migrations.FS, ".")
+	if err != nil {
+		t.Fatal(err)
+	}
+	m, err := migrate.NewWithInstance("iofs", source, "postgres", driver)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := m.Up(); err != nil && err != migrate.ErrNoChange {
+		t.Fatal(err)
+	}
+
+	truncateTables(t, db)
+
+	gormDB, err := gorm.Open(postgres.New(postgres.Config{Conn: db}), &gorm.Config{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return orm.NewStores(gormDB)
+}
+
+// truncateTables empties every migrated table, so tables added by later
+// migrations are covered too
+func truncateTables(t *testing.T, db *sql.DB) {
+	t.Helper()
+
+	rows, err := db.Query("SELECT tablename FROM pg_tables WHERE schemaname = current_schema() AND tablename <> 'schema_migrations'")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rows.Close()
+	var tables []string
+	for rows.Next() {
+		var table string
+		if err := rows.Scan(&table); err != nil {
+			t.Fatal(err)
+		}
+		tables = append(tables, `"`+table+`"`)
+	}
+	if err := rows.Err(); err != nil {
+		t.Fatal(err)
+	}
+	if len(tables) == 0 {
+		return
+	}
+	if _, err := db.Exec("TRUNCATE " + strings.Join(tables, ", ") + " RESTART IDENTITY"); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,40 @@
+package orm
+
+import (
+	"time"
+
+	"github.com/kranikitao/fxhash-telegram-bot/src/errors"
+	"github.com/kranikitao/fxhash-telegram-bot/src/orm/model"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+type settingStore struct {
+	gorm *gorm.DB
+}
+
+func GetSettingStore(gorm *gorm.DB) SettingStore {
+	return &settingStore{
+		gorm: gorm,
+	}
+}
+
+func (s *settingStore) Get(key string) (string, *errors.Error) {
+	m := &model.Setting{}
+	result := s.gorm.Where("key = ?", key).First(&m)
+	if _, err := wrapSingleResult(m, result.Error); err != nil {
+		return "", err.With("key", key)
+	}
+
+	return m.Value, nil
+}
+
+func (s *settingStore) Set(key string, value string) *errors.Error {
+	m := &model.Setting{Key: key, Value: value, UpdatedAt: time.Now()}
+	result := s.gorm.Clauses(clause.OnConflict{UpdateAll: true}).Create(&m)
+	if result.Error != nil {
+		return errors.Wrap(result.Error, "can't save setting").With("key", key)
+	}
+
+	return nil
+}
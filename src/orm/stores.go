@@ -0,0 +1,156 @@
+package orm
+
+import (
+	"time"
+
+	"github.com/kranikitao/fxhash-telegram-bot/src/errors"
+	"github.com/kranikitao/fxhash-telegram-bot/src/orm/model"
+	"gorm.io/gorm"
+)
+
+// Single result finders return an error of kind ErrNotFound when nothing
+// matches, list finders return an empty list instead.
+
+type SubscriberStore interface {
+	Create(m *model.Subscriber) *errors.Error
+	Update(m *model.Subscriber) *errors.Error
+	FindByChatID(chatID int64) (*model.Subscriber, *errors.Error)
+	FindByUsername(username string) (*model.Subscriber, *errors.Error)
+	FindByChatIDs(chatIDs []int64) ([]*model.Subscriber, *errors.Error)
+	// Search pages through subscribers ordered by id, an empty query matches
+	// everyone, otherwise it matches a part of the username or the whole chat id
+	Search(query string, limit int, offset int) ([]*model.Subscriber, *errors.Error)
+	FindSubscribed() ([]*model.Subscriber, *errors.Error)
+	FindAll() ([]*model.Subscriber, *errors.Error)
+	// FindFreeMuteEnded returns subscribers whose zero cost generatives were
+	// muted until now or earlier
+	FindFreeMuteEnded(now time.Time) ([]*model.Subscriber, *errors.Error)
+	// ResumeFreeMuted clears FreeMutedUntil only while it is still the value
+	// of m, it reports whether the row changed
+	ResumeFreeMuted(m *model.Subscriber) (bool, *errors.Error)
+	// FindLinkedArtists returns subscribers linked to their fxhash account
+	FindLinkedArtists() ([]*model.Subscriber, *errors.Error)
+	CountSubscribed() (int64, *errors.Error)
+	CountAll() (int64, *errors.Error)
+}
+
+type ArtistSubscriptionStore interface {
+	Create(m *model.ArtistSubscribtion) *errors.Error
+	Update(m *model.ArtistSubscribtion) *errors.Error
+	FindByID(id uint64) (*model.ArtistSubscribtion, *errors.Error)
+	FindByChatIDAndKindAndFxHashArtistName(chatID int64, kind string, FxHashArtistName string) (*model.ArtistSubscribtion, *errors.Error)
+	FindByChatId(chatID int64) ([]*model.ArtistSubscribtion, *errors.Error)
+	FindActiveByChatId(chatID int64) ([]*model.ArtistSubscribtion, *errors.Error)
+	// SearchByChatID pages through subscriptions of the chat, active or not,
+	// ordered by artist name. An empty prefix matches every artist, otherwise
+	// it matches the start of the name in any case.
+	SearchByChatID(chatID int64, prefix string, limit int, offset int) ([]*model.ArtistSubscribtion, *errors.Error)
+	CountByChatID(chatID int64, prefix string) (int64, *errors.Error)
+	// FindMuteEnded returns subscriptions muted until now or earlier
+	FindMuteEnded(now time.Time) ([]*model.ArtistSubscribtion, *errors.Error)
+	// ResumeMuted clears MutedUntil only while it is still the value of m, it
+	// reports whether the row changed
+	ResumeMuted(m *model.ArtistSubscribtion) (bool, *errors.Error)
+	FindActiveByKindAndFxHashArtistIds(kind string, fxHashArtistIds []string) ([]*model.ArtistSubscribtion, *errors.Error)
+	FindActiveByKind(kind string) ([]*model.ArtistSubscribtion, *errors.Error)
+	// CountActive and CountActiveChats count artist subscriptions only,
+	// followed collectors and wallets are left out
+	CountActive() (int64, *errors.Error)
+	CountActiveChats() (int64, *errors.Error)
+	// FindTopArtists returns up to limit artists with the most active
+	// subscriptions, most followed first. Followed collectors are not counted.
+	FindTopArtists(limit int) ([]*ArtistFollowers, *errors.Error)
+}
+
+type ArtistFollowers struct {
+	FxHashArtistID   string
+	FxHashArtistName string
+	Followers        int64
+}
+
+type DeliveryItemStore interface {
+	Create(m *model.DeliveryItem) *errors.Error
+	// CreateBatch creates every item or none of them when one is rejected
+	CreateBatch(items []*model.DeliveryItem) *errors.Error
+	Update(m *model.DeliveryItem) *errors.Error
+	Delete(m *model.DeliveryItem) *errors.Error
+	// MarkSent marks items sent and saves them in a single transaction
+	MarkSent(items []*model.DeliveryItem) *errors.Error
+	FindByID(id uint64) (*model.DeliveryItem, *errors.Error)
+	FindByTypeAndChatIdAndDedupeKey(Type string, chatId int64, dedupeKey string) (*model.DeliveryItem, *errors.Error)
+	// FindByChatIdAndCollectorIdAndGenerativeSlug returns an item of the chat
+	// about the collector and the generative token
+	FindByChatIdAndCollectorIdAndGenerativeSlug(chatId int64, collectorId string, generativeSlug string) (*model.DeliveryItem, *errors.Error)
+	// ClaimNotSent and FindOldestNotSent skip items held until a later time
+	ClaimNotSent(owner string, limit int, claimTimeout time.Duration) ([]*model.DeliveryItem, *errors.Error)
+	FindOldestNotSent() (*model.DeliveryItem, *errors.Error)
+	CountSentSince(since time.Time) (int64, *errors.Error)
+	// FindPending pages through not sent items, oldest first
+	FindPending(limit int, offset int) ([]*model.DeliveryItem, *errors.Error)
+	// FindFailed pages through items the sender gave up on, they are marked
+	// sent and keep their LastError, latest first
+	FindFailed(limit int, offset int) ([]*model.DeliveryItem, *errors.Error)
+}
+
+type EventStore interface {
+	Push(chatId int64, eventCode string, eventData string) *errors.Error
+	// Find returns events matching the filter, latest first
+	Find(filter EventFilter) ([]*model.Event, *errors.Error)
+}
+
+// EventFilter zero values match every event
+type EventFilter struct {
+	ChatID    int64
+	EventCode string
+	Since     time.Time
+	Limit     int
+}
+
+type SettingStore interface {
+	Get(key string) (string, *errors.Error)
+	Set(key string, value string) *errors.Error
+}
+
+type WalletStore interface {
+	Create(m *model.Wallet) *errors.Error
+	Update(m *model.Wallet) *errors.Error
+	Delete(m *model.Wallet) *errors.Error
+	FindByID(id uint64) (*model.Wallet, *errors.Error)
+	FindAll() ([]*model.Wallet, *errors.Error)
+	FindByChatID(chatID int64) ([]*model.Wallet, *errors.Error)
+	FindByChatIDAndAddress(chatID int64, address string) (*model.Wallet, *errors.Error)
+}
+
+type ListingWatchStore interface {
+	Create(m *model.ListingWatch) *errors.Error
+	Update(m *model.ListingWatch) *errors.Error
+	Delete(m *model.ListingWatch) *errors.Error
+	FindByID(id uint64) (*model.ListingWatch, *errors.Error)
+	FindAll() ([]*model.ListingWatch, *errors.Error)
+	FindByChatID(chatID int64) ([]*model.ListingWatch, *errors.Error)
+	FindByChatIDAndKindAndTargetID(chatID int64, kind string, targetID string) (*model.ListingWatch, *errors.Error)
+}
+
+// Stores bundles every store the components depend on
+type Stores struct {
+	Subscribers         SubscriberStore
+	ArtistSubscriptions ArtistSubscriptionStore
+	DeliveryItems       DeliveryItemStore
+	Events              EventStore
+	Settings            SettingStore
+	Wallets             WalletStore
+	ListingWatches      ListingWatchStore
+}
+
+// NewStores returns stores backed by Postgres
+func NewStores(gorm *gorm.DB) *Stores {
+	return &Stores{
+		Subscribers:         GetSubscriberStore(gorm),
+		ArtistSubscriptions: GetArtistSubscriptionStore(gorm),
+		DeliveryItems:       GetDeliveryItemStore(gorm),
+		Events:              GetEventStore(gorm),
+		Settings:            GetSettingStore(gorm),
+		Wallets:             GetWalletStore(gorm),
+		ListingWatches:      GetListingWatchStore(gorm),
+	}
+}
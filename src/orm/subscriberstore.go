@@ -8,47 +8,124 @@ import (
 	"gorm.io/gorm"
 )
 
-type SubscriberStore struct {
+type subscriberStore struct {
 	gorm *gorm.DB
 }
 
-func GetSubscriberStore(gorm *gorm.DB) *SubscriberStore {
-	return &SubscriberStore{
+func GetSubscriberStore(gorm *gorm.DB) SubscriberStore {
+	return &subscriberStore{
 		gorm: gorm,
 	}
 }
 
-func (s *SubscriberStore) Create(m *model.Subscriber) *errors.Error {
+func (s *subscriberStore) Create(m *model.Subscriber) *errors.Error {
 	m.CreatedAt = time.Now()
 	m.UpdatedAt = time.Now()
 	result := s.gorm.Create(&m)
 	if result.Error != nil {
-		return errors.Wrap(result.Error, "")
+		return errors.Wrap(result.Error, "can't create subscriber")
 	}
 
 	return nil
 }
 
-func (s *SubscriberStore) Update(m *model.Subscriber) *errors.Error {
+func (s *subscriberStore) Update(m *model.Subscriber) *errors.Error {
 	m.UpdatedAt = time.Now()
 	result := s.gorm.Save(&m)
 	if result.Error != nil {
-		return errors.Wrap(result.Error, "")
+		return errors.Wrap(result.Error, "can't update subscriber")
 	}
 
 	return nil
 }
 
-func (s *SubscriberStore) FindByChatID(chatID int64) (*model.Subscriber, *errors.Error) {
+func (s *subscriberStore) FindByChatID(chatID int64) (*model.Subscriber, *errors.Error) {
 	m := &model.Subscriber{}
 	result := s.gorm.Where("chat_id = ?", chatID).First(&m)
 
 	return wrapSingleResult(m, result.Error)
 }
 
-func (s *SubscriberStore) FindSubscribed() ([]*model.Subscriber, *errors.Error) {
+func (s *subscriberStore) FindByUsername(username string) (*model.Subscriber, *errors.Error) {
+	m := &model.Subscriber{}
+	result := s.gorm.Where("username = ?", username).Order("id").First(&m)
+
+	return wrapSingleResult(m, result.Error)
+}
+
+func (s *subscriberStore) FindByChatIDs(chatIDs []int64) ([]*model.Subscriber, *errors.Error) {
+	var m []*model.Subscriber
+	result := s.gorm.Where("chat_id IN ?", chatIDs).Order("id").Find(&m)
+
+	return wrapListResult(m, result.Error)
+}
+
+func (s *subscriberStore) Search(query string, limit int, offset int) ([]*model.Subscriber, *errors.Error) {
+	var m []*model.Subscriber
+	db := s.gorm.Order("id").Limit(limit).Offset(offset)
+	if query != "" {
+		db = db.Where("username ILIKE ? OR CAST(chat_id AS text) = ?", "%"+query+"%", query)
+	}
+	result := db.Find(&m)
+
+	return wrapListResult(m, result.Error)
+}
+
+func (s *subscriberStore) FindSubscribed() ([]*model.Subscriber, *errors.Error) {
 	var m []*model.Subscriber
 	result := s.gorm.Where("subscribed = true").Find(&m)
 
 	return wrapListResult(m, result.Error)
 }
+
+func (s *subscriberStore) CountSubscribed() (int64, *errors.Error) {
+	var count int64
+	result := s.gorm.Model(&model.Subscriber{}).Where("subscribed = true").Count(&count)
+	if result.Error != nil {
+		return 0, errors.Wrap(result.Error, "can't count subscribers")
+	}
+
+	return count, nil
+}
+
+func (s *subscriberStore) FindAll() ([]*model.Subscriber, *errors.Error) {
+	var m []*model.Subscriber
+	result := s.gorm.Order("id").Find(&m)
+
+	return wrapListResult(m, result.Error)
+}
+
+func (s *subscriberStore) FindFreeMuteEnded(now time.Time) ([]*model.Subscriber, *errors.Error) {
+	var m []*model.Subscriber
+	result := s.gorm.Where("free_muted_until <= ?", now).Order("id").Find(&m)
+
+	return wrapListResult(m, result.Error)
+}
+
+func (s *subscriberStore) ResumeFreeMuted(m *model.Subscriber) (bool, *errors.Error) {
+	result := s.gorm.Model(&model.Subscriber{}).
+		Where("id = ? AND free_muted_until = ?", m.ID, m.FreeMutedUntil).
+		Updates(map[string]interface{}{"free_muted_until": nil, "updated_at": time.Now()})
+	if result.Error != nil {
+		return false, errors.Wrap(result.Error, "can't resume zero cost generatives").With("chatID", m.ChatID)
+	}
+
+	return result.RowsAffected > 0, nil
+}
+
+func (s *subscriberStore) FindLinkedArtists() ([]*model.Subscriber, *errors.Error) {
+	var m []*model.Subscriber
+	result := s.gorm.Where("artist_linked_at IS NOT NULL").Order("id").Find(&m)
+
+	return wrapListResult(m, result.Error)
+}
+
+func (s *subscriberStore) CountAll() (int64, *errors.Error) {
+	var count int64
+	result := s.gorm.Model(&model.Subscriber{}).Count(&count)
+	if result.Error != nil {
+		return 0, errors.Wrap(result.Error, "can't count subscribers")
+	}
+
+	return count, nil
+}
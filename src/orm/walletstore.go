@@ -0,0 +1,75 @@
+package orm
+
+import (
+	"time"
+
+	"github.com/kranikitao/fxhash-telegram-bot/src/errors"
+	"github.com/kranikitao/fxhash-telegram-bot/src/orm/model"
+	"gorm.io/gorm"
+)
+
+type walletStore struct {
+	gorm *gorm.DB
+}
+
+func GetWalletStore(gorm *gorm.DB) WalletStore {
+	return &walletStore{
+		gorm: gorm,
+	}
+}
+
+func (s *walletStore) Create(m *model.Wallet) *errors.Error {
+	m.CreatedAt = time.Now()
+	result := s.gorm.Create(&m)
+	if result.Error != nil {
+		return errors.Wrap(result.Error, "can't create wallet")
+	}
+
+	return nil
+}
+
+func (s *walletStore) Update(m *model.Wallet) *errors.Error {
+	result := s.gorm.Save(&m)
+	if result.Error != nil {
+		return errors.Wrap(result.Error, "can't update wallet")
+	}
+
+	return nil
+}
+
+func (s *walletStore) Delete(m *model.Wallet) *errors.Error {
+	result := s.gorm.Delete(&m)
+	if result.Error != nil {
+		return errors.Wrap(result.Error, "can't delete wallet")
+	}
+
+	return nil
+}
+
+func (s *walletStore) FindByID(id uint64) (*model.Wallet, *errors.Error) {
+	var m *model.Wallet
+	result := s.gorm.Where("id = ?", id).First(&m)
+
+	return wrapSingleResult(m, result.Error)
+}
+
+func (s *walletStore) FindAll() ([]*model.Wallet, *errors.Error) {
+	var m []*model.Wallet
+	result := s.gorm.Order("id").Find(&m)
+
+	return wrapListResult(m, result.Error)
+}
+
+func (s *walletStore) FindByChatID(chatID int64) ([]*model.Wallet, *errors.Error) {
+	var m []*model.Wallet
+	result := s.gorm.Where("chat_id = ?", chatID).Order("id").Find(&m)
+
+	return wrapListResult(m, result.Error)
+}
+
+func (s *walletStore) FindByChatIDAndAddress(chatID int64, address string) (*model.Wallet, *errors.Error) {
+	var m *model.Wallet
+	result := s.gorm.Where("chat_id = ? AND address = ?", chatID, address).First(&m)
+
+	return wrapSingleResult(m, result.Error)
+}
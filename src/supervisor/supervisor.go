@@ -0,0 +1,97 @@
+package supervisor
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/kranikitao/fxhash-telegram-bot/src/errors"
+	"github.com/kranikitao/fxhash-telegram-bot/src/metrics"
+	"go.uber.org/zap"
+)
+
+var ErrPanic = errors.NewKind("panic")
+
+// Supervisor keeps background components running: a component which panics
+// or returns before its context is done is restarted with exponential backoff.
+type Supervisor struct {
+	logger     *zap.Logger
+	metrics    *metrics.Metrics
+	minBackoff time.Duration
+	maxBackoff time.Duration
+
+	mu       sync.Mutex
+	restarts map[string]int
+}
+
+func New(logger *zap.Logger, metrics *metrics.Metrics, minBackoff time.Duration, maxBackoff time.Duration) *Supervisor {
+	return &Supervisor{
+		logger:     logger,
+		metrics:    metrics,
+		minBackoff: minBackoff,
+		maxBackoff: maxBackoff,
+		restarts:   map[string]int{},
+	}
+}
+
+// Run runs the component until ctx is done
+func (s *Supervisor) Run(ctx context.Context, name string, run func(ctx context.Context)) {
+	backoff := s.minBackoff
+	for {
+		startedAt := time.Now()
+		s.runOnce(ctx, name, run)
+		if ctx.Err() != nil {
+			return
+		}
+
+		// a component which worked long enough is considered recovered
+		if time.Since(startedAt) > s.maxBackoff {
+			backoff = s.minBackoff
+		}
+		s.logger.Warn("component stopped, restarting",
+			zap.String("component", name),
+			zap.Duration("backoff", backoff),
+		)
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(backoff):
+		}
+
+		s.mu.Lock()
+		s.restarts[name]++
+		s.mu.Unlock()
+		s.metrics.ComponentRestarts.WithLabelValues(name).Inc()
+
+		backoff *= 2
+		if backoff > s.maxBackoff {
+			backoff = s.maxBackoff
+		}
+	}
+}
+
+func (s *Supervisor) runOnce(ctx context.Context, name string, run func(ctx context.Context)) {
+	defer Recover(s.logger, name)
+	run(ctx)
+}
+
+// Restarts returns how many times the component was restarted
+func (s *Supervisor) Restarts(name string) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.restarts[name]
+}
+
+// Recover logs a panic with its stack trace and stops it. It must be
+// deferred directly: defer supervisor.Recover(logger, "component")
+func Recover(logger *zap.Logger, name string) {
+	if recovered := recover(); recovered != nil {
+		err := errors.New(fmt.Sprintf("panic: %v", recovered), ErrPanic).With("component", name)
+		logger.Error("component panicked",
+			zap.Error(err),
+			errors.ErrorTraceLogField(err),
+		)
+	}
+}
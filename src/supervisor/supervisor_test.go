@@ -0,0 +1,124 @@
+package supervisor_test
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+	"go.uber.org/zap/zaptest/observer"
+
+	"github.com/kranikitao/fxhash-telegram-bot/src/metrics"
+	"github.com/kranikitao/fxhash-telegram-bot/src/supervisor"
+)
+
+const (
+	minBackoff = 20 * time.Millisecond
+	maxBackoff = 50 * time.Millisecond
+	timeout    = 2 * time.Second
+)
+
+func newSupervisor(minBackoff time.Duration, maxBackoff time.Duration) (*supervisor.Supervisor, *observer.ObservedLogs) {
+	core, logs := observer.New(zapcore.DebugLevel)
+
+	return supervisor.New(zap.New(core), metrics.New(prometheus.NewRegistry()), minBackoff, maxBackoff), logs
+}
+
+// run runs the supervisor in the background and returns a channel closed
+// when Run returns
+func run(ctx context.Context, s *supervisor.Supervisor, component func(ctx context.Context)) chan struct{} {
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		s.Run(ctx, "collector", component)
+	}()
+
+	return done
+}
+
+func wait(t *testing.T, done chan struct{}) {
+	t.Helper()
+	select {
+	case <-done:
+	case <-time.After(timeout):
+		t.Fatal("timed out waiting until Run returns")
+	}
+}
+
+func TestRestarts(t *testing.T) {
+	s, logs := newSupervisor(minBackoff, maxBackoff)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	var starts []time.Time
+	done := run(ctx, s, func(ctx context.Context) {
+		starts = append(starts, time.Now())
+		switch len(starts) {
+		case 1:
+			panic("nil map")
+		case 2, 3, 4:
+			// the component gave up on an error and returned
+			return
+		default:
+			// the component runs until it is stopped
+			cancel()
+			<-ctx.Done()
+		}
+	})
+	wait(t, done)
+
+	if len(starts) != 5 || s.Restarts("collector") != 4 {
+		t.Fatalf("want 5 runs and 4 restarts, got %d runs and %d restarts", len(starts), s.Restarts("collector"))
+	}
+	// the backoff doubles up to the max
+	for i, want := range []time.Duration{minBackoff, 2 * minBackoff, maxBackoff, maxBackoff} {
+		waited := starts[i+1].Sub(starts[i])
+		if waited < want || waited > want+timeout/2 {
+			t.Fatalf("restart %d: want a backoff of %s, waited %s", i+1, want, waited)
+		}
+	}
+	if waited := starts[4].Sub(starts[3]); waited >= 2*maxBackoff {
+		t.Fatalf("the backoff must stop at %s, waited %s", maxBackoff, waited)
+	}
+
+	panics := logs.FilterMessage("component panicked").All()
+	if len(panics) != 1 {
+		t.Fatalf("want the panic logged once, got %d entries", len(panics))
+	}
+	if fields := panics[0].ContextMap(); fields["error_kind"] != "panic" || fields["component"] != "collector" || fields["error"] != "panic: nil map" {
+		t.Fatalf("the panic must be logged with its kind and component, got %v", fields)
+	}
+	if stopped := logs.FilterMessage("component stopped, restarting").Len(); stopped != 4 {
+		t.Fatalf("want every restart logged, got %d entries", stopped)
+	}
+}
+
+func TestCanceledContextStopsRestarts(t *testing.T) {
+	s, _ := newSupervisor(time.Hour, time.Hour)
+	ctx, cancel := context.WithCancel(context.Background())
+
+	runs := make(chan struct{}, 10)
+	done := run(ctx, s, func(ctx context.Context) {
+		runs <- struct{}{}
+	})
+	<-runs
+	// the supervisor waits for the backoff, canceling stops it
+	cancel()
+	wait(t, done)
+	if len(runs) != 0 || s.Restarts("collector") != 0 {
+		t.Fatalf("a canceled supervisor must not restart, got %d runs and %d restarts", len(runs)+1, s.Restarts("collector"))
+	}
+
+	// a component started with a canceled context runs once
+	done = run(ctx, s, func(ctx context.Context) {
+		runs <- struct{}{}
+		panic(fmt.Sprintf("run %d", len(runs)))
+	})
+	wait(t, done)
+	if len(runs) != 1 || s.Restarts("collector") != 0 {
+		t.Fatalf("a canceled context: want one run and no restarts, got %d runs and %d restarts", len(runs), s.Restarts("collector"))
+	}
+}
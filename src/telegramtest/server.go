@@ -0,0 +1,384 @@
+// Package telegramtest provides a local stand-in for the Telegram Bot API.
+// It queues scripted updates for getUpdates, records every other call and
+// can answer with Telegram errors such as 403 or 429.
+package telegramtest
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+const (
+	Token       = "123456:test-token"
+	BotID       = 123456
+	BotUserName = "fxhash_test_bot"
+)
+
+// Call is a recorded request to the Bot API
+type Call struct {
+	Method string
+	Params url.Values
+	// MessageID is the id of the message created by sendMessage
+	MessageID int
+}
+
+// ChatID returns the chat_id parameter of the call
+func (c Call) ChatID() int64 {
+	chatID, _ := strconv.ParseInt(c.Params.Get("chat_id"), 10, 64)
+
+	return chatID
+}
+
+// Text returns the text parameter of the call
+func (c Call) Text() string {
+	return c.Params.Get("text")
+}
+
+// InlineKeyboard returns the inline keyboard sent with the call, if any
+func (c Call) InlineKeyboard() *tgbotapi.InlineKeyboardMarkup {
+	markup := c.Params.Get("reply_markup")
+	if markup == "" {
+		return nil
+	}
+	keyboard := &tgbotapi.InlineKeyboardMarkup{}
+	if err := json.Unmarshal([]byte(markup), keyboard); err != nil || keyboard.InlineKeyboard == nil {
+		return nil
+	}
+
+	return keyboard
+}
+
+type failure struct {
+	code        int
+	description string
+	retryAfter  int
+}
+
+type Server struct {
+	server *httptest.Server
+
+	mu            sync.Mutex
+	updates       []tgbotapi.Update
+	offset        int
+	nextUpdateID  int
+	nextMessageID int
+	calls         []Call
+	failures      map[string][]failure
+	changed       chan struct{}
+	closed        chan struct{}
+}
+
+func NewServer() *Server {
+	s := &Server{
+		nextUpdateID:  1,
+		nextMessageID: 1,
+		failures:      map[string][]failure{},
+		changed:       make(chan struct{}),
+		closed:        make(chan struct{}),
+	}
+	s.server = httptest.NewServer(http.HandlerFunc(s.handle))
+
+	return s
+}
+
+// Endpoint is the value for tgbotapi.NewBotAPIWithAPIEndpoint
+func (s *Server) Endpoint() string {
+	return s.server.URL + "/bot%s/%s"
+}
+
+// NewBot returns a client talking to this server
+func (s *Server) NewBot() (*tgbotapi.BotAPI, error) {
+	return tgbotapi.NewBotAPIWithAPIEndpoint(Token, s.Endpoint())
+}
+
+func (s *Server) Close() {
+	s.mu.Lock()
+	close(s.closed)
+	s.mu.Unlock()
+	s.server.Close()
+}
+
+// PushUpdate queues an update for getUpdates and returns its id
+func (s *Server) PushUpdate(update tgbotapi.Update) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	update.UpdateID = s.nextUpdateID
+	s.nextUpdateID++
+	s.updates = append(s.updates, update)
+	s.notify()
+
+	return update.UpdateID
+}
+
+// PushMessage queues a private message from the user with the given chat id.
+// Texts starting with a slash are sent as bot commands.
+func (s *Server) PushMessage(chatID int64, userName string, text string) int {
+	message := &tgbotapi.Message{
+		MessageID: s.newMessageID(),
+		From:      user(chatID, userName),
+		Chat:      &tgbotapi.Chat{ID: chatID, Type: "private", UserName: userName},
+		Date:      int(time.Now().Unix()),
+		Text:      text,
+	}
+	if strings.HasPrefix(text, "/") {
+		command := strings.SplitN(text, " ", 2)[0]
+		message.Entities = []tgbotapi.MessageEntity{{Type: "bot_command", Offset: 0, Length: len(command)}}
+	}
+
+	return s.PushUpdate(tgbotapi.Update{Message: message})
+}
+
+// PushCallback queues a press on an inline button of the bot message
+func (s *Server) PushCallback(chatID int64, userName string, messageID int, data string) int {
+	return s.PushUpdate(tgbotapi.Update{CallbackQuery: &tgbotapi.CallbackQuery{
+		ID:   strconv.Itoa(s.newMessageID()),
+		From: user(chatID, userName),
+		Message: &tgbotapi.Message{
+			MessageID: messageID,
+			From:      &tgbotapi.User{ID: BotID, IsBot: true, UserName: BotUserName},
+			Chat:      &tgbotapi.Chat{ID: chatID, Type: "private", UserName: userName},
+			Date:      int(time.Now().Unix()),
+			Text:      s.sentText(messageID),
+		},
+		Data: data,
+	}})
+}
+
+// sentText returns the text of a message sent by the bot, like Telegram puts
+// it into callback queries
+func (s *Server) sentText(messageID int) string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, call := range s.calls {
+		if call.MessageID == messageID {
+			return call.Text()
+		}
+	}
+
+	return ""
+}
+
+// FailNext makes the next call of method fail with the given error code
+func (s *Server) FailNext(method string, code int, description string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.failures[method] = append(s.failures[method], failure{code: code, description: description})
+}
+
+// RateLimitNext makes the next call of method fail with 429 Too Many Requests
+func (s *Server) RateLimitNext(method string, retryAfter int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.failures[method] = append(s.failures[method], failure{
+		code:        http.StatusTooManyRequests,
+		description: fmt.Sprintf("Too Many Requests: retry after %d", retryAfter),
+		retryAfter:  retryAfter,
+	})
+}
+
+// Calls returns recorded calls of method, or all calls if method is empty.
+// getMe and getUpdates are not recorded.
+func (s *Server) Calls(method string) []Call {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var calls []Call
+	for _, call := range s.calls {
+		if method == "" || call.Method == method {
+			calls = append(calls, call)
+		}
+	}
+
+	return calls
+}
+
+// Messages returns sendMessage calls to the chat, failed ones included
+func (s *Server) Messages(chatID int64) []Call {
+	var messages []Call
+	for _, call := range s.Calls("sendMessage") {
+		if call.ChatID() == chatID {
+			messages = append(messages, call)
+		}
+	}
+
+	return messages
+}
+
+// Processed reports whether the bot confirmed the update by asking for the next ones
+func (s *Server) Processed(updateID int) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.offset > updateID
+}
+
+// WaitProcessed waits until the bot confirms the update
+func (s *Server) WaitProcessed(updateID int, timeout time.Duration) bool {
+	return s.wait(timeout, func() bool { return s.offset > updateID })
+}
+
+// WaitCalls waits until at least n calls of method are recorded
+func (s *Server) WaitCalls(method string, n int, timeout time.Duration) bool {
+	return s.wait(timeout, func() bool {
+		count := 0
+		for _, call := range s.calls {
+			if call.Method == method {
+				count++
+			}
+		}
+		return count >= n
+	})
+}
+
+func (s *Server) wait(timeout time.Duration, done func() bool) bool {
+	deadline := time.After(timeout)
+	for {
+		s.mu.Lock()
+		ok := done()
+		changed := s.changed
+		s.mu.Unlock()
+		if ok {
+			return true
+		}
+		select {
+		case <-changed:
+		case <-deadline:
+			return false
+		}
+	}
+}
+
+// notify wakes up waiters, it must be called under lock
+func (s *Server) notify() {
+	close(s.changed)
+	s.changed = make(chan struct{})
+}
+
+func (s *Server) newMessageID() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.nextMessageID++
+
+	return s.nextMessageID
+}
+
+func (s *Server) handle(w http.ResponseWriter, r *http.Request) {
+	parts := strings.Split(strings.TrimPrefix(r.URL.Path, "/"), "/")
+	if len(parts) != 2 || parts[0] != "bot"+Token {
+		writeResponse(w, nil, &failure{code: http.StatusUnauthorized, description: "Unauthorized"})
+		return
+	}
+	method := parts[1]
+	if err := r.ParseForm(); err != nil {
+		writeResponse(w, nil, &failure{code: http.StatusBadRequest, description: err.Error()})
+		return
+	}
+
+	if method == "getUpdates" {
+		s.getUpdates(w, r.PostForm)
+		return
+	}
+
+	s.mu.Lock()
+	var fail *failure
+	if failures := s.failures[method]; len(failures) > 0 {
+		fail = &failures[0]
+		s.failures[method] = failures[1:]
+	}
+	call := Call{Method: method, Params: r.PostForm}
+	if method == "sendMessage" && fail == nil {
+		s.nextMessageID++
+		call.MessageID = s.nextMessageID
+	}
+	if method != "getMe" {
+		s.calls = append(s.calls, call)
+		s.notify()
+	}
+	s.mu.Unlock()
+
+	if fail != nil {
+		writeResponse(w, nil, fail)
+		return
+	}
+
+	switch method {
+	case "getMe":
+		writeResponse(w, &tgbotapi.User{ID: BotID, IsBot: true, UserName: BotUserName, FirstName: "fxhash"}, nil)
+	case "sendMessage":
+		writeResponse(w, &tgbotapi.Message{
+			MessageID: call.MessageID,
+			From:      &tgbotapi.User{ID: BotID, IsBot: true, UserName: BotUserName},
+			Chat:      &tgbotapi.Chat{ID: call.ChatID(), Type: "private"},
+			Date:      int(time.Now().Unix()),
+			Text:      call.Text(),
+		}, nil)
+	default:
+		writeResponse(w, true, nil)
+	}
+}
+
+// getUpdates long polls like Telegram does: it answers as soon as there are
+// updates after offset, or with an empty list after the timeout.
+func (s *Server) getUpdates(w http.ResponseWriter, params url.Values) {
+	offset, _ := strconv.Atoi(params.Get("offset"))
+	timeout, _ := strconv.Atoi(params.Get("timeout"))
+	deadline := time.After(time.Duration(timeout) * time.Second)
+
+	for {
+		s.mu.Lock()
+		if offset > s.offset {
+			s.offset = offset
+			s.notify()
+		}
+		updates := []tgbotapi.Update{}
+		for _, update := range s.updates {
+			if update.UpdateID >= offset {
+				updates = append(updates, update)
+			}
+		}
+		changed := s.changed
+		s.mu.Unlock()
+
+		if len(updates) > 0 {
+			writeResponse(w, updates, nil)
+			return
+		}
+		select {
+		case <-changed:
+		case <-deadline:
+			writeResponse(w, updates, nil)
+			return
+		case <-s.closed:
+			writeResponse(w, updates, nil)
+			return
+		}
+	}
+}
+
+func writeResponse(w http.ResponseWriter, result interface{}, fail *failure) {
+	w.Header().Set("Content-Type", "application/json")
+	response := map[string]interface{}{"ok": fail == nil}
+	if fail != nil {
+		w.WriteHeader(fail.code)
+		response["error_code"] = fail.code
+		response["description"] = fail.description
+		if fail.retryAfter > 0 {
+			response["parameters"] = map[string]int{"retry_after": fail.retryAfter}
+		}
+	} else {
+		response["result"] = result
+	}
+	json.NewEncoder(w).Encode(response)
+}
+
+func user(chatID int64, userName string) *tgbotapi.User {
+	return &tgbotapi.User{ID: chatID, UserName: userName, FirstName: userName, LanguageCode: "en"}
+}
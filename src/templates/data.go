@@ -0,0 +1,173 @@
+package templates
+
+import (
+	"strconv"
+	"time"
+
+	"github.com/kranikitao/fxhash-telegram-bot/src/i18n"
+	"github.com/kranikitao/fxhash-telegram-bot/src/orm/model"
+)
+
+// TimeLayout renders times in messages, in the timezone of the recipient.
+// It has no month names to read the same in every language.
+const TimeLayout = "2006-01-02 15:04 MST"
+
+// Data is passed to every template
+type Data struct {
+	Subscriber Subscriber
+	// Token is set for every kind but welcome and digest
+	Token Token
+	// Tokens and DigestMode are set for digest only
+	Tokens     []Token
+	DigestMode string
+}
+
+type Subscriber struct {
+	ChatID   int64
+	Username string
+	Language string
+	Timezone string
+	Location *time.Location
+}
+
+type Token struct {
+	ID          int64
+	Name        string
+	Slug        string
+	URL         string
+	MintOpensAt *time.Time
+	Artist      Artist
+	// Price is nil when it is unknown
+	Price *Price
+	// Collection is set when a followed collector minted or bought the token
+	Collection *Collection
+}
+
+type Artist struct {
+	Name string
+}
+
+type Collection struct {
+	Collector string
+	// Action is model.CollectorActionMinted or model.CollectorActionBought
+	Action string
+}
+
+type Price struct {
+	Mutez int64
+}
+
+// NewSubscriber returns the recipient of a message, a chat without a
+// subscriber gets UTC and the default language when subscriber is nil
+func NewSubscriber(chatID int64, subscriber *model.Subscriber, location *time.Location) Subscriber {
+	if subscriber == nil {
+		return Subscriber{ChatID: chatID, Language: i18n.DefaultLanguage, Location: time.UTC}
+	}
+
+	return Subscriber{
+		ChatID:   chatID,
+		Username: subscriber.Username,
+		Language: subscriber.Language,
+		Timezone: subscriber.Timezone,
+		Location: location,
+	}
+}
+
+// NewToken returns the token of a delivery item
+func NewToken(item *model.DeliveryItem) Token {
+	token := Token{
+		ID:          item.GenerativeId,
+		Name:        item.Name,
+		Slug:        item.GenerativeSlug,
+		URL:         item.Url,
+		MintOpensAt: item.MintOpensAt,
+		Artist:      Artist{Name: item.Author},
+	}
+	if item.Price != nil {
+		token.Price = &Price{Mutez: *item.Price}
+	}
+	if item.Type == model.DeliveryItemTypeByCollector {
+		token.Collection = &Collection{Collector: item.Collector, Action: item.Action}
+	}
+
+	return token
+}
+
+// Title is the name of the token, its slug when the name is unknown
+func (t Token) Title() string {
+	if t.Name == "" {
+		return t.Slug
+	}
+
+	return t.Name
+}
+
+func (p Price) Free() bool {
+	return p.Mutez == 0
+}
+
+// Tez renders the price in tez without the unit
+func (p Price) Tez() string {
+	return strconv.FormatFloat(float64(p.Mutez)/1e6, 'f', -1, 64)
+}
+
+// T translates the i18n key to the language of the subscriber
+func (d *Data) T(key string, args ...interface{}) string {
+	return i18n.T(d.Subscriber.Language, key, args...)
+}
+
+// N translates the plural form of the i18n key for count
+func (d *Data) N(key string, count int, args ...interface{}) string {
+	return i18n.N(d.Subscriber.Language, key, count, args...)
+}
+
+// Time renders t in the timezone of the subscriber
+func (d *Data) Time(t time.Time) string {
+	location := d.Subscriber.Location
+	if location == nil {
+		location = time.UTC
+	}
+
+	return t.In(location).Format(TimeLayout)
+}
+
+// Sample returns data of the kind rendered by previews and by validation
+func Sample(kind Kind, subscriber Subscriber) *Data {
+	mintOpensAt := time.Date(2022, time.March, 14, 18, 0, 0, 0, time.UTC)
+	price := func(mutez int64) *Price { return &Price{Mutez: mutez} }
+	tokens := []Token{
+		{
+			ID:          1,
+			Name:        "Ondulations",
+			Slug:        "ondulations",
+			URL:         "https://www.fxhash.xyz/generative/slug/ondulations",
+			MintOpensAt: &mintOpensAt,
+			Artist:      Artist{Name: "kranikitao"},
+			Price:       price(5_500_000),
+		},
+		{
+			ID:     2,
+			Name:   "Free <lines> & *dots*",
+			Slug:   "free-lines-dots",
+			URL:    "https://www.fxhash.xyz/generative/slug/free-lines-dots",
+			Artist: Artist{Name: "zancan_"},
+			Price:  price(0),
+		},
+	}
+	data := &Data{Subscriber: subscriber}
+	switch kind {
+	case KindWelcome:
+	case KindDigest:
+		data.Tokens = tokens
+		data.DigestMode = model.DigestModeDaily
+	case KindFreeToken:
+		data.Token = tokens[1]
+	case KindCollected:
+		data.Token = tokens[0]
+		data.Token.Collection = &Collection{Collector: "zancan_fan", Action: model.CollectorActionBought}
+	default:
+		data.Token = tokens[0]
+	}
+
+	return data
+}
@@ -0,0 +1,240 @@
+// Package templates renders messages of the bot with text/template. Every
+// kind of message has a built-in template, a file <kind>.tmpl in the
+// templates directory replaces it and the setting "template.<kind>" in the
+// database replaces both. Templates get Data, translate with .T and .N and
+// render times in the timezone of the recipient with .Time.
+//
+// Messages are plain text unless the template starts with a comment naming
+// the Telegram parse mode, values must then be escaped with html or markdown:
+//
+//	{{/* parse_mode: HTML */}}
+//	<b>{{html .Token.Title}}</b>
+package templates
+
+import (
+	"bytes"
+	"embed"
+	"fmt"
+	"html"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"text/template"
+	"time"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+	"github.com/kranikitao/fxhash-telegram-bot/src/errors"
+	"github.com/kranikitao/fxhash-telegram-bot/src/i18n"
+	"github.com/kranikitao/fxhash-telegram-bot/src/orm"
+	"github.com/kranikitao/fxhash-telegram-bot/src/orm/model"
+)
+
+type Kind string
+
+const (
+	KindWelcome   Kind = "welcome"
+	KindNewToken  Kind = "new_token"
+	KindFreeToken Kind = "free_token"
+	KindDigest    Kind = "digest"
+	KindCollected Kind = "collected"
+)
+
+var kinds = []Kind{KindWelcome, KindNewToken, KindFreeToken, KindDigest, KindCollected}
+
+// sources of a template
+const (
+	SourceBuiltIn  = "built-in"
+	SourceDatabase = "database"
+)
+
+var ErrInvalid = errors.NewKind("invalid_template")
+
+//go:embed defaults/*.tmpl
+var defaults embed.FS
+
+var parseModePattern = regexp.MustCompile(`^\s*\{\{-?\s*/\*\s*parse_mode:\s*(\w+)\s*\*/\s*-?\}\}`)
+
+var funcs = template.FuncMap{
+	"html":     EscapeHTML,
+	"markdown": EscapeMarkdown,
+	"inc":      func(i int) int { return i + 1 },
+}
+
+// Template is a parsed template of a kind
+type Template struct {
+	kind      Kind
+	source    string
+	parseMode string
+	template  *template.Template
+}
+
+// Message is a rendered template
+type Message struct {
+	Text      string
+	ParseMode string
+}
+
+// Set holds the template of every kind
+type Set struct {
+	templates map[Kind]*Template
+}
+
+// Kinds returns every kind of message
+func Kinds() []Kind {
+	return append([]Kind(nil), kinds...)
+}
+
+// ParseKind returns the kind named name
+func ParseKind(name string) (Kind, bool) {
+	for _, kind := range kinds {
+		if string(kind) == name {
+			return kind, true
+		}
+	}
+
+	return "", false
+}
+
+// Parse parses and validates the text of a template, source tells where it
+// comes from
+func Parse(kind Kind, source string, text string) (*Template, *errors.Error) {
+	parseMode := ""
+	if match := parseModePattern.FindStringSubmatch(text); match != nil {
+		parseMode = match[1]
+		if parseMode != tgbotapi.ModeHTML && parseMode != tgbotapi.ModeMarkdownV2 {
+			return nil, errors.New(fmt.Sprintf("%s (%s): unknown parse mode %q, use %s or %s", kind, source, parseMode, tgbotapi.ModeHTML, tgbotapi.ModeMarkdownV2), ErrInvalid)
+		}
+	}
+	parsed, err := template.New(string(kind)).Funcs(funcs).Parse(text)
+	if err != nil {
+		return nil, errors.Wrap(err, fmt.Sprintf("%s (%s): can't parse template", kind, source)).WithKind(ErrInvalid)
+	}
+	t := &Template{kind: kind, source: source, parseMode: parseMode, template: parsed}
+	if err := t.validate(); err != nil {
+		return nil, err
+	}
+
+	return t, nil
+}
+
+// validate renders the sample of the kind in every language
+func (t *Template) validate() *errors.Error {
+	for _, language := range i18n.Languages() {
+		subscriber := Subscriber{ChatID: 1, Username: "sample", Language: language, Location: time.UTC}
+		message, err := t.Render(Sample(t.kind, subscriber))
+		if err != nil {
+			return err
+		}
+		if message.Text == "" {
+			return errors.New(fmt.Sprintf("%s (%s): the message is empty", t.kind, t.source), ErrInvalid)
+		}
+	}
+
+	return nil
+}
+
+func (t *Template) Kind() Kind {
+	return t.kind
+}
+
+// Source is SourceBuiltIn, SourceDatabase or the path of the file
+func (t *Template) Source() string {
+	return t.source
+}
+
+func (t *Template) Render(data *Data) (*Message, *errors.Error) {
+	var text bytes.Buffer
+	if err := t.template.Execute(&text, data); err != nil {
+		return nil, errors.Wrap(err, fmt.Sprintf("%s (%s): can't render template", t.kind, t.source)).WithKind(ErrInvalid)
+	}
+
+	return &Message{Text: strings.TrimSpace(text.String()), ParseMode: t.parseMode}, nil
+}
+
+// Default returns the built-in templates, they are embedded so a broken one
+// panics on start
+func Default() *Set {
+	set := &Set{templates: map[Kind]*Template{}}
+	for _, kind := range kinds {
+		text, err := defaults.ReadFile("defaults/" + string(kind) + ".tmpl")
+		if err != nil {
+			panic(fmt.Sprintf("templates: can't read %s: %v", kind, err))
+		}
+		t, parseErr := Parse(kind, SourceBuiltIn, string(text))
+		if parseErr != nil {
+			panic("templates: " + parseErr.Error())
+		}
+		set.templates[kind] = t
+	}
+
+	return set
+}
+
+// Load returns the built-in templates replaced by files of dir and by
+// settings of the database. dir is skipped when it is empty. The returned
+// error lists every invalid template.
+func Load(dir string, settings orm.SettingStore) (*Set, *errors.Error) {
+	set := Default()
+	var problems []string
+	for _, kind := range kinds {
+		if dir != "" {
+			path := filepath.Join(dir, string(kind)+".tmpl")
+			text, err := os.ReadFile(path)
+			switch {
+			case err == nil:
+				if t, err := Parse(kind, path, string(text)); err != nil {
+					problems = append(problems, err.Error())
+				} else {
+					set.templates[kind] = t
+				}
+			case !os.IsNotExist(err):
+				problems = append(problems, fmt.Sprintf("%s (%s): %v", kind, path, err))
+			}
+		}
+
+		text, err := settings.Get(model.SettingTemplatePrefix + string(kind))
+		if err != nil {
+			if !errors.Is(err, orm.ErrNotFound) {
+				return nil, err
+			}
+			continue
+		}
+		if t, err := Parse(kind, SourceDatabase, text); err != nil {
+			problems = append(problems, err.Error())
+		} else {
+			set.templates[kind] = t
+		}
+	}
+	if len(problems) > 0 {
+		return nil, errors.New("invalid templates:\n  "+strings.Join(problems, "\n  "), ErrInvalid)
+	}
+
+	return set, nil
+}
+
+// Get returns the template of the kind
+func (s *Set) Get(kind Kind) *Template {
+	return s.templates[kind]
+}
+
+// Render renders the template of the kind
+func (s *Set) Render(kind Kind, data *Data) (*Message, *errors.Error) {
+	return s.templates[kind].Render(data)
+}
+
+// EscapeHTML escapes text for messages with the HTML parse mode
+func EscapeHTML(text string) string {
+	return html.EscapeString(text)
+}
+
+var markdownReplacer = strings.NewReplacer(
+	`\`, `\\`, "_", `\_`, "*", `\*`, "[", `\[`, "]", `\]`, "(", `\(`, ")", `\)`,
+	"~", `\~`, "`", "\\`", ">", `\>`, "#", `\#`, "+", `\+`, "-", `\-`, "=", `\=`,
+	"|", `\|`, "{", `\{`, "}", `\}`, ".", `\.`, "!", `\!`,
+)
+
+// EscapeMarkdown escapes text for messages with the MarkdownV2 parse mode
+func EscapeMarkdown(text string) string {
+	return markdownReplacer.Replace(text)
+}
@@ -0,0 +1,136 @@
+package templates_test
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/kranikitao/fxhash-telegram-bot/src/errors"
+	"github.com/kranikitao/fxhash-telegram-bot/src/orm/memory"
+	"github.com/kranikitao/fxhash-telegram-bot/src/orm/model"
+	"github.com/kranikitao/fxhash-telegram-bot/src/templates"
+)
+
+func TestParse(t *testing.T) {
+	for _, test := range []struct {
+		name      string
+		text      string
+		parseMode string
+		problem   string
+	}{
+		{name: "plain", text: `{{.Token.Title}}`},
+		{name: "html", text: "{{/* parse_mode: HTML */}}\n<b>{{html .Token.Title}}</b>", parseMode: "HTML"},
+		{name: "markdown", text: "{{- /* parse_mode: MarkdownV2 */ -}}\n*{{markdown .Token.Title}}*", parseMode: "MarkdownV2"},
+		{name: "unknown parse mode", text: "{{/* parse_mode: Markdown */}}\n{{.Token.Title}}", problem: `unknown parse mode "Markdown"`},
+		{name: "syntax", text: `{{.Token.Title`, problem: "can't parse template"},
+		{name: "unknown field", text: `{{.Token.Owner}}`, problem: "can't render template"},
+		{name: "nil collection", text: `{{.Token.Collection.Collector}}`, problem: "can't render template"},
+		{name: "empty", text: `{{/* nothing */}}`, problem: "the message is empty"},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			parsed, err := templates.Parse(templates.KindNewToken, "test", test.text)
+			if test.problem != "" {
+				if err == nil || !errors.Is(err, templates.ErrInvalid) || !strings.Contains(err.Error(), test.problem) {
+					t.Fatalf("Parse: want %s with %q, got %v", templates.ErrInvalid, test.problem, err)
+				}
+				if !strings.HasPrefix(err.Error(), "new_token (test): ") {
+					t.Fatalf("Parse: want the kind and the source in %q", err.Error())
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Parse: %v", err)
+			}
+			message, err := parsed.Render(templates.Sample(templates.KindNewToken, templates.Subscriber{Language: "en"}))
+			if err != nil {
+				t.Fatalf("Render: %v", err)
+			}
+			if message.ParseMode != test.parseMode || !strings.Contains(message.Text, "Ondulations") {
+				t.Fatalf("Render: want parse mode %q and the title, got %+v", test.parseMode, message)
+			}
+		})
+	}
+}
+
+func TestEscapeHTML(t *testing.T) {
+	for text, want := range map[string]string{
+		"Ondulations":            "Ondulations",
+		"Free <lines> & *dots*":  "Free &lt;lines&gt; &amp; *dots*",
+		`"quoted" 'single'`:      "&#34;quoted&#34; &#39;single&#39;",
+		"<a href=\"x\">link</a>": "&lt;a href=&#34;x&#34;&gt;link&lt;/a&gt;",
+	} {
+		if got := templates.EscapeHTML(text); got != want {
+			t.Fatalf("EscapeHTML(%q): want %q, got %q", text, want, got)
+		}
+	}
+}
+
+func TestEscapeMarkdown(t *testing.T) {
+	for text, want := range map[string]string{
+		"Ondulations":           "Ondulations",
+		"Free <lines> & *dots*": `Free <lines\> & \*dots\*`,
+		"zancan_ (v1.2) #3!":    `zancan\_ \(v1\.2\) \#3\!`,
+		"[a](b) ~c~ `d` e-f=g":  "\\[a\\]\\(b\\) \\~c\\~ \\`d\\` e\\-f\\=g",
+		`{x|y} + \z`:            `\{x\|y\} \+ \\z`,
+	} {
+		if got := templates.EscapeMarkdown(text); got != want {
+			t.Fatalf("EscapeMarkdown(%q): want %q, got %q", text, want, got)
+		}
+	}
+}
+
+func TestLoad(t *testing.T) {
+	dir := t.TempDir()
+	for kind, text := range map[templates.Kind]string{
+		templates.KindWelcome:  "file welcome {{.Subscriber.Username}}",
+		templates.KindNewToken: "file new token {{.Token.URL}}",
+	} {
+		if err := os.WriteFile(filepath.Join(dir, string(kind)+".tmpl"), []byte(text), 0o600); err != nil {
+			t.Fatalf("WriteFile: %v", err)
+		}
+	}
+	settings := memory.NewSettingStore()
+	if err := settings.Set(model.SettingTemplatePrefix+string(templates.KindNewToken), "database new token {{.Token.URL}}"); err != nil {
+		t.Fatalf("Set: %v", err)
+	}
+
+	set, err := templates.Load(dir, settings)
+	if err != nil {
+		t.Fatalf("Load: %v", err)
+	}
+	for _, test := range []struct {
+		kind   templates.Kind
+		source string
+		prefix string
+	}{
+		{kind: templates.KindWelcome, source: filepath.Join(dir, "welcome.tmpl"), prefix: "file welcome sample"},
+		{kind: templates.KindNewToken, source: templates.SourceDatabase, prefix: "database new token"},
+		{kind: templates.KindFreeToken, source: templates.SourceBuiltIn},
+	} {
+		template := set.Get(test.kind)
+		if template.Source() != test.source {
+			t.Fatalf("%s: want source %q, got %q", test.kind, test.source, template.Source())
+		}
+		message, err := set.Render(test.kind, templates.Sample(test.kind, templates.Subscriber{Username: "sample", Language: "en"}))
+		if err != nil || !strings.HasPrefix(message.Text, test.prefix) {
+			t.Fatalf("%s: want %q first, got %+v, %v", test.kind, test.prefix, message, err)
+		}
+	}
+
+	if err := settings.Set(model.SettingTemplatePrefix+string(templates.KindDigest), "{{.Tokens"); err != nil {
+		t.Fatalf("Set: %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "collected.tmpl"), []byte("{{.Nope}}"), 0o600); err != nil {
+		t.Fatalf("WriteFile: %v", err)
+	}
+	_, err = templates.Load(dir, settings)
+	if err == nil || !errors.Is(err, templates.ErrInvalid) {
+		t.Fatalf("Load: want %s, got %v", templates.ErrInvalid, err)
+	}
+	for _, want := range []string{"digest (database): can't parse template", "collected (" + filepath.Join(dir, "collected.tmpl") + "): can't render template"} {
+		if !strings.Contains(err.Error(), want) {
+			t.Fatalf("Load: want every invalid template, %q is missing in %q", want, err.Error())
+		}
+	}
+}
@@ -0,0 +1,74 @@
+package tezos
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"math/big"
+
+	"github.com/kranikitao/fxhash-telegram-bot/src/errors"
+)
+
+const base58Alphabet = "123456789ABCDEFGHJKLMNPQRSTUVWXYZabcdefghijkmnopqrstuvwxyz"
+
+var bigRadix = big.NewInt(58)
+
+// encodeCheck encodes the prefixed payload with a 4 bytes checksum
+func encodeCheck(prefix []byte, payload []byte) string {
+	data := append(append([]byte(nil), prefix...), payload...)
+	data = append(data, checksum(data)...)
+
+	number := new(big.Int).SetBytes(data)
+	var encoded []byte
+	modulo := new(big.Int)
+	for number.Sign() > 0 {
+		number.DivMod(number, bigRadix, modulo)
+		encoded = append(encoded, base58Alphabet[modulo.Int64()])
+	}
+	for _, b := range data {
+		if b != 0 {
+			break
+		}
+		encoded = append(encoded, base58Alphabet[0])
+	}
+	for i, j := 0, len(encoded)-1; i < j; i, j = i+1, j-1 {
+		encoded[i], encoded[j] = encoded[j], encoded[i]
+	}
+
+	return string(encoded)
+}
+
+// decodeCheck returns the payload of the encoded text when it has the
+// prefix, the payload length and a valid checksum
+func decodeCheck(encoded string, prefix []byte, length int) ([]byte, *errors.Error) {
+	number := new(big.Int)
+	zeros := 0
+	for i, c := range []byte(encoded) {
+		digit := bytes.IndexByte([]byte(base58Alphabet), c)
+		if digit < 0 {
+			return nil, errors.New("invalid base58 character", ErrInvalidEncoding).With("position", i)
+		}
+		if digit == 0 && number.Sign() == 0 {
+			zeros++
+		}
+		number.Mul(number, bigRadix)
+		number.Add(number, big.NewInt(int64(digit)))
+	}
+	data := append(make([]byte, zeros), number.Bytes()...)
+
+	if len(data) != len(prefix)+length+4 || !bytes.HasPrefix(data, prefix) {
+		return nil, errors.New("unexpected prefix or length", ErrInvalidEncoding)
+	}
+	body, sum := data[:len(data)-4], data[len(data)-4:]
+	if !bytes.Equal(checksum(body), sum) {
+		return nil, errors.New("invalid checksum", ErrInvalidEncoding)
+	}
+
+	return body[len(prefix):], nil
+}
+
+func checksum(data []byte) []byte {
+	first := sha256.Sum256(data)
+	second := sha256.Sum256(first[:])
+
+	return second[:4]
+}
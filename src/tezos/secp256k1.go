@@ -0,0 +1,132 @@
+package tezos
+
+import (
+	"math/big"
+)
+
+// secp256k1 is y² = x³ + 7, the standard library has no implementation of
+// it and signatures only need to be verified, so affine arithmetic is enough
+var secp256k1 = struct {
+	p, n, halfN, gx, gy *big.Int
+}{
+	p:     hexInt("fffffffffffffffffffffffffffffffffffffffffffffffffffffffefffffc2f"),
+	n:     hexInt("fffffffffffffffffffffffffffffffebaaedce6af48a03bbfd25e8cd0364141"),
+	halfN: hexInt("7fffffffffffffffffffffffffffffff5d576e7357a4501ddfe92f46681b20a0"),
+	gx:    hexInt("79be667ef9dcbbac55a06295ce870b07029bfcdb2dce28d959f2815b16f81798"),
+	gy:    hexInt("483ada7726a3c4655da4fbfc0e1108a8fd17b448a68554199c47d08ffb10d4b8"),
+}
+
+// point is an affine point of secp256k1, nil is the point at infinity
+type point struct {
+	x, y *big.Int
+}
+
+func hexInt(text string) *big.Int {
+	number, ok := new(big.Int).SetString(text, 16)
+	if !ok {
+		panic("tezos: invalid constant " + text)
+	}
+
+	return number
+}
+
+// secp256k1Decompress returns the point of a 33 bytes compressed key
+func secp256k1Decompress(key []byte) *point {
+	if len(key) != 33 || (key[0] != 2 && key[0] != 3) {
+		return nil
+	}
+	p := secp256k1.p
+	x := new(big.Int).SetBytes(key[1:])
+	if x.Cmp(p) >= 0 {
+		return nil
+	}
+	// p = 3 mod 4, so the square root is a power
+	y2 := new(big.Int).Exp(x, big.NewInt(3), p)
+	y2.Add(y2, big.NewInt(7)).Mod(y2, p)
+	y := new(big.Int).Exp(y2, new(big.Int).Rsh(new(big.Int).Add(p, big.NewInt(1)), 2), p)
+	if new(big.Int).Exp(y, big.NewInt(2), p).Cmp(y2) != 0 {
+		return nil
+	}
+	if y.Bit(0) != uint(key[0]&1) {
+		y.Sub(p, y)
+	}
+
+	return &point{x: x, y: y}
+}
+
+func (a *point) add(b *point) *point {
+	if a == nil {
+		return b
+	}
+	if b == nil {
+		return a
+	}
+	p := secp256k1.p
+	var slope *big.Int
+	if a.x.Cmp(b.x) == 0 {
+		sum := new(big.Int).Add(a.y, b.y)
+		if sum.Mod(sum, p).Sign() == 0 {
+			return nil
+		}
+		// tangent: 3x² / 2y
+		numerator := new(big.Int).Mul(a.x, a.x)
+		numerator.Mul(numerator, big.NewInt(3))
+		denominator := new(big.Int).Lsh(a.y, 1)
+		slope = numerator.Mul(numerator, denominator.ModInverse(denominator, p))
+	} else {
+		numerator := new(big.Int).Sub(b.y, a.y)
+		denominator := new(big.Int).Sub(b.x, a.x)
+		denominator.Mod(denominator, p)
+		slope = numerator.Mul(numerator, denominator.ModInverse(denominator, p))
+	}
+	slope.Mod(slope, p)
+
+	x := new(big.Int).Mul(slope, slope)
+	x.Sub(x, a.x).Sub(x, b.x).Mod(x, p)
+	y := new(big.Int).Sub(a.x, x)
+	y.Mul(y, slope).Sub(y, a.y).Mod(y, p)
+
+	return &point{x: x, y: y}
+}
+
+func (a *point) multiply(k *big.Int) *point {
+	var result *point
+	for i := k.BitLen() - 1; i >= 0; i-- {
+		result = result.add(result)
+		if k.Bit(i) == 1 {
+			result = result.add(a)
+		}
+	}
+
+	return result
+}
+
+// secp256k1Verify checks the ECDSA signature r || s of the digest. Like the
+// Tezos node it only accepts the low-S form, s and n - s would otherwise both
+// be valid signatures.
+func secp256k1Verify(key []byte, digest []byte, signature []byte) bool {
+	public := secp256k1Decompress(key)
+	if public == nil || len(signature) != 64 {
+		return false
+	}
+	n := secp256k1.n
+	r := new(big.Int).SetBytes(signature[:32])
+	s := new(big.Int).SetBytes(signature[32:])
+	if r.Sign() == 0 || s.Sign() == 0 || r.Cmp(n) >= 0 || s.Cmp(secp256k1.halfN) > 0 {
+		return false
+	}
+
+	e := new(big.Int).SetBytes(digest)
+	w := new(big.Int).ModInverse(s, n)
+	u1 := new(big.Int).Mul(e, w)
+	u1.Mod(u1, n)
+	u2 := new(big.Int).Mul(r, w)
+	u2.Mod(u2, n)
+	generator := &point{x: secp256k1.gx, y: secp256k1.gy}
+	sum := generator.multiply(u1).add(public.multiply(u2))
+	if sum == nil {
+		return false
+	}
+
+	return new(big.Int).Mod(sum.x, n).Cmp(r) == 0
+}
@@ -0,0 +1,152 @@
+// Package tezos checks that a Tezos address belongs to someone: the wallet of
+// the address signs a message and the signature is verified locally against
+// the public key. ed25519 (tz1), secp256k1 (tz2) and P-256 (tz3) keys are
+// supported. Wallets sign the blake2b hash of the payload, sign-in messages
+// are packed as Micheline strings first:
+//
+//	key, err := tezos.ParsePublicKey("edpk...")
+//	err = key.Verify(tezos.MichelineString("Tezos Signed Message: ..."), "edsig...")
+//	address := key.Address()
+package tezos
+
+import (
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"encoding/binary"
+	"math/big"
+	"strings"
+
+	"github.com/kranikitao/fxhash-telegram-bot/src/errors"
+	"golang.org/x/crypto/blake2b"
+)
+
+var (
+	ErrInvalidEncoding  = errors.NewKind("invalid_encoding")
+	ErrInvalidSignature = errors.NewKind("invalid_signature")
+)
+
+type curve struct {
+	name      string
+	key       []byte
+	keyLength int
+	address   []byte
+	signature []byte
+	verify    func(key []byte, digest []byte, signature []byte) bool
+}
+
+// base58 prefixes of the curves, they make encoded values start with the
+// text of the prefix
+var curves = []*curve{
+	{
+		name:      "edpk",
+		key:       []byte{13, 15, 37, 217},
+		keyLength: 32,
+		address:   []byte{6, 161, 159},
+		signature: []byte{9, 245, 205, 134, 18},
+		verify:    ed25519Verify,
+	},
+	{
+		name:      "sppk",
+		key:       []byte{3, 254, 226, 86},
+		keyLength: 33,
+		address:   []byte{6, 161, 161},
+		signature: []byte{13, 115, 101, 19, 63},
+		verify:    secp256k1Verify,
+	},
+	{
+		name:      "p2pk",
+		key:       []byte{3, 178, 139, 127},
+		keyLength: 33,
+		address:   []byte{6, 161, 164},
+		signature: []byte{54, 240, 44, 52},
+		verify:    p256Verify,
+	},
+}
+
+// genericSignature is the prefix of "sig" signatures of any curve
+var genericSignature = []byte{4, 130, 43}
+
+const signatureLength = 64
+
+// PublicKey is a base58 encoded public key like edpk..., sppk... or p2pk...
+type PublicKey struct {
+	curve *curve
+	key   []byte
+}
+
+func ParsePublicKey(text string) (*PublicKey, *errors.Error) {
+	text = strings.TrimSpace(text)
+	for _, curve := range curves {
+		if !strings.HasPrefix(text, curve.name) {
+			continue
+		}
+		key, err := decodeCheck(text, curve.key, curve.keyLength)
+		if err != nil {
+			return nil, err
+		}
+		return &PublicKey{curve: curve, key: key}, nil
+	}
+
+	return nil, errors.New("unknown public key prefix", ErrInvalidEncoding)
+}
+
+func (k *PublicKey) String() string {
+	return encodeCheck(k.curve.key, k.key)
+}
+
+// Address returns the tz1, tz2 or tz3 address of the key
+func (k *PublicKey) Address() string {
+	hash, _ := blake2b.New(20, nil)
+	hash.Write(k.key)
+
+	return encodeCheck(k.curve.address, hash.Sum(nil))
+}
+
+// Verify checks that signature is the signature of payload made with the
+// key. The signature is encoded for the curve of the key or is a generic
+// sig... signature.
+func (k *PublicKey) Verify(payload []byte, signature string) *errors.Error {
+	signature = strings.TrimSpace(signature)
+	prefix := k.curve.signature
+	if strings.HasPrefix(signature, "sig") {
+		prefix = genericSignature
+	}
+	decoded, err := decodeCheck(signature, prefix, signatureLength)
+	if err != nil {
+		return errors.New("can't decode signature", ErrInvalidSignature)
+	}
+	digest := blake2b.Sum256(payload)
+	if !k.curve.verify(k.key, digest[:], decoded) {
+		return errors.New("signature doesn't match", ErrInvalidSignature)
+	}
+
+	return nil
+}
+
+// MichelineString packs text like PACK does with a Micheline string, this is
+// the payload wallets sign for messages starting with "Tezos Signed Message:"
+func MichelineString(text string) []byte {
+	payload := make([]byte, 6, 6+len(text))
+	payload[0] = 0x05
+	payload[1] = 0x01
+	binary.BigEndian.PutUint32(payload[2:], uint32(len(text)))
+
+	return append(payload, text...)
+}
+
+func ed25519Verify(key []byte, digest []byte, signature []byte) bool {
+	return ed25519.Verify(ed25519.PublicKey(key), digest, signature)
+}
+
+func p256Verify(key []byte, digest []byte, signature []byte) bool {
+	x, y := elliptic.UnmarshalCompressed(elliptic.P256(), key)
+	if x == nil {
+		return false
+	}
+	public := &ecdsa.PublicKey{Curve: elliptic.P256(), X: x, Y: y}
+	r := new(big.Int).SetBytes(signature[:32])
+	s := new(big.Int).SetBytes(signature[32:])
+
+	return ecdsa.Verify(public, digest, r, s)
+}
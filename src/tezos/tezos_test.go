@@ -0,0 +1,139 @@
+package tezos_test
+
+import (
+	"testing"
+
+	"github.com/kranikitao/fxhash-telegram-bot/src/errors"
+	"github.com/kranikitao/fxhash-telegram-bot/src/tezos"
+)
+
+// The ed25519 keys are the sandbox bootstrap1 and bootstrap2 accounts, the
+// other keys and every signature were made outside this package. All
+// signatures sign MichelineString(message).
+const (
+	message       = "Tezos Signed Message: link wallet to fxhash telegram bot 00112233445566778899aabbccddeeff"
+	otherMessage  = "Tezos Signed Message: link wallet to fxhash telegram bot 00112233445566778899aabbccddeef0"
+	ed25519Key    = "edpkuBknW28nW72KG6RoHtYW7p12T6GKc7nAbwYX5m8Wd9sDVC9yav"
+	ed25519Other  = "edpktzNbDAUjUk697W7gYg2CRuBQjyPxbEg8dLccYYwKSKvkPvjtV9"
+	secp256k1Key  = "sppk7ZNKmjzzasPY4ZQd1FruRcFwXuoBEbtXkcybYPTYfG2BvWAiawu"
+	p256Key       = "p2pk66XJ7qQbReKUT5WZcXv7ihSHH9id3uEn2k2DSGmGJkJYHAefqWD"
+	ed25519Sig    = "edsigtuH7QPbWSSY3rjkJm7LZjzH2STd7Sho38EynEPr5tnHTuPZKSujziBjGooYyQqpGpVCBmxbEDTmTwW5bB8NXdSb3Kzi1m6"
+	ed25519Sig2   = "sigjTeHLNcAWM1oYm1d5VNngzWfdYBU4vSkZE3W3r6tSGWbZcix1pud8VMmCwBKNdvNwiZrSosNqohCi3PWz2ZSPWwTio1E7"
+	secp256k1Sig  = "spsig1TDydksN2vfPajLiQfs8mENhbU41DieDGmzT1PgsooGarek3gxr3cmEvT3xKqh6sbsB5kDvaDL3VvvXte2aAtXMwvQGNcf"
+	secp256k1Sig2 = "sigjQJJhG7ZahFCZLxSXJz7KhKgeGS9f1WoCs8EbXZzuLsRb6EWPmffdm4kgPEnJ31X9Rw1G4wnBtmqdpn89tfyJpqQ5hLAs"
+	p256Sig       = "p2sigWc749hGiToURkoHst3MqCWB3TbrWEgf356vqKoXBPc9spabtAqXSTGvSZ436Xxkt4GMfy2hJ8UY3eBom12qsuFmbPuBBZ"
+	p256Sig2      = "sigXHtD4biczsRxpYXdASq3h3Pf4wdF9GEpdL5SvM5tB9sLHJpZnnSDB6W9N7Ws6mBZSEqetnkxdXDgFVt2QaeSdZRbQ2b7B"
+)
+
+func parse(t *testing.T, text string) *tezos.PublicKey {
+	t.Helper()
+	key, err := tezos.ParsePublicKey(text)
+	if err != nil {
+		t.Fatalf("ParsePublicKey(%s): %v", text, err)
+	}
+
+	return key
+}
+
+// corrupt replaces the last character, which breaks the checksum
+func corrupt(encoded string) string {
+	last := byte('1')
+	if encoded[len(encoded)-1] == last {
+		last = '2'
+	}
+
+	return encoded[:len(encoded)-1] + string(last)
+}
+
+func TestAddress(t *testing.T) {
+	for _, test := range []struct {
+		key     string
+		address string
+	}{
+		{key: ed25519Key, address: "tz1KqTpEZ7Yob7QbPE4Hy4Wo8fHG8LhKxZSx"},
+		{key: ed25519Other, address: "tz1gjaF81ZRRvdzjobyfVNsAeSC6PScjfQwN"},
+		{key: secp256k1Key, address: "tz2VXyvyQG6H4auako7igC9iB6rSwBbMFvhe"},
+		{key: p256Key, address: "tz3doCgjS9eYzXoN2aUDdWBhhuqjMvPV2viA"},
+	} {
+		key := parse(t, test.key)
+		if address := key.Address(); address != test.address {
+			t.Fatalf("Address of %s: want %s, got %s", test.key, test.address, address)
+		}
+		if key.String() != test.key {
+			t.Fatalf("String: want %s, got %s", test.key, key.String())
+		}
+	}
+}
+
+func TestParsePublicKeyErrors(t *testing.T) {
+	for _, text := range []string{
+		"",
+		"tz1KqTpEZ7Yob7QbPE4Hy4Wo8fHG8LhKxZSx",
+		corrupt(ed25519Key),
+		corrupt(secp256k1Key),
+		corrupt(p256Key),
+		ed25519Key[:len(ed25519Key)-4],
+	} {
+		if _, err := tezos.ParsePublicKey(text); err == nil || !errors.Is(err, tezos.ErrInvalidEncoding) {
+			t.Fatalf("ParsePublicKey(%q): want %s, got %v", text, tezos.ErrInvalidEncoding, err)
+		}
+	}
+}
+
+func TestVerify(t *testing.T) {
+	payload := tezos.MichelineString(message)
+	for _, test := range []struct {
+		key       string
+		signature string
+	}{
+		{key: ed25519Key, signature: ed25519Sig},
+		{key: ed25519Key, signature: ed25519Sig2},
+		{key: secp256k1Key, signature: secp256k1Sig},
+		{key: secp256k1Key, signature: secp256k1Sig2},
+		{key: p256Key, signature: p256Sig},
+		{key: p256Key, signature: p256Sig2},
+	} {
+		if err := parse(t, test.key).Verify(payload, test.signature); err != nil {
+			t.Fatalf("Verify %s with %s: %v", test.signature, test.key, err)
+		}
+	}
+}
+
+func TestVerifyRejects(t *testing.T) {
+	payload := tezos.MichelineString(message)
+	for _, test := range []struct {
+		name      string
+		key       string
+		payload   []byte
+		signature string
+	}{
+		{name: "wrong key", key: ed25519Other, signature: ed25519Sig},
+		{name: "wrong curve", key: p256Key, signature: secp256k1Sig2},
+		{name: "tampered nonce ed25519", key: ed25519Key, payload: tezos.MichelineString(otherMessage), signature: ed25519Sig},
+		{name: "tampered nonce secp256k1", key: secp256k1Key, payload: tezos.MichelineString(otherMessage), signature: secp256k1Sig},
+		{name: "tampered nonce p256", key: p256Key, payload: tezos.MichelineString(otherMessage), signature: p256Sig},
+		{name: "unpacked message", key: ed25519Key, payload: []byte(message), signature: ed25519Sig},
+		{name: "bad checksum", key: ed25519Key, signature: corrupt(ed25519Sig)},
+		{name: "bad generic checksum", key: secp256k1Key, signature: corrupt(secp256k1Sig2)},
+		{name: "signature of another curve", key: secp256k1Key, signature: p256Sig},
+		{name: "truncated", key: ed25519Key, signature: ed25519Sig[:len(ed25519Sig)-10]},
+		// n - s of secp256k1Sig, valid ECDSA but not canonical
+		{name: "high s", key: secp256k1Key, signature: "spsig1TDydksN2vfPajLiQfs8mENhbU41DieDGmzT1PgsooGasNHQ6VmBkHqSwA3FWDs3aj8xihsJNuakKjsQrVhMXyzUhnYoz2"},
+		{name: "secp256k1 r = 0", key: secp256k1Key, signature: "spsig15oyPL6RPsCmQbjdHRDQgBpnqfF1PGCaNk9eV5ksEABhYhnQLcxJus2A9oUBac6RwB1NJuFSyytei55QDPqP8whJEkjgde"},
+		{name: "secp256k1 r = n", key: secp256k1Key, signature: "spsig1fJWmkWTSFeayPrYU3RomkFvjJhgcvdkVFA8Kaj2Hhzm54UNkvEKmwY31FVTLrs5373FAkgsvriFDGA2ZfaAqe1PBPzqwF"},
+		{name: "secp256k1 s = n", key: secp256k1Key, signature: "spsig1TDydksN2vfPajLiQfs8mENhbU41DieDGmzT1PgsooGasytK1TKYPs9kbtrExmUwFbWDMbJVdurnbEm9PkRQtkBaPrTH8f"},
+		{name: "p256 r = 0", key: p256Key, signature: "p2sigMJWuMaj1zAfVMzdZzFnoncCKE7faHzJ7coB6h3ziUiGf3JKbJEvqWuQ3WBnMPsurA3KKa7rPgSE2PprfDrHEBxP3Tx3Pu"},
+		{name: "p256 r = n", key: p256Key, signature: "p2sigvo4HmueCYgAdcugYkawaq3mpqxxWvcpwh94pxp2gnneoNEyR1h6KmuwiKFMt4KQA21jztyVn6CKHV12DnuuwCe2Q5aaSd"},
+		{name: "p256 s = n", key: p256Key, signature: "p2sigWc749hGiToURkoHst3MqCWB3TbrWEgf356vqKoXBPc9uHpv5nhtFgWLBdJrhsqqjusFJgXtVNFBaQ7wrAxG9X2hbb3f6J"},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			testPayload := test.payload
+			if testPayload == nil {
+				testPayload = payload
+			}
+			if err := parse(t, test.key).Verify(testPayload, test.signature); err == nil || !errors.Is(err, tezos.ErrInvalidSignature) {
+				t.Fatalf("Verify: want %s, got %v", tezos.ErrInvalidSignature, err)
+			}
+		})
+	}
+}